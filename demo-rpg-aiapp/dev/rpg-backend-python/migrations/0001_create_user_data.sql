@@ -0,0 +1,5 @@
+-- Accounts INSERTUSER creates and LOGIN checks
+CREATE TABLE UserData (
+    UserId NVARCHAR(100) NOT NULL PRIMARY KEY,
+    Password NVARCHAR(255) NOT NULL  -- PBKDF2-SHA256 hashed
+);
@@ -0,0 +1,15 @@
+-- Characters INSERTPLAYER creates, UPDATE saves and SELECTPLAYER reads in
+-- the column order row_to_player_dict expects
+CREATE TABLE PlayerData (
+    UserId NVARCHAR(100) NOT NULL,
+    CharId INT NOT NULL,
+    Exp INT,
+    Parameter1 INT,  -- Charisma
+    Parameter2 INT,  -- Intuition
+    Parameter3 INT,  -- Logic
+    Parameter4 INT,  -- Order
+    CurrentEventId INT,
+    CurrentSeq INT,
+    PRIMARY KEY (UserId, CharId),
+    FOREIGN KEY (UserId) REFERENCES UserData(UserId)
+);
@@ -0,0 +1,9 @@
+-- Story events SELECTEVENTS reads in the column order row_to_event_dict
+-- expects
+CREATE TABLE EventData (
+    EventId INT NOT NULL,
+    Seq INT NOT NULL,
+    EventType NVARCHAR(50),
+    EventText NVARCHAR(MAX),
+    PRIMARY KEY (EventId, Seq)
+);
@@ -6,17 +6,20 @@ locals {
     environment   = var.environment
     project       = "rpg-aiapp"
     managed_by    = "terraform"
-    created_date  = formatdate("YYYY-MM-DD", timestamp())
+    created_date  = formatdate("YYYY-MM-DD", time_static.created.rfc3339)
   }
   
   name_prefix = "${var.environment}-rpg"
 }
 
+# Creation time, recorded once so later plans keep the created_date tag
+resource "time_static" "created" {}
+
 resource "azurerm_resource_group" "rg" {
   name     = var.azurerm_resource_group_name
   location = var.azurerm_resource_group_location
 
-  tags = local.common_tags
+  tags = merge(local.common_tags, var.resource_group_tags)
 }
 
 # VNet and subnets with enhanced security
@@ -12,7 +12,8 @@ resource "azurerm_key_vault" "kv" {
   enabled_for_disk_encryption     = true
   enabled_for_deployment          = false
   enabled_for_template_deployment = false
-  rbac_authorization_enabled      = false
+  # azurerm 3.x name, as providers.tf pins; 4.x renames it rbac_authorization_enabled
+  enable_rbac_authorization       = var.enable_rbac_authorization
 
   network_acls {
     default_action             = var.network_acls_default_action
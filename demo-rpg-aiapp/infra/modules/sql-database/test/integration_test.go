@@ -1,46 +1,38 @@
 package test
 
 import (
-	"database/sql"
+	"os"
 	"testing"
-	"time"
 
 	"github.com/gruntwork-io/terratest/modules/terraform"
-	"github.com/stretchr/testify/assert"
-	_ "github.com/denisenkom/go-mssqldb"
-)
-
-func TestSQLDatabaseConnectivity(t *testing.T) {
-	terraformOptions := &terraform.Options{
-		TerraformDir: "./",
-	}
 
-	connectionString := terraform.Output(t, terraformOptions, "connection_string")
-	
-	db, err := sql.Open("sqlserver", connectionString)
-	assert.NoError(t, err)
-	defer db.Close()
+	"github.com/vanehru/terraform-modules/testkit/sqldatabase"
+)
 
-	// Retry connection
-	var connected bool
-	for i := 0; i < 5; i++ {
-		if err := db.Ping(); err == nil {
-			connected = true
-			break
+// sourceEnv picks the database TestSQLDatabaseConnectivity verifies
+const sourceEnv = "SQL_TEST_SOURCE"
+
+// connectionSource returns the database named by SQL_TEST_SOURCE: "terraform"
+// for the connection_string output of terraform.tf in this directory, applied
+// with make deploy, or else a SQL Server container started for the test
+func connectionSource(t *testing.T) sqldatabase.ConnectionSource {
+	switch source := os.Getenv(sourceEnv); source {
+	case "terraform":
+		return sqldatabase.TerraformOutput{
+			Options: &terraform.Options{TerraformDir: ".", NoColor: true},
 		}
-		time.Sleep(10 * time.Second)
+	case "", "container":
+		return sqldatabase.Container{}
+	default:
+		t.Fatalf("%s=%q: want terraform or container", sourceEnv, source)
+		return nil
 	}
-	assert.True(t, connected)
-
-	// Test CRUD operations
-	_, err = db.Exec("CREATE TABLE test_table (id INT PRIMARY KEY, name NVARCHAR(50))")
-	assert.NoError(t, err)
+}
 
-	_, err = db.Exec("INSERT INTO test_table VALUES (1, 'test')")
-	assert.NoError(t, err)
+// TestSQLDatabaseConnectivity checks TLS, the login user and a table round
+// trip on the database, dropping the table afterwards
+func TestSQLDatabaseConnectivity(t *testing.T) {
+	t.Parallel()
 
-	var name string
-	err = db.QueryRow("SELECT name FROM test_table WHERE id = 1").Scan(&name)
-	assert.NoError(t, err)
-	assert.Equal(t, "test", name)
-}
\ No newline at end of file
+	sqldatabase.Verify(t, connectionSource(t))
+}
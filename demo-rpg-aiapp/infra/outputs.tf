@@ -83,6 +83,11 @@ output "function_app_name" {
   value       = module.function_app.function_app_name
 }
 
+output "function_app_default_hostname" {
+  description = "Default hostname of the Function App, whose API the contract tests call under /api"
+  value       = module.function_app.function_app_default_hostname
+}
+
 output "static_web_app_url" {
   description = "URL of the Static Web App"
   value       = "https://${module.static_web_app.default_host_name}"
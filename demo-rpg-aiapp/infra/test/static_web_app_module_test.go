@@ -0,0 +1,24 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/vanehru/terraform-modules/testkit"
+	"github.com/vanehru/terraform-modules/testkit/config"
+	"github.com/vanehru/terraform-modules/testkit/fixture"
+	"github.com/vanehru/terraform-modules/testkit/staticwebapp"
+)
+
+// TestStaticWebAppModule tests the Static Web App module independently
+func TestStaticWebAppModule(t *testing.T) {
+	t.Parallel()
+
+	cfg := config.ForTest(t)
+	cfg.RequireTimeout(t, config.ModuleTest)
+	network := fixture.NewNetwork(t, cfg.Region())
+	staticwebapp.Test(t, "../modules/static-web-app", staticwebapp.Expected{
+		Name:              cfg.ResourceName(t, "azurerm_static_web_app", "swa", testkit.UniqueID()),
+		ResourceGroupName: network.ResourceGroupName,
+		Location:          "East Asia",
+	})
+}
@@ -36,7 +36,12 @@ function Test-Modules {
 
 function Test-Integration {
     Write-Host "Running integration tests..." -ForegroundColor Green
-    go test -v -timeout 60m -run TestIntegrationEndToEnd
+    $env:SKIP_validate = "true"
+    try {
+        go test -v -timeout 90m -run TestRPGAIAppInfrastructure
+    } finally {
+        Remove-Item Env:SKIP_validate
+    }
 }
 
 function Test-All {
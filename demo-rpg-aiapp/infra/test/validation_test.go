@@ -4,6 +4,10 @@ import (
 	"testing"
 
 	"github.com/gruntwork-io/terratest/modules/terraform"
+	tfjson "github.com/hashicorp/terraform-json"
+
+	"github.com/vanehru/terraform-modules/testkit/config"
+	"github.com/vanehru/terraform-modules/testkit/planassert"
 )
 
 // TestTerraformValidation validates the Terraform configuration syntax
@@ -20,22 +24,66 @@ func TestTerraformValidation(t *testing.T) {
 	terraform.Validate(t, terraformOptions)
 }
 
-// TestTerraformPlan tests that terraform plan runs without errors
+// TestTerraformPlan plans the stack and checks the planned network isolation,
+// private endpoints and secrets without deploying anything
 func TestTerraformPlan(t *testing.T) {
 	t.Parallel()
 
 	terraformOptions := terraform.WithDefaultRetryableErrors(t, &terraform.Options{
 		TerraformDir: "../",
 		Vars: map[string]interface{}{
-			"azurerm_resource_group_name":     "test-rg-plan",
-			"azurerm_resource_group_location": "Japan East",
+			"azurerm_resource_group_name":     config.ForTest(t).ResourceName(t, "azurerm_resource_group", "rg", "plan"),
+			"azurerm_resource_group_location": config.ForTest(t).Region(),
 		},
 		NoColor: true,
 	})
 
-	// Initialize and plan
-	terraform.Init(t, terraformOptions)
-	terraform.Plan(t, terraformOptions)
+	plan := planassert.InitAndPlan(t, terraformOptions)
+
+	t.Run("Network", func(t *testing.T) {
+		plan.AssertAttribute(t, "azurerm_virtual_network.vnet", "address_space", []string{"172.16.0.0/16"})
+		plan.AssertResourceCount(t, "azurerm_subnet", 6)
+
+		plan.AssertAttribute(t, "azurerm_subnet.app_subnet",
+			"delegation.0.service_delegation.0.name", "Microsoft.Web/serverFarms")
+		plan.AssertAttribute(t, "azurerm_subnet.deployment_subnet",
+			"delegation.0.service_delegation.0.name", "Microsoft.ContainerInstance/containerGroups")
+		plan.AssertAttributeContains(t, "azurerm_subnet.database_subnet", "service_endpoints", "Microsoft.Sql")
+	})
+
+	t.Run("KeyVault", func(t *testing.T) {
+		address := "module.key_vault.azurerm_key_vault.kv"
+		plan.AssertAttribute(t, address, "network_acls.0.default_action", "Deny")
+		plan.AssertAttribute(t, address, "network_acls.0.bypass", "AzureServices")
+		plan.AssertResourceExists(t, "module.key_vault.azurerm_private_endpoint.kv_endpoint[0]")
+		plan.AssertAttribute(t, "module.key_vault.azurerm_private_dns_zone.kv_dns[0]",
+			"name", "privatelink.vaultcore.azure.net")
+		plan.AssertResourceCount(t, "module.key_vault.azurerm_key_vault_secret.secrets", 6)
+	})
+
+	t.Run("SQLDatabase", func(t *testing.T) {
+		address := "module.sql_database.azurerm_mssql_server.sql_server"
+		plan.AssertAttribute(t, address, "public_network_access_enabled", false)
+		plan.AssertAttribute(t, address, "minimum_tls_version", "1.2")
+		plan.AssertResourceExists(t, "module.sql_database.azurerm_private_endpoint.sql_endpoint[0]")
+	})
+
+	t.Run("OpenAI", func(t *testing.T) {
+		address := "module.openai.azurerm_cognitive_account.openai"
+		plan.AssertAttribute(t, address, "kind", "OpenAI")
+		plan.AssertAttribute(t, address, "public_network_access_enabled", false)
+		plan.AssertResourceExists(t, "module.openai.azurerm_private_endpoint.openai_endpoint[0]")
+	})
+
+	t.Run("StaticWebApp", func(t *testing.T) {
+		plan.AssertAttribute(t, "module.static_web_app.azurerm_static_web_app.swa", "sku_tier", "Standard")
+	})
+
+	t.Run("Actions", func(t *testing.T) {
+		for address := range plan.ResourceChangesMap {
+			plan.AssertAction(t, address, tfjson.ActionCreate)
+		}
+	})
 }
 
 // TestModuleStructure validates that all required modules exist
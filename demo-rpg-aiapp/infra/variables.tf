@@ -95,3 +95,9 @@ variable "deployment_subnet_cidr" {
   type        = string
   default     = "172.16.6.0/24"
 }
+
+variable "resource_group_tags" {
+  description = "Additional tags for the resource group, such as the creation time the test harness stamps for its janitor"
+  type        = map(string)
+  default     = {}
+}
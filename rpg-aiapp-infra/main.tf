@@ -1,17 +1,24 @@
-# Get current public IP address for Key Vault access during deployment
+# Public IP address allowed through the Key Vault firewall during deployment.
+# Looked up only when caller_ip is not set, so a plan that passes it needs no
+# internet access.
 data "http" "current_ip" {
-  url = "https://api.ipify.org?format=text"
+  count = var.caller_ip == "" ? 1 : 0
+  url   = var.caller_ip_url
+}
+
+locals {
+  caller_ip = var.caller_ip != "" ? var.caller_ip : trimspace(data.http.current_ip[0].response_body)
 }
 
 resource "azurerm_resource_group" "rg" {
   name     = var.azurerm_resource_group_name
   location = var.azurerm_resource_group_location
 
-  tags = {
+  tags = merge({
     project_owner = "ootsuka"
     author        = "Nehru"
     environment   = "development"
-  }
+  }, var.resource_group_tags)
 }
 
 # VNet and subnets
@@ -171,7 +178,7 @@ module "key_vault" {
   network_acls_default_action = "Deny"
   network_acls_bypass         = "AzureServices"
   allowed_subnet_ids          = [azurerm_subnet.app_subnet.id, azurerm_subnet.keyvault_subnet.id]
-  allowed_ip_addresses        = [data.http.current_ip.response_body]
+  allowed_ip_addresses        = [local.caller_ip]
 
   access_policies = [
     # Function App access policy removed due to quota limitations
@@ -7,6 +7,9 @@ resource "azurerm_key_vault" "kv" {
   sku_name                 = var.sku_name
   purge_protection_enabled = var.purge_protection_enabled
 
+  # azurerm 3.x name; 4.x renames it rbac_authorization_enabled
+  enable_rbac_authorization = var.enable_rbac_authorization
+
   network_acls {
     default_action             = var.network_acls_default_action
     bypass                     = var.network_acls_bypass
@@ -85,5 +88,7 @@ resource "azurerm_key_vault_secret" "secrets" {
   value        = each.value
   key_vault_id = azurerm_key_vault.kv.id
 
+  tags = var.tags
+
   depends_on = [azurerm_key_vault.kv]
 }
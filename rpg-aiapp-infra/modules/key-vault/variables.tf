@@ -30,6 +30,12 @@ variable "purge_protection_enabled" {
   default     = false
 }
 
+variable "enable_rbac_authorization" {
+  description = "Authorize data-plane access with Azure RBAC role assignments instead of access policies"
+  type        = bool
+  default     = false
+}
+
 variable "network_acls_default_action" {
   description = "Default action for network ACLs (Allow or Deny)"
   type        = string
@@ -93,6 +93,11 @@ output "deployment_instructions" {
 #   description = "Name of the Function App"
 #   value       = module.function_app.function_app_name
 # }
+#
+# output "function_app_default_hostname" {
+#   description = "Default hostname of the Function App, whose API the contract tests call under /api"
+#   value       = module.function_app.function_app_default_hostname
+# }
 
 output "static_web_app_url" {
   description = "URL of the Static Web App"
@@ -112,4 +117,9 @@ output "sql_server_name" {
 output "openai_account_name" {
   description = "Name of the OpenAI account"
   value       = module.openai.openai_account_name
+}
+
+output "resource_tags" {
+  description = "Tags applied to the resource group, required on every taggable resource by test/tag-policy.yml"
+  value       = azurerm_resource_group.rg.tags
 }
\ No newline at end of file
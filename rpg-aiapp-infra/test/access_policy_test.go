@@ -0,0 +1,35 @@
+package test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/vanehru/terraform-modules/testkit/accesspolicy"
+)
+
+// accessPolicyFile is the least-privilege baseline for Key Vault access
+// policies, per role
+const accessPolicyFile = "access-policy.yml"
+
+// TestKeyVaultAccessPolicies audits the access policies in the saved plan
+// against the baseline and logs every policy as a table
+func TestKeyVaultAccessPolicies(t *testing.T) {
+	t.Parallel()
+
+	policy, err := accesspolicy.Load(accessPolicyFile)
+	require.NoError(t, err)
+
+	plan := loadPlan(t)
+	report, err := accesspolicy.Audit(&plan.RawPlan, policy)
+	require.NoError(t, err)
+	require.NotEmpty(t, report.Grants, "the plan should have Key Vault access policies")
+
+	var table strings.Builder
+	require.NoError(t, report.WriteText(&table))
+	t.Logf("Key Vault access policies:\n%s", table.String())
+	for _, v := range report.Violations() {
+		t.Error(v)
+	}
+}
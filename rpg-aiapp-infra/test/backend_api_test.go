@@ -0,0 +1,19 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/vanehru/terraform-modules/testkit"
+	"github.com/vanehru/terraform-modules/testkit/backendapi"
+	"github.com/vanehru/terraform-modules/testkit/stack"
+)
+
+// TestBackendAPI runs the backend API contract against the backend that
+// test.backend_api_url (or TEST_BACKEND_API_URL) names: an in-process stub
+// by default, the Function App of the stack TestRPGAIAppInfrastructure saved
+// to .test-data with "stack", or a URL such as a local func start
+func TestBackendAPI(t *testing.T) {
+	t.Parallel()
+
+	backendapi.Validate(t, stack.BackendAPI(t, "."), "contract-"+testkit.UniqueID())
+}
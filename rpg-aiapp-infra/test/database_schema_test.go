@@ -0,0 +1,21 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/vanehru/terraform-modules/testkit/backendapi"
+	"github.com/vanehru/terraform-modules/testkit/migrate"
+	"github.com/vanehru/terraform-modules/testkit/sqldatabase"
+	"github.com/vanehru/terraform-modules/testkit/stack"
+)
+
+// TestDatabaseSchema applies the backend's migrations to the database that
+// test.sql_database (or TEST_SQL_DATABASE) names: a local SQL Server
+// container by default, or with "stack" the rpg-gaming-db of the stack
+// TestRPGAIAppInfrastructure saved to .test-data. It then checks the tables
+// against the columns row_to_player_dict and row_to_event_dict read. Without
+// Docker the container default is skipped.
+func TestDatabaseSchema(t *testing.T) {
+	db := sqldatabase.Open(t, stack.SQLDatabase(t, ".").ConnectionString(t))
+	migrate.Validate(t, db, "../../"+backendapi.MigrationsDir, backendapi.Schema)
+}
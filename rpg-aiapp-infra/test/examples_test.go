@@ -9,10 +9,12 @@ import (
 	"github.com/gruntwork-io/terratest/modules/terraform"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+
+	"github.com/vanehru/terraform-modules/testkit/config"
 )
 
-// Example_BasicTest demonstrates a basic Terratest structure
-func Example_BasicTest() {
+// Example_basicTest demonstrates a basic Terratest structure
+func Example_basicTest() {
 	// This is a documentation example - not an actual test
 	// It shows the basic pattern for writing Terratest tests
 }
@@ -269,7 +271,7 @@ func getTestTerraformOptions(t *testing.T, resourceGroupName string) *terraform.
 		TerraformDir: "../",
 		Vars: map[string]interface{}{
 			"azurerm_resource_group_name":     resourceGroupName,
-			"azurerm_resource_group_location": "Japan East",
+			"azurerm_resource_group_location": config.ForTest(t).Region(),
 		},
 		NoColor: true,
 	})
@@ -0,0 +1,21 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/vanehru/terraform-modules/testkit/naming"
+)
+
+// TestNamingRules checks every resource name the configuration sets against
+// Azure's naming rules for its type
+func TestNamingRules(t *testing.T) {
+	t.Parallel()
+
+	violations, err := naming.CheckConfig("../")
+	require.NoError(t, err)
+	for _, v := range violations {
+		t.Error(v)
+	}
+}
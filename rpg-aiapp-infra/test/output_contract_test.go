@@ -0,0 +1,53 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/vanehru/terraform-modules/testkit/functionapp"
+	"github.com/vanehru/terraform-modules/testkit/keyvault"
+	"github.com/vanehru/terraform-modules/testkit/openai"
+	"github.com/vanehru/terraform-modules/testkit/outputcontract"
+	"github.com/vanehru/terraform-modules/testkit/sqldatabase"
+	"github.com/vanehru/terraform-modules/testkit/stack"
+	"github.com/vanehru/terraform-modules/testkit/staticwebapp"
+)
+
+// TestOutputContract verifies that every output read by the suite is declared
+// by the Terraform configuration it is read from. It runs without Azure
+// credentials, so a missing output fails here instead of after a full apply.
+func TestOutputContract(t *testing.T) {
+	t.Parallel()
+
+	issues, err := outputcontract.Check(".", outputcontract.Options{
+		DefaultTerraformDir: "../",
+		// The examples document terratest patterns against made-up outputs
+		Exclude: []string{"examples_test.go"},
+	})
+	require.NoError(t, err)
+
+	// The shared helpers read their outputs from whichever directory the
+	// suite passes them
+	helpers := []struct {
+		terraformDir string
+		source       string
+		outputs      []string
+	}{
+		{"../", "testkit/stack", stack.Outputs},
+		{"../modules/key-vault", "testkit/keyvault", keyvault.Outputs},
+		{"../modules/sql-database", "testkit/sqldatabase", sqldatabase.Outputs},
+		{"../modules/openai", "testkit/openai", openai.Outputs},
+		{"../modules/function-app", "testkit/functionapp", functionapp.Outputs},
+		{"../modules/static-web-app", "testkit/staticwebapp", staticwebapp.Outputs},
+	}
+	for _, helper := range helpers {
+		helperIssues, err := outputcontract.CheckOutputs(helper.terraformDir, helper.source, helper.outputs)
+		require.NoError(t, err)
+		issues = append(issues, helperIssues...)
+	}
+
+	for _, issue := range issues {
+		t.Error(issue)
+	}
+}
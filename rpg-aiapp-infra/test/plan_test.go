@@ -0,0 +1,91 @@
+package test
+
+import (
+	"os"
+	"testing"
+
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	tfjson "github.com/hashicorp/terraform-json"
+
+	"github.com/vanehru/terraform-modules/testkit/callerip"
+	"github.com/vanehru/terraform-modules/testkit/config"
+	"github.com/vanehru/terraform-modules/testkit/planassert"
+)
+
+// planFixture is the checked-in `terraform show -json` output the plan tests
+// run against. Set UPDATE_PLAN_FIXTURE=1 (with Azure credentials) to
+// regenerate it from the current configuration.
+const planFixture = "testdata/plan.json"
+
+// loadPlan returns the plan under test, regenerating the fixture when
+// requested. The regenerated plan looks up the caller IP from a local stub,
+// which answers callerip.Placeholder, rather than from api.ipify.org.
+func loadPlan(t *testing.T) *planassert.Plan {
+	if os.Getenv("UPDATE_PLAN_FIXTURE") == "" {
+		return planassert.Load(t, planFixture)
+	}
+
+	terraformOptions := &terraform.Options{
+		TerraformDir: "../",
+		Vars: map[string]interface{}{
+			"azurerm_resource_group_name":     "rpg-aiapp-rg-plan",
+			"azurerm_resource_group_location": config.ForTest(t).Region(),
+			"caller_ip_url":                   callerip.NewServer(t, callerip.Placeholder).URL,
+		},
+		NoColor: true,
+	}
+	return planassert.InitAndPlanToFile(t, terraformOptions, planFixture)
+}
+
+// TestTerraformPlanAssertions validates the planned resources without deploying anything
+func TestTerraformPlanAssertions(t *testing.T) {
+	t.Parallel()
+
+	plan := loadPlan(t)
+
+	t.Run("Network", func(t *testing.T) {
+		plan.AssertAttribute(t, "azurerm_virtual_network.vnet", "address_space", []string{"172.16.0.0/16"})
+		plan.AssertResourceCount(t, "azurerm_subnet", 6)
+
+		plan.AssertAttribute(t, "azurerm_subnet.app_subnet",
+			"delegation.0.service_delegation.0.name", "Microsoft.Web/serverFarms")
+		plan.AssertAttribute(t, "azurerm_subnet.deployment_subnet",
+			"delegation.0.service_delegation.0.name", "Microsoft.ContainerInstance/containerGroups")
+		plan.AssertAttributeContains(t, "azurerm_subnet.database_subnet", "service_endpoints", "Microsoft.Sql")
+	})
+
+	t.Run("KeyVault", func(t *testing.T) {
+		address := "module.key_vault.azurerm_key_vault.kv"
+		plan.AssertAttribute(t, address, "network_acls.0.default_action", "Deny")
+		plan.AssertAttribute(t, address, "network_acls.0.bypass", "AzureServices")
+		plan.AssertAttribute(t, address, "network_acls.0.ip_rules", []string{callerip.Placeholder.String()})
+		plan.AssertResourceExists(t, "module.key_vault.azurerm_private_endpoint.kv_endpoint[0]")
+		plan.AssertAttribute(t, "module.key_vault.azurerm_private_dns_zone.kv_dns[0]",
+			"name", "privatelink.vaultcore.azure.net")
+		plan.AssertResourceCount(t, "module.key_vault.azurerm_key_vault_secret.secrets", 6)
+	})
+
+	t.Run("SQLDatabase", func(t *testing.T) {
+		address := "module.sql_database.azurerm_mssql_server.sql_server"
+		plan.AssertAttribute(t, address, "public_network_access_enabled", false)
+		plan.AssertAttribute(t, address, "minimum_tls_version", "1.2")
+		plan.AssertAttribute(t, "module.sql_database.azurerm_mssql_database.sql_db", "name", "rpg-gaming-db")
+		plan.AssertResourceAbsent(t, "module.sql_database.azurerm_mssql_firewall_rule.allow_azure_services[0]")
+		plan.AssertResourceExists(t, "module.sql_database.azurerm_private_endpoint.sql_endpoint[0]")
+	})
+
+	t.Run("OpenAI", func(t *testing.T) {
+		plan.AssertAttribute(t, "module.openai.azurerm_cognitive_account.openai", "kind", "OpenAI")
+		plan.AssertResourceAbsent(t, "module.openai.azurerm_private_endpoint.openai_endpoint[0]")
+	})
+
+	t.Run("StaticWebApp", func(t *testing.T) {
+		plan.AssertAttribute(t, "module.static_web_app.azurerm_static_web_app.swa", "sku_tier", "Standard")
+	})
+
+	t.Run("Actions", func(t *testing.T) {
+		for address := range plan.ResourceChangesMap {
+			plan.AssertAction(t, address, tfjson.ActionCreate)
+		}
+	})
+}
@@ -0,0 +1,23 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/vanehru/terraform-modules/testkit/privatedns"
+)
+
+// TestPrivateDNS checks the private DNS zones, A records and VNet links in the
+// saved plan against the private endpoints they serve
+func TestPrivateDNS(t *testing.T) {
+	t.Parallel()
+
+	plan := loadPlan(t)
+	dns, err := privatedns.FromPlan(&plan.RawPlan)
+	require.NoError(t, err)
+	require.NotEmpty(t, dns.Zones, "The plan should create a private DNS zone")
+	for _, v := range dns.Check("azurerm_virtual_network.vnet") {
+		t.Error(v)
+	}
+}
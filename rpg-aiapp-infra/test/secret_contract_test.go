@@ -0,0 +1,24 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/vanehru/terraform-modules/testkit/secretcontract"
+)
+
+// TestSecretContract checks that every Key Vault secret the backends read is
+// written by the configuration, and that every secret written is read
+func TestSecretContract(t *testing.T) {
+	t.Parallel()
+
+	issues, err := secretcontract.Check(secretcontract.Options{
+		TerraformDir: "../",
+		SourceDirs:   []string{"../../demo-rpg-aiapp/dev"},
+	})
+	require.NoError(t, err)
+	for _, issue := range issues {
+		t.Error(issue)
+	}
+}
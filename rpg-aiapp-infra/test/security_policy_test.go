@@ -0,0 +1,34 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/vanehru/terraform-modules/testkit/policy"
+)
+
+// securityPolicyFile adds rules and justified suppressions to the built-in
+// security rules
+const securityPolicyFile = "security-policy.yml"
+
+// TestSecurityPolicy checks the saved plan against the security policy
+func TestSecurityPolicy(t *testing.T) {
+	t.Parallel()
+
+	p, err := policy.Load(securityPolicyFile)
+	require.NoError(t, err)
+
+	plan := loadPlan(t)
+	result, err := p.CheckPlan(&plan.RawPlan, "../")
+	require.NoError(t, err)
+	for _, v := range result.Violations {
+		t.Error(v)
+	}
+	for _, s := range result.UnusedSuppressions {
+		t.Errorf("%s: suppression of %s matches nothing, remove it", s.Address, s.Rule)
+	}
+	for _, s := range result.Suppressed {
+		t.Logf("suppressed %s: %s", s.Violation, s.Justification)
+	}
+}
@@ -0,0 +1,69 @@
+package test
+
+import (
+	"net/netip"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/vanehru/terraform-modules/testkit/subnetplan"
+)
+
+// TestSubnetLayout validates the VNet and subnet CIDRs without deploying anything
+func TestSubnetLayout(t *testing.T) {
+	t.Parallel()
+
+	sources := map[string][]string{
+		"Defaults":      nil,
+		"TfvarsExample": {"../terraform.tfvars.example"},
+	}
+	for name, varFiles := range sources {
+		name, varFiles := name, varFiles
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			layout, err := subnetplan.Load("../", varFiles...)
+			require.NoError(t, err)
+			assert.Len(t, layout.Subnets, 6, "Expected six subnets in the root configuration")
+
+			for _, problem := range layout.Validate() {
+				t.Error(problem)
+			}
+		})
+	}
+
+	// The bastion subnet lives in the deployment-vm module, which has no VNet
+	// of its own, so only its size can be checked here
+	t.Run("DeploymentVMBastion", func(t *testing.T) {
+		t.Parallel()
+
+		layout, err := subnetplan.Load("../modules/deployment-vm")
+		require.NoError(t, err)
+		require.Len(t, layout.Subnets, 1)
+		assert.Equal(t, "AzureBastionSubnet", layout.Subnets[0].Name)
+
+		for _, problem := range layout.Validate() {
+			t.Error(problem)
+		}
+	})
+
+	t.Run("ProposeAlternateVNet", func(t *testing.T) {
+		t.Parallel()
+
+		layout, err := subnetplan.Load("../")
+		require.NoError(t, err)
+
+		vnet := netip.MustParsePrefix("10.10.0.0/20")
+		proposal, err := subnetplan.Propose(vnet, layout.Requests())
+		require.NoError(t, err)
+
+		proposed := &subnetplan.Layout{VNet: []netip.Prefix{vnet}}
+		for i, subnet := range layout.Subnets {
+			subnet.Prefix = proposal[i]
+			proposed.Subnets = append(proposed.Subnets, subnet)
+			t.Logf("%s = %q", subnet.Variable, proposal[i])
+		}
+		assert.Empty(t, proposed.Validate())
+	})
+}
@@ -0,0 +1,37 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/vanehru/terraform-modules/testkit/tagpolicy"
+)
+
+// tagPolicyFile lists the tags required on every taggable resource
+const tagPolicyFile = "tag-policy.yml"
+
+// TestTagPolicy checks resource tags in the configuration and the saved plan
+func TestTagPolicy(t *testing.T) {
+	t.Parallel()
+
+	policy, err := tagpolicy.LoadPolicy(tagPolicyFile)
+	require.NoError(t, err)
+
+	t.Run("Configuration", func(t *testing.T) {
+		violations, err := tagpolicy.CheckConfig("../", policy)
+		require.NoError(t, err)
+		for _, v := range violations {
+			t.Error(v)
+		}
+	})
+
+	t.Run("Plan", func(t *testing.T) {
+		plan := loadPlan(t)
+		violations, err := tagpolicy.CheckPlan(&plan.RawPlan, policy, "../")
+		require.NoError(t, err)
+		for _, v := range violations {
+			t.Error(v)
+		}
+	})
+}
@@ -55,3 +55,28 @@ variable "deployment_subnet_cidr" {
   type        = string
   default     = "172.16.6.0/24"
 }
+
+# Key Vault Firewall Variables
+variable "caller_ip" {
+  description = "Public IPv4 address allowed through the Key Vault firewall for the deployment; empty looks it up at caller_ip_url on every plan"
+  type        = string
+  default     = ""
+
+  validation {
+    condition     = var.caller_ip == "" || can(regex("^(\\d{1,3}\\.){3}\\d{1,3}$", var.caller_ip))
+    error_message = "caller_ip must be empty or an IPv4 address."
+  }
+}
+
+variable "caller_ip_url" {
+  description = "Service that returns the caller's public IP address as plain text, used when caller_ip is empty"
+  type        = string
+  default     = "https://api.ipify.org?format=text"
+}
+
+# Tagging Variables
+variable "resource_group_tags" {
+  description = "Additional tags for the resource group, such as the creation time the test harness stamps for its janitor"
+  type        = map(string)
+  default     = {}
+}
@@ -0,0 +1,501 @@
+// Package accesspolicy audits the access policies of the Key Vaults in a
+// `terraform show -json` plan against a least-privilege baseline per role. It
+// labels each object ID as the deploying principal, a Function App identity or
+// a human, and reports every permission a policy grants beyond what the
+// role's baseline allows in the vault's environment.
+package accesspolicy
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	tfjson "github.com/hashicorp/terraform-json"
+	"gopkg.in/yaml.v3"
+
+	"github.com/vanehru/terraform-modules/testkit/keyvault/kvroles"
+	"github.com/vanehru/terraform-modules/testkit/planassert"
+)
+
+// The roles an object ID is labelled with. Every policy file has a baseline
+// for each of them.
+const (
+	RoleDeployer    = "deployer"
+	RoleFunctionApp = "function-app"
+	RoleHuman       = "human"
+)
+
+// Roles are the roles a policy file must have a baseline for
+var Roles = []string{RoleDeployer, RoleFunctionApp, RoleHuman}
+
+// UnknownObjectID stands in for an object ID the plan does not know yet
+const UnknownObjectID = "(known after apply)"
+
+// SourceAccessPolicy is the Source of a grant by an access_policy block
+const SourceAccessPolicy = "access_policy"
+
+// functionAppTypes are the resource types whose managed identity is labelled
+// RoleFunctionApp
+var functionAppTypes = map[string]bool{
+	"azurerm_function_app":         true,
+	"azurerm_linux_function_app":   true,
+	"azurerm_windows_function_app": true,
+}
+
+// Permissions are the operations granted on each kind of vault object
+type Permissions struct {
+	Secrets      []string `yaml:"secrets"`
+	Keys         []string `yaml:"keys"`
+	Certificates []string `yaml:"certificates"`
+	Storage      []string `yaml:"storage"`
+}
+
+// kinds pairs each kind of object with its permissions, in the order reports
+// list them
+func (p Permissions) kinds() []kind {
+	return []kind{
+		{"secret", p.Secrets},
+		{"key", p.Keys},
+		{"certificate", p.Certificates},
+		{"storage", p.Storage},
+	}
+}
+
+type kind struct {
+	name        string
+	permissions []string
+}
+
+// String lists the permissions by kind, such as "secret: Get, List"
+func (p Permissions) String() string {
+	var parts []string
+	for _, k := range p.kinds() {
+		if len(k.permissions) > 0 {
+			parts = append(parts, k.name+": "+strings.Join(k.permissions, ", "))
+		}
+	}
+	if len(parts) == 0 {
+		return "-"
+	}
+	return strings.Join(parts, "; ")
+}
+
+// Baseline is what a role may hold in every environment, and what more it may
+// hold in some
+type Baseline struct {
+	Permissions `yaml:",inline"`
+	// Environments maps the value of a vault's environment tag to the
+	// permissions the role may hold on top of the baseline there
+	Environments map[string]Permissions `yaml:"environments"`
+}
+
+// Policy is a least-privilege baseline per role
+type Policy struct {
+	Roles map[string]Baseline `yaml:"roles"`
+	// Principals maps object IDs, such as a CI service principal or an
+	// operations group, to the role they are audited as, overriding the
+	// role they would be labelled with
+	Principals map[string]string `yaml:"principals"`
+	// EnvironmentTag is the vault tag that names its environment. It
+	// defaults to environment.
+	EnvironmentTag string `yaml:"environment_tag"`
+}
+
+// Load reads a YAML policy file
+func Load(path string) (*Policy, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	decoder := yaml.NewDecoder(f)
+	decoder.KnownFields(true)
+	policy := &Policy{}
+	if err := decoder.Decode(policy); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if err := policy.validate(); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return policy, nil
+}
+
+func (p *Policy) validate() error {
+	var problems []string
+	for _, role := range Roles {
+		if _, ok := p.Roles[role]; !ok {
+			problems = append(problems, fmt.Sprintf("roles has no baseline for %s", role))
+		}
+	}
+	for objectID, role := range p.Principals {
+		if _, ok := p.Roles[role]; !ok {
+			problems = append(problems, fmt.Sprintf("principals.%s is %q, which roles has no baseline for", objectID, role))
+		}
+	}
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return fmt.Errorf("%s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+func (p *Policy) environmentTag() string {
+	if p.EnvironmentTag == "" {
+		return "environment"
+	}
+	return p.EnvironmentTag
+}
+
+// Grant is an access policy of a vault, or a role assignment on a vault with
+// RBAC authorization, the role its object ID is labelled with and what it
+// holds beyond that role's baseline
+type Grant struct {
+	// Vault is the address of the azurerm_key_vault
+	Vault       string
+	Environment string
+	ObjectID    string
+	Role        string
+	// Source is SourceAccessPolicy, or the address of the
+	// azurerm_role_assignment and the role it assigns
+	Source string
+	// Permissions are what the grant amounts to, for a role assignment as
+	// kvroles maps its role
+	Permissions Permissions
+	// Excess lists each permission beyond the baseline, such as "secret Purge"
+	Excess []string
+}
+
+// Report is every access policy in a plan
+type Report struct {
+	Grants []Grant
+}
+
+// Violations returns a message per grant that holds more than its baseline
+func (r *Report) Violations() []string {
+	var violations []string
+	for _, g := range r.Grants {
+		if len(g.Excess) == 0 {
+			continue
+		}
+		environment := g.Environment
+		if environment == "" {
+			environment = "an untagged environment"
+		}
+		violations = append(violations, fmt.Sprintf("%s: %s %s holds %s beyond its baseline in %s, granted by %s",
+			g.Vault, g.Role, g.ObjectID, strings.Join(g.Excess, ", "), environment, g.Source))
+	}
+	return violations
+}
+
+// WriteText writes the report as a table
+func (r *Report) WriteText(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "VAULT\tENVIRONMENT\tOBJECT ID\tROLE\tGRANTED BY\tPERMISSIONS\tBEYOND BASELINE")
+	for _, g := range r.Grants {
+		environment, excess := g.Environment, strings.Join(g.Excess, ", ")
+		if environment == "" {
+			environment = "-"
+		}
+		if excess == "" {
+			excess = "-"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", g.Vault, environment, g.ObjectID, g.Role, g.Source, g.Permissions, excess)
+	}
+	return tw.Flush()
+}
+
+// Audit labels the object ID of every access_policy of every azurerm_key_vault
+// in plan and compares what it grants with the role's baseline. For a vault
+// with RBAC authorization it audits the azurerm_role_assignment resources
+// scoped to the vault, or above it, in place of its access policies. The deployer
+// is the object ID data.azurerm_client_config reads, and a Function App
+// identity is the principal_id of a Function App's identity. An object ID the
+// plan does not know yet belongs to an identity the same apply creates, which
+// the stacks only grant to Function Apps. Any other object ID is a human's,
+// unless policy.Principals says otherwise.
+func Audit(plan *tfjson.Plan, policy *Policy) (*Report, error) {
+	if plan.PlannedValues == nil {
+		return nil, fmt.Errorf("plan has no planned values")
+	}
+	roles := map[string]string{}
+	var prior *tfjson.StateModule
+	if plan.PriorState != nil && plan.PriorState.Values != nil {
+		prior = plan.PriorState.Values.RootModule
+	}
+	for _, module := range []*tfjson.StateModule{prior, plan.PlannedValues.RootModule} {
+		for _, r := range resources(module) {
+			switch {
+			case r.Mode == tfjson.DataResourceMode && r.Type == "azurerm_client_config":
+				if objectID, ok := r.AttributeValues["object_id"].(string); ok && objectID != "" {
+					roles[strings.ToLower(objectID)] = RoleDeployer
+				}
+			case r.Mode == tfjson.ManagedResourceMode && functionAppTypes[r.Type]:
+				for _, identity := range objects(r.AttributeValues["identity"]) {
+					if principalID, ok := identity["principal_id"].(string); ok && principalID != "" {
+						roles[strings.ToLower(principalID)] = RoleFunctionApp
+					}
+				}
+			}
+		}
+	}
+	for objectID, role := range policy.Principals {
+		roles[strings.ToLower(objectID)] = role
+	}
+
+	var expressions map[string]map[string]*tfjson.Expression
+	if plan.Config != nil && plan.Config.RootModule != nil {
+		expressions = map[string]map[string]*tfjson.Expression{}
+		indexConfig(plan.Config.RootModule, "", expressions)
+	}
+	planned := modules(plan.PlannedValues.RootModule)
+	var assignments []placed
+	for _, p := range planned {
+		if p.resource.Mode == tfjson.ManagedResourceMode && p.resource.Type == "azurerm_role_assignment" {
+			assignments = append(assignments, p)
+		}
+	}
+
+	report := &Report{}
+	label := func(objectID string) (string, string) {
+		switch {
+		case objectID == "":
+			return UnknownObjectID, RoleFunctionApp
+		case roles[strings.ToLower(objectID)] != "":
+			return objectID, roles[strings.ToLower(objectID)]
+		default:
+			return objectID, RoleHuman
+		}
+	}
+	for _, v := range planned {
+		r := v.resource
+		if r.Mode != tfjson.ManagedResourceMode || r.Type != "azurerm_key_vault" {
+			continue
+		}
+		environment := ""
+		if tags, ok := r.AttributeValues["tags"].(map[string]interface{}); ok {
+			environment, _ = tags[policy.environmentTag()].(string)
+		}
+
+		// Azure ignores the access policies of a vault with RBAC
+		// authorization, so only the role assignments on it count
+		if RBACAuthorization(r.AttributeValues) {
+			for _, a := range assignments {
+				if !assignedTo(a, v, expressions) {
+					continue
+				}
+				principalID, _ := a.resource.AttributeValues["principal_id"].(string)
+				grant := Grant{Vault: r.Address, Environment: environment, Source: a.resource.Address}
+				grant.ObjectID, grant.Role = label(principalID)
+				role, ok := assignedRole(a.resource.AttributeValues)
+				if !ok {
+					grant.Source += " (unknown role)"
+					grant.Excess = []string{"a role whose rights are not known to kvroles"}
+					report.Grants = append(report.Grants, grant)
+					continue
+				}
+				grant.Source += " (" + role.Name + ")"
+				grant.Permissions = Permissions{Secrets: role.Secrets, Keys: role.Keys, Certificates: role.Certificates}
+				grant.Excess = excess(grant.Permissions, policy.Roles[grant.Role], environment)
+				report.Grants = append(report.Grants, grant)
+			}
+			continue
+		}
+
+		for _, ap := range objects(r.AttributeValues["access_policy"]) {
+			grant := Grant{
+				Vault:       r.Address,
+				Environment: environment,
+				Source:      SourceAccessPolicy,
+				Permissions: Permissions{
+					Secrets:      strs(ap["secret_permissions"]),
+					Keys:         strs(ap["key_permissions"]),
+					Certificates: strs(ap["certificate_permissions"]),
+					Storage:      strs(ap["storage_permissions"]),
+				},
+			}
+			objectID, _ := ap["object_id"].(string)
+			grant.ObjectID, grant.Role = label(objectID)
+			grant.Excess = excess(grant.Permissions, policy.Roles[grant.Role], environment)
+			report.Grants = append(report.Grants, grant)
+		}
+	}
+	return report, nil
+}
+
+// RBACAuthorization reports whether the planned values of an azurerm_key_vault
+// enable RBAC authorization, under the attribute name of azurerm 3.x or 4.x
+func RBACAuthorization(values map[string]interface{}) bool {
+	for _, name := range []string{"enable_rbac_authorization", "rbac_authorization_enabled"} {
+		if enabled, _ := values[name].(bool); enabled {
+			return true
+		}
+	}
+	return false
+}
+
+// assignedRole returns the built-in role a planned azurerm_role_assignment
+// assigns
+func assignedRole(values map[string]interface{}) (kvroles.Role, bool) {
+	if name, _ := values["role_definition_name"].(string); name != "" {
+		return kvroles.ByName(name)
+	}
+	if id, _ := values["role_definition_id"].(string); id != "" {
+		return kvroles.ByDefinitionID(id)
+	}
+	return kvroles.Role{}, false
+}
+
+// assignedTo reports whether the role assignment a applies to the vault v:
+// its scope is the vault's ID or one above it, or, when the scope is not known
+// before apply, its configured scope refers to the vault or to the module
+// that holds it. The ID of a new vault is not known either, so a known scope
+// only matches it at the subscription or at the vault's resource group.
+func assignedTo(a, v placed, expressions map[string]map[string]*tfjson.Expression) bool {
+	scope, _ := a.resource.AttributeValues["scope"].(string)
+	id, _ := v.resource.AttributeValues["id"].(string)
+	if scope != "" && id != "" {
+		scope, id = strings.ToLower(strings.TrimSuffix(scope, "/")), strings.ToLower(id)
+		return scope == id || strings.HasPrefix(id, scope+"/")
+	}
+	if scope != "" {
+		group, _ := v.resource.AttributeValues["resource_group_name"].(string)
+		parts := strings.Split(strings.Trim(scope, "/"), "/")
+		switch {
+		case len(parts) == 2 && strings.EqualFold(parts[0], "subscriptions"):
+			return true
+		case len(parts) == 4 && strings.EqualFold(parts[2], "resourceGroups"):
+			return group != "" && strings.EqualFold(parts[3], group)
+		}
+		return false
+	}
+
+	module := planassert.StripIndexes(a.module)
+	expression := expressions[join(module, a.resource.Type+"."+a.resource.Name)]["scope"]
+	if expression == nil || expression.ExpressionData == nil {
+		return false
+	}
+	vault := planassert.StripIndexes(v.resource.Address)
+	for _, reference := range expression.References {
+		switch {
+		case strings.HasPrefix(reference, "module."):
+			call := strings.SplitN(reference, ".", 3)
+			if strings.HasPrefix(vault, join(module, call[0]+"."+call[1])+".") {
+				return true
+			}
+		case strings.HasPrefix(reference, "azurerm_key_vault."):
+			parts := strings.SplitN(reference, ".", 3)
+			if vault == join(module, parts[0]+"."+parts[1]) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// placed is a planned resource and the address of its module
+type placed struct {
+	module   string
+	resource *tfjson.StateResource
+}
+
+// modules flattens a module and its children, keeping the module address of
+// each resource, sorted by resource address
+func modules(module *tfjson.StateModule) []placed {
+	if module == nil {
+		return nil
+	}
+	var all []placed
+	for _, r := range module.Resources {
+		all = append(all, placed{module.Address, r})
+	}
+	for _, child := range module.ChildModules {
+		all = append(all, modules(child)...)
+	}
+	sort.Slice(all, func(i, j int) bool {
+		return all[i].resource.Address < all[j].resource.Address
+	})
+	return all
+}
+
+// indexConfig maps the address of each resource in module and its children,
+// without instance keys, to its configured expressions
+func indexConfig(module *tfjson.ConfigModule, path string, expressions map[string]map[string]*tfjson.Expression) {
+	for _, r := range module.Resources {
+		expressions[join(path, r.Address)] = r.Expressions
+	}
+	for name, call := range module.ModuleCalls {
+		if call.Module != nil {
+			indexConfig(call.Module, join(path, "module."+name), expressions)
+		}
+	}
+}
+
+func join(module, address string) string {
+	if module == "" {
+		return address
+	}
+	return module + "." + address
+}
+
+// excess returns each permission in granted that baseline does not allow in
+// environment. Permissions compare case-insensitively, and "all" is only
+// allowed where the baseline lists it.
+func excess(granted Permissions, baseline Baseline, environment string) []string {
+	extra := baseline.Environments[environment].kinds()
+	var out []string
+	for i, k := range granted.kinds() {
+		allowed := map[string]bool{}
+		for _, p := range append(append([]string{}, baseline.kinds()[i].permissions...), extra[i].permissions...) {
+			allowed[strings.ToLower(p)] = true
+		}
+		for _, p := range k.permissions {
+			if !allowed[strings.ToLower(p)] {
+				out = append(out, k.name+" "+p)
+			}
+		}
+	}
+	return out
+}
+
+// resources flattens a module and its children, sorted by address
+func resources(module *tfjson.StateModule) []*tfjson.StateResource {
+	if module == nil {
+		return nil
+	}
+	all := append([]*tfjson.StateResource{}, module.Resources...)
+	for _, child := range module.ChildModules {
+		all = append(all, resources(child)...)
+	}
+	sort.Slice(all, func(i, j int) bool {
+		return all[i].Address < all[j].Address
+	})
+	return all
+}
+
+// objects returns the elements of a nested block list that are objects
+func objects(value interface{}) []map[string]interface{} {
+	list, _ := value.([]interface{})
+	var out []map[string]interface{}
+	for _, element := range list {
+		if object, ok := element.(map[string]interface{}); ok {
+			out = append(out, object)
+		}
+	}
+	return out
+}
+
+// strs returns the strings in a list value
+func strs(value interface{}) []string {
+	list, _ := value.([]interface{})
+	var out []string
+	for _, element := range list {
+		if s, ok := element.(string); ok {
+			out = append(out, s)
+		}
+	}
+	return out
+}
@@ -0,0 +1,108 @@
+package accesspolicy
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	tfjson "github.com/hashicorp/terraform-json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func auditTestPlan(t *testing.T) *Report {
+	return auditPlan(t, "testdata/plan.json")
+}
+
+func auditPlan(t *testing.T, path string) *Report {
+	policy, err := Load("testdata/policy.yml")
+	require.NoError(t, err)
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	var plan tfjson.Plan
+	require.NoError(t, json.Unmarshal(data, &plan))
+
+	report, err := Audit(&plan, policy)
+	require.NoError(t, err)
+	return report
+}
+
+func TestLoad(t *testing.T) {
+	t.Parallel()
+
+	policy, err := Load("testdata/policy.yml")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Purge"}, policy.Roles[RoleDeployer].Environments["development"].Secrets)
+	assert.Equal(t, "environment", policy.environmentTag())
+
+	path := filepath.Join(t.TempDir(), "policy.yml")
+	require.NoError(t, os.WriteFile(path, []byte("roles:\n  deployer: {}\nprincipals:\n  abc: operator\n"), 0o600))
+	_, err = Load(path)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "roles has no baseline for function-app; roles has no baseline for human")
+	assert.Contains(t, err.Error(), `principals.abc is "operator"`)
+}
+
+func TestAudit(t *testing.T) {
+	t.Parallel()
+
+	report := auditTestPlan(t)
+	var roles []string
+	for _, g := range report.Grants {
+		roles = append(roles, g.Vault+" "+g.ObjectID+" "+g.Role)
+	}
+	assert.Equal(t, []string{
+		"module.dev_vault.azurerm_key_vault.kv 22222222-2222-2222-2222-222222222222 deployer",
+		"module.dev_vault.azurerm_key_vault.kv (known after apply) function-app",
+		"module.prod_vault.azurerm_key_vault.kv 22222222-2222-2222-2222-222222222222 deployer",
+		"module.prod_vault.azurerm_key_vault.kv 33333333-3333-3333-3333-333333333333 function-app",
+		"module.prod_vault.azurerm_key_vault.kv 55555555-5555-5555-5555-555555555555 human",
+		"module.prod_vault.azurerm_key_vault.kv 44444444-4444-4444-4444-444444444444 deployer",
+	}, roles)
+
+	assert.Equal(t, []string{
+		"module.prod_vault.azurerm_key_vault.kv: deployer 22222222-2222-2222-2222-222222222222 holds secret Purge beyond its baseline in production, granted by access_policy",
+		"module.prod_vault.azurerm_key_vault.kv: function-app 33333333-3333-3333-3333-333333333333 holds key Get, key UnwrapKey, certificate Get beyond its baseline in production, granted by access_policy",
+		"module.prod_vault.azurerm_key_vault.kv: human 55555555-5555-5555-5555-555555555555 holds secret Set beyond its baseline in production, granted by access_policy",
+	}, report.Violations(), "Purge is only allowed in development, and case does not matter")
+}
+
+func TestAuditRoleAssignments(t *testing.T) {
+	t.Parallel()
+
+	report := auditPlan(t, "testdata/rbac.json")
+	var grants []string
+	for _, g := range report.Grants {
+		grants = append(grants, g.Vault+" "+g.ObjectID+" "+g.Role+" "+g.Source)
+	}
+	assert.Equal(t, []string{
+		"azurerm_key_vault.existing 44444444-4444-4444-4444-444444444444 deployer azurerm_role_assignment.custom (unknown role)",
+		"azurerm_key_vault.existing 55555555-5555-5555-5555-555555555555 human azurerm_role_assignment.group_officer (Key Vault Secrets Officer)",
+		"azurerm_key_vault.existing 55555555-5555-5555-5555-555555555555 human azurerm_role_assignment.subscription_reader (Key Vault Reader)",
+		"module.vault.azurerm_key_vault.kv (known after apply) function-app azurerm_role_assignment.app_secrets (Key Vault Secrets User)",
+		"module.vault.azurerm_key_vault.kv 22222222-2222-2222-2222-222222222222 deployer azurerm_role_assignment.deployer_secrets (Key Vault Secrets Officer)",
+		"module.vault.azurerm_key_vault.kv 55555555-5555-5555-5555-555555555555 human azurerm_role_assignment.subscription_reader (Key Vault Reader)",
+	}, grants, "the access policy of an RBAC vault and the storage account assignment should not count")
+
+	assert.Equal(t, []string{
+		"azurerm_key_vault.existing: deployer 44444444-4444-4444-4444-444444444444 holds a role whose rights are not known to kvroles beyond its baseline in development, granted by azurerm_role_assignment.custom (unknown role)",
+		"azurerm_key_vault.existing: human 55555555-5555-5555-5555-555555555555 holds secret Set, secret Delete, secret Recover, secret Backup, secret Restore, secret Purge beyond its baseline in development, granted by azurerm_role_assignment.group_officer (Key Vault Secrets Officer)",
+		"azurerm_key_vault.existing: human 55555555-5555-5555-5555-555555555555 holds key List, certificate List beyond its baseline in development, granted by azurerm_role_assignment.subscription_reader (Key Vault Reader)",
+		"module.vault.azurerm_key_vault.kv: deployer 22222222-2222-2222-2222-222222222222 holds secret Backup, secret Restore, secret Purge beyond its baseline in production, granted by azurerm_role_assignment.deployer_secrets (Key Vault Secrets Officer)",
+		"module.vault.azurerm_key_vault.kv: human 55555555-5555-5555-5555-555555555555 holds key List, certificate List beyond its baseline in production, granted by azurerm_role_assignment.subscription_reader (Key Vault Reader)",
+	}, report.Violations())
+}
+
+func TestWriteText(t *testing.T) {
+	t.Parallel()
+
+	var out strings.Builder
+	require.NoError(t, auditTestPlan(t).WriteText(&out))
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	require.Len(t, lines, 7)
+	assert.Regexp(t, `^VAULT\s+ENVIRONMENT\s+OBJECT ID\s+ROLE\s+GRANTED BY\s+PERMISSIONS\s+BEYOND BASELINE$`, lines[0])
+	assert.Regexp(t, `^module.dev_vault.azurerm_key_vault.kv\s+development\s+\(known after apply\)\s+function-app\s+access_policy\s+secret: Get, List\s+-$`, lines[2])
+	assert.Regexp(t, `function-app\s+access_policy\s+secret: get, list; key: Get, UnwrapKey; certificate: Get\s+key Get, key UnwrapKey, certificate Get$`, lines[4])
+}
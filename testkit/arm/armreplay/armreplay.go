@@ -0,0 +1,134 @@
+// Package armreplay is an httptest stand-in for Azure Resource Manager that
+// answers from recorded responses, so a check that reads a resource, such as
+// a Key Vault's access policies, can be exercised offline against what a real
+// deployment returned. Unlike armtest it creates nothing: a request without a
+// recording is a 404.
+package armreplay
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/vanehru/terraform-modules/testkit/arm"
+)
+
+// Token is the only bearer token the server accepts
+const Token = "armreplay-token"
+
+// Recording is a request and the response Resource Manager gave it, as a
+// JSON file in a recordings directory
+type Recording struct {
+	Request struct {
+		Method string `json:"method"`
+		// URL is the path and query, such as
+		// /subscriptions/.../vaults/kv?api-version=2022-07-01
+		URL string `json:"url"`
+	} `json:"request"`
+	Response struct {
+		Status int             `json:"status"`
+		Body   json.RawMessage `json:"body"`
+	} `json:"response"`
+}
+
+// Server replays recordings at its URL
+type Server struct {
+	*httptest.Server
+
+	recordings map[string]Recording
+}
+
+// NewServer starts a server replaying every .json file in dir and closes it
+// when t completes
+func NewServer(t testing.TB, dir string) *Server {
+	t.Helper()
+	recordings, err := Load(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &Server{recordings: map[string]Recording{}}
+	for _, r := range recordings {
+		path, query, _ := strings.Cut(r.Request.URL, "?")
+		s.recordings[key(r.Request.Method, path, query)] = r
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// Load reads every .json file in dir as a Recording
+func Load(dir string) ([]Recording, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("armreplay: no recordings in %s", dir)
+	}
+	var recordings []Recording
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		var r Recording
+		if err := json.Unmarshal(data, &r); err != nil {
+			return nil, fmt.Errorf("armreplay: %s: %w", file, err)
+		}
+		if r.Request.Method == "" || r.Request.URL == "" || r.Response.Status == 0 {
+			return nil, fmt.Errorf("armreplay: %s: a recording needs a request method and url and a response status", file)
+		}
+		recordings = append(recordings, r)
+	}
+	return recordings, nil
+}
+
+// Client returns an arm.Client for subscriptionID that talks to the server
+func (s *Server) Client(subscriptionID string) *arm.Client {
+	client := arm.NewClient(s.URL, subscriptionID, func(ctx context.Context) (string, error) {
+		return Token, nil
+	})
+	client.HTTPClient = s.Server.Client()
+	return client
+}
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Authorization") != "Bearer "+Token {
+		writeError(w, http.StatusUnauthorized, "AuthenticationFailed", "Authentication failed. The 'Authorization' header is missing or invalid.")
+		return
+	}
+	recording, ok := s.recordings[key(r.Method, r.URL.Path, r.URL.RawQuery)]
+	if !ok {
+		writeError(w, http.StatusNotFound, "NotFound", fmt.Sprintf("armreplay has no recording for %s %s.", r.Method, r.URL.RequestURI()))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(recording.Response.Status)
+	_, _ = w.Write(recording.Response.Body)
+}
+
+// key identifies a request. Resource Manager paths are case-insensitive, and
+// the query is compared without regard to the order of its parameters.
+func key(method, path, rawQuery string) string {
+	query, _ := url.ParseQuery(rawQuery)
+	return strings.ToUpper(method) + " " + strings.ToLower(path) + "?" + query.Encode()
+}
+
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	type body struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(struct {
+		Error body `json:"error"`
+	}{body{code, message}})
+}
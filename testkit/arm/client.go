@@ -0,0 +1,441 @@
+// Package arm is a small Azure Resource Manager client for the resource groups
+// the tests create, so the harness can tag them and the janitor can find and
+// delete the ones a killed test left behind. It can also read any resource by
+// ID, for checks against what a deployment created.
+package arm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/vanehru/terraform-modules/testkit/config"
+)
+
+// APIVersion is the Microsoft.Resources API version Client speaks
+const APIVersion = "2021-04-01"
+
+// Endpoint is the Resource Manager endpoint of the public cloud
+const Endpoint = "https://management.azure.com"
+
+// Resource is the audience of the tokens Resource Manager accepts
+const Resource = "https://management.azure.com/"
+
+// LoginEndpoint is the Microsoft Entra endpoint of the public cloud
+const LoginEndpoint = "https://login.microsoftonline.com"
+
+// ResourceGroupClient lists, tags and deletes the resource groups of a
+// subscription
+type ResourceGroupClient interface {
+	// ListResourceGroups returns every resource group in the subscription
+	ListResourceGroups(ctx context.Context) ([]ResourceGroup, error)
+	// GetResourceGroup returns the named resource group
+	GetResourceGroup(ctx context.Context, name string) (*ResourceGroup, error)
+	// SetTags replaces the tags of the named resource group
+	SetTags(ctx context.Context, name string, tags map[string]string) (*ResourceGroup, error)
+	// DeleteResourceGroup starts deleting the named resource group and
+	// everything in it. It does not wait for the delete to finish.
+	DeleteResourceGroup(ctx context.Context, name string) error
+}
+
+// ResourceGroup is a resource group as Resource Manager returns it
+type ResourceGroup struct {
+	ID         string            `json:"id"`
+	Name       string            `json:"name"`
+	Location   string            `json:"location"`
+	Tags       map[string]string `json:"tags,omitempty"`
+	Properties struct {
+		ProvisioningState string `json:"provisioningState"`
+	} `json:"properties"`
+}
+
+// NormalizeLocation turns a display name such as "Japan East" into
+// "japaneast", as Resource Manager returns it
+func NormalizeLocation(location string) string {
+	return strings.ToLower(strings.ReplaceAll(location, " ", ""))
+}
+
+// Error is an error response from Resource Manager, or from another Azure
+// API that answers with the same error envelope
+type Error struct {
+	// Service names the API that answered, such as "key vault". Empty is
+	// Resource Manager.
+	Service    string
+	StatusCode int
+	Code       string
+	Message    string
+}
+
+func (e *Error) Error() string {
+	service := e.Service
+	if service == "" {
+		service = "arm"
+	}
+	return fmt.Sprintf("%s: %d %s: %s", service, e.StatusCode, e.Code, e.Message)
+}
+
+// ResponseError returns the Error for a response of service with status and
+// body. A body that is not an error envelope still yields the status.
+func ResponseError(service string, status int, body []byte) *Error {
+	var envelope struct {
+		Error struct {
+			Code    string `json:"code"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	_ = json.Unmarshal(body, &envelope)
+	return &Error{Service: service, StatusCode: status, Code: envelope.Error.Code, Message: envelope.Error.Message}
+}
+
+// IsNotFound reports whether err is a 404 from Resource Manager, such as
+// ResourceGroupNotFound, or from another API, such as SecretNotFound
+func IsNotFound(err error) bool {
+	var armErr *Error
+	return errors.As(err, &armErr) && armErr.StatusCode == http.StatusNotFound
+}
+
+// TokenFunc returns a bearer token for an API, Resource unless it says
+// otherwise
+type TokenFunc func(ctx context.Context) (string, error)
+
+// AzureCLIToken returns a token for Resource from the account the Azure CLI is
+// signed in with
+func AzureCLIToken(ctx context.Context) (string, error) {
+	return AzureCLITokenFor(Resource)(ctx)
+}
+
+// AzureCLITokenFor returns a TokenFunc for resource, such as the Key Vault
+// data plane, from the account the Azure CLI is signed in with
+func AzureCLITokenFor(resource string) TokenFunc {
+	return func(ctx context.Context) (string, error) {
+		out, err := exec.CommandContext(ctx, "az", "account", "get-access-token",
+			"--resource", resource, "--query", "accessToken", "--output", "tsv").Output()
+		if err != nil {
+			return "", fmt.Errorf("az account get-access-token: %w", err)
+		}
+		return strings.TrimSpace(string(out)), nil
+	}
+}
+
+// Credential returns a TokenFunc for resource that authenticates as
+// Terraform does with cfg: with the service principal if test-config.yml sets
+// one, or else with the Azure CLI
+func Credential(cfg *config.Config, resource string) TokenFunc {
+	if cfg.Azure.ClientSecret == "" {
+		return AzureCLITokenFor(resource)
+	}
+	credential := &ClientSecretCredential{
+		Resource:     resource,
+		TenantID:     cfg.Azure.TenantID,
+		ClientID:     cfg.Azure.ClientID,
+		ClientSecret: cfg.Azure.ClientSecret,
+	}
+	return credential.Token
+}
+
+// AzureCLISubscription returns the ID of the subscription the Azure CLI has
+// selected
+func AzureCLISubscription(ctx context.Context) (string, error) {
+	out, err := exec.CommandContext(ctx, "az", "account", "show", "--query", "id", "--output", "tsv").Output()
+	if err != nil {
+		return "", fmt.Errorf("az account show: %w", err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// ClientSecretCredential gets tokens for an API with a service principal's
+// client secret, as the azurerm provider does with ARM_CLIENT_SECRET. Its
+// Token method is a TokenFunc and reuses a token until shortly before it
+// expires.
+type ClientSecretCredential struct {
+	// LoginEndpoint defaults to the package LoginEndpoint
+	LoginEndpoint string
+	// Resource is the audience of the tokens, the package Resource by default
+	Resource     string
+	TenantID     string
+	ClientID     string
+	ClientSecret string
+	// HTTPClient defaults to a client with a 30 second timeout
+	HTTPClient *http.Client
+
+	mu      sync.Mutex
+	token   string
+	expires time.Time
+}
+
+// Token returns a token from the cache or the v2.0 token endpoint
+func (c *ClientSecretCredential) Token(ctx context.Context) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.token != "" && time.Now().Before(c.expires) {
+		return c.token, nil
+	}
+
+	login := c.LoginEndpoint
+	if login == "" {
+		login = LoginEndpoint
+	}
+	resource := c.Resource
+	if resource == "" {
+		resource = Resource
+	}
+	form := url.Values{
+		"grant_type":    {"client_credentials"},
+		"client_id":     {c.ClientID},
+		"client_secret": {c.ClientSecret},
+		"scope":         {strings.TrimSuffix(resource, "/") + "/.default"},
+	}
+	tokenURL := strings.TrimSuffix(login, "/") + "/" + url.PathEscape(c.TenantID) + "/oauth2/v2.0/token"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := httpClient(c.HTTPClient).Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var body struct {
+		AccessToken      string `json:"access_token"`
+		ExpiresIn        int    `json:"expires_in"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", fmt.Errorf("arm: decoding token response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK || body.AccessToken == "" {
+		return "", fmt.Errorf("arm: getting a token for %s: %d %s: %s", c.ClientID, resp.StatusCode, body.Error, body.ErrorDescription)
+	}
+	c.token = body.AccessToken
+	// Renew five minutes early, so a token does not expire mid-request
+	c.expires = time.Now().Add(time.Duration(body.ExpiresIn)*time.Second - 5*time.Minute)
+	return c.token, nil
+}
+
+// Client is a ResourceGroupClient for the Resource Manager REST API
+type Client struct {
+	// BaseURL is Endpoint, or the URL of a stand-in like armtest.Server
+	BaseURL        string
+	SubscriptionID string
+	Token          TokenFunc
+	// HTTPClient defaults to a client with a 30 second timeout
+	HTTPClient *http.Client
+}
+
+// NewClient returns a Client for the subscription at baseURL
+func NewClient(baseURL, subscriptionID string, token TokenFunc) *Client {
+	return &Client{
+		BaseURL:        strings.TrimSuffix(baseURL, "/"),
+		SubscriptionID: subscriptionID,
+		Token:          token,
+		HTTPClient:     &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// FromConfig returns a Client for the public cloud that authenticates as
+// Terraform does with cfg: with the service principal if test-config.yml sets
+// one, or else with the Azure CLI. Without a subscription_id it uses the one
+// the Azure CLI has selected.
+func FromConfig(ctx context.Context, cfg *config.Config) (*Client, error) {
+	subscriptionID := cfg.Azure.SubscriptionID
+	if subscriptionID == "" {
+		var err error
+		if subscriptionID, err = AzureCLISubscription(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	return NewClient(Endpoint, subscriptionID, Credential(cfg, Resource)), nil
+}
+
+// ListResourceGroups follows nextLink through every page of resource groups
+func (c *Client) ListResourceGroups(ctx context.Context) ([]ResourceGroup, error) {
+	var groups []ResourceGroup
+	err := c.list(ctx, c.url("resourcegroups"), func(value json.RawMessage) error {
+		var page []ResourceGroup
+		if err := json.Unmarshal(value, &page); err != nil {
+			return err
+		}
+		groups = append(groups, page...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return groups, nil
+}
+
+// GetResourceGroup returns the named resource group
+func (c *Client) GetResourceGroup(ctx context.Context, name string) (*ResourceGroup, error) {
+	group := &ResourceGroup{}
+	if err := c.do(ctx, http.MethodGet, c.url("resourcegroups", url.PathEscape(name)), nil, group); err != nil {
+		return nil, err
+	}
+	return group, nil
+}
+
+// SetTags replaces the tags of the named resource group with a PATCH, which
+// leaves the rest of it alone
+func (c *Client) SetTags(ctx context.Context, name string, tags map[string]string) (*ResourceGroup, error) {
+	if tags == nil {
+		tags = map[string]string{}
+	}
+	group := &ResourceGroup{}
+	body := map[string]interface{}{"tags": tags}
+	if err := c.do(ctx, http.MethodPatch, c.url("resourcegroups", url.PathEscape(name)), body, group); err != nil {
+		return nil, err
+	}
+	return group, nil
+}
+
+// DeleteResourceGroup starts deleting the named resource group. A group that
+// is already gone is not an error.
+func (c *Client) DeleteResourceGroup(ctx context.Context, name string) error {
+	err := c.do(ctx, http.MethodDelete, c.url("resourcegroups", url.PathEscape(name)), nil, nil)
+	if IsNotFound(err) {
+		return nil
+	}
+	return err
+}
+
+// GetResource decodes the resource at id, such as a private DNS record set,
+// into out. apiVersion is a version of the resource's provider API.
+func (c *Client) GetResource(ctx context.Context, id, apiVersion string, out interface{}) error {
+	return c.do(ctx, http.MethodGet, c.resourceURL(id, apiVersion), nil, out)
+}
+
+// ListResources returns every resource in the collection at id, such as
+// the virtual network links of a private DNS zone, following nextLink
+func (c *Client) ListResources(ctx context.Context, id, apiVersion string) ([]json.RawMessage, error) {
+	var resources []json.RawMessage
+	err := c.list(ctx, c.resourceURL(id, apiVersion), func(value json.RawMessage) error {
+		var page []json.RawMessage
+		if err := json.Unmarshal(value, &page); err != nil {
+			return err
+		}
+		resources = append(resources, page...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return resources, nil
+}
+
+// list gets next and every page its nextLink leads to, passing the value of
+// each to add
+func (c *Client) list(ctx context.Context, next string, add func(value json.RawMessage) error) error {
+	for next != "" {
+		var page struct {
+			Value    json.RawMessage `json:"value"`
+			NextLink string          `json:"nextLink"`
+		}
+		if err := c.do(ctx, http.MethodGet, next, nil, &page); err != nil {
+			return err
+		}
+		if len(page.Value) > 0 {
+			if err := add(page.Value); err != nil {
+				return err
+			}
+		}
+
+		if page.NextLink != "" {
+			if err := c.sameHost(page.NextLink); err != nil {
+				return err
+			}
+		}
+		next = page.NextLink
+	}
+	return nil
+}
+
+func (c *Client) url(segments ...string) string {
+	return c.BaseURL + "/subscriptions/" + url.PathEscape(c.SubscriptionID) + "/" + strings.Join(segments, "/") + "?api-version=" + APIVersion
+}
+
+func (c *Client) resourceURL(id, apiVersion string) string {
+	return c.BaseURL + "/" + strings.TrimPrefix(id, "/") + "?api-version=" + url.QueryEscape(apiVersion)
+}
+
+// sameHost keeps the bearer token from being sent anywhere but BaseURL
+func (c *Client) sameHost(link string) error {
+	base, err := url.Parse(c.BaseURL)
+	if err != nil {
+		return err
+	}
+	next, err := url.Parse(link)
+	if err != nil {
+		return err
+	}
+	if next.Scheme != base.Scheme || next.Host != base.Host {
+		return fmt.Errorf("arm: nextLink %s leaves %s", link, c.BaseURL)
+	}
+	return nil
+}
+
+// do sends a request with body, if not nil, as JSON and decodes the response
+// into out, if not nil
+func (c *Client) do(ctx context.Context, method, rawURL string, body, out interface{}) error {
+	token, err := c.Token(ctx)
+	if err != nil {
+		return err
+	}
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, rawURL, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := httpClient(c.HTTPClient).Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return ResponseError("", resp.StatusCode, data)
+	}
+	if out == nil || len(data) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("arm: decoding %s %s: %w", method, req.URL.Path, err)
+	}
+	return nil
+}
+
+func httpClient(c *http.Client) *http.Client {
+	if c == nil {
+		return http.DefaultClient
+	}
+	return c
+}
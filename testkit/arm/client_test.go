@@ -0,0 +1,188 @@
+package arm_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/vanehru/terraform-modules/testkit/arm"
+	"github.com/vanehru/terraform-modules/testkit/armtest"
+)
+
+func newClient(t *testing.T) (*arm.Client, *armtest.Server) {
+	server := armtest.NewServer(t)
+	credential := &arm.ClientSecretCredential{
+		LoginEndpoint: server.URL,
+		TenantID:      armtest.TenantID,
+		ClientID:      armtest.ClientID,
+		ClientSecret:  armtest.ClientSecret,
+		HTTPClient:    server.Client(),
+	}
+	client := arm.NewClient(server.URL+"/", armtest.SubscriptionID, credential.Token)
+	client.HTTPClient = server.Client()
+	return client, server
+}
+
+func groupID(name string) string {
+	return "/subscriptions/" + armtest.SubscriptionID + "/resourceGroups/" + name
+}
+
+func TestClient(t *testing.T) {
+	t.Parallel()
+
+	client, server := newClient(t)
+	require.NoError(t, server.Put(groupID("test-rg-b"), map[string]interface{}{"location": "japaneast"}))
+	require.NoError(t, server.Put(groupID("test-rg-a"), map[string]interface{}{
+		"location": "japaneast",
+		"tags":     map[string]string{"environment": "development"},
+	}))
+	ctx := context.Background()
+
+	groups, err := client.ListResourceGroups(ctx)
+	require.NoError(t, err)
+	require.Len(t, groups, 2)
+	assert.Equal(t, "test-rg-a", groups[0].Name)
+	assert.Equal(t, "japaneast", groups[0].Location)
+	assert.Equal(t, map[string]string{"environment": "development"}, groups[0].Tags)
+	assert.Equal(t, "Succeeded", groups[0].Properties.ProvisioningState)
+
+	tagged, err := client.SetTags(ctx, "test-rg-a", map[string]string{"environment": "development", "owner": "ci"})
+	require.NoError(t, err)
+	assert.Equal(t, "ci", tagged.Tags["owner"])
+	group, err := client.GetResourceGroup(ctx, "test-rg-a")
+	require.NoError(t, err)
+	assert.Equal(t, tagged.Tags, group.Tags)
+	assert.Equal(t, groupID("test-rg-a"), group.ID)
+
+	require.NoError(t, client.DeleteResourceGroup(ctx, "test-rg-b"))
+	group, err = client.GetResourceGroup(ctx, "test-rg-b")
+	require.NoError(t, err)
+	assert.Equal(t, "Deleting", group.Properties.ProvisioningState, "the delete should not be waited for")
+
+	_, err = client.GetResourceGroup(ctx, "test-rg-c")
+	assert.True(t, arm.IsNotFound(err))
+	assert.EqualError(t, err, "arm: 404 ResourceGroupNotFound: Resource group 'test-rg-c' could not be found.")
+	assert.NoError(t, client.DeleteResourceGroup(ctx, "test-rg-c"), "deleting what is gone succeeds")
+
+	client.Token = func(ctx context.Context) (string, error) { return "expired", nil }
+	_, err = client.ListResourceGroups(ctx)
+	var armErr *arm.Error
+	require.ErrorAs(t, err, &armErr)
+	assert.Equal(t, "AuthenticationFailed", armErr.Code)
+}
+
+func TestResources(t *testing.T) {
+	t.Parallel()
+
+	client, server := newClient(t)
+	zoneID := groupID("test-rg") + "/providers/Microsoft.Network/privateDnsZones/privatelink.vaultcore.azure.net"
+	require.NoError(t, server.Put(groupID("test-rg"), map[string]interface{}{"location": "japaneast"}))
+	require.NoError(t, server.Put(zoneID, map[string]interface{}{"location": "global"}))
+	for _, name := range []string{"link-b", "link-a"} {
+		require.NoError(t, server.Put(zoneID+"/virtualNetworkLinks/"+name, map[string]interface{}{
+			"location":   "global",
+			"properties": map[string]interface{}{"virtualNetwork": map[string]interface{}{"id": "/vnet/" + name}},
+		}))
+	}
+	ctx := context.Background()
+
+	var zone struct {
+		Name string `json:"name"`
+	}
+	require.NoError(t, client.GetResource(ctx, zoneID, "2020-06-01", &zone))
+	assert.Equal(t, "privatelink.vaultcore.azure.net", zone.Name)
+
+	links, err := client.ListResources(ctx, zoneID+"/virtualNetworkLinks", "2020-06-01")
+	require.NoError(t, err)
+	require.Len(t, links, 2)
+	var link struct {
+		Name string `json:"name"`
+	}
+	require.NoError(t, json.Unmarshal(links[0], &link))
+	assert.Equal(t, "link-a", link.Name)
+
+	err = client.GetResource(ctx, zoneID+"/A/missing", "2020-06-01", &zone)
+	assert.True(t, arm.IsNotFound(err))
+}
+
+func TestClientSecretCredential(t *testing.T) {
+	t.Parallel()
+
+	server := armtest.NewServer(t)
+	credential := &arm.ClientSecretCredential{
+		LoginEndpoint: server.URL,
+		TenantID:      armtest.TenantID,
+		ClientID:      armtest.ClientID,
+		ClientSecret:  armtest.ClientSecret,
+		HTTPClient:    server.Client(),
+	}
+	token, err := credential.Token(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, server.Token(), token)
+
+	credential.ClientSecret = "wrong"
+	token, err = credential.Token(context.Background())
+	require.NoError(t, err, "a cached token should be reused")
+	assert.Equal(t, server.Token(), token)
+
+	wrong := &arm.ClientSecretCredential{
+		LoginEndpoint: server.URL,
+		TenantID:      armtest.TenantID,
+		ClientID:      armtest.ClientID,
+		ClientSecret:  "wrong",
+		HTTPClient:    server.Client(),
+	}
+	_, err = wrong.Token(context.Background())
+	assert.ErrorContains(t, err, "invalid_client")
+}
+
+// TestCredentialResource gets a token for the Key Vault data plane with the
+// service principal from the configuration, as the secret checks do
+func TestCredentialResource(t *testing.T) {
+	t.Parallel()
+
+	var scope string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		scope = r.PostFormValue("scope")
+		fmt.Fprint(w, `{"access_token":"vault-token","expires_in":3600}`)
+	}))
+	t.Cleanup(server.Close)
+
+	credential := &arm.ClientSecretCredential{
+		LoginEndpoint: server.URL,
+		Resource:      "https://vault.azure.net",
+		TenantID:      "tenant",
+		ClientID:      "client",
+		ClientSecret:  "secret",
+	}
+	token, err := credential.Token(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "vault-token", token)
+	assert.Equal(t, "https://vault.azure.net/.default", scope)
+
+	_, err = (&arm.ClientSecretCredential{LoginEndpoint: server.URL, TenantID: "tenant"}).Token(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, arm.Resource+".default", scope, "Resource should be the default audience")
+}
+
+func TestResponseError(t *testing.T) {
+	t.Parallel()
+
+	err := arm.ResponseError("key vault", http.StatusNotFound, []byte(`{"error":{"code":"SecretNotFound","message":"missing"}}`))
+	assert.EqualError(t, err, "key vault: 404 SecretNotFound: missing")
+	assert.True(t, arm.IsNotFound(err))
+	assert.EqualError(t, arm.ResponseError("", http.StatusBadGateway, []byte("<html>")), "arm: 502 : ")
+}
+
+func TestNormalizeLocation(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, "japaneast", arm.NormalizeLocation("Japan East"))
+	assert.Equal(t, "japaneast", arm.NormalizeLocation("japaneast"))
+}
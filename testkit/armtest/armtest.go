@@ -0,0 +1,429 @@
+// Package armtest is an httptest stand-in for Azure Resource Manager, so a
+// configuration can be applied and destroyed with the azurerm provider without
+// a subscription. It serves the cloud metadata and token endpoints the
+// provider starts with, then PUT, PATCH, GET and DELETE for the resource types
+// the RPG AI App modules create, answering the slow ones with long-running
+// operations the provider has to poll. It is also the HTTPS proxy EnvVars
+// points the provider at, and answers the data-plane hosts of the vaults and
+// storage accounts it holds itself: Key Vault secrets, and storage service
+// properties and file shares.
+package armtest
+
+import (
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// The identity the server authenticates, and the subscription it hosts
+const (
+	SubscriptionID = "00000000-0000-0000-0000-00000000a001"
+	TenantID       = "00000000-0000-0000-0000-00000000a002"
+	ClientID       = "00000000-0000-0000-0000-00000000a003"
+	ObjectID       = "00000000-0000-0000-0000-00000000a004"
+	ClientSecret   = "armtest-client-secret"
+)
+
+// EnvironmentName is the name of the cloud the metadata endpoint describes
+const EnvironmentName = "armtest"
+
+// operationsPath is where long-running operations are polled
+const operationsPath = "/armtest/operations/"
+
+// tokenPath matches the Microsoft Entra token endpoints, v1 and v2
+var tokenPath = regexp.MustCompile(`^/[^/]+/oauth2(/v2\.0)?/token$`)
+
+// systemCertFiles are the CA bundles Go reads on Linux, in the order it tries them
+var systemCertFiles = []string{
+	"/etc/ssl/certs/ca-certificates.crt",
+	"/etc/pki/tls/certs/ca-bundle.crt",
+	"/etc/ssl/ca-bundle.pem",
+	"/etc/pki/tls/cacert.pem",
+	"/etc/pki/ca-trust/extracted/pem/tls-ca-bundle.pem",
+	"/etc/ssl/cert.pem",
+}
+
+// Server serves Resource Manager for SubscriptionID over TLS at its URL
+type Server struct {
+	*httptest.Server
+	// Polls is how many times a long-running operation reports that it is
+	// still running before it completes. Set it before the first request.
+	Polls int
+	// RetryAfter is the Retry-After, in seconds, on long-running responses.
+	// The azurerm provider waits that long between polls.
+	RetryAfter int
+
+	token    string
+	certFile string
+
+	// dataPlane serves the data-plane hosts on the tunnels proxy opens
+	dataPlane     *http.Server
+	dataPlaneCert tls.Certificate
+	tunnels       *tunnelListener
+
+	mu         sync.Mutex
+	resources  map[string]*resource
+	operations map[string]*operation
+	nextOp     int
+	nextHost   map[string]uint32
+	// vaults and deletedVaults are keyed by lower-case vault name, and
+	// accounts by storage account name
+	vaults        map[string]*vaultData
+	deletedVaults map[string]*deletedVault
+	accounts      map[string]*accountData
+}
+
+// Start starts a server with no resources. Close it when done.
+func Start() (*Server, error) {
+	s := &Server{
+		Polls:      1,
+		RetryAfter: 1,
+		resources:  map[string]*resource{},
+		operations: map[string]*operation{},
+		nextHost:   map[string]uint32{},
+
+		vaults:        map[string]*vaultData{},
+		deletedVaults: map[string]*deletedVault{},
+		accounts:      map[string]*accountData{},
+	}
+	s.Server = httptest.NewTLSServer(http.HandlerFunc(s.serve))
+	if err := s.startDataPlane(); err != nil {
+		s.Server.Close()
+		return nil, err
+	}
+
+	certFile, err := writeCertBundle(s.Certificate().Raw, s.dataPlaneCert.Leaf.Raw)
+	if err != nil {
+		s.Close()
+		return nil, err
+	}
+	s.certFile = certFile
+	s.token = newToken(s.URL)
+	return s, nil
+}
+
+// NewServer starts a server with no resources and closes it when t completes
+func NewServer(t testing.TB) *Server {
+	s, err := Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(s.Close)
+	return s
+}
+
+// Close shuts the server down and removes its certificate bundle
+func (s *Server) Close() {
+	s.Server.Close()
+	s.dataPlane.Close()
+	s.tunnels.Close()
+	if s.certFile != "" {
+		os.Remove(s.certFile)
+	}
+}
+
+// Token returns the bearer token the server issues and accepts
+func (s *Server) Token() string {
+	return s.token
+}
+
+// EnvVars returns the variables that point the azurerm provider at the
+// server, for terraform.Options.EnvVars. They replace any real credentials.
+// SSL_CERT_FILE adds the server certificates to the system roots, so
+// terraform init still reaches the registry. Go ignores it on macOS.
+// HTTPS_PROXY sends the data-plane hosts to the server, which tunnels every
+// other host through; Go never proxies the loopback address the server
+// listens on.
+func (s *Server) EnvVars() map[string]string {
+	return map[string]string{
+		"ARM_METADATA_HOSTNAME":          s.Listener.Addr().String(),
+		"ARM_ENVIRONMENT":                EnvironmentName,
+		"ARM_SUBSCRIPTION_ID":            SubscriptionID,
+		"ARM_TENANT_ID":                  TenantID,
+		"ARM_CLIENT_ID":                  ClientID,
+		"ARM_CLIENT_SECRET":              ClientSecret,
+		"ARM_SKIP_PROVIDER_REGISTRATION": "true",
+		"SSL_CERT_FILE":                  s.certFile,
+		"HTTPS_PROXY":                    s.URL,
+	}
+}
+
+// Resource returns the resource with id as a GET would, and whether it exists
+func (s *Server) Resource(id string) (map[string]interface{}, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r, ok := s.resources[strings.ToLower(id)]
+	if !ok {
+		return nil, false
+	}
+	var view map[string]interface{}
+	data, _ := json.Marshal(s.view(r))
+	_ = json.Unmarshal(data, &view)
+	return view, true
+}
+
+// Put stores a resource as a PUT of body to id leaves it once its operation
+// has completed, for tests that need resources to exist beforehand
+func (s *Server) Put(id string, body map[string]interface{}) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rt, err := parse(id)
+	if err != nil {
+		return err
+	}
+	if rt.kind == nil || rt.action != "" {
+		return noRoute(id)
+	}
+	// Round-trip the body, so the server holds what a request would send
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	stored := map[string]interface{}{}
+	if err := json.Unmarshal(data, &stored); err != nil {
+		return err
+	}
+	res, _, err := s.store(rt, stored)
+	if err != nil {
+		return err
+	}
+	res.state = "Succeeded"
+	return nil
+}
+
+// ResourceIDs returns the ID of every resource, sorted
+func (s *Server) ResourceIDs() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ids := make([]string, 0, len(s.resources))
+	for _, r := range s.resources {
+		ids = append(ids, r.id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case r.Method == http.MethodConnect:
+		s.proxy(w, r)
+		return
+	case r.URL.Path == "/metadata/endpoints":
+		s.metadata(w, r)
+		return
+	case tokenPath.MatchString(r.URL.Path):
+		s.issueToken(w, r)
+		return
+	}
+
+	if r.Header.Get("Authorization") != "Bearer "+s.token {
+		writeError(w, &armError{http.StatusUnauthorized, "AuthenticationFailed", "Authentication failed. The 'Authorization' header is missing or invalid."})
+		return
+	}
+	if r.URL.Query().Get("api-version") == "" {
+		writeError(w, &armError{http.StatusBadRequest, "MissingApiVersionParameter", "The api-version query parameter (?api-version=) is required for all requests."})
+		return
+	}
+	if strings.HasPrefix(r.URL.Path, operationsPath) {
+		s.poll(w, r)
+		return
+	}
+	s.serveResource(w, r)
+}
+
+// metadata describes a cloud whose every endpoint is the server. The
+// 2022-09-01 schema is one environment; earlier ones are a list.
+func (s *Server) metadata(w http.ResponseWriter, r *http.Request) {
+	endpoint := s.URL + "/"
+	env := map[string]interface{}{
+		"name":            EnvironmentName,
+		"portal":          endpoint,
+		"resourceManager": endpoint,
+		"authentication": map[string]interface{}{
+			"loginEndpoint":    endpoint,
+			"audiences":        []string{endpoint},
+			"tenant":           "common",
+			"identityProvider": "AAD",
+		},
+		"graph":                    endpoint,
+		"graphAudience":            endpoint,
+		"microsoftGraphResourceId": endpoint,
+		"suffixes": map[string]interface{}{
+			"keyVaultDns":       "vault.azure.net",
+			"storage":           "core.windows.net",
+			"sqlServerHostname": "database.windows.net",
+			"mhsmDns":           "managedhsm.azure.net",
+			"acrLoginServer":    "azurecr.io",
+		},
+	}
+	if r.URL.Query().Get("api-version") == "2022-09-01" {
+		writeJSON(w, http.StatusOK, env)
+		return
+	}
+	writeJSON(w, http.StatusOK, []interface{}{env})
+}
+
+// issueToken answers a client credentials grant for ClientID
+func (s *Server) issueToken(w http.ResponseWriter, r *http.Request) {
+	oauthError := func(status int, code, description string) {
+		writeJSON(w, status, map[string]string{"error": code, "error_description": description})
+	}
+	if r.Method != http.MethodPost {
+		oauthError(http.StatusMethodNotAllowed, "invalid_request", "The token endpoint only accepts POST.")
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		oauthError(http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+	if grant := r.PostForm.Get("grant_type"); grant != "client_credentials" {
+		oauthError(http.StatusBadRequest, "unsupported_grant_type", fmt.Sprintf("armtest only supports client_credentials, not %q.", grant))
+		return
+	}
+	// The client may authenticate in the form or with basic auth
+	clientID, secret, ok := r.BasicAuth()
+	if !ok {
+		clientID, secret = r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+	}
+	if clientID != ClientID || secret != ClientSecret {
+		oauthError(http.StatusUnauthorized, "invalid_client", "AADSTS7000215: Invalid client secret provided.")
+		return
+	}
+
+	lifetime := 24 * time.Hour
+	if strings.Contains(r.URL.Path, "/v2.0/") {
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"token_type":     "Bearer",
+			"expires_in":     int(lifetime.Seconds()),
+			"ext_expires_in": int(lifetime.Seconds()),
+			"access_token":   s.token,
+		})
+		return
+	}
+	// The v1 endpoint returns its numbers as strings
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"token_type":   "Bearer",
+		"expires_in":   fmt.Sprint(int(lifetime.Seconds())),
+		"expires_on":   fmt.Sprint(time.Now().Add(lifetime).Unix()),
+		"resource":     r.PostForm.Get("resource"),
+		"access_token": s.token,
+	})
+}
+
+// newToken returns an unsigned JWT with the claims the azurerm provider reads
+// to find the tenant and object ID it runs as
+func newToken(audience string) string {
+	now := time.Now()
+	header, _ := json.Marshal(map[string]string{"alg": "none", "typ": "JWT"})
+	claims, _ := json.Marshal(map[string]interface{}{
+		"aud":   audience + "/",
+		"iss":   "https://sts.windows.net/" + TenantID + "/",
+		"iat":   now.Unix(),
+		"nbf":   now.Unix(),
+		"exp":   now.Add(24 * time.Hour).Unix(),
+		"appid": ClientID,
+		"oid":   ObjectID,
+		"sub":   ObjectID,
+		"tid":   TenantID,
+		"idtyp": "app",
+	})
+	encode := base64.RawURLEncoding.EncodeToString
+	return encode(header) + "." + encode(claims) + "." + encode([]byte("armtest"))
+}
+
+// writeCertBundle writes the system roots followed by certs to a temporary
+// file, for SSL_CERT_FILE
+func writeCertBundle(certs ...[]byte) (string, error) {
+	var bundle []byte
+	candidates := systemCertFiles
+	if existing := os.Getenv("SSL_CERT_FILE"); existing != "" {
+		candidates = []string{existing}
+	}
+	for _, path := range candidates {
+		if roots, err := os.ReadFile(path); err == nil {
+			bundle = append(roots, '\n')
+			break
+		}
+	}
+	for _, cert := range certs {
+		bundle = append(bundle, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert})...)
+	}
+
+	f, err := os.CreateTemp("", "armtest-*.pem")
+	if err != nil {
+		return "", err
+	}
+	_, err = f.Write(bundle)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
+
+// armError is an error response in the Resource Manager envelope
+type armError struct {
+	status  int
+	code    string
+	message string
+}
+
+func (e *armError) Error() string {
+	return fmt.Sprintf("%d %s: %s", e.status, e.code, e.message)
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	var armErr *armError
+	if !errors.As(err, &armErr) {
+		armErr = &armError{http.StatusInternalServerError, "InternalServerError", err.Error()}
+	}
+	type body struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	}
+	writeJSON(w, armErr.status, struct {
+		Error body `json:"error"`
+	}{body{armErr.code, armErr.message}})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// randomHex returns n random bytes in hex
+func randomHex(n int) string {
+	b := make([]byte, n)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// newUUID returns a random version 4 UUID
+func newUUID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
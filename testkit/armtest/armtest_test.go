@@ -0,0 +1,471 @@
+package armtest
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	test_structure "github.com/gruntwork-io/terratest/modules/test-structure"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/vanehru/terraform-modules/testkit/callerip"
+)
+
+const apiVersion = "2023-05-01"
+
+// client calls the server as the azurerm provider does, polling long-running
+// operations to completion
+type client struct {
+	t      *testing.T
+	server *Server
+	token  string
+}
+
+func newClient(t *testing.T) *client {
+	server := NewServer(t)
+	server.RetryAfter = 0
+	return &client{t: t, server: server, token: server.Token()}
+}
+
+// do sends body to path and returns the status and decoded response
+func (c *client) do(method, path string, body interface{}) (*http.Response, map[string]interface{}) {
+	c.t.Helper()
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		require.NoError(c.t, err)
+		reader = bytes.NewReader(data)
+	}
+	target := path
+	if !strings.HasPrefix(path, "https://") {
+		target = c.server.URL + path + "?api-version=" + apiVersion
+	}
+	req, err := http.NewRequest(method, target, reader)
+	require.NoError(c.t, err)
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	resp, err := c.server.Client().Do(req)
+	require.NoError(c.t, err)
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	require.NoError(c.t, err)
+	var decoded map[string]interface{}
+	if len(data) > 0 {
+		require.NoError(c.t, json.Unmarshal(data, &decoded), string(data))
+	}
+	return resp, decoded
+}
+
+// wait polls the operation resp started and returns how many polls it took
+func (c *client) wait(resp *http.Response) int {
+	c.t.Helper()
+	polls := 0
+	if operation := resp.Header.Get("Azure-AsyncOperation"); operation != "" {
+		for {
+			polls++
+			_, status := c.do(http.MethodGet, operation, nil)
+			if status["status"] != "InProgress" {
+				require.Equal(c.t, "Succeeded", status["status"])
+				return polls
+			}
+		}
+	}
+	for location := resp.Header.Get("Location"); location != ""; {
+		polls++
+		resp, _ := c.do(http.MethodGet, location, nil)
+		if resp.StatusCode != http.StatusAccepted {
+			require.Equal(c.t, http.StatusNoContent, resp.StatusCode)
+			return polls
+		}
+		location = resp.Header.Get("Location")
+	}
+	return polls
+}
+
+// put creates or updates a resource and waits for it
+func (c *client) put(path string, body interface{}) map[string]interface{} {
+	c.t.Helper()
+	resp, _ := c.do(http.MethodPut, path, body)
+	require.Contains(c.t, []int{http.StatusOK, http.StatusCreated}, resp.StatusCode)
+	c.wait(resp)
+	_, got := c.do(http.MethodGet, path, nil)
+	return got
+}
+
+func properties(resource map[string]interface{}) map[string]interface{} {
+	props, _ := resource["properties"].(map[string]interface{})
+	return props
+}
+
+func errorCode(body map[string]interface{}) interface{} {
+	envelope, _ := body["error"].(map[string]interface{})
+	return envelope["code"]
+}
+
+var (
+	group  = "/subscriptions/" + SubscriptionID + "/resourceGroups/rpg-rg"
+	vnet   = group + "/providers/Microsoft.Network/virtualNetworks/rpg-vnet"
+	subnet = vnet + "/subnets/keyvault-subnet"
+)
+
+func TestMetadataAndToken(t *testing.T) {
+	t.Parallel()
+
+	c := newClient(t)
+	c.token = ""
+	_, env := c.do(http.MethodGet, c.server.URL+"/metadata/endpoints?api-version=2022-09-01", nil)
+	assert.Equal(t, EnvironmentName, env["name"])
+	assert.Equal(t, c.server.URL+"/", env["resourceManager"])
+
+	form := url.Values{
+		"grant_type":    {"client_credentials"},
+		"client_id":     {ClientID},
+		"client_secret": {ClientSecret},
+		"scope":         {c.server.URL + "/.default"},
+	}
+	resp, err := c.server.Client().PostForm(c.server.URL+"/"+TenantID+"/oauth2/v2.0/token", form)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var token struct {
+		AccessToken string `json:"access_token"`
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&token))
+	assert.Equal(t, c.server.Token(), token.AccessToken)
+
+	// The provider reads the tenant and object ID from the token's claims
+	parts := strings.Split(token.AccessToken, ".")
+	require.Len(t, parts, 3)
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	require.NoError(t, err)
+	var claims map[string]interface{}
+	require.NoError(t, json.Unmarshal(payload, &claims))
+	assert.Equal(t, TenantID, claims["tid"])
+	assert.Equal(t, ObjectID, claims["oid"])
+
+	form.Set("client_secret", "wrong")
+	resp, err = c.server.Client().PostForm(c.server.URL+"/"+TenantID+"/oauth2/v2.0/token", form)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+}
+
+func TestEnvVars(t *testing.T) {
+	t.Parallel()
+
+	server := NewServer(t)
+	vars := server.EnvVars()
+	assert.Equal(t, strings.TrimPrefix(server.URL, "https://"), vars["ARM_METADATA_HOSTNAME"])
+	assert.Equal(t, ClientSecret, vars["ARM_CLIENT_SECRET"])
+	assert.Equal(t, server.URL, vars["HTTPS_PROXY"])
+
+	bundle, err := os.ReadFile(vars["SSL_CERT_FILE"])
+	require.NoError(t, err)
+	assert.Contains(t, string(bundle), "-----BEGIN CERTIFICATE-----")
+
+	server.Close()
+	_, err = os.Stat(vars["SSL_CERT_FILE"])
+	assert.True(t, os.IsNotExist(err), "Close should remove the certificate bundle")
+}
+
+func TestResourceLifecycle(t *testing.T) {
+	t.Parallel()
+
+	c := newClient(t)
+	c.server.Polls = 2
+
+	rg := c.put(group, map[string]interface{}{"location": "Japan East", "tags": map[string]string{"env": "test"}})
+	assert.Equal(t, "japaneast", rg["location"])
+	assert.Equal(t, "Microsoft.Resources/resourceGroups", rg["type"])
+	_, groups := c.do(http.MethodGet, "/subscriptions/"+SubscriptionID+"/resourcegroups", nil)
+	value, _ := groups["value"].([]interface{})
+	require.Len(t, value, 1)
+	assert.Equal(t, group, value[0].(map[string]interface{})["id"])
+
+	resp, created := c.do(http.MethodPut, vnet, map[string]interface{}{
+		"location":   "japaneast",
+		"properties": map[string]interface{}{"addressSpace": map[string]interface{}{"addressPrefixes": []string{"172.16.0.0/16"}}},
+	})
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	assert.Equal(t, "Creating", properties(created)["provisioningState"])
+	assert.Equal(t, 3, c.wait(resp), "the operation should report InProgress Polls times")
+	_, got := c.do(http.MethodGet, vnet, nil)
+	assert.Equal(t, "Succeeded", properties(got)["provisioningState"])
+	assert.NotEmpty(t, properties(got)["resourceGuid"])
+
+	c.put(subnet, map[string]interface{}{"properties": map[string]interface{}{"addressPrefix": "172.16.3.0/24"}})
+	_, got = c.do(http.MethodGet, vnet, nil)
+	subnets, _ := properties(got)["subnets"].([]interface{})
+	require.Len(t, subnets, 1)
+	assert.Equal(t, subnet, subnets[0].(map[string]interface{})["id"])
+
+	endpoint := group + "/providers/Microsoft.Network/privateEndpoints/kv-pe"
+	pe := c.put(endpoint, map[string]interface{}{
+		"location": "japaneast",
+		"properties": map[string]interface{}{
+			"subnet": map[string]interface{}{"id": subnet},
+			"privateLinkServiceConnections": []interface{}{map[string]interface{}{
+				"name":       "kv-connection",
+				"properties": map[string]interface{}{"groupIds": []string{"vault"}},
+			}},
+		},
+	})
+	nics, _ := properties(pe)["networkInterfaces"].([]interface{})
+	require.Len(t, nics, 1)
+	nicID := nics[0].(map[string]interface{})["id"].(string)
+	_, nic := c.do(http.MethodGet, nicID, nil)
+	configs := properties(nic)["ipConfigurations"].([]interface{})
+	assert.Equal(t, "172.16.3.4", properties(configs[0].(map[string]interface{}))["privateIPAddress"],
+		"the first address after the four Azure reserves")
+
+	// Deleting the endpoint deletes its network interface
+	resp, _ = c.do(http.MethodDelete, endpoint, nil)
+	assert.Equal(t, http.StatusAccepted, resp.StatusCode)
+	c.wait(resp)
+	_, ok := c.server.Resource(nicID)
+	assert.False(t, ok)
+
+	// Deleting the resource group deletes everything in it
+	resp, _ = c.do(http.MethodDelete, group, nil)
+	assert.Equal(t, http.StatusAccepted, resp.StatusCode)
+	c.wait(resp)
+	assert.Empty(t, c.server.ResourceIDs())
+	resp, body := c.do(http.MethodGet, vnet, nil)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	assert.Equal(t, "ResourceGroupNotFound", errorCode(body))
+
+	resp, _ = c.do(http.MethodDelete, group, nil)
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode, "deleting what is gone succeeds")
+}
+
+func TestPatch(t *testing.T) {
+	t.Parallel()
+
+	c := newClient(t)
+	c.put(group, map[string]interface{}{"location": "japaneast"})
+	account := group + "/providers/Microsoft.Storage/storageAccounts/rpgstorage"
+	c.put(account, map[string]interface{}{
+		"location":   "japaneast",
+		"kind":       "StorageV2",
+		"properties": map[string]interface{}{"publicNetworkAccess": "Enabled", "minimumTlsVersion": "TLS1_2"},
+	})
+
+	resp, _ := c.do(http.MethodPatch, account, map[string]interface{}{
+		"properties": map[string]interface{}{"publicNetworkAccess": "Disabled"},
+	})
+	c.wait(resp)
+	_, got := c.do(http.MethodGet, account, nil)
+	assert.Equal(t, "Disabled", properties(got)["publicNetworkAccess"])
+	assert.Equal(t, "TLS1_2", properties(got)["minimumTlsVersion"])
+	assert.Equal(t, "StorageV2", got["kind"])
+}
+
+func TestPut(t *testing.T) {
+	t.Parallel()
+
+	c := newClient(t)
+	require.NoError(t, c.server.Put(group, map[string]interface{}{"location": "Japan East", "tags": map[string]string{"env": "test"}}))
+	require.NoError(t, c.server.Put(vnet, map[string]interface{}{"location": "japaneast"}))
+
+	_, got := c.do(http.MethodGet, vnet, nil)
+	assert.Equal(t, "Succeeded", properties(got)["provisioningState"], "Put should not leave an operation to poll")
+	rg, ok := c.server.Resource(group)
+	require.True(t, ok)
+	assert.Equal(t, "japaneast", rg["location"])
+	assert.Equal(t, map[string]interface{}{"env": "test"}, rg["tags"])
+
+	err := c.server.Put(group+"2/providers/Microsoft.Network/virtualNetworks/vnet", map[string]interface{}{"location": "japaneast"})
+	assert.ErrorContains(t, err, "Resource group 'rpg-rg2' could not be found.")
+}
+
+func TestErrors(t *testing.T) {
+	t.Parallel()
+
+	c := newClient(t)
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   interface{}
+		status int
+		code   string
+	}{
+		{"ResourceGroupNotFound", http.MethodPut, vnet, map[string]interface{}{"location": "japaneast"}, http.StatusNotFound, "ResourceGroupNotFound"},
+		{"LocationRequired", http.MethodPut, group, map[string]interface{}{}, http.StatusBadRequest, "LocationRequired"},
+		{"UnknownType", http.MethodGet, group + "/providers/Microsoft.Compute/virtualMachines/vm", nil, http.StatusBadRequest, "NoRegisteredProviderFound"},
+		{"OtherSubscription", http.MethodGet, "/subscriptions/other/resourceGroups/rg", nil, http.StatusNotFound, "SubscriptionNotFound"},
+	}
+	for _, tc := range tests {
+		resp, body := c.do(tc.method, tc.path, tc.body)
+		assert.Equal(t, tc.status, resp.StatusCode, tc.name)
+		assert.Equal(t, tc.code, errorCode(body), tc.name)
+	}
+
+	c.put(group, map[string]interface{}{"location": "japaneast"})
+	resp, body := c.do(http.MethodPut, subnet, map[string]interface{}{})
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	assert.Equal(t, "ParentResourceNotFound", errorCode(body))
+
+	resp, body = c.do(http.MethodPut, group+"/providers/Microsoft.Network/privateEndpoints/pe", map[string]interface{}{
+		"location":   "japaneast",
+		"properties": map[string]interface{}{"subnet": map[string]interface{}{"id": subnet}},
+	})
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	assert.Equal(t, "InvalidResourceReference", errorCode(body))
+
+	c.token = "not-issued"
+	resp, body = c.do(http.MethodGet, group, nil)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	assert.Equal(t, "AuthenticationFailed", errorCode(body))
+}
+
+func TestComputedProperties(t *testing.T) {
+	t.Parallel()
+
+	c := newClient(t)
+	c.put(group, map[string]interface{}{"location": "japaneast"})
+
+	vault := c.put(group+"/providers/Microsoft.KeyVault/vaults/rpg-kv", map[string]interface{}{
+		"location":   "japaneast",
+		"properties": map[string]interface{}{"tenantId": TenantID, "sku": map[string]string{"name": "standard", "family": "A"}},
+	})
+	assert.Equal(t, "https://rpg-kv.vault.azure.net/", properties(vault)["vaultUri"])
+
+	server := group + "/providers/Microsoft.Sql/servers/rpg-sql"
+	sql := c.put(server, map[string]interface{}{"location": "japaneast", "properties": map[string]interface{}{"version": "12.0"}})
+	assert.Equal(t, "rpg-sql.database.windows.net", properties(sql)["fullyQualifiedDomainName"])
+	database := c.put(server+"/databases/rpg-db", map[string]interface{}{"location": "japaneast", "sku": map[string]string{"name": "Basic"}})
+	assert.Equal(t, "Online", properties(database)["status"])
+	assert.Equal(t, "Basic", properties(database)["currentServiceObjectiveName"])
+
+	openAI := group + "/providers/Microsoft.CognitiveServices/accounts/rpg-openai"
+	account := c.put(openAI, map[string]interface{}{
+		"location":   "japaneast",
+		"kind":       "OpenAI",
+		"properties": map[string]interface{}{"customSubDomainName": "rpg-openai", "publicNetworkAccess": "Disabled"},
+	})
+	assert.Equal(t, "https://rpg-openai.openai.azure.com/", properties(account)["endpoint"])
+	_, keys := c.do(http.MethodPost, openAI+"/listKeys", nil)
+	assert.NotEmpty(t, keys["key1"])
+
+	site := group + "/providers/Microsoft.Web/staticSites/rpg-swa"
+	swa := c.put(site, map[string]interface{}{"location": "eastasia", "sku": map[string]string{"name": "Free"}})
+	assert.Regexp(t, `^armtest-[0-9a-f]{10}\.azurestaticapps\.net$`, properties(swa)["defaultHostname"])
+	_, secrets := c.do(http.MethodPost, site+"/listSecrets", nil)
+	assert.NotEmpty(t, properties(secrets)["apiKey"])
+
+	account2 := group + "/providers/Microsoft.Storage/storageAccounts/rpgstorage"
+	storage := c.put(account2, map[string]interface{}{"location": "japaneast", "kind": "StorageV2"})
+	endpoints, _ := properties(storage)["primaryEndpoints"].(map[string]interface{})
+	assert.Equal(t, "https://rpgstorage.blob.core.windows.net/", endpoints["blob"])
+	_, storageKeys := c.do(http.MethodPost, account2+"/listKeys", nil)
+	assert.Len(t, storageKeys["keys"], 2)
+
+	zone := group + "/providers/Microsoft.Network/privateDnsZones/privatelink.vaultcore.azure.net"
+	c.put(zone, map[string]interface{}{"location": "global"})
+	record := c.put(zone+"/A/rpg-kv", map[string]interface{}{"properties": map[string]interface{}{
+		"ttl":      300,
+		"aRecords": []interface{}{map[string]string{"ipv4Address": "172.16.3.4"}},
+	}})
+	assert.Equal(t, "rpg-kv.privatelink.vaultcore.azure.net.", properties(record)["fqdn"])
+	assert.EqualValues(t, 300, properties(record)["ttl"])
+
+	_, available := c.do(http.MethodPost, "/subscriptions/"+SubscriptionID+"/providers/Microsoft.KeyVault/checkNameAvailability",
+		map[string]string{"name": "rpg-kv", "type": "Microsoft.KeyVault/vaults"})
+	assert.Equal(t, false, available["nameAvailable"])
+
+	_, listed := c.do(http.MethodGet, group+"/resources", nil)
+	assert.Len(t, listed["value"], 6)
+}
+
+// TestTerraformApply applies and destroys the network fixture module tests
+// deploy into with the azurerm provider. It needs terraform and the provider
+// registry, so it is skipped with -short or without terraform on PATH.
+func TestTerraformApply(t *testing.T) {
+	if testing.Short() {
+		t.Skip("downloads the azurerm provider")
+	}
+	if _, err := exec.LookPath("terraform"); err != nil {
+		t.Skip("terraform is not on PATH")
+	}
+	t.Parallel()
+
+	server := NewServer(t)
+	server.RetryAfter = 0
+	terraformOptions := &terraform.Options{
+		TerraformDir: test_structure.CopyTerraformFolderToTemp(t, "../fixture", "network"),
+		Vars: map[string]interface{}{
+			"resource_group_name": "armtest-apply-rg",
+			"location":            "Japan East",
+		},
+		EnvVars: server.EnvVars(),
+		NoColor: true,
+	}
+	terraform.InitAndApply(t, terraformOptions)
+	applied := "/subscriptions/" + SubscriptionID + "/resourceGroups/armtest-apply-rg"
+	_, ok := server.Resource(applied + "/providers/Microsoft.Network/virtualNetworks/armtest-apply-rg-vnet/subnets/private-endpoint-subnet")
+	assert.True(t, ok, "the apply should create the subnets")
+
+	terraform.Destroy(t, terraformOptions)
+	assert.Empty(t, server.ResourceIDs())
+}
+
+// TestTerraformApplyStack applies and destroys the RPG AI App stack, whose
+// Key Vault secrets and Cloud Shell file share go through the data planes
+// the server answers as the provider's proxy. It is skipped as
+// TestTerraformApply is.
+func TestTerraformApplyStack(t *testing.T) {
+	if testing.Short() {
+		t.Skip("downloads the azurerm provider")
+	}
+	if _, err := exec.LookPath("terraform"); err != nil {
+		t.Skip("terraform is not on PATH")
+	}
+	t.Parallel()
+
+	server := NewServer(t)
+	server.RetryAfter = 0
+	terraformOptions := &terraform.Options{
+		TerraformDir: test_structure.CopyTerraformFolderToTemp(t, "../..", "rpg-aiapp-infra"),
+		Vars: map[string]interface{}{
+			"azurerm_resource_group_name": "armtest-stack-rg",
+			"caller_ip":                   callerip.Placeholder.String(),
+		},
+		EnvVars: server.EnvVars(),
+		NoColor: true,
+	}
+	terraform.InitAndApply(t, terraformOptions)
+	applied := "/subscriptions/" + SubscriptionID + "/resourceGroups/armtest-stack-rg"
+	_, ok := server.Resource(applied + "/providers/Microsoft.KeyVault/vaults/demo-rpgkv123")
+	require.True(t, ok, "the apply should create the vault")
+
+	c := &client{t: t, server: server, token: server.Token()}
+	_, secrets := c.do(http.MethodGet, "https://demo-rpgkv123.vault.azure.net/secrets?api-version="+vaultAPIVersion, nil)
+	assert.Len(t, secrets["value"], 6, "the apply should write the stack's secrets")
+
+	var storageAccount string
+	for _, id := range server.ResourceIDs() {
+		if prefix := applied + "/providers/Microsoft.Storage/storageAccounts/"; strings.HasPrefix(id, prefix) && !strings.Contains(id[len(prefix):], "/") {
+			storageAccount = id[len(prefix):]
+		}
+	}
+	require.NotEmpty(t, storageAccount, "the apply should create the Cloud Shell storage account")
+	resp, _ := c.raw(http.MethodGet, "https://"+storageAccount+".file.core.windows.net/cloudshell?restype=share",
+		http.Header{"Authorization": {"SharedKey " + storageAccount + ":signature"}}, "")
+	assert.Equal(t, http.StatusOK, resp.StatusCode, "the apply should create the Cloud Shell share")
+	assert.Equal(t, "6", resp.Header.Get("x-ms-share-quota"))
+
+	terraform.Destroy(t, terraformOptions)
+	assert.Empty(t, server.ResourceIDs())
+}
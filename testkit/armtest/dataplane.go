@@ -0,0 +1,233 @@
+package armtest
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// vaultSuffix is the host suffix of a vault's data plane
+const vaultSuffix = ".vault.azure.net"
+
+// dataPlaneSuffixes are the hosts, after a vault or storage account name,
+// the server answers itself when asked to CONNECT to them
+var dataPlaneSuffixes = []string{
+	vaultSuffix,
+	".blob.core.windows.net",
+	".dfs.core.windows.net",
+	".file.core.windows.net",
+	".queue.core.windows.net",
+	".table.core.windows.net",
+	".web.core.windows.net",
+}
+
+// dataPlaneHost returns the vault or account name in host and the suffix
+// after it, and whether the server serves the host
+func dataPlaneHost(host string) (name, suffix string, ok bool) {
+	host = strings.ToLower(host)
+	if h, port, err := net.SplitHostPort(host); err == nil {
+		if port != "443" {
+			return "", "", false
+		}
+		host = h
+	}
+	for _, suffix := range dataPlaneSuffixes {
+		name := strings.TrimSuffix(host, suffix)
+		if name != host && name != "" && !strings.Contains(name, ".") {
+			return name, suffix, true
+		}
+	}
+	return "", "", false
+}
+
+// newDataPlaneCertificate returns a self-signed certificate for every host
+// in dataPlaneSuffixes
+func newDataPlaneCertificate() (tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 62))
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{Organization: []string{"armtest"}, CommonName: "armtest data plane"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(7 * 24 * time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	for _, suffix := range dataPlaneSuffixes {
+		template.DNSNames = append(template.DNSNames, "*"+suffix)
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}, nil
+}
+
+// startDataPlane serves the data-plane hosts on the connections proxy hands
+// over, with the data-plane certificate
+func (s *Server) startDataPlane() error {
+	cert, err := newDataPlaneCertificate()
+	if err != nil {
+		return err
+	}
+	s.dataPlaneCert = cert
+	s.tunnels = &tunnelListener{addr: s.Listener.Addr(), conns: make(chan net.Conn), closed: make(chan struct{})}
+	s.dataPlane = &http.Server{
+		Handler:   http.HandlerFunc(s.serveDataPlane),
+		TLSConfig: &tls.Config{Certificates: []tls.Certificate{cert}},
+	}
+	go func() { _ = s.dataPlane.ServeTLS(s.tunnels, "", "") }()
+	return nil
+}
+
+// proxy answers a CONNECT request. A data-plane host is served by the server
+// itself; any other, such as the Terraform registry, is tunnelled to as is.
+func (s *Server) proxy(w http.ResponseWriter, r *http.Request) {
+	var upstream net.Conn
+	if _, _, ok := dataPlaneHost(r.Host); !ok {
+		conn, err := net.DialTimeout("tcp", r.Host, 30*time.Second)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		upstream = conn
+	}
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		if upstream != nil {
+			upstream.Close()
+		}
+		http.Error(w, "armtest cannot tunnel over this connection", http.StatusInternalServerError)
+		return
+	}
+	conn, buffered, err := hijacker.Hijack()
+	if err != nil {
+		if upstream != nil {
+			upstream.Close()
+		}
+		return
+	}
+	if _, err := conn.Write([]byte("HTTP/1.1 200 Connection established\r\n\r\n")); err != nil {
+		conn.Close()
+		if upstream != nil {
+			upstream.Close()
+		}
+		return
+	}
+	client := &bufferedConn{Conn: conn, reader: buffered.Reader}
+	if upstream == nil {
+		s.tunnels.hand(client)
+		return
+	}
+	go func() {
+		_, _ = io.Copy(upstream, client)
+		upstream.Close()
+		client.Close()
+	}()
+	go func() {
+		_, _ = io.Copy(client, upstream)
+		upstream.Close()
+		client.Close()
+	}()
+}
+
+// serveDataPlane routes a request that came through proxy by its host
+func (s *Server) serveDataPlane(w http.ResponseWriter, r *http.Request) {
+	name, suffix, ok := dataPlaneHost(r.Host)
+	switch {
+	case !ok:
+		http.Error(w, "armtest does not serve "+r.Host, http.StatusNotFound)
+	case suffix == vaultSuffix:
+		s.serveVault(w, r, name)
+	default:
+		s.serveStorage(w, r, name, strings.TrimSuffix(strings.TrimPrefix(suffix, "."), ".core.windows.net"))
+	}
+}
+
+// Client returns an HTTP client that trusts the server's certificates and,
+// like Terraform run with EnvVars, reaches the data-plane hosts through it
+func (s *Server) Client() *http.Client {
+	roots := x509.NewCertPool()
+	roots.AddCert(s.Certificate())
+	roots.AddCert(s.dataPlaneCert.Leaf)
+	proxyURL, _ := url.Parse(s.URL)
+	return &http.Client{Transport: &http.Transport{
+		Proxy: func(r *http.Request) (*url.URL, error) {
+			if _, _, ok := dataPlaneHost(r.URL.Host); ok {
+				return proxyURL, nil
+			}
+			return nil, nil
+		},
+		TLSClientConfig: &tls.Config{RootCAs: roots},
+	}}
+}
+
+// tunnelListener accepts the connections proxy hands to the data plane
+type tunnelListener struct {
+	addr   net.Addr
+	conns  chan net.Conn
+	closed chan struct{}
+	once   sync.Once
+}
+
+func (l *tunnelListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case <-l.closed:
+		return nil, net.ErrClosed
+	}
+}
+
+func (l *tunnelListener) Close() error {
+	l.once.Do(func() { close(l.closed) })
+	return nil
+}
+
+func (l *tunnelListener) Addr() net.Addr {
+	return l.addr
+}
+
+// hand passes conn to Accept, or closes it once the listener is closed
+func (l *tunnelListener) hand(conn net.Conn) {
+	select {
+	case l.conns <- conn:
+	case <-l.closed:
+		conn.Close()
+	}
+}
+
+// bufferedConn reads what the server buffered before the tunnel was
+// hijacked, then the connection
+type bufferedConn struct {
+	net.Conn
+	reader *bufio.Reader
+}
+
+func (c *bufferedConn) Read(p []byte) (int, error) {
+	return c.reader.Read(p)
+}
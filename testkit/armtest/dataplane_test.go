@@ -0,0 +1,264 @@
+package armtest
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const vaultAPIVersion = "7.4"
+
+var (
+	vault   = group + "/providers/Microsoft.KeyVault/vaults/rpg-kv"
+	account = group + "/providers/Microsoft.Storage/storageAccounts/rpgstorage"
+)
+
+// secretURL returns the URL of a path in the rpg-kv vault's data plane
+func secretURL(path string) string {
+	return "https://rpg-kv.vault.azure.net/" + path + "?api-version=" + vaultAPIVersion
+}
+
+// raw sends body to target with header, and returns the status and body
+func (c *client) raw(method, target string, header http.Header, body string) (*http.Response, string) {
+	c.t.Helper()
+	req, err := http.NewRequest(method, target, strings.NewReader(body))
+	require.NoError(c.t, err)
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	resp, err := c.server.Client().Do(req)
+	require.NoError(c.t, err)
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	require.NoError(c.t, err)
+	return resp, string(data)
+}
+
+func newVault(c *client) {
+	c.t.Helper()
+	c.put(group, map[string]interface{}{"location": "japaneast"})
+	c.put(vault, map[string]interface{}{
+		"location":   "japaneast",
+		"properties": map[string]interface{}{"tenantId": TenantID, "sku": map[string]string{"family": "A", "name": "standard"}},
+	})
+}
+
+func TestVaultSecrets(t *testing.T) {
+	t.Parallel()
+
+	c := newClient(t)
+	newVault(c)
+
+	// Key Vault challenges a request without a token, as the provider's
+	// check that a new vault is reachable expects
+	resp, _ := c.raw(http.MethodGet, secretURL("secrets"), nil, "")
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	assert.Contains(t, resp.Header.Get("WWW-Authenticate"), "Bearer authorization=")
+
+	resp, set := c.do(http.MethodPut, secretURL("secrets/sql-password"), map[string]interface{}{
+		"value":       "s3cret",
+		"contentType": "password",
+	})
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	id, _ := set["id"].(string)
+	assert.Regexp(t, `^https://rpg-kv\.vault\.azure\.net/secrets/sql-password/[0-9a-f]{32}$`, id)
+
+	_, got := c.do(http.MethodGet, secretURL("secrets/sql-password/"), nil)
+	assert.Equal(t, "s3cret", got["value"])
+	assert.Equal(t, "password", got["contentType"])
+	_, version := c.do(http.MethodGet, id+"?api-version="+vaultAPIVersion, nil)
+	assert.Equal(t, "s3cret", version["value"])
+
+	_, listed := c.do(http.MethodGet, secretURL("secrets"), nil)
+	items, _ := listed["value"].([]interface{})
+	require.Len(t, items, 1)
+	assert.Equal(t, "https://rpg-kv.vault.azure.net/secrets/sql-password", items[0].(map[string]interface{})["id"])
+	assert.NotContains(t, items[0], "value", "a list should not return values")
+
+	// A deleted secret is kept until it is purged
+	resp, deleted := c.do(http.MethodDelete, secretURL("secrets/sql-password"), nil)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "https://rpg-kv.vault.azure.net/deletedsecrets/sql-password", deleted["recoveryId"])
+	resp, missing := c.do(http.MethodGet, secretURL("secrets/sql-password"), nil)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	assert.Equal(t, "SecretNotFound", errorCode(missing))
+	resp, _ = c.do(http.MethodPut, secretURL("secrets/sql-password"), map[string]interface{}{"value": "again"})
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+	resp, _ = c.do(http.MethodGet, secretURL("deletedsecrets/sql-password"), nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	resp, _ = c.do(http.MethodDelete, secretURL("deletedsecrets/sql-password"), nil)
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+	resp, _ = c.do(http.MethodGet, secretURL("deletedsecrets/sql-password"), nil)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	resp, _ = c.do(http.MethodPut, secretURL("secrets/sql-password"), map[string]interface{}{"value": "again"})
+	assert.Equal(t, http.StatusOK, resp.StatusCode, "a purged secret's name should be free")
+
+	resp, _ = c.do(http.MethodGet, "https://other-kv.vault.azure.net/secrets?api-version="+vaultAPIVersion, nil)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode, "only vaults the server holds should answer")
+}
+
+func TestDeletedVault(t *testing.T) {
+	t.Parallel()
+
+	c := newClient(t)
+	newVault(c)
+	c.do(http.MethodPut, secretURL("secrets/kept"), map[string]interface{}{"value": "v1"})
+
+	resp, _ := c.do(http.MethodDelete, vault, nil)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	deletedVault := "/subscriptions/" + SubscriptionID + "/providers/Microsoft.KeyVault/locations/japaneast/deletedVaults/rpg-kv"
+	_, got := c.do(http.MethodGet, deletedVault, nil)
+	assert.Equal(t, vault, properties(got)["vaultId"])
+
+	body := map[string]interface{}{"location": "japaneast", "properties": map[string]interface{}{"tenantId": TenantID}}
+	resp, conflict := c.do(http.MethodPut, vault, body)
+	assert.Equal(t, http.StatusConflict, resp.StatusCode, "a deleted vault's name should stay taken")
+	assert.Equal(t, "ConflictError", errorCode(conflict))
+
+	// Recovering brings the secrets back
+	body["properties"].(map[string]interface{})["createMode"] = "recover"
+	c.put(vault, body)
+	_, secret := c.do(http.MethodGet, secretURL("secrets/kept"), nil)
+	assert.Equal(t, "v1", secret["value"])
+
+	c.do(http.MethodDelete, vault, nil)
+	resp, _ = c.do(http.MethodPost, deletedVault+"/purge", nil)
+	require.Equal(t, http.StatusAccepted, resp.StatusCode)
+	for location := resp.Header.Get("Location"); ; {
+		_, status := c.do(http.MethodGet, location, nil)
+		if status["status"] != "InProgress" {
+			require.Equal(t, "Succeeded", status["status"])
+			break
+		}
+	}
+	resp, _ = c.do(http.MethodGet, deletedVault, nil)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	c.put(vault, map[string]interface{}{"location": "japaneast", "properties": map[string]interface{}{"tenantId": TenantID}})
+	resp, _ = c.do(http.MethodGet, secretURL("secrets/kept"), nil)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode, "purging should drop the secrets")
+}
+
+func TestStorageDataPlane(t *testing.T) {
+	t.Parallel()
+
+	c := newClient(t)
+	c.put(group, map[string]interface{}{"location": "japaneast"})
+	c.put(account, map[string]interface{}{"location": "japaneast", "kind": "StorageV2"})
+	sharedKey := http.Header{"Authorization": {"SharedKey rpgstorage:signature"}}
+
+	// Azure creates the services with the account
+	_, blob := c.do(http.MethodGet, account+"/blobServices/default", nil)
+	assert.Equal(t, false, properties(blob)["isVersioningEnabled"])
+	_, file := c.do(http.MethodGet, account+"/fileServices/default", nil)
+	assert.NotNil(t, properties(file)["shareDeleteRetentionPolicy"])
+
+	serviceProperties := "https://rpgstorage.queue.core.windows.net/?restype=service&comp=properties"
+	resp, body := c.raw(http.MethodGet, serviceProperties, nil, "")
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	assert.Contains(t, body, "<Code>AuthenticationFailed</Code>")
+	resp, body = c.raw(http.MethodGet, serviceProperties, sharedKey, "")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Contains(t, body, "<HourMetrics>")
+	_, body = c.raw(http.MethodGet, strings.Replace(serviceProperties, ".queue.", ".blob.", 1), sharedKey, "")
+	assert.Contains(t, body, "<StaticWebsite><Enabled>false</Enabled></StaticWebsite>")
+
+	set := `<?xml version="1.0" encoding="utf-8"?><StorageServiceProperties><Cors /></StorageServiceProperties>`
+	resp, _ = c.raw(http.MethodPut, serviceProperties, sharedKey, set)
+	assert.Equal(t, http.StatusAccepted, resp.StatusCode)
+	_, body = c.raw(http.MethodGet, serviceProperties, sharedKey, "")
+	assert.Equal(t, set, body)
+
+	share := "https://rpgstorage.file.core.windows.net/cloudshell?restype=share"
+	create := http.Header{"Authorization": sharedKey["Authorization"], "X-Ms-Share-Quota": {"6"}, "X-Ms-Meta-Owner": {"rpg"}}
+	resp, _ = c.raw(http.MethodPut, share, create, "")
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	resp, body = c.raw(http.MethodPut, share, create, "")
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+	assert.Contains(t, body, "ShareAlreadyExists")
+	resp, _ = c.raw(http.MethodGet, share, sharedKey, "")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "6", resp.Header.Get("x-ms-share-quota"))
+	assert.Equal(t, "rpg", resp.Header.Get("x-ms-meta-owner"))
+	_, body = c.raw(http.MethodGet, share+"&comp=acl", sharedKey, "")
+	assert.Contains(t, body, "<SignedIdentifiers />")
+
+	resp, _ = c.raw(http.MethodDelete, share, sharedKey, "")
+	assert.Equal(t, http.StatusAccepted, resp.StatusCode)
+	resp, body = c.raw(http.MethodGet, share, sharedKey, "")
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	assert.Contains(t, body, "ShareNotFound")
+
+	// Deleting the account drops its data plane with it
+	c.raw(http.MethodPut, share, create, "")
+	c.do(http.MethodDelete, account, nil)
+	c.put(account, map[string]interface{}{"location": "japaneast", "kind": "StorageV2"})
+	resp, _ = c.raw(http.MethodGet, share, sharedKey, "")
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func TestSubscriptionLists(t *testing.T) {
+	t.Parallel()
+
+	c := newClient(t)
+	newVault(c)
+	c.put(account, map[string]interface{}{"location": "japaneast", "kind": "StorageV2"})
+	subscription := c.server.URL + "/subscriptions/" + SubscriptionID
+
+	// The provider finds a vault from its URI by type and name
+	filter := url.QueryEscape("resourceType eq 'Microsoft.KeyVault/vaults' and name eq 'rpg-kv'")
+	_, found := c.do(http.MethodGet, subscription+"/resources?api-version="+apiVersion+"&$filter="+filter, nil)
+	value, _ := found["value"].([]interface{})
+	require.Len(t, value, 1)
+	assert.Equal(t, vault, value[0].(map[string]interface{})["id"])
+
+	_, all := c.do(http.MethodGet, subscription+"/resources?api-version="+apiVersion, nil)
+	assert.Len(t, all["value"], 6, "the vault, the account and its four services")
+
+	resp, bad := c.do(http.MethodGet, subscription+"/resources?api-version="+apiVersion+"&$filter="+url.QueryEscape("tagName eq 'env'"), nil)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	assert.Equal(t, "InvalidFilterInQueryString", errorCode(bad))
+
+	// and a storage account by listing the subscription's accounts
+	_, accounts := c.do(http.MethodGet, "/subscriptions/"+SubscriptionID+"/providers/Microsoft.Storage/storageAccounts", nil)
+	value, _ = accounts["value"].([]interface{})
+	require.Len(t, value, 1)
+	assert.Equal(t, account, value[0].(map[string]interface{})["id"])
+}
+
+func TestProxyTunnelsOtherHosts(t *testing.T) {
+	t.Parallel()
+
+	server := NewServer(t)
+	upstream := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "upstream")
+	}))
+	defer upstream.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(server.Certificate())
+	roots.AddCert(upstream.Certificate())
+	proxyURL, err := url.Parse(server.URL)
+	require.NoError(t, err)
+	client := &http.Client{Transport: &http.Transport{
+		Proxy:           http.ProxyURL(proxyURL),
+		TLSClientConfig: &tls.Config{RootCAs: roots},
+	}}
+
+	resp, err := client.Get(upstream.URL)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, "upstream", string(body), "the server should tunnel to hosts it does not serve")
+}
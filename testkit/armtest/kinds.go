@@ -0,0 +1,426 @@
+package armtest
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/netip"
+	"strings"
+	"time"
+)
+
+// kind is a resource type the server implements
+type kind struct {
+	// typ is the resource type as Resource Manager spells it
+	typ string
+	// asyncWrite and asyncDelete answer PUT and PATCH, or DELETE, with an
+	// operation to poll, as Resource Manager does for the slow types
+	asyncWrite, asyncDelete bool
+	// embed maps a property to the child type a GET returns in it, and a PUT
+	// may create through it
+	embed map[string]string
+	// create validates a new resource and fills its read-only properties and
+	// secrets. It runs with the server locked, before the resource is stored.
+	create func(s *Server, r *resource) error
+	// deleted runs with the server locked as the resource is removed, to drop
+	// or keep what the server holds for it outside resources
+	deleted func(s *Server, r *resource)
+	// defaults are the children Azure creates with the resource, such as a
+	// storage account's blobServices/default, by type and name, with the body
+	// each starts with
+	defaults map[string]func() map[string]interface{}
+	// actions answer POST requests to the resource, by lower-case name
+	actions map[string]func(s *Server, r *resource) interface{}
+}
+
+// Resource types that refer to each other
+const (
+	subnetType           = "Microsoft.Network/virtualNetworks/subnets"
+	networkInterfaceType = "Microsoft.Network/networkInterfaces"
+)
+
+// kinds holds every implemented type by lower-case type
+var kinds = map[string]*kind{}
+
+func init() {
+	for _, k := range []*kind{
+		{typ: resourceGroupType, asyncDelete: true, create: requireLocation},
+		{
+			typ: "Microsoft.Network/virtualNetworks", asyncWrite: true, asyncDelete: true,
+			embed:  map[string]string{"subnets": subnetType},
+			create: setComputed(func(r *resource) map[string]interface{} { return map[string]interface{}{"resourceGuid": newUUID()} }),
+		},
+		{typ: subnetType, asyncWrite: true, asyncDelete: true},
+		{typ: networkInterfaceType, asyncWrite: true, asyncDelete: true, create: createNetworkInterface},
+		{typ: "Microsoft.Network/privateEndpoints", asyncWrite: true, asyncDelete: true, create: createPrivateEndpoint},
+		{typ: "Microsoft.Network/privateEndpoints/privateDnsZoneGroups", asyncWrite: true, asyncDelete: true},
+		{
+			typ: "Microsoft.Network/privateDnsZones", asyncWrite: true, asyncDelete: true,
+			create: setComputed(func(r *resource) map[string]interface{} {
+				return map[string]interface{}{
+					"numberOfRecordSets":                             1,
+					"maxNumberOfRecordSets":                          25000,
+					"maxNumberOfVirtualNetworkLinks":                 1000,
+					"maxNumberOfVirtualNetworkLinksWithRegistration": 100,
+				}
+			}),
+		},
+		{
+			typ: "Microsoft.Network/privateDnsZones/virtualNetworkLinks", asyncWrite: true, asyncDelete: true,
+			create: setComputed(func(r *resource) map[string]interface{} {
+				return map[string]interface{}{"virtualNetworkLinkState": "Completed"}
+			}),
+		},
+		{typ: "Microsoft.Network/privateDnsZones/A", create: createRecordSet},
+		{typ: "Microsoft.KeyVault/vaults", create: createVault, deleted: deleteVault},
+		{
+			typ: storageAccountType, asyncWrite: true,
+			create:  createStorageAccount,
+			deleted: deleteStorageAccount,
+			defaults: map[string]func() map[string]interface{}{
+				"blobServices/default": withProperties(map[string]interface{}{
+					"cors":                           map[string]interface{}{"corsRules": []interface{}{}},
+					"deleteRetentionPolicy":          map[string]interface{}{"enabled": false},
+					"containerDeleteRetentionPolicy": map[string]interface{}{"enabled": false},
+					"isVersioningEnabled":            false,
+					"changeFeed":                     map[string]interface{}{"enabled": false},
+				}),
+				"fileServices/default": withProperties(map[string]interface{}{
+					"cors":                       map[string]interface{}{"corsRules": []interface{}{}},
+					"shareDeleteRetentionPolicy": map[string]interface{}{"enabled": true, "days": 7},
+				}),
+				"queueServices/default": withProperties(map[string]interface{}{"cors": map[string]interface{}{"corsRules": []interface{}{}}}),
+				"tableServices/default": withProperties(map[string]interface{}{"cors": map[string]interface{}{"corsRules": []interface{}{}}}),
+			},
+			actions: map[string]func(s *Server, r *resource) interface{}{"listkeys": listStorageKeys},
+		},
+		{typ: storageAccountType + "/blobServices"},
+		{typ: storageAccountType + "/fileServices"},
+		{typ: storageAccountType + "/fileServices/shares"},
+		{typ: storageAccountType + "/queueServices"},
+		{typ: storageAccountType + "/tableServices"},
+		{
+			typ: "Microsoft.Sql/servers", asyncWrite: true, asyncDelete: true,
+			create: setComputed(func(r *resource) map[string]interface{} {
+				return map[string]interface{}{
+					"fullyQualifiedDomainName": r.name + ".database.windows.net",
+					"state":                    "Ready",
+				}
+			}),
+			defaults: map[string]func() map[string]interface{}{
+				"connectionPolicies/default": withProperties(map[string]interface{}{"connectionType": "Default"}),
+			},
+		},
+		{typ: "Microsoft.Sql/servers/connectionPolicies"},
+		{typ: "Microsoft.Sql/servers/administrators"},
+		{typ: "Microsoft.Sql/servers/azureADOnlyAuthentications"},
+		{typ: "Microsoft.Sql/servers/firewallRules"},
+		{typ: "Microsoft.Sql/servers/virtualNetworkRules", asyncWrite: true, asyncDelete: true},
+		{typ: "Microsoft.Sql/servers/restorableDroppedDatabases"},
+		{
+			typ: "Microsoft.Sql/servers/databases", asyncWrite: true, asyncDelete: true,
+			create: createDatabase,
+			defaults: map[string]func() map[string]interface{}{
+				"transparentDataEncryption/current": withProperties(map[string]interface{}{"state": "Enabled"}),
+				"securityAlertPolicies/default": withProperties(map[string]interface{}{
+					"state":              "Disabled",
+					"emailAccountAdmins": false,
+					"retentionDays":      0,
+				}),
+				"backupShortTermRetentionPolicies/default": withProperties(map[string]interface{}{"retentionDays": 7, "diffBackupIntervalInHours": 12}),
+				"backupLongTermRetentionPolicies/default": withProperties(map[string]interface{}{
+					"weeklyRetention":  "PT0S",
+					"monthlyRetention": "PT0S",
+					"yearlyRetention":  "PT0S",
+					"weekOfYear":       1,
+				}),
+				"geoBackupPolicies/Geo":            withProperties(map[string]interface{}{"state": "Enabled"}),
+				"extendedAuditingSettings/default": withProperties(map[string]interface{}{"state": "Disabled"}),
+			},
+		},
+		{typ: "Microsoft.Sql/servers/databases/transparentDataEncryption"},
+		{typ: "Microsoft.Sql/servers/databases/securityAlertPolicies"},
+		{typ: "Microsoft.Sql/servers/databases/backupShortTermRetentionPolicies", asyncWrite: true},
+		{typ: "Microsoft.Sql/servers/databases/backupLongTermRetentionPolicies", asyncWrite: true},
+		{typ: "Microsoft.Sql/servers/databases/geoBackupPolicies"},
+		{typ: "Microsoft.Sql/servers/databases/extendedAuditingSettings"},
+		{typ: "Microsoft.Sql/servers/databases/replicationLinks"},
+		{
+			typ: "Microsoft.CognitiveServices/accounts", asyncWrite: true, asyncDelete: true,
+			create:  createCognitiveAccount,
+			actions: map[string]func(s *Server, r *resource) interface{}{"listkeys": listCognitiveKeys},
+		},
+		{typ: "Microsoft.CognitiveServices/accounts/deployments", asyncWrite: true, asyncDelete: true},
+		{
+			typ: "Microsoft.Web/staticSites", asyncWrite: true, asyncDelete: true,
+			create: createStaticSite,
+			actions: map[string]func(s *Server, r *resource) interface{}{
+				"listsecrets":     listStaticSiteSecrets,
+				"listappsettings": listStaticSiteAppSettings,
+			},
+		},
+		{typ: "Microsoft.Web/staticSites/config"},
+		{typ: "Microsoft.Web/staticSites/basicAuth"},
+	} {
+		kinds[key(k.typ)] = k
+	}
+}
+
+// setComputed returns a create function that sets the read-only properties
+// computed returns
+func setComputed(computed func(r *resource) map[string]interface{}) func(s *Server, r *resource) error {
+	return func(s *Server, r *resource) error {
+		for k, v := range computed(r) {
+			r.computed[k] = v
+		}
+		return nil
+	}
+}
+
+// withProperties returns a body function for a default child with props
+func withProperties(props map[string]interface{}) func() map[string]interface{} {
+	return func() map[string]interface{} {
+		// Round-trip props, so no two children share a map
+		data, _ := json.Marshal(props)
+		body := map[string]interface{}{}
+		_ = json.Unmarshal(data, &body)
+		return map[string]interface{}{"properties": body}
+	}
+}
+
+func requireLocation(s *Server, r *resource) error {
+	if r.location() == "" {
+		return &armError{http.StatusBadRequest, "LocationRequired", "The location property is required for this definition."}
+	}
+	return nil
+}
+
+// createNetworkInterface gives every IP configuration without an address
+// the next free one in its subnet
+func createNetworkInterface(s *Server, r *resource) error {
+	configs, _ := r.properties()["ipConfigurations"].([]interface{})
+	for _, item := range configs {
+		config, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		name, _ := config["name"].(string)
+		config["id"] = r.id + "/ipConfigurations/" + name
+		props, _ := config["properties"].(map[string]interface{})
+		if props == nil {
+			continue
+		}
+		if address, _ := props["privateIPAddress"].(string); address != "" {
+			continue
+		}
+		address, err := s.allocateIP(idOf(props["subnet"]))
+		if err != nil {
+			return err
+		}
+		props["privateIPAddress"] = address
+		props["privateIPAddressVersion"] = "IPv4"
+	}
+	r.computed["macAddress"] = strings.ToUpper(strings.Join(splitPairs(randomHex(6)), "-"))
+	return nil
+}
+
+// createPrivateEndpoint creates the network interface Azure gives a private
+// endpoint, with the next free address in its subnet, and approves its
+// connections
+func createPrivateEndpoint(s *Server, r *resource) error {
+	subnetID := idOf(r.properties()["subnet"])
+	address, err := s.allocateIP(subnetID)
+	if err != nil {
+		return err
+	}
+
+	nicName := fmt.Sprintf("%s.nic.%s", r.name, newUUID())
+	nicID := r.id[:strings.Index(key(r.id), "/providers/")] + "/providers/" + networkInterfaceType + "/" + nicName
+	s.resources[key(nicID)] = &resource{
+		id: nicID, name: nicName, kind: kinds[key(networkInterfaceType)],
+		parent: r.parent, owner: key(r.id), state: "Succeeded",
+		body: map[string]interface{}{
+			"location": r.location(),
+			"properties": map[string]interface{}{
+				"ipConfigurations": []interface{}{map[string]interface{}{
+					"id":   nicID + "/ipConfigurations/privateEndpointIpConfig",
+					"name": "privateEndpointIpConfig",
+					"properties": map[string]interface{}{
+						"privateIPAddress":          address,
+						"privateIPAllocationMethod": "Dynamic",
+						"privateIPAddressVersion":   "IPv4",
+						"subnet":                    map[string]interface{}{"id": subnetID},
+					},
+				}},
+			},
+		},
+		computed: map[string]interface{}{}, secrets: map[string]string{},
+	}
+
+	r.computed["networkInterfaces"] = []interface{}{map[string]interface{}{"id": nicID}}
+	r.computed["customDnsConfigs"] = []interface{}{map[string]interface{}{"ipAddresses": []interface{}{address}}}
+	for _, property := range []string{"privateLinkServiceConnections", "manualPrivateLinkServiceConnections"} {
+		connections, _ := r.properties()[property].([]interface{})
+		for _, item := range connections {
+			connection, _ := item.(map[string]interface{})
+			if props, ok := connection["properties"].(map[string]interface{}); ok {
+				props["privateLinkServiceConnectionState"] = map[string]interface{}{
+					"status":          "Approved",
+					"description":     "Auto-Approved",
+					"actionsRequired": "None",
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// createRecordSet sets the FQDN of a record set from its zone
+func createRecordSet(s *Server, r *resource) error {
+	zone := s.resources[r.parent]
+	r.computed["fqdn"] = r.name + "." + zone.name + "."
+	r.computed["isAutoRegistered"] = false
+	return nil
+}
+
+func createStorageAccount(s *Server, r *resource) error {
+	if err := requireLocation(s, r); err != nil {
+		return err
+	}
+	endpoints := map[string]interface{}{}
+	for _, service := range []string{"blob", "dfs", "file", "queue", "table", "web"} {
+		endpoints[service] = fmt.Sprintf("https://%s.%s.core.windows.net/", r.name, service)
+	}
+	r.computed["primaryEndpoints"] = endpoints
+	r.computed["primaryLocation"] = r.location()
+	r.computed["statusOfPrimary"] = "available"
+	r.computed["creationTime"] = time.Now().UTC().Format(time.RFC3339)
+	r.secrets["key1"], r.secrets["key2"] = newKey(), newKey()
+	return nil
+}
+
+func listStorageKeys(s *Server, r *resource) interface{} {
+	keys := []interface{}{}
+	for _, name := range []string{"key1", "key2"} {
+		keys = append(keys, map[string]interface{}{"keyName": name, "value": r.secrets[name], "permissions": "FULL"})
+	}
+	return map[string]interface{}{"keys": keys}
+}
+
+func createDatabase(s *Server, r *resource) error {
+	r.computed["status"] = "Online"
+	r.computed["databaseId"] = newUUID()
+	r.computed["creationDate"] = time.Now().UTC().Format(time.RFC3339)
+	if sku, ok := r.body["sku"].(map[string]interface{}); ok {
+		r.computed["currentServiceObjectiveName"] = sku["name"]
+	}
+	return nil
+}
+
+// createCognitiveAccount sets the endpoint Azure derives from the custom
+// subdomain and kind, such as https://name.openai.azure.com/ for OpenAI
+func createCognitiveAccount(s *Server, r *resource) error {
+	if err := requireLocation(s, r); err != nil {
+		return err
+	}
+	endpoint := fmt.Sprintf("https://%s.api.cognitive.microsoft.com/", r.location())
+	if subdomain, _ := r.properties()["customSubDomainName"].(string); subdomain != "" {
+		endpoint = fmt.Sprintf("https://%s.cognitiveservices.azure.com/", subdomain)
+		if kind, _ := r.body["kind"].(string); kind == "OpenAI" {
+			endpoint = fmt.Sprintf("https://%s.openai.azure.com/", subdomain)
+		}
+	}
+	r.computed["endpoint"] = endpoint
+	r.computed["internalId"] = randomHex(16)
+	r.secrets["key1"], r.secrets["key2"] = randomHex(16), randomHex(16)
+	return nil
+}
+
+func listCognitiveKeys(s *Server, r *resource) interface{} {
+	return map[string]interface{}{"key1": r.secrets["key1"], "key2": r.secrets["key2"]}
+}
+
+func createStaticSite(s *Server, r *resource) error {
+	r.computed["defaultHostname"] = fmt.Sprintf("armtest-%s.azurestaticapps.net", randomHex(5))
+	r.secrets["apiKey"] = randomHex(32)
+	return nil
+}
+
+func listStaticSiteSecrets(s *Server, r *resource) interface{} {
+	return map[string]interface{}{
+		"id":         r.id + "/secrets",
+		"name":       "secrets",
+		"properties": map[string]interface{}{"apiKey": r.secrets["apiKey"]},
+	}
+}
+
+// listStaticSiteAppSettings returns the settings last PUT to config/appsettings
+func listStaticSiteAppSettings(s *Server, r *resource) interface{} {
+	settings := map[string]interface{}{}
+	if config, ok := s.resources[key(r.id+"/config/appsettings")]; ok {
+		settings = config.properties()
+	}
+	return map[string]interface{}{
+		"id":         r.id + "/config/appsettings",
+		"name":       "appsettings",
+		"properties": settings,
+	}
+}
+
+// allocateIP returns the next free address in a subnet, after the first
+// four, which Azure reserves
+func (s *Server) allocateIP(subnetID string) (string, error) {
+	subnet, ok := s.resources[key(subnetID)]
+	if !ok || subnet.kind.typ != subnetType {
+		return "", &armError{http.StatusBadRequest, "InvalidResourceReference", fmt.Sprintf("Subnet '%s' referenced by the request was not found.", subnetID)}
+	}
+	props := subnet.properties()
+	prefixText, _ := props["addressPrefix"].(string)
+	if list, ok := props["addressPrefixes"].([]interface{}); prefixText == "" && ok && len(list) > 0 {
+		prefixText, _ = list[0].(string)
+	}
+	prefix, err := netip.ParsePrefix(prefixText)
+	if err != nil || !prefix.Addr().Is4() {
+		return "", &armError{http.StatusBadRequest, "InvalidAddressPrefix", fmt.Sprintf("Subnet '%s' has no IPv4 address prefix.", subnet.name)}
+	}
+
+	host := s.nextHost[key(subnetID)]
+	if host < 4 {
+		host = 4
+	}
+	// The last address is the broadcast address
+	if host >= uint32(1)<<(32-prefix.Bits())-1 {
+		return "", &armError{http.StatusBadRequest, "SubnetIsFull", fmt.Sprintf("Subnet '%s' has no free addresses.", subnet.name)}
+	}
+	s.nextHost[key(subnetID)] = host + 1
+
+	base := prefix.Masked().Addr().As4()
+	var address [4]byte
+	binary.BigEndian.PutUint32(address[:], binary.BigEndian.Uint32(base[:])+host)
+	return netip.AddrFrom4(address).String(), nil
+}
+
+// idOf returns the id of a reference such as {"id": "/subscriptions/..."}
+func idOf(reference interface{}) string {
+	m, _ := reference.(map[string]interface{})
+	id, _ := m["id"].(string)
+	return id
+}
+
+func splitPairs(s string) []string {
+	var pairs []string
+	for i := 0; i+2 <= len(s); i += 2 {
+		pairs = append(pairs, s[i:i+2])
+	}
+	return pairs
+}
+
+// newKey returns a random key in the base64 form storage accounts use
+func newKey() string {
+	b := make([]byte, 64)
+	_, _ = rand.Read(b)
+	return base64.StdEncoding.EncodeToString(b)
+}
@@ -0,0 +1,747 @@
+package armtest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/vanehru/terraform-modules/testkit/arm"
+)
+
+// resourceGroupType is the type of the resource groups every resource lives in
+const resourceGroupType = "Microsoft.Resources/resourceGroups"
+
+// resource is a resource as the last PUT or PATCH left it
+type resource struct {
+	id, name string
+	kind     *kind
+	// parent is the key of the parent resource, or of the resource group for
+	// a top-level resource
+	parent string
+	// owner is the key of the resource that created this one, such as the
+	// private endpoint of a network interface, and deletes it with itself
+	owner string
+	// body is the request body without id, name and type
+	body map[string]interface{}
+	// computed holds the read-only properties, kept across updates
+	computed map[string]interface{}
+	// secrets holds the keys actions such as listKeys return
+	secrets map[string]string
+	state   string
+}
+
+func (r *resource) properties() map[string]interface{} {
+	props, ok := r.body["properties"].(map[string]interface{})
+	if !ok {
+		props = map[string]interface{}{}
+		r.body["properties"] = props
+	}
+	return props
+}
+
+func (r *resource) location() string {
+	location, _ := r.body["location"].(string)
+	return location
+}
+
+// route is a parsed request path
+type route struct {
+	// subscription is set for the subscription itself
+	subscription bool
+	// all is set to list the subscription's resources
+	all bool
+	// namespace is set, with action, for a provider route such as
+	// Microsoft.KeyVault/checkNameAvailability, with path for what follows,
+	// as in Microsoft.KeyVault/locations/japaneast/deletedVaults/name
+	namespace string
+	path      []string
+	// resources is set to a resource group key to list its resources
+	resources string
+	// groups is set to list the resource groups
+	groups bool
+
+	id, name, typ string
+	// group and parent are keys, as for resource
+	group, parent string
+	groupName     string
+	kind          *kind
+	// action is a POST action on the resource, or the child type a GET lists
+	action string
+}
+
+// key returns the case-insensitive map key of an ID
+func key(id string) string {
+	return strings.ToLower(id)
+}
+
+func noRoute(path string) error {
+	return &armError{http.StatusNotFound, "NotFound", fmt.Sprintf("armtest has no route for %s.", path)}
+}
+
+// parse splits a request path into the resource or action it addresses
+func parse(path string) (*route, error) {
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	if len(segments) < 2 || !strings.EqualFold(segments[0], "subscriptions") {
+		return nil, noRoute(path)
+	}
+	if !strings.EqualFold(segments[1], SubscriptionID) {
+		return nil, &armError{http.StatusNotFound, "SubscriptionNotFound", fmt.Sprintf("The subscription '%s' could not be found.", segments[1])}
+	}
+	subscription := "/subscriptions/" + SubscriptionID
+	rest := segments[2:]
+	switch {
+	case len(rest) == 0:
+		return &route{subscription: true}, nil
+	case len(rest) == 1 && strings.EqualFold(rest[0], "resources"):
+		return &route{all: true}, nil
+	case len(rest) >= 3 && strings.EqualFold(rest[0], "providers"):
+		return &route{namespace: rest[1], action: rest[2], path: rest[3:]}, nil
+	case len(rest) == 1 && strings.EqualFold(rest[0], "resourceGroups"):
+		return &route{groups: true}, nil
+	case len(rest) < 2 || !strings.EqualFold(rest[0], "resourceGroups"):
+		return nil, noRoute(path)
+	}
+
+	group := subscription + "/resourceGroups/" + rest[1]
+	rest = rest[2:]
+	switch {
+	case len(rest) == 0:
+		return &route{id: group, name: segments[3], typ: resourceGroupType, group: key(group), groupName: segments[3], kind: kinds[key(resourceGroupType)]}, nil
+	case len(rest) == 1 && strings.EqualFold(rest[0], "resources"):
+		return &route{resources: key(group), group: key(group), groupName: segments[3]}, nil
+	case len(rest) < 4 || !strings.EqualFold(rest[0], "providers"):
+		return nil, noRoute(path)
+	}
+
+	r := &route{group: key(group), parent: key(group), groupName: segments[3]}
+	r.id = group + "/providers/" + rest[1]
+	r.typ = rest[1]
+	pairs := rest[2:]
+	if len(pairs)%2 == 1 {
+		r.action = pairs[len(pairs)-1]
+		pairs = pairs[:len(pairs)-1]
+	}
+	for i := 0; i < len(pairs); i += 2 {
+		if i > 0 {
+			r.parent = key(r.id)
+		}
+		r.id += "/" + pairs[i] + "/" + pairs[i+1]
+		r.typ += "/" + pairs[i]
+		r.name = pairs[i+1]
+	}
+
+	var ok bool
+	if r.kind, ok = kinds[key(r.typ)]; !ok {
+		return nil, &armError{http.StatusBadRequest, "NoRegisteredProviderFound", fmt.Sprintf("armtest does not implement the resource type '%s'.", r.typ)}
+	}
+	return r, nil
+}
+
+func (s *Server) serveResource(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rt, err := parse(r.URL.Path)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	switch {
+	case rt.subscription && r.Method == http.MethodGet:
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"id":             "/subscriptions/" + SubscriptionID,
+			"subscriptionId": SubscriptionID,
+			"tenantId":       TenantID,
+			"displayName":    EnvironmentName,
+			"state":          "Enabled",
+		})
+	case rt.all && r.Method == http.MethodGet:
+		s.listAll(w, r)
+	case rt.namespace != "":
+		s.serveProvider(w, r, rt)
+	case rt.groups && r.Method == http.MethodGet:
+		s.listGroups(w)
+	case rt.resources != "" && r.Method == http.MethodGet:
+		s.list(w, rt)
+	case rt.kind == nil:
+		writeError(w, &armError{http.StatusMethodNotAllowed, "MethodNotAllowed", fmt.Sprintf("armtest does not allow %s on %s.", r.Method, r.URL.Path)})
+	case rt.action != "" && r.Method == http.MethodGet:
+		s.listChildren(w, rt)
+	case rt.action != "" && r.Method == http.MethodPost:
+		s.act(w, rt)
+	case rt.action != "":
+		writeError(w, noRoute(r.URL.Path))
+	case r.Method == http.MethodGet:
+		s.get(w, rt)
+	case r.Method == http.MethodPut:
+		s.put(w, r, rt)
+	case r.Method == http.MethodPatch:
+		s.patch(w, r, rt)
+	case r.Method == http.MethodDelete:
+		s.delete(w, r, rt)
+	default:
+		writeError(w, &armError{http.StatusMethodNotAllowed, "MethodNotAllowed", fmt.Sprintf("armtest does not allow %s on %s.", r.Method, r.URL.Path)})
+	}
+}
+
+func (s *Server) get(w http.ResponseWriter, rt *route) {
+	res, ok := s.resources[key(rt.id)]
+	if !ok {
+		writeError(w, s.notFound(rt))
+		return
+	}
+	writeJSON(w, http.StatusOK, s.view(res))
+}
+
+// notFound says whether the resource group or the resource itself is missing
+func (s *Server) notFound(rt *route) error {
+	if _, ok := s.resources[rt.group]; !ok {
+		return &armError{http.StatusNotFound, "ResourceGroupNotFound", fmt.Sprintf("Resource group '%s' could not be found.", rt.groupName)}
+	}
+	return &armError{http.StatusNotFound, "ResourceNotFound", fmt.Sprintf("The Resource '%s/%s' under resource group '%s' was not found.", rt.typ, rt.name, rt.groupName)}
+}
+
+func (s *Server) put(w http.ResponseWriter, r *http.Request, rt *route) {
+	body, err := decodeBody(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	res, exists, err := s.store(rt, body)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if exists {
+		s.accept(w, r, res, http.StatusOK, "Updating")
+		return
+	}
+	s.accept(w, r, res, http.StatusCreated, "Creating")
+}
+
+// store creates or replaces the resource rt addresses with body, and reports
+// whether it existed
+func (s *Server) store(rt *route, body map[string]interface{}) (*resource, bool, error) {
+	if rt.typ != resourceGroupType {
+		if err := s.requireParent(rt); err != nil {
+			return nil, false, err
+		}
+	}
+
+	res := &resource{id: rt.id, name: rt.name, kind: rt.kind, parent: rt.parent, body: body}
+	if rt.typ == resourceGroupType {
+		res.parent = ""
+	}
+	if location, ok := body["location"].(string); ok && location != "global" {
+		body["location"] = arm.NormalizeLocation(location)
+	}
+
+	existing, exists := s.resources[key(rt.id)]
+	if exists {
+		res.id, res.owner, res.computed, res.secrets = existing.id, existing.owner, existing.computed, existing.secrets
+	} else {
+		res.computed, res.secrets = map[string]interface{}{}, map[string]string{}
+		if rt.kind.create != nil {
+			if err := rt.kind.create(s, res); err != nil {
+				return nil, false, err
+			}
+		}
+	}
+	s.resources[key(rt.id)] = res
+	if !exists {
+		s.putDefaults(res)
+	}
+	s.putChildren(res)
+	return res, exists, nil
+}
+
+// requireParent fails unless the resource group and any parent resource exist
+func (s *Server) requireParent(rt *route) error {
+	if _, ok := s.resources[rt.group]; !ok {
+		return s.notFound(rt)
+	}
+	if parent, ok := s.resources[rt.parent]; !ok || parent.state == "Deleting" {
+		// The parent is the ID without the last type and name
+		parentID := rt.id
+		for i := 0; i < 2; i++ {
+			parentID = parentID[:strings.LastIndex(parentID, "/")]
+		}
+		return &armError{http.StatusNotFound, "ParentResourceNotFound",
+			fmt.Sprintf("Can not perform requested operation on nested resource. Parent resource '%s' not found.", parentID)}
+	}
+	return nil
+}
+
+// putDefaults stores the children Azure creates with a resource
+func (s *Server) putDefaults(res *resource) {
+	for path, body := range res.kind.defaults {
+		childType, name, _ := strings.Cut(path, "/")
+		id := res.id + "/" + path
+		s.resources[key(id)] = &resource{
+			id: id, name: name, kind: kinds[key(res.kind.typ+"/"+childType)], parent: key(res.id), body: body(),
+			computed: map[string]interface{}{}, secrets: map[string]string{}, state: "Succeeded",
+		}
+	}
+}
+
+// putChildren stores the children a PUT sends inline, such as the subnets of
+// a virtual network. Children it leaves out are kept.
+func (s *Server) putChildren(res *resource) {
+	props := res.properties()
+	for property, childType := range res.kind.embed {
+		items, _ := props[property].([]interface{})
+		delete(props, property)
+		for _, item := range items {
+			child, ok := item.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			name, _ := child["name"].(string)
+			if name == "" {
+				continue
+			}
+			delete(child, "id")
+			delete(child, "name")
+			delete(child, "type")
+			id := res.id + "/" + childType[strings.LastIndex(childType, "/")+1:] + "/" + name
+			s.resources[key(id)] = &resource{
+				id: id, name: name, kind: kinds[key(childType)], parent: key(res.id), body: child,
+				computed: map[string]interface{}{}, secrets: map[string]string{}, state: "Succeeded",
+			}
+		}
+	}
+}
+
+func (s *Server) patch(w http.ResponseWriter, r *http.Request, rt *route) {
+	existing, ok := s.resources[key(rt.id)]
+	if !ok {
+		writeError(w, s.notFound(rt))
+		return
+	}
+	body, err := decodeBody(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	res := *existing
+	res.body = map[string]interface{}{}
+	for k, v := range existing.body {
+		res.body[k] = v
+	}
+	props := map[string]interface{}{}
+	for k, v := range existing.properties() {
+		props[k] = v
+	}
+	for k, v := range body {
+		if k != "properties" {
+			res.body[k] = v
+		}
+	}
+	if patch, ok := body["properties"].(map[string]interface{}); ok {
+		for k, v := range patch {
+			props[k] = v
+		}
+	}
+	res.body["properties"] = props
+	s.resources[key(rt.id)] = &res
+	s.accept(w, r, &res, http.StatusOK, "Updating")
+}
+
+// accept answers a PUT or PATCH. A kind with asyncWrite returns the resource
+// in state and an Azure-AsyncOperation to poll until it has succeeded.
+func (s *Server) accept(w http.ResponseWriter, r *http.Request, res *resource, status int, state string) {
+	if !res.kind.asyncWrite {
+		res.state = "Succeeded"
+		writeJSON(w, status, s.view(res))
+		return
+	}
+	res.state = state
+	op := s.startOperation(res, false)
+	w.Header().Set("Azure-AsyncOperation", s.operationURL(op, r))
+	w.Header().Set("Retry-After", strconv.Itoa(s.RetryAfter))
+	writeJSON(w, status, s.view(res))
+}
+
+func (s *Server) delete(w http.ResponseWriter, r *http.Request, rt *route) {
+	res, ok := s.resources[key(rt.id)]
+	if !ok {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if !res.kind.asyncDelete {
+		s.remove(key(res.id))
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	res.state = "Deleting"
+	op := s.startOperation(res, true)
+	w.Header().Set("Location", s.operationURL(op, r))
+	w.Header().Set("Retry-After", strconv.Itoa(s.RetryAfter))
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// remove deletes a resource with its children and the resources it owns
+func (s *Server) remove(k string) {
+	if res, ok := s.resources[k]; ok && res.kind.deleted != nil {
+		res.kind.deleted(s, res)
+	}
+	delete(s.resources, k)
+	for childKey, child := range s.resources {
+		if child.parent == k || child.owner == k {
+			s.remove(childKey)
+		}
+	}
+}
+
+// list returns the top-level resources in a resource group
+func (s *Server) list(w http.ResponseWriter, rt *route) {
+	if _, ok := s.resources[rt.resources]; !ok {
+		writeError(w, s.notFound(rt))
+		return
+	}
+	value := []interface{}{}
+	for _, res := range s.sorted(func(res *resource) bool { return res.parent == rt.resources }) {
+		value = append(value, s.view(res))
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"value": value})
+}
+
+// listAll returns the subscription's resources, except resource groups,
+// that match the request's $filter
+func (s *Server) listAll(w http.ResponseWriter, r *http.Request) {
+	match, err := parseFilter(r.URL.Query().Get("$filter"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	value := []interface{}{}
+	for _, res := range s.sorted(func(res *resource) bool { return res.kind.typ != resourceGroupType && match(res) }) {
+		value = append(value, s.view(res))
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"value": value})
+}
+
+// filterClause is one of the $filter clauses the azurerm provider sends to
+// find a resource by type and name
+var filterClause = regexp.MustCompile(`(?i)^(resourceType|name) eq '([^']*)'$`)
+
+// filterAnd separates $filter clauses
+var filterAnd = regexp.MustCompile(`(?i)\s+and\s+`)
+
+// parseFilter returns a match for a $filter of filterClause clauses joined
+// by and
+func parseFilter(filter string) (func(res *resource) bool, error) {
+	var clauses []func(res *resource) bool
+	if strings.TrimSpace(filter) != "" {
+		for _, text := range filterAnd.Split(strings.TrimSpace(filter), -1) {
+			parts := filterClause.FindStringSubmatch(text)
+			if parts == nil {
+				return nil, &armError{http.StatusBadRequest, "InvalidFilterInQueryString", fmt.Sprintf("armtest does not support the filter '%s'.", text)}
+			}
+			field, value := strings.ToLower(parts[1]), parts[2]
+			clauses = append(clauses, func(res *resource) bool {
+				if field == "name" {
+					return strings.EqualFold(res.name, value)
+				}
+				return strings.EqualFold(res.kind.typ, value)
+			})
+		}
+	}
+	return func(res *resource) bool {
+		for _, clause := range clauses {
+			if !clause(res) {
+				return false
+			}
+		}
+		return true
+	}, nil
+}
+
+// serveProvider answers the subscription-level routes of a resource
+// provider: name checks, the resources of a type, and deleted vaults
+func (s *Server) serveProvider(w http.ResponseWriter, r *http.Request, rt *route) {
+	deleted := strings.EqualFold(rt.action, "locations") && len(rt.path) > 1
+	switch {
+	case len(rt.path) == 0 && r.Method == http.MethodPost:
+		s.checkName(w, r, rt)
+	case len(rt.path) == 0 && r.Method == http.MethodGet:
+		s.listType(w, rt.namespace+"/"+rt.action)
+	case deleted && strings.EqualFold(rt.namespace, "Microsoft.KeyVault"):
+		s.serveDeletedVault(w, r, rt.path[0], rt.path[1:])
+	case deleted && strings.EqualFold(rt.namespace, "Microsoft.CognitiveServices") && r.Method == http.MethodDelete:
+		// Accounts are deleted outright, so purging finds nothing to purge
+		w.WriteHeader(http.StatusNoContent)
+	case deleted && strings.EqualFold(rt.namespace, "Microsoft.CognitiveServices") && r.Method == http.MethodGet:
+		writeError(w, &armError{http.StatusNotFound, "ResourceNotFound", fmt.Sprintf("armtest keeps no deleted account at %s.", r.URL.Path)})
+	default:
+		writeError(w, noRoute(r.URL.Path))
+	}
+}
+
+// listType returns every resource of a type in the subscription
+func (s *Server) listType(w http.ResponseWriter, typ string) {
+	k, ok := kinds[key(typ)]
+	if !ok {
+		writeError(w, &armError{http.StatusBadRequest, "NoRegisteredProviderFound", fmt.Sprintf("armtest does not implement the resource type '%s'.", typ)})
+		return
+	}
+	value := []interface{}{}
+	for _, res := range s.sorted(func(res *resource) bool { return res.kind == k }) {
+		value = append(value, s.view(res))
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"value": value})
+}
+
+// listGroups returns the resource groups, including those being deleted
+func (s *Server) listGroups(w http.ResponseWriter) {
+	value := []interface{}{}
+	for _, res := range s.sorted(func(res *resource) bool { return res.kind.typ == resourceGroupType }) {
+		value = append(value, s.view(res))
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"value": value})
+}
+
+// listChildren returns the children of one type, such as a network's subnets
+func (s *Server) listChildren(w http.ResponseWriter, rt *route) {
+	childKind, ok := kinds[key(rt.typ+"/"+rt.action)]
+	if !ok {
+		writeError(w, noRoute(rt.id+"/"+rt.action))
+		return
+	}
+	if _, ok := s.resources[key(rt.id)]; !ok {
+		writeError(w, s.notFound(rt))
+		return
+	}
+	value := []interface{}{}
+	for _, res := range s.children(key(rt.id), childKind) {
+		value = append(value, s.view(res))
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"value": value})
+}
+
+func (s *Server) act(w http.ResponseWriter, rt *route) {
+	res, ok := s.resources[key(rt.id)]
+	if !ok {
+		writeError(w, s.notFound(rt))
+		return
+	}
+	action, ok := res.kind.actions[strings.ToLower(rt.action)]
+	if !ok {
+		writeError(w, &armError{http.StatusNotFound, "NotFound", fmt.Sprintf("armtest does not implement the action '%s' on '%s'.", rt.action, res.kind.typ)})
+		return
+	}
+	writeJSON(w, http.StatusOK, action(s, res))
+}
+
+// checkName answers the name availability checks of the providers whose
+// names are global, such as Key Vault and Storage
+func (s *Server) checkName(w http.ResponseWriter, r *http.Request, rt *route) {
+	body, err := decodeJSON(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	name, _ := body["name"].(string)
+	if subdomain, ok := body["subdomainName"].(string); ok {
+		name = subdomain
+	}
+	typ, _ := body["type"].(string)
+	if typ == "" {
+		typ = rt.namespace
+	}
+
+	taken := false
+	for _, res := range s.resources {
+		if strings.EqualFold(res.name, name) && strings.HasPrefix(strings.ToLower(res.kind.typ), strings.ToLower(typ)) {
+			taken = true
+		}
+	}
+
+	switch strings.ToLower(rt.action) {
+	case "checkdomainavailability":
+		writeJSON(w, http.StatusOK, map[string]interface{}{"subdomainName": name, "type": typ, "isSubdomainAvailable": !taken})
+	case "checknameavailability":
+		result := map[string]interface{}{"nameAvailable": !taken}
+		if taken {
+			result["reason"] = "AlreadyExists"
+			result["message"] = fmt.Sprintf("The name '%s' is already in use.", name)
+		}
+		writeJSON(w, http.StatusOK, result)
+	default:
+		writeError(w, noRoute(r.URL.Path))
+	}
+}
+
+// view returns a resource as a GET does: the last body with its read-only
+// properties, embedded children and provisioning state
+func (s *Server) view(res *resource) map[string]interface{} {
+	view := map[string]interface{}{}
+	for k, v := range res.body {
+		view[k] = v
+	}
+	props := map[string]interface{}{}
+	for k, v := range res.properties() {
+		props[k] = v
+	}
+	for k, v := range res.computed {
+		props[k] = v
+	}
+	for property, childType := range res.kind.embed {
+		children := []interface{}{}
+		for _, child := range s.children(key(res.id), kinds[key(childType)]) {
+			children = append(children, s.view(child))
+		}
+		props[property] = children
+	}
+	props["provisioningState"] = res.state
+	view["properties"] = props
+	view["id"] = res.id
+	view["name"] = res.name
+	view["type"] = res.kind.typ
+	return view
+}
+
+func (s *Server) children(parent string, childKind *kind) []*resource {
+	return s.sorted(func(res *resource) bool { return res.parent == parent && res.kind == childKind })
+}
+
+// sorted returns the resources match accepts, by ID
+func (s *Server) sorted(match func(res *resource) bool) []*resource {
+	var matched []*resource
+	for _, res := range s.resources {
+		if match(res) {
+			matched = append(matched, res)
+		}
+	}
+	sort.Slice(matched, func(i, j int) bool { return key(matched[i].id) < key(matched[j].id) })
+	return matched
+}
+
+// operation is a long-running PUT, PATCH or DELETE
+type operation struct {
+	id       string
+	resource string
+	delete   bool
+	// remaining is how many more polls report the operation running
+	remaining int
+	done      bool
+	started   time.Time
+}
+
+func (s *Server) startOperation(res *resource, delete bool) *operation {
+	s.nextOp++
+	op := &operation{
+		id:        strconv.Itoa(s.nextOp),
+		resource:  key(res.id),
+		delete:    delete,
+		remaining: s.Polls,
+		started:   time.Now().UTC(),
+	}
+	s.operations[op.id] = op
+	return op
+}
+
+func (s *Server) operationURL(op *operation, r *http.Request) string {
+	return s.URL + operationsPath + op.id + "?api-version=" + url.QueryEscape(r.URL.Query().Get("api-version"))
+}
+
+// poll reports on an operation, completing it once Polls polls have seen it
+// running. Deletes are polled through Location, the rest through
+// Azure-AsyncOperation.
+func (s *Server) poll(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	op, ok := s.operations[strings.TrimPrefix(r.URL.Path, operationsPath)]
+	if !ok {
+		writeError(w, &armError{http.StatusNotFound, "OperationNotFound", fmt.Sprintf("The operation %s was not found.", r.URL.Path)})
+		return
+	}
+	if !op.done {
+		if op.remaining > 0 {
+			op.remaining--
+		} else {
+			s.complete(op)
+		}
+	}
+
+	if op.delete {
+		if op.done {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		w.Header().Set("Location", s.URL+r.URL.RequestURI())
+		w.Header().Set("Retry-After", strconv.Itoa(s.RetryAfter))
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+
+	status := map[string]interface{}{
+		"id":        s.URL + r.URL.Path,
+		"name":      op.id,
+		"status":    "InProgress",
+		"startTime": op.started.Format(time.RFC3339),
+	}
+	if op.done {
+		status["status"] = "Succeeded"
+		status["endTime"] = time.Now().UTC().Format(time.RFC3339)
+	} else {
+		w.Header().Set("Retry-After", strconv.Itoa(s.RetryAfter))
+	}
+	writeJSON(w, http.StatusOK, status)
+}
+
+func (s *Server) complete(op *operation) {
+	op.done = true
+	res, ok := s.resources[op.resource]
+	switch {
+	case !ok:
+	case op.delete:
+		s.remove(op.resource)
+	case res.state != "Deleting":
+		res.state = "Succeeded"
+	}
+}
+
+// decodeBody returns the resource in the request body without the fields the
+// server owns
+func decodeBody(r *http.Request) (map[string]interface{}, error) {
+	body, err := decodeJSON(r)
+	if err != nil {
+		return nil, err
+	}
+	delete(body, "id")
+	delete(body, "name")
+	delete(body, "type")
+	if props, ok := body["properties"].(map[string]interface{}); ok {
+		delete(props, "provisioningState")
+	}
+	return body, nil
+}
+
+// decodeJSON returns the JSON object in the request body, keeping numbers as
+// they were sent
+func decodeJSON(r *http.Request) (map[string]interface{}, error) {
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+	body := map[string]interface{}{}
+	if len(strings.TrimSpace(string(data))) > 0 {
+		decoder := json.NewDecoder(strings.NewReader(string(data)))
+		decoder.UseNumber()
+		if err := decoder.Decode(&body); err != nil {
+			return nil, &armError{http.StatusBadRequest, "InvalidRequestContent", fmt.Sprintf("The request content was invalid and could not be deserialized: %v.", err)}
+		}
+	}
+	return body, nil
+}
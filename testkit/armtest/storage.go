@@ -0,0 +1,237 @@
+package armtest
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// storageAccountType is the type whose accounts the storage data plane serves
+const storageAccountType = "Microsoft.Storage/storageAccounts"
+
+// accountData is the data plane of a storage account, kept until the account
+// is deleted
+type accountData struct {
+	// properties holds the service properties last set, by service
+	properties map[string][]byte
+	shares     map[string]*share
+}
+
+// share is a file share as its last request left it
+type share struct {
+	quota, accessTier, protocols string
+	metadata                     http.Header
+	acl                          []byte
+	modified                     time.Time
+	etag                         string
+}
+
+// defaultServiceProperties is what a new account returns for its service
+// properties, with %s for the settings only some services have
+const defaultServiceProperties = `<?xml version="1.0" encoding="utf-8"?><StorageServiceProperties>` +
+	`<Logging><Version>1.0</Version><Read>false</Read><Write>false</Write><Delete>false</Delete><RetentionPolicy><Enabled>false</Enabled></RetentionPolicy></Logging>` +
+	`<HourMetrics><Version>1.0</Version><Enabled>false</Enabled><RetentionPolicy><Enabled>false</Enabled></RetentionPolicy></HourMetrics>` +
+	`<MinuteMetrics><Version>1.0</Version><Enabled>false</Enabled><RetentionPolicy><Enabled>false</Enabled></RetentionPolicy></MinuteMetrics>` +
+	`<Cors />%s</StorageServiceProperties>`
+
+// blobServiceProperties are the settings only the blob service has
+const blobServiceProperties = `<DeleteRetentionPolicy><Enabled>false</Enabled></DeleteRetentionPolicy><StaticWebsite><Enabled>false</Enabled></StaticWebsite>`
+
+// serveStorage answers the service properties of the account name's
+// services, and the file shares of its file service. It accepts any Shared
+// Key signature for the account, or the server's token.
+func (s *Server) serveStorage(w http.ResponseWriter, r *http.Request, name, service string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.findResource(storageAccountType, name) == nil {
+		writeStorageError(w, http.StatusNotFound, "ResourceNotFound", fmt.Sprintf("armtest holds no storage account named '%s'.", name))
+		return
+	}
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(strings.ToLower(auth), "sharedkey "+name+":") && auth != "Bearer "+s.token {
+		writeStorageError(w, http.StatusForbidden, "AuthenticationFailed",
+			"Server failed to authenticate the request. Make sure the value of Authorization header is formed correctly including the signature.")
+		return
+	}
+
+	data := s.accounts[name]
+	if data == nil {
+		data = &accountData{properties: map[string][]byte{}, shares: map[string]*share{}}
+		s.accounts[name] = data
+	}
+	query := r.URL.Query()
+	path := strings.Trim(r.URL.Path, "/")
+	switch {
+	case path == "" && query.Get("restype") == "service" && query.Get("comp") == "properties":
+		data.serveProperties(w, r, service)
+	case service == "file" && path != "" && !strings.Contains(path, "/") && query.Get("restype") == "share":
+		data.serveShare(w, r, path, query.Get("comp"))
+	default:
+		writeStorageError(w, http.StatusBadRequest, "UnsupportedHttpVerb",
+			fmt.Sprintf("armtest does not implement %s %s on the %s service.", r.Method, r.URL.RequestURI(), service))
+	}
+}
+
+func (d *accountData) serveProperties(w http.ResponseWriter, r *http.Request, service string) {
+	switch r.Method {
+	case http.MethodGet:
+		properties, ok := d.properties[service]
+		if !ok {
+			extra := ""
+			if service == "blob" {
+				extra = blobServiceProperties
+			}
+			properties = []byte(fmt.Sprintf(defaultServiceProperties, extra))
+		}
+		writeXML(w, http.StatusOK, properties)
+	case http.MethodPut:
+		body, err := readXML(r)
+		if err != nil {
+			writeStorageError(w, http.StatusBadRequest, "InvalidXmlDocument", err.Error())
+			return
+		}
+		d.properties[service] = body
+		w.WriteHeader(http.StatusAccepted)
+	default:
+		writeStorageError(w, http.StatusMethodNotAllowed, "UnsupportedHttpVerb", fmt.Sprintf("armtest does not allow %s on service properties.", r.Method))
+	}
+}
+
+// serveShare creates, reads, updates and deletes a file share
+func (d *accountData) serveShare(w http.ResponseWriter, r *http.Request, name, comp string) {
+	sh, ok := d.shares[name]
+	if r.Method == http.MethodPut && comp == "" {
+		if ok {
+			writeStorageError(w, http.StatusConflict, "ShareAlreadyExists", "The specified share already exists.")
+			return
+		}
+		sh = &share{quota: "5120", accessTier: "TransactionOptimized", protocols: "SMB", metadata: http.Header{}}
+		sh.update(r)
+		d.shares[name] = sh
+		sh.writeHeaders(w, false)
+		w.WriteHeader(http.StatusCreated)
+		return
+	}
+	if !ok {
+		writeStorageError(w, http.StatusNotFound, "ShareNotFound", "The specified share does not exist.")
+		return
+	}
+
+	switch {
+	case comp == "" && (r.Method == http.MethodGet || r.Method == http.MethodHead):
+		sh.writeHeaders(w, true)
+		w.WriteHeader(http.StatusOK)
+	case comp == "" && r.Method == http.MethodDelete:
+		delete(d.shares, name)
+		w.WriteHeader(http.StatusAccepted)
+	case (comp == "metadata" || comp == "properties") && r.Method == http.MethodPut:
+		if comp == "metadata" {
+			sh.metadata = http.Header{}
+		}
+		sh.update(r)
+		sh.writeHeaders(w, false)
+		w.WriteHeader(http.StatusOK)
+	case comp == "acl" && r.Method == http.MethodGet:
+		acl := sh.acl
+		if acl == nil {
+			acl = []byte(`<?xml version="1.0" encoding="utf-8"?><SignedIdentifiers />`)
+		}
+		sh.writeHeaders(w, false)
+		writeXML(w, http.StatusOK, acl)
+	case comp == "acl" && r.Method == http.MethodPut:
+		acl, err := readXML(r)
+		if err != nil {
+			writeStorageError(w, http.StatusBadRequest, "InvalidXmlDocument", err.Error())
+			return
+		}
+		sh.acl = acl
+		sh.touch()
+		sh.writeHeaders(w, false)
+		w.WriteHeader(http.StatusOK)
+	case comp == "stats" && r.Method == http.MethodGet:
+		writeXML(w, http.StatusOK, []byte(`<?xml version="1.0" encoding="utf-8"?><ShareStats><ShareUsageBytes>0</ShareUsageBytes></ShareStats>`))
+	default:
+		writeStorageError(w, http.StatusBadRequest, "UnsupportedHttpVerb", fmt.Sprintf("armtest does not implement %s on a share with comp=%s.", r.Method, comp))
+	}
+}
+
+// update applies the quota, access tier, protocols and metadata headers a
+// request sends
+func (sh *share) update(r *http.Request) {
+	for header, field := range map[string]*string{
+		"x-ms-share-quota":       &sh.quota,
+		"x-ms-access-tier":       &sh.accessTier,
+		"x-ms-enabled-protocols": &sh.protocols,
+	} {
+		if value := r.Header.Get(header); value != "" {
+			*field = value
+		}
+	}
+	for header, values := range r.Header {
+		if strings.HasPrefix(strings.ToLower(header), "x-ms-meta-") {
+			sh.metadata[header] = values
+		}
+	}
+	sh.touch()
+}
+
+func (sh *share) touch() {
+	sh.modified = time.Now().UTC()
+	sh.etag = fmt.Sprintf(`"0x%X"`, sh.modified.UnixNano())
+}
+
+// writeHeaders sets the share's ETag and, with properties, the headers a
+// read of the share returns
+func (sh *share) writeHeaders(w http.ResponseWriter, properties bool) {
+	w.Header().Set("ETag", sh.etag)
+	w.Header().Set("Last-Modified", sh.modified.Format(http.TimeFormat))
+	if !properties {
+		return
+	}
+	w.Header().Set("x-ms-share-quota", sh.quota)
+	w.Header().Set("x-ms-access-tier", sh.accessTier)
+	w.Header().Set("x-ms-enabled-protocols", sh.protocols)
+	for header, values := range sh.metadata {
+		w.Header()[header] = values
+	}
+}
+
+// deleteStorageAccount drops the data plane of a deleted account
+func deleteStorageAccount(s *Server, r *resource) {
+	delete(s.accounts, strings.ToLower(r.name))
+}
+
+// readXML returns the request body once it has checked it is XML
+func readXML(r *http.Request) ([]byte, error) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+	decoder := xml.NewDecoder(bytes.NewReader(body))
+	for {
+		if _, err := decoder.Token(); err == io.EOF {
+			return body, nil
+		} else if err != nil {
+			return nil, err
+		}
+	}
+}
+
+func writeXML(w http.ResponseWriter, status int, body []byte) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	_, _ = w.Write(body)
+}
+
+// writeStorageError writes an error in the XML envelope storage services use
+func writeStorageError(w http.ResponseWriter, status int, code, message string) {
+	var escaped bytes.Buffer
+	_ = xml.EscapeText(&escaped, []byte(message))
+	w.Header().Set("x-ms-error-code", code)
+	writeXML(w, status, []byte(fmt.Sprintf(`<?xml version="1.0" encoding="utf-8"?><Error><Code>%s</Code><Message>%s</Message></Error>`, code, escaped.String())))
+}
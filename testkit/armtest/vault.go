@@ -0,0 +1,348 @@
+package armtest
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/vanehru/terraform-modules/testkit/arm"
+)
+
+// vaultData is the data plane of a vault, kept from its first write until
+// the vault is purged
+type vaultData struct {
+	secrets map[string]*secret
+}
+
+// secret is a Key Vault secret as its latest version left it
+type secret struct {
+	version     string
+	value       string
+	contentType string
+	tags        interface{}
+	// attributes are the ones the client sets, such as enabled and exp
+	attributes map[string]interface{}
+	created    int64
+	updated    int64
+	// deleted is when the secret was deleted, or 0
+	deleted int64
+}
+
+// deletedVault is a vault in its soft-delete retention period
+type deletedVault struct {
+	id, name, location string
+	vaultID            string
+	tags               interface{}
+	purgeProtection    bool
+	deletionDate       time.Time
+}
+
+// recoverableDays is how long deleted vaults and secrets are kept
+const recoverableDays = 90
+
+// serveVault answers the secrets API of the vault name. Like Key Vault, it
+// challenges a request without a token for the tenant to authenticate with.
+func (s *Server) serveVault(w http.ResponseWriter, r *http.Request, name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.findResource("Microsoft.KeyVault/vaults", name) == nil {
+		writeError(w, &armError{http.StatusNotFound, "VaultNotFound", fmt.Sprintf("armtest holds no vault named '%s'.", name)})
+		return
+	}
+	if r.Header.Get("Authorization") != "Bearer "+s.token {
+		w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer authorization="%s/%s", resource="https://vault.azure.net"`, s.URL, TenantID))
+		writeError(w, &armError{http.StatusUnauthorized, "Unauthorized", "AKV10000: Request is missing a Bearer or PoP token."})
+		return
+	}
+	if r.URL.Query().Get("api-version") == "" {
+		writeError(w, &armError{http.StatusBadRequest, "BadParameter", "The api-version query parameter is required."})
+		return
+	}
+
+	data := s.vaults[name]
+	if data == nil {
+		data = &vaultData{secrets: map[string]*secret{}}
+		s.vaults[name] = data
+	}
+	base := "https://" + name + vaultSuffix
+	segments := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	collection := strings.ToLower(segments[0])
+	switch {
+	case collection == "secrets" && len(segments) == 1 && r.Method == http.MethodGet:
+		data.list(w, base)
+	case collection == "secrets" && len(segments) >= 2 && len(segments) <= 3:
+		data.serveSecret(w, r, base, segments[1], strings.Join(segments[2:], ""))
+	case collection == "deletedsecrets" && len(segments) >= 2 && len(segments) <= 3:
+		data.serveDeletedSecret(w, r, base, segments[1], strings.Join(segments[2:], ""))
+	case collection == "certificates" && len(segments) == 2 && strings.EqualFold(segments[1], "contacts") && r.Method == http.MethodGet:
+		writeError(w, &armError{http.StatusNotFound, "ContactsNotFound", "Contacts not found"})
+	default:
+		writeError(w, &armError{http.StatusNotFound, "NotFound", fmt.Sprintf("armtest does not implement %s %s on a vault.", r.Method, r.URL.Path)})
+	}
+}
+
+func (d *vaultData) list(w http.ResponseWriter, base string) {
+	names := make([]string, 0, len(d.secrets))
+	for name, sec := range d.secrets {
+		if sec.deleted == 0 {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	value := []interface{}{}
+	for _, name := range names {
+		item := d.secrets[name].bundle(base, name)
+		item["id"] = base + "/secrets/" + name
+		delete(item, "value")
+		value = append(value, item)
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"value": value, "nextLink": nil})
+}
+
+// serveSecret answers a secret, or one of its versions. Only the latest
+// version is kept, and any version ID reads it.
+func (d *vaultData) serveSecret(w http.ResponseWriter, r *http.Request, base, name, version string) {
+	sec, ok := d.secrets[name]
+	if r.Method == http.MethodPut {
+		if version != "" {
+			writeError(w, &armError{http.StatusMethodNotAllowed, "MethodNotAllowed", "Secrets are set without a version."})
+			return
+		}
+		if ok && sec.deleted != 0 {
+			writeError(w, &armError{http.StatusConflict, "Conflict", fmt.Sprintf(
+				"Secret %s is currently in a deleted but recoverable state, and its name cannot be reused; in this state, the secret can only be recovered or purged.", name)})
+			return
+		}
+		d.set(w, r, base, name)
+		return
+	}
+	if !ok || sec.deleted != 0 {
+		writeError(w, &armError{http.StatusNotFound, "SecretNotFound", fmt.Sprintf("A secret with (name/id) %s was not found in this key vault.", name)})
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		if enabled, ok := sec.attributes["enabled"].(bool); ok && !enabled {
+			writeError(w, &armError{http.StatusForbidden, "Forbidden", "Operation get is not allowed on a disabled secret."})
+			return
+		}
+		writeJSON(w, http.StatusOK, sec.bundle(base, name))
+	case http.MethodPatch:
+		body, err := decodeJSON(r)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		sec.update(body)
+		bundle := sec.bundle(base, name)
+		delete(bundle, "value")
+		writeJSON(w, http.StatusOK, bundle)
+	case http.MethodDelete:
+		if version != "" {
+			writeError(w, &armError{http.StatusMethodNotAllowed, "MethodNotAllowed", "Secrets are deleted without a version."})
+			return
+		}
+		sec.deleted = time.Now().Unix()
+		writeJSON(w, http.StatusOK, sec.deletedBundle(base, name))
+	default:
+		writeError(w, &armError{http.StatusMethodNotAllowed, "MethodNotAllowed", fmt.Sprintf("armtest does not allow %s on a secret.", r.Method)})
+	}
+}
+
+// set stores a new version of a secret
+func (d *vaultData) set(w http.ResponseWriter, r *http.Request, base, name string) {
+	body, err := decodeJSON(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	value, ok := body["value"].(string)
+	if !ok {
+		writeError(w, &armError{http.StatusBadRequest, "BadParameter", "The secret value is required."})
+		return
+	}
+	now := time.Now().Unix()
+	sec := &secret{version: randomHex(16), value: value, attributes: map[string]interface{}{}, created: now, updated: now}
+	sec.update(body)
+	d.secrets[name] = sec
+	writeJSON(w, http.StatusOK, sec.bundle(base, name))
+}
+
+// update applies the content type, tags and attributes a request sends
+func (sec *secret) update(body map[string]interface{}) {
+	if contentType, ok := body["contentType"].(string); ok {
+		sec.contentType = contentType
+	}
+	if tags, ok := body["tags"]; ok {
+		sec.tags = tags
+	}
+	if attributes, ok := body["attributes"].(map[string]interface{}); ok {
+		for k, v := range attributes {
+			sec.attributes[k] = v
+		}
+	}
+	sec.updated = time.Now().Unix()
+}
+
+// serveDeletedSecret reads, purges or recovers a deleted secret
+func (d *vaultData) serveDeletedSecret(w http.ResponseWriter, r *http.Request, base, name, action string) {
+	sec, ok := d.secrets[name]
+	if !ok || sec.deleted == 0 {
+		writeError(w, &armError{http.StatusNotFound, "SecretNotFound", fmt.Sprintf("Deleted Secret not found: %s", name)})
+		return
+	}
+	switch {
+	case action == "" && r.Method == http.MethodGet:
+		writeJSON(w, http.StatusOK, sec.deletedBundle(base, name))
+	case action == "" && r.Method == http.MethodDelete:
+		delete(d.secrets, name)
+		w.WriteHeader(http.StatusNoContent)
+	case strings.EqualFold(action, "recover") && r.Method == http.MethodPost:
+		sec.deleted = 0
+		bundle := sec.bundle(base, name)
+		delete(bundle, "value")
+		writeJSON(w, http.StatusOK, bundle)
+	default:
+		writeError(w, &armError{http.StatusMethodNotAllowed, "MethodNotAllowed", fmt.Sprintf("armtest does not allow %s on a deleted secret.", r.Method)})
+	}
+}
+
+// bundle returns the secret as Key Vault does, with the attributes it adds
+func (sec *secret) bundle(base, name string) map[string]interface{} {
+	attributes := map[string]interface{}{"enabled": true}
+	for k, v := range sec.attributes {
+		attributes[k] = v
+	}
+	attributes["created"] = sec.created
+	attributes["updated"] = sec.updated
+	attributes["recoveryLevel"] = "Recoverable+Purgeable"
+	attributes["recoverableDays"] = recoverableDays
+
+	bundle := map[string]interface{}{
+		"id":         base + "/secrets/" + name + "/" + sec.version,
+		"value":      sec.value,
+		"attributes": attributes,
+	}
+	if sec.contentType != "" {
+		bundle["contentType"] = sec.contentType
+	}
+	if sec.tags != nil {
+		bundle["tags"] = sec.tags
+	}
+	return bundle
+}
+
+func (sec *secret) deletedBundle(base, name string) map[string]interface{} {
+	bundle := sec.bundle(base, name)
+	delete(bundle, "value")
+	bundle["recoveryId"] = base + "/deletedsecrets/" + name
+	bundle["deletedDate"] = sec.deleted
+	bundle["scheduledPurgeDate"] = sec.deleted + int64(recoverableDays*24*time.Hour/time.Second)
+	return bundle
+}
+
+// createVault sets a vault's URI, recovering a deleted vault of the same
+// name when the request asks to and refusing to replace one otherwise
+func createVault(s *Server, r *resource) error {
+	name := strings.ToLower(r.name)
+	if _, ok := s.deletedVaults[name]; ok {
+		if mode, _ := r.properties()["createMode"].(string); !strings.EqualFold(mode, "recover") {
+			return &armError{http.StatusConflict, "ConflictError", fmt.Sprintf(
+				"A vault with the same name already exists in deleted state. You need to either recover or purge existing key vault '%s'.", r.name)}
+		}
+		delete(s.deletedVaults, name)
+	} else {
+		delete(s.vaults, name)
+	}
+	r.computed["vaultUri"] = fmt.Sprintf("https://%s%s/", r.name, vaultSuffix)
+	return nil
+}
+
+// deleteVault keeps a deleted vault, with its secrets, until it is purged,
+// unless soft delete is turned off
+func deleteVault(s *Server, r *resource) {
+	name := strings.ToLower(r.name)
+	props := r.properties()
+	if soft, ok := props["enableSoftDelete"].(bool); ok && !soft {
+		delete(s.vaults, name)
+		return
+	}
+	protected, _ := props["enablePurgeProtection"].(bool)
+	location := r.location()
+	s.deletedVaults[name] = &deletedVault{
+		id:              deletedVaultID(location, r.name),
+		name:            r.name,
+		location:        location,
+		vaultID:         r.id,
+		tags:            r.body["tags"],
+		purgeProtection: protected,
+		deletionDate:    time.Now().UTC(),
+	}
+}
+
+func deletedVaultID(location, name string) string {
+	return fmt.Sprintf("/subscriptions/%s/providers/Microsoft.KeyVault/locations/%s/deletedVaults/%s", SubscriptionID, location, name)
+}
+
+// serveDeletedVault reads or purges a deleted vault. path is what follows
+// the location, such as deletedVaults/name/purge.
+func (s *Server) serveDeletedVault(w http.ResponseWriter, r *http.Request, location string, path []string) {
+	if len(path) < 2 || len(path) > 3 || !strings.EqualFold(path[0], "deletedVaults") {
+		writeError(w, noRoute(r.URL.Path))
+		return
+	}
+	name := strings.ToLower(path[1])
+	vault, ok := s.deletedVaults[name]
+	if !ok || vault.location != arm.NormalizeLocation(location) {
+		writeError(w, &armError{http.StatusNotFound, "ResourceNotFound", fmt.Sprintf("The Resource 'Microsoft.KeyVault/deletedVaults/%s' was not found.", path[1])})
+		return
+	}
+
+	switch {
+	case len(path) == 2 && r.Method == http.MethodGet:
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"id":   vault.id,
+			"name": vault.name,
+			"type": "Microsoft.KeyVault/deletedVaults",
+			"properties": map[string]interface{}{
+				"vaultId":                vault.vaultID,
+				"location":               vault.location,
+				"deletionDate":           vault.deletionDate.Format(time.RFC3339),
+				"scheduledPurgeDate":     vault.deletionDate.Add(recoverableDays * 24 * time.Hour).Format(time.RFC3339),
+				"tags":                   vault.tags,
+				"purgeProtectionEnabled": vault.purgeProtection,
+			},
+		})
+	case len(path) == 3 && strings.EqualFold(path[2], "purge") && r.Method == http.MethodPost:
+		if vault.purgeProtection {
+			writeError(w, &armError{http.StatusConflict, "ConflictError", fmt.Sprintf("Vault '%s' has purge protection enabled and cannot be purged.", vault.name)})
+			return
+		}
+		delete(s.deletedVaults, name)
+		delete(s.vaults, name)
+		// The purge is polled through Location for its status, which finds
+		// no resource to update when it completes
+		op := s.startOperation(&resource{id: vault.id}, false)
+		w.Header().Set("Location", s.operationURL(op, r))
+		w.Header().Set("Retry-After", strconv.Itoa(s.RetryAfter))
+		w.WriteHeader(http.StatusAccepted)
+	default:
+		writeError(w, &armError{http.StatusMethodNotAllowed, "MethodNotAllowed", fmt.Sprintf("armtest does not allow %s on %s.", r.Method, r.URL.Path)})
+	}
+}
+
+// findResource returns the resource of typ named name, or nil. Vault and
+// storage account names are unique across Azure, so the name is enough.
+func (s *Server) findResource(typ, name string) *resource {
+	for _, res := range s.resources {
+		if strings.EqualFold(res.kind.typ, typ) && strings.EqualFold(res.name, name) && res.state != "Deleting" {
+			return res
+		}
+	}
+	return nil
+}
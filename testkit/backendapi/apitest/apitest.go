@@ -0,0 +1,369 @@
+// Package apitest is an httptest stand-in for the Python Function App, serving
+// the same routes, status codes, bodies and validation messages from memory,
+// so the backendapi contract checks run without Azure or func start
+package apitest
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/vanehru/terraform-modules/testkit/backendapi"
+)
+
+// Server serves the backend API under /api at its URL
+type Server struct {
+	*httptest.Server
+	// Scores is what the OpenAI route answers every message with
+	Scores backendapi.Scores
+
+	mu      sync.Mutex
+	users   map[string]string
+	players map[playerKey]*backendapi.Player
+	events  []backendapi.Event
+}
+
+type playerKey struct {
+	userID string
+	charID int
+}
+
+// NewServer starts a server with no users and one event, and closes it when
+// t completes
+func NewServer(t testing.TB) *Server {
+	s := &Server{
+		Scores:  backendapi.Scores{Charisma: 50, Intuition: 50, Logic: 50, Order: 50},
+		users:   map[string]string{},
+		players: map[playerKey]*backendapi.Player{},
+		events: []backendapi.Event{
+			{EventID: backendapi.DefaultEventID, Seq: backendapi.DefaultSeq, EventType: "text", EventText: "冒険が始まる"},
+		},
+	}
+	mux := http.NewServeMux()
+	for route, handler := range map[string]struct {
+		methods []string
+		serve   http.HandlerFunc
+	}{
+		backendapi.RouteOpenAI:          {[]string{http.MethodGet, http.MethodPost}, s.openAI},
+		backendapi.RouteSelectPlayer:    {[]string{http.MethodGet, http.MethodPost}, s.selectPlayer},
+		backendapi.RouteSelectAllPlayer: {[]string{http.MethodGet, http.MethodPost}, s.selectAllPlayer},
+		backendapi.RouteSelectEvents:    {[]string{http.MethodGet, http.MethodPost}, s.selectEvents},
+		backendapi.RouteUpdate:          {[]string{http.MethodPost}, s.update},
+		backendapi.RouteInsertUser:      {[]string{http.MethodPost}, s.insertUser},
+		backendapi.RouteInsertPlayer:    {[]string{http.MethodPost}, s.insertPlayer},
+		backendapi.RouteLogin:           {[]string{http.MethodPost}, s.login},
+	} {
+		handler := handler
+		mux.HandleFunc("/api/"+route, func(w http.ResponseWriter, r *http.Request) {
+			// The Functions host answers a method the route does not declare
+			// as it does an unknown route
+			for _, method := range handler.methods {
+				if r.Method == method {
+					handler.serve(w, r)
+					return
+				}
+			}
+			http.NotFound(w, r)
+		})
+	}
+	s.Server = httptest.NewServer(mux)
+	t.Cleanup(s.Close)
+	return s
+}
+
+// BaseURL returns the URL a backendapi.Client takes
+func (s *Server) BaseURL() string {
+	return s.URL + "/api"
+}
+
+// AddEvent adds an EventData row
+func (s *Server) AddEvent(event backendapi.Event) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.events = append(s.events, event)
+}
+
+// Player returns a PlayerData row
+func (s *Server) Player(userID string, charID int) (backendapi.Player, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	player, ok := s.players[playerKey{userID, charID}]
+	if !ok {
+		return backendapi.Player{}, false
+	}
+	return *player, true
+}
+
+// body decodes a JSON object body as req.get_json() does, returning false
+// for anything else
+func body(r *http.Request) (map[string]interface{}, bool) {
+	var object map[string]interface{}
+	if err := json.NewDecoder(r.Body).Decode(&object); err != nil || object == nil {
+		return nil, false
+	}
+	return object, true
+}
+
+// param returns a query parameter or, failing that, the body field of the
+// same name, as the GET and POST routes read them
+func param(r *http.Request, name string) string {
+	if value := r.URL.Query().Get(name); value != "" {
+		return value
+	}
+	object, _ := body(r)
+	return str(object[name])
+}
+
+// str formats a JSON value the way Python would pass it to the database,
+// with nil as the empty string
+func str(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// integer converts a JSON value as int() does, reporting false for anything
+// int() would raise on
+func integer(value interface{}) (int, bool) {
+	switch v := value.(type) {
+	case float64:
+		return int(math.Trunc(v)), true
+	case bool:
+		if v {
+			return 1, true
+		}
+		return 0, true
+	case string:
+		n, err := strconv.Atoi(strings.TrimSpace(v))
+		return n, err == nil
+	}
+	return 0, false
+}
+
+func (s *Server) openAI(w http.ResponseWriter, r *http.Request) {
+	if param(r, "message") == "" {
+		writeText(w, http.StatusBadRequest, "Please provide a 'message' parameter.")
+		return
+	}
+	content, _ := json.Marshal(s.Scores)
+	writeJSON(w, map[string]interface{}{
+		"id":      "chatcmpl-apitest",
+		"object":  "chat.completion",
+		"created": 0,
+		"model":   "gpt-4o",
+		"choices": []interface{}{map[string]interface{}{
+			"index":         0,
+			"message":       map[string]interface{}{"role": "assistant", "content": string(content)},
+			"finish_reason": "stop",
+		}},
+		"usage": map[string]interface{}{"prompt_tokens": 0, "completion_tokens": 0, "total_tokens": 0},
+	})
+}
+
+func (s *Server) selectPlayer(w http.ResponseWriter, r *http.Request) {
+	userID := param(r, "UserId")
+	if userID == "" {
+		writeText(w, http.StatusBadRequest, "UserId パラメータが必要です。")
+		return
+	}
+	s.writePlayers(w, func(p *backendapi.Player) bool { return p.UserID == userID })
+}
+
+func (s *Server) selectAllPlayer(w http.ResponseWriter, r *http.Request) {
+	s.writePlayers(w, func(*backendapi.Player) bool { return true })
+}
+
+func (s *Server) writePlayers(w http.ResponseWriter, match func(*backendapi.Player) bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	list := []backendapi.Player{}
+	for _, player := range s.players {
+		if match(player) {
+			list = append(list, *player)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].UserID != list[j].UserID {
+			return list[i].UserID < list[j].UserID
+		}
+		return list[i].CharID < list[j].CharID
+	})
+	writeJSON(w, backendapi.PlayerList{List: list})
+}
+
+func (s *Server) selectEvents(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	writeJSON(w, backendapi.EventList{List: append([]backendapi.Event{}, s.events...)})
+}
+
+func (s *Server) update(w http.ResponseWriter, r *http.Request) {
+	object, ok := body(r)
+	if !ok {
+		writeText(w, http.StatusBadRequest, "Invalid JSON in request body.")
+		return
+	}
+	userID := str(object["UserId"])
+	if userID == "" || object["CharId"] == nil {
+		writeText(w, http.StatusBadRequest, "UserId と CharId は必須です。")
+		return
+	}
+	values := map[string]int{}
+	for _, name := range []string{"Parameter1", "Parameter2", "Parameter3", "Parameter4"} {
+		if object[name] == nil {
+			continue
+		}
+		value, ok := integer(object[name])
+		if !ok {
+			writeText(w, http.StatusBadRequest, name+" must be a valid number")
+			return
+		}
+		if value < backendapi.MinParameter || value > backendapi.MaxParameter {
+			writeText(w, http.StatusBadRequest, fmt.Sprintf("%s must be between %d and %d", name, backendapi.MinParameter, backendapi.MaxParameter))
+			return
+		}
+		values[name] = value
+	}
+	for _, name := range []string{"Exp", "CurrentEventId", "CurrentSeq"} {
+		values[name], _ = integer(object[name])
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	charID, _ := integer(object["CharId"])
+	player, ok := s.players[playerKey{userID, charID}]
+	if !ok {
+		writeText(w, http.StatusOK, "更新されたレコード数: 0")
+		return
+	}
+	// A parameter left out is set to NULL, which the select returns as 0
+	player.Exp = values["Exp"]
+	player.Parameter1 = values["Parameter1"]
+	player.Parameter2 = values["Parameter2"]
+	player.Parameter3 = values["Parameter3"]
+	player.Parameter4 = values["Parameter4"]
+	player.CurrentEventID = values["CurrentEventId"]
+	player.CurrentSeq = values["CurrentSeq"]
+	writeText(w, http.StatusOK, "更新されたレコード数: 1")
+}
+
+func (s *Server) insertUser(w http.ResponseWriter, r *http.Request) {
+	object, ok := body(r)
+	if !ok {
+		writeText(w, http.StatusBadRequest, "Invalid JSON in request body.")
+		return
+	}
+	userID, password := str(object["UserId"]), str(object["Password"])
+	if userID == "" || password == "" {
+		writeText(w, http.StatusBadRequest, "UserId と Password は必須です。")
+		return
+	}
+	if len([]rune(password)) < backendapi.MinPasswordLength {
+		writeText(w, http.StatusBadRequest, "Password は8文字以上である必要があります。")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.users[userID]; ok {
+		writeText(w, http.StatusConflict, "このUserIdは既に登録されています。")
+		return
+	}
+	s.users[userID] = password
+	writeText(w, http.StatusOK, "ユーザー登録が完了しました。")
+}
+
+func (s *Server) insertPlayer(w http.ResponseWriter, r *http.Request) {
+	object, ok := body(r)
+	if !ok {
+		writeText(w, http.StatusBadRequest, "Invalid JSON in request body.")
+		return
+	}
+	userID := str(object["UserId"])
+	if userID == "" {
+		writeText(w, http.StatusBadRequest, "UserId は必須です。")
+		return
+	}
+	charID := backendapi.DefaultCharID
+	if value, ok := object["CharId"]; ok {
+		charID, _ = integer(value)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// The primary key and the foreign key to UserData fail the insert, which
+	// the backend reports as any other database error
+	key := playerKey{userID, charID}
+	if _, ok := s.users[userID]; !ok || s.players[key] != nil {
+		writeText(w, http.StatusInternalServerError, "プレイヤーデータ初期化エラーが発生しました。")
+		return
+	}
+	s.players[key] = &backendapi.Player{
+		UserID:         userID,
+		CharID:         charID,
+		Exp:            backendapi.DefaultExp,
+		Parameter1:     backendapi.DefaultParameter,
+		Parameter2:     backendapi.DefaultParameter,
+		Parameter3:     backendapi.DefaultParameter,
+		Parameter4:     backendapi.DefaultParameter,
+		CurrentEventID: backendapi.DefaultEventID,
+		CurrentSeq:     backendapi.DefaultSeq,
+	}
+	writeText(w, http.StatusOK, "プレイヤーデータの初期化が完了しました。")
+}
+
+func (s *Server) login(w http.ResponseWriter, r *http.Request) {
+	object, ok := body(r)
+	if !ok {
+		writeText(w, http.StatusBadRequest, "Invalid JSON in request body.")
+		return
+	}
+	userID, password := str(object["UserId"]), str(object["Password"])
+	if userID == "" || password == "" {
+		writeText(w, http.StatusBadRequest, "UserId と Password は必須です。")
+		return
+	}
+
+	s.mu.Lock()
+	stored, ok := s.users[userID]
+	s.mu.Unlock()
+
+	if !ok || stored != password {
+		writeText(w, http.StatusUnauthorized, "ユーザーIDまたはパスワードが正しくありません。")
+		return
+	}
+	writeJSON(w, backendapi.LoginResponse{Result: "success", UserID: userID})
+}
+
+func writeText(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(status)
+	_, _ = w.Write([]byte(message))
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(v)
+}
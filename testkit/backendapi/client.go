@@ -0,0 +1,430 @@
+// Package backendapi is a typed client for the HTTP API of the Python Function
+// App in demo-rpg-aiapp/dev/rpg-backend-python, and the contract checks that
+// run through it. The client takes a base URL, so the same checks run against
+// the deployed Function App, a local func start or the apitest stub.
+package backendapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Routes, as function_app.py declares them. The Functions host serves them
+// under /api.
+const (
+	RouteOpenAI          = "OpenAI"
+	RouteSelectPlayer    = "SELECTPLAYER"
+	RouteSelectAllPlayer = "SELECTALLPLAYER"
+	RouteSelectEvents    = "SELECTEVENTS"
+	RouteUpdate          = "UPDATE"
+	RouteInsertUser      = "INSERTUSER"
+	RouteInsertPlayer    = "INSERTPLAYER"
+	RouteLogin           = "LOGIN"
+)
+
+// Routes lists every route in the order function_app.py declares them
+var Routes = []string{
+	RouteOpenAI,
+	RouteSelectPlayer,
+	RouteSelectAllPlayer,
+	RouteSelectEvents,
+	RouteUpdate,
+	RouteInsertUser,
+	RouteInsertPlayer,
+	RouteLogin,
+}
+
+// The values INSERTPLAYER gives a new player, and the range UPDATE accepts
+// for each parameter
+const (
+	DefaultCharID    = 1
+	DefaultExp       = 0
+	DefaultParameter = 50
+	DefaultEventID   = 1
+	DefaultSeq       = 1
+	MinParameter     = 0
+	MaxParameter     = 100
+)
+
+// MinPasswordLength is the shortest password INSERTUSER accepts
+const MinPasswordLength = 8
+
+// Player is a PlayerData row, as SELECTPLAYER and SELECTALLPLAYER return it
+type Player struct {
+	UserID         string `json:"UserId"`
+	CharID         int    `json:"CharId"`
+	Exp            int    `json:"Exp"`
+	Parameter1     int    `json:"Parameter1"`
+	Parameter2     int    `json:"Parameter2"`
+	Parameter3     int    `json:"Parameter3"`
+	Parameter4     int    `json:"Parameter4"`
+	CurrentEventID int    `json:"CurrentEventId"`
+	CurrentSeq     int    `json:"CurrentSeq"`
+}
+
+// Event is an EventData row, as SELECTEVENTS returns it
+type Event struct {
+	EventID   int    `json:"EventId"`
+	Seq       int    `json:"Seq"`
+	EventType string `json:"EventType"`
+	EventText string `json:"EventText"`
+}
+
+// PlayerList is the body of SELECTPLAYER and SELECTALLPLAYER
+type PlayerList struct {
+	List []Player `json:"List"`
+}
+
+// EventList is the body of SELECTEVENTS
+type EventList struct {
+	List []Event `json:"List"`
+}
+
+// OpenAIRequest is the body of OpenAI, which also takes message as a query
+// parameter
+type OpenAIRequest struct {
+	Message string `json:"message"`
+}
+
+// ChatCompletion is the part of the Azure OpenAI chat completion that OpenAI
+// passes through and the frontend reads
+type ChatCompletion struct {
+	ID      string `json:"id"`
+	Object  string `json:"object"`
+	Model   string `json:"model"`
+	Choices []struct {
+		Index   int `json:"index"`
+		Message struct {
+			Role    string `json:"role"`
+			Content string `json:"content"`
+		} `json:"message"`
+		FinishReason string `json:"finish_reason"`
+	} `json:"choices"`
+}
+
+// Scores are the MBTI-style scores the system prompt asks the model for, as
+// the content of the first choice
+type Scores struct {
+	Charisma  int `json:"Charisma"`
+	Intuition int `json:"Intuition"`
+	Logic     int `json:"Logic"`
+	Order     int `json:"Order"`
+}
+
+// Scores decodes the content of the first choice
+func (c *ChatCompletion) Scores() (*Scores, error) {
+	if len(c.Choices) == 0 {
+		return nil, errors.New("the completion has no choices")
+	}
+	scores := &Scores{}
+	if err := decodeExact([]byte(c.Choices[0].Message.Content), scores); err != nil {
+		return nil, fmt.Errorf("choices[0].message.content: %w", err)
+	}
+	return scores, nil
+}
+
+// SelectPlayerRequest is the body of SELECTPLAYER, which also takes UserId as
+// a query parameter
+type SelectPlayerRequest struct {
+	UserID string `json:"UserId"`
+}
+
+// UpdateRequest is the body of UPDATE. It sets every column of the player
+// UserID and CharID name.
+type UpdateRequest struct {
+	UserID         string `json:"UserId"`
+	CharID         int    `json:"CharId"`
+	Exp            int    `json:"Exp"`
+	Parameter1     int    `json:"Parameter1"`
+	Parameter2     int    `json:"Parameter2"`
+	Parameter3     int    `json:"Parameter3"`
+	Parameter4     int    `json:"Parameter4"`
+	CurrentEventID int    `json:"CurrentEventId"`
+	CurrentSeq     int    `json:"CurrentSeq"`
+}
+
+// UserRequest is the body of INSERTUSER and LOGIN
+type UserRequest struct {
+	UserID   string `json:"UserId"`
+	Password string `json:"Password"`
+}
+
+// InsertPlayerRequest is the body of INSERTPLAYER. A zero CharID leaves the
+// backend's DefaultCharID.
+type InsertPlayerRequest struct {
+	UserID string `json:"UserId"`
+	CharID int    `json:"CharId,omitempty"`
+}
+
+// LoginResponse is the body of a successful LOGIN
+type LoginResponse struct {
+	Result string `json:"result"`
+	UserID string `json:"UserId"`
+}
+
+// Client calls the backend API at BaseURL, such as
+// https://func-rpg.azurewebsites.net/api
+type Client struct {
+	BaseURL    string
+	HTTPClient *http.Client
+}
+
+// NewClient returns a client for the API at baseURL. The timeout leaves room
+// for a cold start and an OpenAI completion.
+func NewClient(baseURL string) *Client {
+	return &Client{
+		BaseURL:    strings.TrimSuffix(baseURL, "/"),
+		HTTPClient: &http.Client{Timeout: 2 * time.Minute},
+	}
+}
+
+// Response is a response from the API, whatever its status
+type Response struct {
+	StatusCode  int
+	ContentType string
+	Body        []byte
+}
+
+// Error is a response with a status other than 200. The backend answers
+// errors with a plain-text message.
+type Error struct {
+	Route      string
+	StatusCode int
+	Body       string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("backend api: %s: %d %s", e.Route, e.StatusCode, e.Body)
+}
+
+// StatusCode returns the status of an *Error, or 0 for any other error
+func StatusCode(err error) int {
+	var apiErr *Error
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode
+	}
+	return 0
+}
+
+// Do sends body, which may be nil, to route with query and returns the
+// response whatever its status, so contract checks can send malformed
+// requests. Only a transport error is returned as an error.
+func (c *Client) Do(ctx context.Context, method, route string, query url.Values, body []byte) (*Response, error) {
+	u := c.BaseURL + "/" + route
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, reader)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	return &Response{StatusCode: resp.StatusCode, ContentType: resp.Header.Get("Content-Type"), Body: data}, nil
+}
+
+// call sends request as JSON, if it is not nil, and returns the response if
+// its status is 200
+func (c *Client) call(ctx context.Context, method, route string, query url.Values, request interface{}) (*Response, error) {
+	var body []byte
+	if request != nil {
+		var err error
+		if body, err = json.Marshal(request); err != nil {
+			return nil, err
+		}
+	}
+	resp, err := c.Do(ctx, method, route, query, body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, &Error{Route: route, StatusCode: resp.StatusCode, Body: strings.TrimSpace(string(resp.Body))}
+	}
+	return resp, nil
+}
+
+// callJSON is call for a route that answers JSON, decoded into out
+func (c *Client) callJSON(ctx context.Context, method, route string, query url.Values, request, out interface{}) error {
+	resp, err := c.call(ctx, method, route, query, request)
+	if err != nil {
+		return err
+	}
+	if err := resp.checkJSON(); err != nil {
+		return fmt.Errorf("backend api: %s: %w", route, err)
+	}
+	if err := decodeExact(resp.Body, out); err != nil {
+		return fmt.Errorf("backend api: %s: %w", route, err)
+	}
+	return nil
+}
+
+// checkJSON fails unless the response is labelled as JSON
+func (r *Response) checkJSON() error {
+	mediaType, _, err := mime.ParseMediaType(r.ContentType)
+	if err != nil || mediaType != "application/json" {
+		return fmt.Errorf("Content-Type is %q, not application/json", r.ContentType)
+	}
+	return nil
+}
+
+// OpenAI scores message with the model, posted as the frontend does
+func (c *Client) OpenAI(ctx context.Context, message string) (*ChatCompletion, error) {
+	resp, err := c.call(ctx, http.MethodPost, RouteOpenAI, nil, OpenAIRequest{Message: message})
+	if err != nil {
+		return nil, err
+	}
+	if err := resp.checkJSON(); err != nil {
+		return nil, fmt.Errorf("backend api: %s: %w", RouteOpenAI, err)
+	}
+	// The route passes the whole completion through, with fields that vary
+	// by model and API version, so only the part read is held to the contract
+	completion := &ChatCompletion{}
+	if err := json.Unmarshal(resp.Body, completion); err != nil {
+		return nil, fmt.Errorf("backend api: %s: %w", RouteOpenAI, err)
+	}
+	return completion, nil
+}
+
+// SelectPlayer returns the players of userID, posted as the frontend does
+func (c *Client) SelectPlayer(ctx context.Context, userID string) ([]Player, error) {
+	var list PlayerList
+	err := c.callJSON(ctx, http.MethodPost, RouteSelectPlayer, nil, SelectPlayerRequest{UserID: userID}, &list)
+	return list.List, err
+}
+
+// SelectAllPlayer returns every player
+func (c *Client) SelectAllPlayer(ctx context.Context) ([]Player, error) {
+	var list PlayerList
+	err := c.callJSON(ctx, http.MethodGet, RouteSelectAllPlayer, nil, nil, &list)
+	return list.List, err
+}
+
+// SelectEvents returns every event
+func (c *Client) SelectEvents(ctx context.Context) ([]Event, error) {
+	var list EventList
+	err := c.callJSON(ctx, http.MethodGet, RouteSelectEvents, nil, nil, &list)
+	return list.List, err
+}
+
+// updatedPattern matches UPDATE's "更新されたレコード数: N"
+var updatedPattern = regexp.MustCompile(`:\s*(\d+)$`)
+
+// Update updates a player and returns the number of rows updated
+func (c *Client) Update(ctx context.Context, request UpdateRequest) (int, error) {
+	resp, err := c.call(ctx, http.MethodPost, RouteUpdate, nil, request)
+	if err != nil {
+		return 0, err
+	}
+	body := strings.TrimSpace(string(resp.Body))
+	match := updatedPattern.FindStringSubmatch(body)
+	if match == nil {
+		return 0, fmt.Errorf("backend api: %s: %q does not end with the number of records updated", RouteUpdate, body)
+	}
+	return strconv.Atoi(match[1])
+}
+
+// InsertUser registers a user
+func (c *Client) InsertUser(ctx context.Context, request UserRequest) error {
+	_, err := c.call(ctx, http.MethodPost, RouteInsertUser, nil, request)
+	return err
+}
+
+// InsertPlayer creates a player with the default values
+func (c *Client) InsertPlayer(ctx context.Context, request InsertPlayerRequest) error {
+	_, err := c.call(ctx, http.MethodPost, RouteInsertPlayer, nil, request)
+	return err
+}
+
+// Login checks a user's password
+func (c *Client) Login(ctx context.Context, request UserRequest) (*LoginResponse, error) {
+	login := &LoginResponse{}
+	if err := c.callJSON(ctx, http.MethodPost, RouteLogin, nil, request, login); err != nil {
+		return nil, err
+	}
+	return login, nil
+}
+
+// decodeExact unmarshals data into v and fails on any field v does not
+// declare, or declares without omitempty and data lacks, so a renamed or
+// dropped column breaks the contract instead of decoding to a zero value
+func decodeExact(data []byte, v interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		return err
+	}
+	var raw interface{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	return missingFields(raw, reflect.TypeOf(v), "")
+}
+
+// missingFields reports the first field of typ that raw lacks. path names
+// the value raw is, such as List[0].
+func missingFields(raw interface{}, typ reflect.Type, path string) error {
+	for typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	switch typ.Kind() {
+	case reflect.Struct:
+		object, ok := raw.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		for i := 0; i < typ.NumField(); i++ {
+			field := typ.Field(i)
+			name, options, _ := strings.Cut(field.Tag.Get("json"), ",")
+			if !field.IsExported() || name == "-" {
+				continue
+			}
+			if name == "" {
+				name = field.Name
+			}
+			value, ok := object[name]
+			if !ok {
+				if strings.Contains(options, "omitempty") {
+					continue
+				}
+				return fmt.Errorf("%s%s is missing", path, name)
+			}
+			if err := missingFields(value, field.Type, path+name+"."); err != nil {
+				return err
+			}
+		}
+	case reflect.Slice:
+		items, _ := raw.([]interface{})
+		for i, item := range items {
+			if err := missingFields(item, typ.Elem(), fmt.Sprintf("%s[%d].", strings.TrimSuffix(path, "."), i)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
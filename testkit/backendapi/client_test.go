@@ -0,0 +1,94 @@
+package backendapi_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/vanehru/terraform-modules/testkit/backendapi"
+	"github.com/vanehru/terraform-modules/testkit/backendapi/apitest"
+)
+
+func TestValidate(t *testing.T) {
+	t.Parallel()
+
+	server := apitest.NewServer(t)
+	backendapi.Validate(t, backendapi.NewClient(server.BaseURL()+"/"), "contract-user")
+
+	player, ok := server.Player("contract-user", backendapi.DefaultCharID)
+	require.True(t, ok)
+	assert.Equal(t, 95, player.Parameter1, "the UPDATE check should have written the player")
+}
+
+func TestClient(t *testing.T) {
+	t.Parallel()
+
+	server := apitest.NewServer(t)
+	server.Scores = backendapi.Scores{Charisma: 95, Intuition: 80, Logic: 35, Order: 70}
+	server.AddEvent(backendapi.Event{EventID: 1, Seq: 2, EventType: "choice", EventText: "どうする？"})
+	client := backendapi.NewClient(server.BaseURL())
+	ctx := context.Background()
+
+	completion, err := client.OpenAI(ctx, "今すぐ皆を集めて相談乗る")
+	require.NoError(t, err)
+	scores, err := completion.Scores()
+	require.NoError(t, err)
+	assert.Equal(t, server.Scores, *scores)
+
+	events, err := client.SelectEvents(ctx)
+	require.NoError(t, err)
+	require.Len(t, events, 2)
+	assert.Equal(t, "choice", events[1].EventType)
+
+	err = client.InsertUser(ctx, backendapi.UserRequest{UserID: "player1", Password: "short"})
+	var apiErr *backendapi.Error
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, http.StatusBadRequest, apiErr.StatusCode)
+	assert.EqualError(t, err, "backend api: INSERTUSER: 400 Password は8文字以上である必要があります。")
+
+	err = client.InsertPlayer(ctx, backendapi.InsertPlayerRequest{UserID: "player1"})
+	assert.Equal(t, http.StatusInternalServerError, backendapi.StatusCode(err), "a player needs a registered user")
+	assert.Zero(t, backendapi.StatusCode(context.Canceled))
+}
+
+func TestClientShapes(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		wantErr     string
+	}{
+		{"Exact", "application/json", `{"List":[{"UserId":"u","CharId":1,"Exp":0,"Parameter1":50,"Parameter2":50,"Parameter3":50,"Parameter4":50,"CurrentEventId":1,"CurrentSeq":null}]}`, ""},
+		{"Missing", "application/json", `{"List":[{"UserId":"u","CharId":1,"Exp":0,"Parameter1":50,"Parameter2":50,"Parameter3":50,"Parameter4":50,"CurrentEventId":1}]}`, "List[0].CurrentSeq is missing"},
+		{"Renamed", "application/json", `{"List":[{"userId":"u","CharId":1,"Exp":0,"Parameter1":50,"Parameter2":50,"Parameter3":50,"Parameter4":50,"CurrentEventId":1,"CurrentSeq":1}]}`, "List[0].UserId is missing"},
+		{"Unknown", "application/json", `{"List":[],"Count":0}`, `unknown field "Count"`},
+		{"WrongType", "application/json", `{"List":[{"UserId":"u","CharId":"one"}]}`, "cannot unmarshal string"},
+		{"NotJSON", "text/plain", `{"List":[]}`, `Content-Type is "text/plain", not application/json`},
+	}
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", tc.contentType)
+				_, _ = w.Write([]byte(tc.body))
+			}))
+			t.Cleanup(server.Close)
+
+			_, err := backendapi.NewClient(server.URL).SelectAllPlayer(context.Background())
+			if tc.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.ErrorContains(t, err, "backend api: SELECTALLPLAYER: ")
+			assert.ErrorContains(t, err, tc.wantErr)
+		})
+	}
+}
@@ -0,0 +1,171 @@
+package backendapi
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Validate runs the API contract against the backend at client: each route's
+// status codes, response shape and validation errors. It registers userID
+// and creates its player, so userID must be new to the backend's database on
+// every run. The backend has no route to delete either.
+func Validate(t *testing.T, client *Client, userID string) {
+	ctx := context.Background()
+	password := "contract-" + userID
+
+	t.Run(RouteOpenAI, func(t *testing.T) {
+		expectError(t, client, http.MethodPost, RouteOpenAI, jsonBody(t, OpenAIRequest{}), http.StatusBadRequest, "message")
+
+		completion, err := client.OpenAI(ctx, "一人で要件洗い出して計画立てる")
+		require.NoError(t, err)
+		scores, err := completion.Scores()
+		require.NoError(t, err)
+		for axis, score := range map[string]int{
+			"Charisma": scores.Charisma, "Intuition": scores.Intuition, "Logic": scores.Logic, "Order": scores.Order,
+		} {
+			assert.True(t, score >= MinParameter && score <= MaxParameter, "%s score %d should be between %d and %d", axis, score, MinParameter, MaxParameter)
+		}
+	})
+
+	t.Run(RouteInsertUser, func(t *testing.T) {
+		expectError(t, client, http.MethodPost, RouteInsertUser, []byte("not json"), http.StatusBadRequest, "Invalid JSON")
+		expectError(t, client, http.MethodPost, RouteInsertUser, jsonBody(t, map[string]interface{}{"UserId": userID}), http.StatusBadRequest, "Password")
+		expectError(t, client, http.MethodPost, RouteInsertUser, jsonBody(t, UserRequest{UserID: userID, Password: "short"}), http.StatusBadRequest, "Password")
+
+		require.NoError(t, client.InsertUser(ctx, UserRequest{UserID: userID, Password: password}))
+		err := client.InsertUser(ctx, UserRequest{UserID: userID, Password: password})
+		assert.Equal(t, http.StatusConflict, StatusCode(err), "registering %s twice: %v", userID, err)
+	})
+
+	t.Run(RouteLogin, func(t *testing.T) {
+		expectError(t, client, http.MethodPost, RouteLogin, []byte("not json"), http.StatusBadRequest, "Invalid JSON")
+		expectError(t, client, http.MethodPost, RouteLogin, jsonBody(t, map[string]interface{}{"UserId": userID}), http.StatusBadRequest, "Password")
+
+		login, err := client.Login(ctx, UserRequest{UserID: userID, Password: password})
+		require.NoError(t, err)
+		assert.Equal(t, LoginResponse{Result: "success", UserID: userID}, *login)
+
+		_, err = client.Login(ctx, UserRequest{UserID: userID, Password: password + "-wrong"})
+		assert.Equal(t, http.StatusUnauthorized, StatusCode(err), "a wrong password: %v", err)
+		_, err = client.Login(ctx, UserRequest{UserID: userID + "-unknown", Password: password})
+		assert.Equal(t, http.StatusUnauthorized, StatusCode(err), "an unknown user: %v", err)
+	})
+
+	t.Run(RouteInsertPlayer, func(t *testing.T) {
+		expectError(t, client, http.MethodPost, RouteInsertPlayer, []byte("not json"), http.StatusBadRequest, "Invalid JSON")
+		expectError(t, client, http.MethodPost, RouteInsertPlayer, jsonBody(t, map[string]interface{}{}), http.StatusBadRequest, "UserId")
+
+		require.NoError(t, client.InsertPlayer(ctx, InsertPlayerRequest{UserID: userID}))
+	})
+
+	t.Run(RouteSelectPlayer, func(t *testing.T) {
+		expectError(t, client, http.MethodPost, RouteSelectPlayer, jsonBody(t, SelectPlayerRequest{}), http.StatusBadRequest, "UserId")
+
+		players, err := client.SelectPlayer(ctx, userID)
+		require.NoError(t, err)
+		assert.Equal(t, []Player{{
+			UserID:         userID,
+			CharID:         DefaultCharID,
+			Exp:            DefaultExp,
+			Parameter1:     DefaultParameter,
+			Parameter2:     DefaultParameter,
+			Parameter3:     DefaultParameter,
+			Parameter4:     DefaultParameter,
+			CurrentEventID: DefaultEventID,
+			CurrentSeq:     DefaultSeq,
+		}}, players, "INSERTPLAYER should create one player with the defaults")
+
+		// The route reads UserId from the query string too
+		resp, err := client.Do(ctx, http.MethodGet, RouteSelectPlayer, url.Values{"UserId": {userID}}, nil)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, resp.StatusCode, string(resp.Body))
+		var list PlayerList
+		require.NoError(t, decodeExact(resp.Body, &list))
+		assert.Equal(t, players, list.List)
+
+		players, err = client.SelectPlayer(ctx, userID+"-unknown")
+		require.NoError(t, err)
+		assert.Empty(t, players, "an unknown user has no players")
+	})
+
+	t.Run(RouteUpdate, func(t *testing.T) {
+		expectError(t, client, http.MethodPost, RouteUpdate, []byte("not json"), http.StatusBadRequest, "Invalid JSON")
+		expectError(t, client, http.MethodPost, RouteUpdate, jsonBody(t, map[string]interface{}{"UserId": userID}), http.StatusBadRequest, "CharId")
+		expectError(t, client, http.MethodPost, RouteUpdate,
+			jsonBody(t, map[string]interface{}{"UserId": userID, "CharId": DefaultCharID, "Parameter1": MaxParameter + 1}),
+			http.StatusBadRequest, "Parameter1 must be between 0 and 100")
+		expectError(t, client, http.MethodPost, RouteUpdate,
+			jsonBody(t, map[string]interface{}{"UserId": userID, "CharId": DefaultCharID, "Parameter2": MinParameter - 1}),
+			http.StatusBadRequest, "Parameter2 must be between 0 and 100")
+		expectError(t, client, http.MethodPost, RouteUpdate,
+			jsonBody(t, map[string]interface{}{"UserId": userID, "CharId": DefaultCharID, "Parameter3": "high"}),
+			http.StatusBadRequest, "Parameter3 must be a valid number")
+
+		update := UpdateRequest{
+			UserID: userID, CharID: DefaultCharID, Exp: 120,
+			Parameter1: 95, Parameter2: 20, Parameter3: 80, Parameter4: 5,
+			CurrentEventID: DefaultEventID, CurrentSeq: DefaultSeq + 1,
+		}
+		updated, err := client.Update(ctx, update)
+		require.NoError(t, err)
+		assert.Equal(t, 1, updated)
+
+		players, err := client.SelectPlayer(ctx, userID)
+		require.NoError(t, err)
+		assert.Equal(t, []Player{Player(update)}, players, "SELECTPLAYER should return what UPDATE wrote")
+
+		update.UserID += "-unknown"
+		updated, err = client.Update(ctx, update)
+		require.NoError(t, err)
+		assert.Equal(t, 0, updated, "an unknown player should update nothing")
+	})
+
+	t.Run(RouteSelectAllPlayer, func(t *testing.T) {
+		players, err := client.SelectAllPlayer(ctx)
+		require.NoError(t, err)
+		found := false
+		for _, player := range players {
+			found = found || player.UserID == userID
+		}
+		assert.True(t, found, "SELECTALLPLAYER should list %s", userID)
+	})
+
+	t.Run(RouteSelectEvents, func(t *testing.T) {
+		// The migrations seed no events, so an empty list is valid; decoding
+		// already rejects any element with a field missing, renamed or of the
+		// wrong type
+		events, err := client.SelectEvents(ctx)
+		require.NoError(t, err)
+		assert.NotNil(t, events, "SELECTEVENTS should return a list, even an empty one")
+		seen := map[[2]int]bool{}
+		for _, event := range events {
+			key := [2]int{event.EventID, event.Seq}
+			assert.False(t, seen[key], "event %d/%d is listed twice", event.EventID, event.Seq)
+			seen[key] = true
+		}
+	})
+}
+
+// expectError sends a request that should fail with status, and a plain-text
+// message that contains mention, naming the offending parameter
+func expectError(t *testing.T, client *Client, method, route string, body []byte, status int, mention string) {
+	t.Helper()
+	resp, err := client.Do(context.Background(), method, route, nil, body)
+	require.NoError(t, err)
+	if assert.Equal(t, status, resp.StatusCode, "%s %s with %q: %s", method, route, body, resp.Body) {
+		assert.Contains(t, string(resp.Body), mention, "%s %s with %q", method, route, body)
+	}
+}
+
+func jsonBody(t *testing.T, v interface{}) []byte {
+	t.Helper()
+	data, err := json.Marshal(v)
+	require.NoError(t, err)
+	return data
+}
@@ -0,0 +1,73 @@
+package backendapi
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/vanehru/terraform-modules/testkit/migrate"
+)
+
+// MigrationsDir holds the versioned SQL files that create the tables in
+// Schema, relative to the repository root
+const MigrationsDir = "demo-rpg-aiapp/dev/rpg-backend-python/migrations"
+
+// FindMigrations returns MigrationsDir under dir or the nearest of its parents
+// that has it, so a test in any directory of the repository finds it
+func FindMigrations(dir string) (string, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	for {
+		candidate := filepath.Join(abs, filepath.FromSlash(MigrationsDir))
+		if info, err := os.Stat(candidate); err == nil && info.IsDir() {
+			return candidate, nil
+		}
+		parent := filepath.Dir(abs)
+		if parent == abs {
+			return "", fmt.Errorf("no %s in %s or any of its parents", MigrationsDir, dir)
+		}
+		abs = parent
+	}
+}
+
+// Schema is the tables function_app.py reads and writes. PlayerData and
+// EventData list the columns its SELECTs read, in the order
+// row_to_player_dict and row_to_event_dict index them, which is also the
+// order of the JSON fields of Player and Event.
+var Schema = []migrate.Table{
+	{
+		Name: "UserData",
+		Columns: []migrate.Column{
+			{Name: "UserId", Type: "nvarchar"},
+			{Name: "Password", Type: "nvarchar"},
+		},
+		PrimaryKey: []string{"UserId"},
+	},
+	{
+		Name: "PlayerData",
+		Columns: []migrate.Column{
+			{Name: "UserId", Type: "nvarchar"},
+			{Name: "CharId", Type: "int"},
+			{Name: "Exp", Type: "int"},
+			{Name: "Parameter1", Type: "int"},
+			{Name: "Parameter2", Type: "int"},
+			{Name: "Parameter3", Type: "int"},
+			{Name: "Parameter4", Type: "int"},
+			{Name: "CurrentEventId", Type: "int"},
+			{Name: "CurrentSeq", Type: "int"},
+		},
+		PrimaryKey: []string{"UserId", "CharId"},
+	},
+	{
+		Name: "EventData",
+		Columns: []migrate.Column{
+			{Name: "EventId", Type: "int"},
+			{Name: "Seq", Type: "int"},
+			{Name: "EventType", Type: "nvarchar"},
+			{Name: "EventText", Type: "nvarchar"},
+		},
+		PrimaryKey: []string{"EventId", "Seq"},
+	},
+}
@@ -0,0 +1,52 @@
+package backendapi_test
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/vanehru/terraform-modules/testkit/backendapi"
+	"github.com/vanehru/terraform-modules/testkit/migrate"
+)
+
+func TestFindMigrations(t *testing.T) {
+	t.Parallel()
+
+	dir, err := backendapi.FindMigrations(".")
+	require.NoError(t, err)
+	want, err := filepath.Abs(filepath.Join("..", "..", filepath.FromSlash(backendapi.MigrationsDir)))
+	require.NoError(t, err)
+	assert.Equal(t, want, dir)
+
+	_, err = backendapi.FindMigrations(t.TempDir())
+	assert.ErrorContains(t, err, "no "+backendapi.MigrationsDir)
+}
+
+// TestSchemaMatchesRows checks that the PlayerData and EventData columns are
+// the fields of Player and Event, in the same order and of matching types
+func TestSchemaMatchesRows(t *testing.T) {
+	t.Parallel()
+
+	tables := map[string]migrate.Table{}
+	for _, table := range backendapi.Schema {
+		tables[table.Name] = table
+	}
+	for name, row := range map[string]interface{}{
+		"PlayerData": backendapi.Player{},
+		"EventData":  backendapi.Event{},
+	} {
+		table, ok := tables[name]
+		require.True(t, ok, name)
+		rowType := reflect.TypeOf(row)
+		require.Len(t, table.Columns, rowType.NumField(), name)
+		for i, column := range table.Columns {
+			field := rowType.Field(i)
+			assert.Equal(t, field.Tag.Get("json"), column.Name, "%s column %d", name, i)
+			want := map[reflect.Kind]string{reflect.Int: "int", reflect.String: "nvarchar"}[field.Type.Kind()]
+			assert.Equal(t, want, column.Type, "%s.%s", name, column.Name)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+// Package callerip finds the public IPv4 address the deploying tests reach
+// Azure from, which the RPG AI App stack adds to its Key Vault firewall. The
+// root configuration takes it as the caller_ip variable, so a plan only asks
+// a lookup service such as api.ipify.org when nobody supplied it.
+package callerip
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"testing"
+)
+
+// DefaultURL is the lookup service Detect and the root configuration ask by
+// default. It answers a GET with the caller's address as plain text.
+const DefaultURL = "https://api.ipify.org?format=text"
+
+// Placeholder is an address from the documentation range 203.0.113.0/24, for
+// runs that reach no real Key Vault, such as against a fake ARM server
+var Placeholder = netip.MustParseAddr("203.0.113.10")
+
+// maxResponse caps how much of a lookup response Detect reads
+const maxResponse = 64
+
+// Parse reads an address as the lookup service returns it. Key Vault network
+// rules take IPv4 addresses only.
+func Parse(s string) (netip.Addr, error) {
+	addr, err := netip.ParseAddr(strings.TrimSpace(s))
+	if err != nil {
+		return netip.Addr{}, err
+	}
+	if !addr.Is4() {
+		return netip.Addr{}, fmt.Errorf("%s is not an IPv4 address", addr)
+	}
+	return addr, nil
+}
+
+// Detect asks the lookup service at url for the caller's public address
+func Detect(ctx context.Context, url string) (netip.Addr, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return netip.Addr{}, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return netip.Addr{}, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxResponse))
+	if err != nil {
+		return netip.Addr{}, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return netip.Addr{}, fmt.Errorf("GET %s: %s", url, resp.Status)
+	}
+	addr, err := Parse(string(body))
+	if err != nil {
+		return netip.Addr{}, fmt.Errorf("GET %s: %w", url, err)
+	}
+	return addr, nil
+}
+
+// NewServer starts a stand-in for the lookup service that answers every GET
+// with addr, and closes it when t completes. Pass its URL as the root's
+// caller_ip_url to plan without internet access.
+func NewServer(t testing.TB, addr netip.Addr) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain")
+		io.WriteString(w, addr.String())
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
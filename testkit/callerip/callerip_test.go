@@ -0,0 +1,57 @@
+package callerip
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	t.Parallel()
+
+	addr, err := Parse("198.51.100.7\n")
+	require.NoError(t, err)
+	assert.Equal(t, netip.MustParseAddr("198.51.100.7"), addr)
+
+	_, err = Parse("2001:db8::1")
+	assert.EqualError(t, err, "2001:db8::1 is not an IPv4 address")
+	_, err = Parse("<html>")
+	assert.Error(t, err)
+}
+
+func TestDetect(t *testing.T) {
+	t.Parallel()
+
+	server := NewServer(t, Placeholder)
+	addr, err := Detect(context.Background(), server.URL)
+	require.NoError(t, err)
+	assert.Equal(t, Placeholder, addr)
+
+	resp, err := http.Post(server.URL, "text/plain", nil)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
+}
+
+func TestDetectErrors(t *testing.T) {
+	t.Parallel()
+
+	unavailable := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "rate limited", http.StatusTooManyRequests)
+	}))
+	defer unavailable.Close()
+	_, err := Detect(context.Background(), unavailable.URL)
+	assert.EqualError(t, err, "GET "+unavailable.URL+": 429 Too Many Requests")
+
+	html := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("<html>captive portal</html>"))
+	}))
+	defer html.Close()
+	_, err = Detect(context.Background(), html.URL)
+	assert.ErrorContains(t, err, "GET "+html.URL+": ")
+}
@@ -0,0 +1,201 @@
+// Command driftcheck reports what has changed in a deployed stack since
+// Terraform last applied it, such as a Key Vault firewall opened or OpenAI
+// made public in the portal. Run it from a suite's test directory, so it
+// reads the suite's test-config.yml, against the root configuration and state
+// in the directory above:
+//
+//	go run github.com/vanehru/terraform-modules/testkit/cmd/driftcheck
+//
+// It runs terraform init, `terraform plan -detailed-exitcode -json` and
+// terraform show through Terratest, authenticating with the service principal
+// in test-config.yml or the ARM_* variables, or else with the Azure CLI. It
+// then reports the plan's resource_drift and resource_changes, each change
+// categorized as security-relevant, tag-only or cosmetic. With -plan-json it
+// reads a saved `terraform show -json` plan instead of running Terraform.
+//
+// For scheduled runs, it exits 0 when nothing drifted and the plan changes
+// nothing, 2 when the worst change is tag-only or cosmetic, 3 when any change
+// is security-relevant, and 1 if it could not run, as terraform plan
+// -detailed-exitcode does for its 0, 1 and 2.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	terratesting "github.com/gruntwork-io/terratest/modules/testing"
+
+	"github.com/vanehru/terraform-modules/testkit/config"
+	"github.com/vanehru/terraform-modules/testkit/drift"
+)
+
+// Exit codes
+const (
+	exitClean    = 0
+	exitError    = 1
+	exitDrift    = 2
+	exitSecurity = 3
+)
+
+// varFiles is a flag that may be repeated
+type varFiles []string
+
+func (v *varFiles) String() string {
+	return strings.Join(*v, ",")
+}
+
+func (v *varFiles) Set(value string) error {
+	*v = append(*v, value)
+	return nil
+}
+
+func main() {
+	os.Exit(run())
+}
+
+func run() int {
+	configPath := os.Getenv("TEST_CONFIG")
+	if configPath == "" {
+		configPath = config.DefaultPath
+	}
+	var varFileFlag varFiles
+	flag.StringVar(&configPath, "config", configPath, "test configuration to read credentials from")
+	dir := flag.String("dir", "..", "Terraform root configuration, with the state to compare")
+	flag.Var(&varFileFlag, "var-file", "variable file to plan with, relative to -dir; repeatable")
+	planJSON := flag.String("plan-json", "", "read this `terraform show -json` plan instead of running Terraform")
+	out := flag.String("out", "", "also write the plan JSON to this file")
+	jsonOutput := flag.Bool("json", false, "write the report as JSON")
+	flag.Parse()
+
+	var data []byte
+	var err error
+	if *planJSON != "" {
+		data, err = os.ReadFile(*planJSON)
+	} else {
+		data, err = plan(configPath, *dir, varFileFlag)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "driftcheck:", err)
+		return exitError
+	}
+	if *out != "" {
+		if err := os.WriteFile(*out, data, 0o644); err != nil {
+			fmt.Fprintln(os.Stderr, "driftcheck:", err)
+			return exitError
+		}
+	}
+
+	report, err := drift.Parse(strings.NewReader(string(data)))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "driftcheck:", err)
+		return exitError
+	}
+	if *jsonOutput {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		err = encoder.Encode(report)
+	} else {
+		err = writeText(os.Stdout, report)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "driftcheck:", err)
+		return exitError
+	}
+
+	switch report.Category() {
+	case "":
+		return exitClean
+	case drift.Security:
+		return exitSecurity
+	default:
+		return exitDrift
+	}
+}
+
+// plan runs terraform plan against dir and returns the plan as JSON
+func plan(configPath, dir string, varFiles []string) ([]byte, error) {
+	cfg, err := config.Load(configPath)
+	if err != nil {
+		return nil, err
+	}
+	planFile, err := os.CreateTemp("", "driftcheck-plan-")
+	if err != nil {
+		return nil, err
+	}
+	planFile.Close()
+	defer os.Remove(planFile.Name())
+
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	// Terratest logs Terraform's output to os.Stdout, which holds the report
+	stdout := os.Stdout
+	os.Stdout = os.Stderr
+	defer func() { os.Stdout = stdout }()
+
+	t := cli{}
+	options := terraform.WithDefaultRetryableErrors(t, &terraform.Options{
+		TerraformDir: absDir,
+		VarFiles:     varFiles,
+		EnvVars:      cfg.EnvVars(),
+		NoColor:      true,
+		PlanFilePath: planFile.Name(),
+	})
+
+	if _, err := terraform.InitE(t, options); err != nil {
+		return nil, err
+	}
+	// A failed plan is exit code 1 rather than an error
+	args := terraform.FormatArgs(options, "plan", "-input=false", "-detailed-exitcode", "-json")
+	if code, err := terraform.GetExitCodeForTerraformCommandE(t, options, args...); err != nil {
+		return nil, err
+	} else if code != 0 && code != 2 {
+		return nil, fmt.Errorf("terraform plan exited with %d", code)
+	}
+	show, err := terraform.ShowE(t, options)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(show), nil
+}
+
+// writeText writes the report and a one-line summary
+func writeText(w io.Writer, report *drift.Report) error {
+	if err := report.WriteText(w); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintf(w, "%d security-relevant, %d tag-only, %d cosmetic\n",
+		report.Count(drift.Security), report.Count(drift.Tags), report.Count(drift.Cosmetic))
+	return err
+}
+
+// cli is the testing.TestingT Terratest runs under outside go test. Only the
+// E functions, which return their errors, are called with it.
+type cli struct{}
+
+var _ terratesting.TestingT = cli{}
+
+func (cli) Fail()    {}
+func (cli) FailNow() { os.Exit(exitError) }
+func (c cli) Fatal(args ...interface{}) {
+	c.Error(args...)
+	c.FailNow()
+}
+func (c cli) Fatalf(format string, args ...interface{}) {
+	c.Errorf(format, args...)
+	c.FailNow()
+}
+func (cli) Error(args ...interface{}) {
+	fmt.Fprintln(os.Stderr, append([]interface{}{"driftcheck:"}, args...)...)
+}
+func (cli) Errorf(format string, args ...interface{}) {
+	fmt.Fprintf(os.Stderr, "driftcheck: "+format+"\n", args...)
+}
+func (cli) Name() string { return "driftcheck" }
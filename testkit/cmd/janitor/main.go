@@ -0,0 +1,103 @@
+// Command janitor deletes the test resource groups that have outlived a TTL,
+// such as those a killed go test left running. Run it from a suite's test
+// directory, so it reads the suite's test-config.yml:
+//
+//	go run github.com/vanehru/terraform-modules/testkit/cmd/janitor -dry-run
+//
+// It considers the groups whose names start with the resource_prefix from
+// test-config.yml or a legacy suite prefix, or with each -prefix given
+// instead, and deletes those whose testkit-created tag is older than -ttl. It
+// authenticates as the tests do: with the service principal in
+// test-config.yml or the ARM_* variables, or else with the Azure CLI. It
+// exits 1 if a delete failed and 2 if it could not run.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/vanehru/terraform-modules/testkit/arm"
+	"github.com/vanehru/terraform-modules/testkit/config"
+	"github.com/vanehru/terraform-modules/testkit/janitor"
+)
+
+// prefixes is a flag that may be repeated
+type prefixes []string
+
+func (p *prefixes) String() string {
+	return strings.Join(*p, ",")
+}
+
+func (p *prefixes) Set(value string) error {
+	*p = append(*p, value)
+	return nil
+}
+
+func main() {
+	os.Exit(run())
+}
+
+func run() int {
+	configPath := os.Getenv("TEST_CONFIG")
+	if configPath == "" {
+		configPath = config.DefaultPath
+	}
+	var prefixFlag prefixes
+	flag.StringVar(&configPath, "config", configPath, "test configuration to read the resource prefix and credentials from")
+	ttl := flag.Duration("ttl", janitor.DefaultTTL, "delete groups created longer ago than this")
+	flag.Var(&prefixFlag, "prefix", "delete only groups whose names start with this, instead of the configured prefixes; repeatable")
+	dryRun := flag.Bool("dry-run", false, "report what would be deleted without deleting it")
+	jsonOutput := flag.Bool("json", false, "write the report as JSON")
+	includeUntagged := flag.Bool("include-untagged", false, "also delete matching groups without a "+janitor.CreatedTag+" tag")
+	timeout := flag.Duration("timeout", 5*time.Minute, "give up after this long")
+	flag.Parse()
+
+	cfg, err := config.Load(configPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "janitor:", err)
+		return 2
+	}
+	if len(prefixFlag) == 0 {
+		prefixFlag = janitor.Prefixes(cfg)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+	client, err := arm.FromConfig(ctx, cfg)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "janitor:", err)
+		return 2
+	}
+	report, err := janitor.Run(ctx, client, janitor.Options{
+		Prefixes:        prefixFlag,
+		TTL:             *ttl,
+		DryRun:          *dryRun,
+		IncludeUntagged: *includeUntagged,
+	})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "janitor:", err)
+		return 2
+	}
+
+	if *jsonOutput {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		err = encoder.Encode(report)
+	} else {
+		err = report.WriteText(os.Stdout)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "janitor:", err)
+		return 2
+	}
+	if failed := report.Failed(); len(failed) > 0 {
+		fmt.Fprintf(os.Stderr, "janitor: %d deletes failed\n", len(failed))
+		return 1
+	}
+	return 0
+}
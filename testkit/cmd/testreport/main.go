@@ -0,0 +1,88 @@
+// Command testreport turns go test -json output into a JUnit XML report and
+// a standalone HTML summary:
+//
+//	go test -json -timeout 120m -run TestRPGAIAppInfrastructure > test-output.json
+//	go run github.com/vanehru/terraform-modules/testkit/cmd/testreport -junit test-report.xml -html test-report.html test-output.json
+//
+// It reads standard input without a file argument. It prints a one-line
+// summary and exits 0 once the reports are written, whether or not the tests
+// passed, so a pipeline keeps go test's exit status for that.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/vanehru/terraform-modules/testkit/report"
+)
+
+func main() {
+	junitPath := flag.String("junit", "", "write a JUnit XML report to this file")
+	htmlPath := flag.String("html", "", "write an HTML summary to this file")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [-junit file] [-html file] [go-test-json-file]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() > 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if err := run(flag.Arg(0), *junitPath, *htmlPath); err != nil {
+		fmt.Fprintln(os.Stderr, "testreport:", err)
+		os.Exit(1)
+	}
+}
+
+func run(input, junitPath, htmlPath string) error {
+	var in io.Reader = os.Stdin
+	if input != "" {
+		f, err := os.Open(input)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		in = f
+	}
+	r, err := report.Parse(in)
+	if err != nil {
+		return err
+	}
+
+	if junitPath != "" {
+		if err := write(junitPath, r.WriteJUnit); err != nil {
+			return err
+		}
+	}
+	if htmlPath != "" {
+		if err := write(htmlPath, r.WriteHTML); err != nil {
+			return err
+		}
+	}
+
+	counts := r.Counts()
+	fmt.Printf("%d tests and subtests: %d passed, %d failed, %d skipped\n", counts.Tests, counts.Passed, counts.Failed, counts.Skipped)
+	for _, test := range r.Failures() {
+		if len(test.Subtests) > 0 {
+			continue
+		}
+		fmt.Printf("  %s %s: %s\n", test.Result, test.Name, test.Message())
+	}
+	return nil
+}
+
+// write creates path and writes a report to it
+func write(path string, report func(w io.Writer) error) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := report(f); err != nil {
+		f.Close()
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return f.Close()
+}
@@ -0,0 +1,447 @@
+// Package config loads test-config.yml, the per-developer settings for the
+// deploying tests: Azure credentials, region, resource name prefix, per-tier
+// timeouts and cleanup policy. Every field can be overridden from the
+// environment, so CI needs no file at all.
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/vanehru/terraform-modules/testkit/callerip"
+	"github.com/vanehru/terraform-modules/testkit/naming"
+)
+
+// DefaultPath is the file ForTest reads, relative to the test package, unless
+// TEST_CONFIG names another
+const DefaultPath = "test-config.yml"
+
+// Tier is a class of test with its own timeout
+type Tier string
+
+// Tiers, named as in the timeouts section
+const (
+	ModuleTest      Tier = "module_test"
+	IntegrationTest Tier = "integration_test"
+	FullTest        Tier = "full_test"
+)
+
+// Tiers lists every tier in the order they appear in the template
+var Tiers = []Tier{ModuleTest, IntegrationTest, FullTest}
+
+// placeholderPrefix starts every value in test-config.template.yml that must
+// be replaced before use
+const placeholderPrefix = "your-"
+
+// prefixPattern keeps generated names valid for storage accounts and Key
+// Vaults, which allow only lower-case letters and digits
+var prefixPattern = regexp.MustCompile(`^[a-z][a-z0-9]{0,9}$`)
+
+// backendURLPattern is an absolute http or https URL
+var backendURLPattern = regexp.MustCompile(`^https?://[^/\s]+(/\S*)?$`)
+
+// Config mirrors test-config.template.yml
+type Config struct {
+	Azure          Azure          `yaml:"azure"`
+	Test           Test           `yaml:"test"`
+	Infrastructure Infrastructure `yaml:"infrastructure"`
+	Notifications  Notifications  `yaml:"notifications"`
+}
+
+// Azure holds the credentials Terraform authenticates with. Empty fields fall
+// back to whatever the azurerm provider finds, such as an az login session.
+type Azure struct {
+	SubscriptionID string `yaml:"subscription_id"`
+	TenantID       string `yaml:"tenant_id"`
+	ClientID       string `yaml:"client_id"`
+	ClientSecret   string `yaml:"client_secret"`
+}
+
+// Test holds the settings every deploying test reads
+type Test struct {
+	DefaultRegion  string `yaml:"default_region"`
+	ResourcePrefix string `yaml:"resource_prefix"`
+	// Timeouts are in minutes, keyed by tier
+	Timeouts map[Tier]int `yaml:"timeouts"`
+	Cleanup  Cleanup      `yaml:"cleanup"`
+	Parallel Parallel     `yaml:"parallel"`
+	Cost     Cost         `yaml:"cost"`
+	// FakeARM applies every deployment against an armtest server instead of
+	// Azure
+	FakeARM bool `yaml:"fake_arm"`
+	// BackendAPIURL is the backend the API contract tests call: empty for an
+	// in-process stub, BackendAPIStack for the Function App of the deployed
+	// stack, or a base URL such as http://localhost:7071/api
+	BackendAPIURL string `yaml:"backend_api_url"`
+	// CallerIP is the public IPv4 address the Key Vault firewall allows for
+	// the deploying tests. Empty detects it once per test binary.
+	CallerIP string `yaml:"caller_ip"`
+	// SQLDatabase is the database the schema tests migrate: empty for a
+	// local SQL Server container, or SQLDatabaseStack for the database of
+	// the deployed stack
+	SQLDatabase string `yaml:"sql_database"`
+}
+
+// BackendAPIStack is the test.backend_api_url that targets the Function App
+// of the stack the deploy stage saved
+const BackendAPIStack = "stack"
+
+// SQLDatabaseStack is the test.sql_database that targets the database of the
+// stack the deploy stage saved
+const SQLDatabaseStack = "stack"
+
+// Cleanup decides what happens to deployed resources when a test ends
+type Cleanup struct {
+	// AutoDestroy destroys resources when a test ends; false keeps everything
+	AutoDestroy bool `yaml:"auto_destroy"`
+	// ForceCleanup deletes the whole resource group when terraform destroy fails
+	ForceCleanup bool `yaml:"force_cleanup"`
+	// CleanupOnFailure destroys resources of failed tests too; false keeps
+	// them for debugging
+	CleanupOnFailure bool `yaml:"cleanup_on_failure"`
+}
+
+// Parallel controls how many tests deploy at once
+type Parallel struct {
+	Enabled    bool `yaml:"enabled"`
+	MaxWorkers int  `yaml:"max_workers"`
+}
+
+// Cost holds the expected spend per run in USD
+type Cost struct {
+	MaxExpectedCost float64 `yaml:"max_expected_cost"`
+	AlertThreshold  float64 `yaml:"alert_threshold"`
+}
+
+// Infrastructure holds the sizing the template suggests for test deployments
+type Infrastructure struct {
+	VNetAddressSpace       []string `yaml:"vnet_address_space"`
+	FunctionAppSKU         string   `yaml:"function_app_sku"`
+	SQLSKU                 string   `yaml:"sql_sku"`
+	OpenAISKU              string   `yaml:"openai_sku"`
+	KeyVaultSKU            string   `yaml:"key_vault_sku"`
+	EnablePrivateEndpoints bool     `yaml:"enable_private_endpoints"`
+	EnableVNetIntegration  bool     `yaml:"enable_vnet_integration"`
+	EnableManagedIdentity  bool     `yaml:"enable_managed_identity"`
+}
+
+// Notifications configures where results are reported
+type Notifications struct {
+	Enabled         bool   `yaml:"enabled"`
+	Email           string `yaml:"email"`
+	SlackWebhook    string `yaml:"slack_webhook"`
+	NotifyOnFailure bool   `yaml:"notify_on_failure"`
+	NotifyOnSuccess bool   `yaml:"notify_on_success"`
+}
+
+// Default returns the settings used for anything test-config.yml leaves out.
+// They match test-config.template.yml.
+func Default() *Config {
+	return &Config{
+		Test: Test{
+			DefaultRegion:  "Japan East",
+			ResourcePrefix: "test",
+			Timeouts: map[Tier]int{
+				ModuleTest:      30,
+				IntegrationTest: 60,
+				FullTest:        120,
+			},
+			Cleanup: Cleanup{
+				AutoDestroy:      true,
+				CleanupOnFailure: true,
+			},
+			Parallel: Parallel{Enabled: true, MaxWorkers: 4},
+			Cost:     Cost{MaxExpectedCost: 10, AlertThreshold: 15},
+		},
+		Infrastructure: Infrastructure{
+			VNetAddressSpace:       []string{"172.16.0.0/16"},
+			FunctionAppSKU:         "P1v2",
+			SQLSKU:                 "Basic",
+			OpenAISKU:              "S0",
+			KeyVaultSKU:            "standard",
+			EnablePrivateEndpoints: true,
+			EnableVNetIntegration:  true,
+			EnableManagedIdentity:  true,
+		},
+	}
+}
+
+// envOverrides maps each environment variable to the field it overrides
+var envOverrides = []struct {
+	name string
+	set  func(c *Config, value string) error
+}{
+	{"ARM_SUBSCRIPTION_ID", func(c *Config, v string) error { c.Azure.SubscriptionID = v; return nil }},
+	{"ARM_TENANT_ID", func(c *Config, v string) error { c.Azure.TenantID = v; return nil }},
+	{"ARM_CLIENT_ID", func(c *Config, v string) error { c.Azure.ClientID = v; return nil }},
+	{"ARM_CLIENT_SECRET", func(c *Config, v string) error { c.Azure.ClientSecret = v; return nil }},
+	{"TEST_DEFAULT_REGION", func(c *Config, v string) error { c.Test.DefaultRegion = v; return nil }},
+	{"TEST_RESOURCE_PREFIX", func(c *Config, v string) error { c.Test.ResourcePrefix = v; return nil }},
+	{"TEST_TIMEOUT_MODULE", timeoutSetter(ModuleTest)},
+	{"TEST_TIMEOUT_INTEGRATION", timeoutSetter(IntegrationTest)},
+	{"TEST_TIMEOUT_FULL", timeoutSetter(FullTest)},
+	{"TEST_AUTO_DESTROY", boolSetter(func(c *Config) *bool { return &c.Test.Cleanup.AutoDestroy })},
+	{"TEST_FORCE_CLEANUP", boolSetter(func(c *Config) *bool { return &c.Test.Cleanup.ForceCleanup })},
+	{"TEST_CLEANUP_ON_FAILURE", boolSetter(func(c *Config) *bool { return &c.Test.Cleanup.CleanupOnFailure })},
+	{"TEST_FAKE_ARM", boolSetter(func(c *Config) *bool { return &c.Test.FakeARM })},
+	{"TEST_BACKEND_API_URL", func(c *Config, v string) error { c.Test.BackendAPIURL = v; return nil }},
+	{"TEST_CALLER_IP", func(c *Config, v string) error { c.Test.CallerIP = v; return nil }},
+	{"TEST_SQL_DATABASE", func(c *Config, v string) error { c.Test.SQLDatabase = v; return nil }},
+}
+
+func timeoutSetter(tier Tier) func(c *Config, value string) error {
+	return func(c *Config, value string) error {
+		minutes, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+		c.Test.Timeouts[tier] = minutes
+		return nil
+	}
+}
+
+func boolSetter(field func(c *Config) *bool) func(c *Config, value string) error {
+	return func(c *Config, value string) error {
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		*field(c) = b
+		return nil
+	}
+}
+
+// Load reads path over the defaults, applies the environment overrides and
+// validates the result. A missing file is not an error: the defaults and the
+// environment are used on their own.
+func Load(path string) (*Config, error) {
+	c := Default()
+
+	f, err := os.Open(path)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+	case err != nil:
+		return nil, err
+	default:
+		defer f.Close()
+		decoder := yaml.NewDecoder(f)
+		decoder.KnownFields(true)
+		if err := decoder.Decode(c); err != nil && !errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+
+	for _, override := range envOverrides {
+		value, ok := os.LookupEnv(override.name)
+		if !ok {
+			continue
+		}
+		if err := override.set(c, value); err != nil {
+			return nil, fmt.Errorf("%s: %w", override.name, err)
+		}
+	}
+
+	if err := c.Validate(); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return c, nil
+}
+
+// Validate reports every missing or malformed required field
+func (c *Config) Validate() error {
+	var problems []string
+	if c.Test.DefaultRegion == "" {
+		problems = append(problems, "test.default_region is required")
+	}
+	if !prefixPattern.MatchString(c.Test.ResourcePrefix) {
+		problems = append(problems, fmt.Sprintf("test.resource_prefix %q must be 1-10 lower-case letters and digits, starting with a letter", c.Test.ResourcePrefix))
+	}
+	for _, tier := range Tiers {
+		if c.Test.Timeouts[tier] <= 0 {
+			problems = append(problems, fmt.Sprintf("test.timeouts.%s must be a positive number of minutes", tier))
+		}
+	}
+	if url := c.Test.BackendAPIURL; url != "" && url != BackendAPIStack && !backendURLPattern.MatchString(url) {
+		problems = append(problems, fmt.Sprintf("test.backend_api_url %q must be empty, %q or an http(s) URL", url, BackendAPIStack))
+	}
+	if ip := c.Test.CallerIP; ip != "" {
+		if _, err := callerip.Parse(ip); err != nil {
+			problems = append(problems, fmt.Sprintf("test.caller_ip %q must be empty or an IPv4 address", ip))
+		}
+	}
+	if db := c.Test.SQLDatabase; db != "" && db != SQLDatabaseStack {
+		problems = append(problems, fmt.Sprintf("test.sql_database %q must be empty or %q", db, SQLDatabaseStack))
+	}
+	for _, field := range []struct{ key, value string }{
+		{"subscription_id", c.Azure.SubscriptionID},
+		{"tenant_id", c.Azure.TenantID},
+		{"client_id", c.Azure.ClientID},
+		{"client_secret", c.Azure.ClientSecret},
+	} {
+		if strings.HasPrefix(field.value, placeholderPrefix) {
+			problems = append(problems, fmt.Sprintf("azure.%s still holds the template placeholder", field.key))
+		}
+	}
+
+	if len(problems) > 0 {
+		return errors.New(strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// Region returns the Azure region tests deploy to
+func (c *Config) Region() string {
+	return c.Test.DefaultRegion
+}
+
+// NamePrefix returns the prefix of every generated resource name
+func (c *Config) NamePrefix() string {
+	return c.Test.ResourcePrefix
+}
+
+// ResourceName returns a name for resourceType that satisfies Azure's naming
+// rules, built from the prefix and parts such as a kind and a unique ID:
+// test-kv-abc123 for a Key Vault, teststgabc123 for a storage account
+func (c *Config) ResourceName(t testing.TB, resourceType string, parts ...string) string {
+	t.Helper()
+	name, err := naming.Generate(resourceType, append([]string{c.Test.ResourcePrefix}, parts...)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return name
+}
+
+// FakeARM reports whether deployments go to an armtest server instead of Azure
+func (c *Config) FakeARM() bool {
+	return c.Test.FakeARM
+}
+
+// BackendAPIURL returns test.backend_api_url: empty, BackendAPIStack or the
+// base URL of the backend API
+func (c *Config) BackendAPIURL() string {
+	return c.Test.BackendAPIURL
+}
+
+// SQLDatabase returns test.sql_database: empty or SQLDatabaseStack
+func (c *Config) SQLDatabase() string {
+	return c.Test.SQLDatabase
+}
+
+// CallerIP returns test.caller_ip, and false when it is empty and the
+// address has to be detected
+func (c *Config) CallerIP() (netip.Addr, bool) {
+	addr, err := callerip.Parse(c.Test.CallerIP)
+	return addr, err == nil
+}
+
+// Timeout returns how long a test of tier may take
+func (c *Config) Timeout(tier Tier) time.Duration {
+	return time.Duration(c.Test.Timeouts[tier]) * time.Minute
+}
+
+// CleanupPolicy returns what to do with resources when a test ends
+func (c *Config) CleanupPolicy() Cleanup {
+	return c.Test.Cleanup
+}
+
+// Destroy reports whether a test's resources should be destroyed, given
+// whether it failed
+func (p Cleanup) Destroy(failed bool) bool {
+	return p.AutoDestroy && (p.CleanupOnFailure || !failed)
+}
+
+// EnvVars returns the ARM_* variables for the credentials set in the file,
+// for terraform.Options.EnvVars
+func (c *Config) EnvVars() map[string]string {
+	vars := map[string]string{}
+	for name, value := range map[string]string{
+		"ARM_SUBSCRIPTION_ID": c.Azure.SubscriptionID,
+		"ARM_TENANT_ID":       c.Azure.TenantID,
+		"ARM_CLIENT_ID":       c.Azure.ClientID,
+		"ARM_CLIENT_SECRET":   c.Azure.ClientSecret,
+	} {
+		if value != "" {
+			vars[name] = value
+		}
+	}
+	return vars
+}
+
+// DeadlineMargin is how much of the go test deadline may already have passed
+// when a test checks it, such as while a parallel test waits for the serial
+// ones, so that running with -timeout equal to the tier's timeout passes
+const DeadlineMargin = 5 * time.Minute
+
+// CheckDeadline returns an error when a go test deadline leaves less than the
+// tier's timeout, less DeadlineMargin, so a test fails before deploying
+// instead of being killed half way through and leaking resources
+func (c *Config) CheckDeadline(tier Tier, deadline time.Time, ok bool) error {
+	if !ok {
+		return nil
+	}
+	if remaining := time.Until(deadline); remaining < c.Timeout(tier)-DeadlineMargin {
+		return fmt.Errorf("%s needs %s but go test -timeout leaves %s; rerun with -timeout %s or lower test.timeouts.%s",
+			tier, c.Timeout(tier), remaining.Round(time.Second), c.Timeout(tier), tier)
+	}
+	return nil
+}
+
+// DefaultGoTestTimeout is the -timeout go test passes when none is given
+const DefaultGoTestTimeout = 10 * time.Minute
+
+// RequireTimeout fails t unless the go test deadline leaves the tier's
+// timeout, less DeadlineMargin. Under go test's default timeout it skips t
+// instead, so a plain go test ./... stays green and says what to rerun with.
+func (c *Config) RequireTimeout(t *testing.T, tier Tier) {
+	t.Helper()
+	deadline, ok := t.Deadline()
+	err := c.CheckDeadline(tier, deadline, ok)
+	if err == nil {
+		return
+	}
+	if isDefaultTimeout(flag.Lookup("test.timeout")) {
+		t.Skipf("skipping under go test's default timeout: %v", err)
+	}
+	t.Fatal(err)
+}
+
+// isDefaultTimeout reports whether the -test.timeout flag still has the value
+// go test gives it when no -timeout was given
+func isDefaultTimeout(f *flag.Flag) bool {
+	return f == nil || f.Value.String() == DefaultGoTestTimeout.String()
+}
+
+var (
+	loadOnce sync.Once
+	loaded   *Config
+	loadErr  error
+)
+
+// ForTest returns the configuration for this test binary, loaded once from
+// the file named by TEST_CONFIG or else DefaultPath. An invalid file fails t.
+func ForTest(t *testing.T) *Config {
+	t.Helper()
+	loadOnce.Do(func() {
+		path := os.Getenv("TEST_CONFIG")
+		if path == "" {
+			path = DefaultPath
+		}
+		loaded, loadErr = Load(path)
+	})
+	if loadErr != nil {
+		t.Fatal(loadErr)
+	}
+	return loaded
+}
@@ -0,0 +1,174 @@
+package config
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// clearEnv unsets every override for the duration of t, so the host
+// environment cannot leak into a test
+func clearEnv(t *testing.T) {
+	for _, override := range envOverrides {
+		// Setenv restores the original value when t ends
+		t.Setenv(override.name, "")
+		os.Unsetenv(override.name)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	clearEnv(t)
+
+	c, err := Load("testdata/test-config.yml")
+	require.NoError(t, err)
+
+	assert.Equal(t, "Japan West", c.Region())
+	assert.Equal(t, "ci", c.NamePrefix())
+	assert.Equal(t, "ci-rg-abc123", c.ResourceName(t, "azurerm_resource_group", "rg", "abc123"))
+	assert.Equal(t, "cistgabc123", c.ResourceName(t, "azurerm_storage_account", "stg", "abc123"))
+
+	// Keys the file leaves out keep their defaults
+	assert.Equal(t, 45*time.Minute, c.Timeout(ModuleTest))
+	assert.Equal(t, 60*time.Minute, c.Timeout(IntegrationTest))
+	assert.Equal(t, 120*time.Minute, c.Timeout(FullTest))
+	assert.Equal(t, Cleanup{AutoDestroy: true, CleanupOnFailure: false}, c.CleanupPolicy())
+	_, ok := c.CallerIP()
+	assert.False(t, ok, "an empty caller_ip is detected")
+
+	assert.Equal(t, map[string]string{
+		"ARM_SUBSCRIPTION_ID": "00000000-0000-0000-0000-000000000001",
+		"ARM_TENANT_ID":       "00000000-0000-0000-0000-000000000002",
+	}, c.EnvVars())
+}
+
+func TestLoadMissingFile(t *testing.T) {
+	clearEnv(t)
+
+	c, err := Load(filepath.Join(t.TempDir(), DefaultPath))
+	require.NoError(t, err)
+	assert.Equal(t, Default(), c)
+}
+
+func TestLoadEnvOverrides(t *testing.T) {
+	clearEnv(t)
+	t.Setenv("TEST_DEFAULT_REGION", "East Asia")
+	t.Setenv("TEST_RESOURCE_PREFIX", "pr42")
+	t.Setenv("TEST_TIMEOUT_FULL", "90")
+	t.Setenv("TEST_AUTO_DESTROY", "false")
+	t.Setenv("TEST_FAKE_ARM", "true")
+	t.Setenv("TEST_BACKEND_API_URL", "http://localhost:7071/api")
+	t.Setenv("TEST_CALLER_IP", "198.51.100.7")
+	t.Setenv("TEST_SQL_DATABASE", SQLDatabaseStack)
+	t.Setenv("ARM_CLIENT_ID", "client")
+
+	c, err := Load("testdata/test-config.yml")
+	require.NoError(t, err)
+
+	assert.Equal(t, "East Asia", c.Region())
+	assert.Equal(t, "pr42", c.NamePrefix())
+	assert.Equal(t, 90*time.Minute, c.Timeout(FullTest))
+	assert.False(t, c.CleanupPolicy().AutoDestroy)
+	assert.True(t, c.FakeARM())
+	assert.Equal(t, "http://localhost:7071/api", c.BackendAPIURL())
+	callerIP, ok := c.CallerIP()
+	assert.True(t, ok)
+	assert.Equal(t, "198.51.100.7", callerIP.String())
+	assert.Equal(t, SQLDatabaseStack, c.SQLDatabase())
+	assert.Equal(t, "client", c.EnvVars()["ARM_CLIENT_ID"])
+}
+
+func TestLoadErrors(t *testing.T) {
+	clearEnv(t)
+
+	_, err := Load("testdata/template.yml")
+	require.Error(t, err)
+	for _, problem := range []string{
+		"test.default_region is required",
+		`test.resource_prefix "Test-"`,
+		"test.timeouts.full_test",
+		"azure.subscription_id still holds the template placeholder",
+		"azure.tenant_id still holds the template placeholder",
+	} {
+		assert.Contains(t, err.Error(), problem)
+	}
+
+	_, err = Load("testdata/unknown.yml")
+	assert.ErrorContains(t, err, "default_regoin")
+
+	t.Setenv("TEST_TIMEOUT_MODULE", "thirty")
+	_, err = Load("testdata/test-config.yml")
+	assert.ErrorContains(t, err, "TEST_TIMEOUT_MODULE")
+
+	t.Setenv("TEST_TIMEOUT_MODULE", "30")
+	t.Setenv("TEST_BACKEND_API_URL", "localhost:7071")
+	_, err = Load("testdata/test-config.yml")
+	assert.ErrorContains(t, err, `test.backend_api_url "localhost:7071" must be empty, "stack" or an http(s) URL`)
+	t.Setenv("TEST_BACKEND_API_URL", BackendAPIStack)
+	_, err = Load("testdata/test-config.yml")
+	assert.NoError(t, err)
+
+	t.Setenv("TEST_CALLER_IP", "2001:db8::1")
+	_, err = Load("testdata/test-config.yml")
+	assert.ErrorContains(t, err, `test.caller_ip "2001:db8::1" must be empty or an IPv4 address`)
+
+	t.Setenv("TEST_CALLER_IP", "")
+	t.Setenv("TEST_SQL_DATABASE", "container")
+	_, err = Load("testdata/test-config.yml")
+	assert.ErrorContains(t, err, `test.sql_database "container" must be empty or "stack"`)
+}
+
+func TestCleanupDestroy(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		policy Cleanup
+		failed bool
+		want   bool
+	}{
+		{Cleanup{AutoDestroy: true, CleanupOnFailure: true}, false, true},
+		{Cleanup{AutoDestroy: true, CleanupOnFailure: true}, true, true},
+		{Cleanup{AutoDestroy: true}, false, true},
+		{Cleanup{AutoDestroy: true}, true, false},
+		{Cleanup{CleanupOnFailure: true}, false, false},
+	}
+	for _, tc := range tests {
+		assert.Equal(t, tc.want, tc.policy.Destroy(tc.failed), "%+v failed=%v", tc.policy, tc.failed)
+	}
+}
+
+func TestCheckDeadline(t *testing.T) {
+	t.Parallel()
+
+	c := Default()
+	assert.NoError(t, c.CheckDeadline(ModuleTest, time.Time{}, false))
+	assert.NoError(t, c.CheckDeadline(ModuleTest, time.Now().Add(time.Hour), true))
+
+	err := c.CheckDeadline(ModuleTest, time.Now().Add(10*time.Minute), true)
+	assert.ErrorContains(t, err, "module_test needs 30m0s")
+	assert.ErrorContains(t, err, "-timeout 30m0s")
+
+	// The -timeout the error asks for passes, though some of it has gone by
+	for _, tier := range Tiers {
+		assert.NoError(t, c.CheckDeadline(tier, time.Now().Add(c.Timeout(tier)), true), tier)
+		assert.NoError(t, c.CheckDeadline(tier, time.Now().Add(c.Timeout(tier)-time.Minute), true), tier)
+		assert.Error(t, c.CheckDeadline(tier, time.Now().Add(c.Timeout(tier)-DeadlineMargin-time.Minute), true), tier)
+	}
+}
+
+func TestIsDefaultTimeout(t *testing.T) {
+	t.Parallel()
+
+	assert.True(t, isDefaultTimeout(nil))
+
+	for value, want := range map[string]bool{"10m": true, "10m0s": true, "30m": false, "0": false} {
+		flags := flag.NewFlagSet("test", flag.ContinueOnError)
+		flags.Duration("test.timeout", 0, "")
+		require.NoError(t, flags.Set("test.timeout", value))
+		assert.Equal(t, want, isDefaultTimeout(flags.Lookup("test.timeout")), value)
+	}
+}
@@ -0,0 +1,181 @@
+// Package deploy applies and destroys Terraform configurations for the
+// module helpers and the stack suite. It decides where a deployment goes,
+// Azure or the fake Resource Manager, and what the cleanup policy in
+// test-config.yml keeps.
+package deploy
+
+import (
+	"context"
+	"net/netip"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gruntwork-io/terratest/modules/shell"
+	"github.com/gruntwork-io/terratest/modules/terraform"
+
+	"github.com/vanehru/terraform-modules/testkit/arm"
+	"github.com/vanehru/terraform-modules/testkit/armtest"
+	"github.com/vanehru/terraform-modules/testkit/callerip"
+	"github.com/vanehru/terraform-modules/testkit/config"
+	"github.com/vanehru/terraform-modules/testkit/idempotency"
+	"github.com/vanehru/terraform-modules/testkit/janitor"
+)
+
+// Options returns the terraform.Options every suite uses for terraformDir,
+// authenticating with the credentials from test-config.yml if it sets any.
+// With test.fake_arm set, Terraform talks to FakeARM instead, with its
+// credentials, and reaches the Key Vault and storage data planes through it.
+func Options(t *testing.T, terraformDir string, vars map[string]interface{}) *terraform.Options {
+	cfg := config.ForTest(t)
+	envVars := cfg.EnvVars()
+	if cfg.FakeARM() {
+		envVars = FakeARM(t).EnvVars()
+	}
+	return terraform.WithDefaultRetryableErrors(t, &terraform.Options{
+		TerraformDir: terraformDir,
+		Vars:         vars,
+		EnvVars:      envVars,
+		NoColor:      true,
+	})
+}
+
+var (
+	fakeARMOnce   sync.Once
+	fakeARMServer *armtest.Server
+	fakeARMErr    error
+)
+
+// FakeARM returns the armtest server the deployments of this test binary go
+// to when test.fake_arm is set. It is started on first use and serves until
+// the binary exits, so every stage of a staged run must run in the same go
+// test invocation.
+func FakeARM(t *testing.T) *armtest.Server {
+	t.Helper()
+	fakeARMOnce.Do(func() {
+		fakeARMServer, fakeARMErr = armtest.Start()
+	})
+	if fakeARMErr != nil {
+		t.Fatal(fakeARMErr)
+	}
+	return fakeARMServer
+}
+
+var (
+	callerIPOnce sync.Once
+	callerIPAddr netip.Addr
+	callerIPErr  error
+)
+
+// CallerIP returns the public address the deploying tests reach Azure from,
+// for the RPG AI App root's caller_ip: test.caller_ip when set, else
+// callerip.Placeholder with test.fake_arm set, else the address
+// callerip.DefaultURL reports, asked once per test binary. A runner that
+// cannot reach it must set test.caller_ip.
+func CallerIP(t *testing.T) netip.Addr {
+	t.Helper()
+	cfg := config.ForTest(t)
+	if addr, ok := cfg.CallerIP(); ok {
+		return addr
+	}
+	if cfg.FakeARM() {
+		return callerip.Placeholder
+	}
+	callerIPOnce.Do(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		callerIPAddr, callerIPErr = callerip.Detect(ctx, callerip.DefaultURL)
+	})
+	if callerIPErr != nil {
+		t.Fatalf("detecting the caller IP: %v; set test.caller_ip or TEST_CALLER_IP", callerIPErr)
+	}
+	return callerIPAddr
+}
+
+// CreatedTags returns tags with janitor.CreatedTag set to now, for a
+// configuration that takes its resource group tags as a variable. Pass the
+// same stamp to every apply of a deployment, or Terraform resets it.
+func CreatedTags(tags map[string]string) map[string]string {
+	created := map[string]string{}
+	for k, v := range tags {
+		created[k] = v
+	}
+	created[janitor.CreatedTag] = time.Now().UTC().Format(time.RFC3339)
+	return created
+}
+
+// armClient returns a Resource Manager client for where Options deploys to
+func armClient(t *testing.T) (*arm.Client, error) {
+	cfg := config.ForTest(t)
+	if !cfg.FakeARM() {
+		return arm.FromConfig(context.Background(), cfg)
+	}
+	server := FakeARM(t)
+	client := arm.NewClient(server.URL, armtest.SubscriptionID, func(ctx context.Context) (string, error) {
+		return server.Token(), nil
+	})
+	client.HTTPClient = server.Client()
+	return client, nil
+}
+
+// ARMClient returns a Resource Manager client for where Options deploys to,
+// for checks that read back what a deployment created
+func ARMClient(t *testing.T) *arm.Client {
+	t.Helper()
+	client, err := armClient(t)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+// Run applies terraformOptions, checks in an Idempotent subtest that a
+// second plan changes nothing but the unstable attributes, and runs validate
+// against the result. The module helpers pass none: their modules take every
+// value as an input and call nothing that changes per plan, which
+// idempotency.TestNoImpureCalls checks. The destroy is registered with
+// t.Cleanup before the apply, so everything is torn down when t completes
+// even if the apply fails or the test panics, and before any fixture the test
+// created earlier.
+func Run(t *testing.T, terraformOptions *terraform.Options, unstable []idempotency.Unstable, validate func(t *testing.T, terraformOptions *terraform.Options)) {
+	t.Cleanup(func() {
+		Destroy(t, terraformOptions, "")
+	})
+
+	terraform.InitAndApply(t, terraformOptions)
+	t.Run("Idempotent", func(t *testing.T) {
+		idempotency.Check(t, terraformOptions, unstable)
+	})
+	validate(t, terraformOptions)
+}
+
+// Destroy destroys terraformOptions unless the cleanup policy in
+// test-config.yml keeps it, and reports whether it did. When the destroy
+// fails and force_cleanup is set, resourceGroupName, if not empty, is deleted
+// with the Azure CLI instead, unless the deployment went to FakeARM.
+func Destroy(t *testing.T, terraformOptions *terraform.Options, resourceGroupName string) bool {
+	cfg := config.ForTest(t)
+	policy := cfg.CleanupPolicy()
+	if !policy.Destroy(t.Failed()) {
+		t.Logf("Keeping %s as the cleanup policy asks", terraformOptions.TerraformDir)
+		return false
+	}
+
+	_, err := terraform.DestroyE(t, terraformOptions)
+	if err == nil {
+		return true
+	}
+	// The Azure CLI would delete a real resource group of the same name
+	if !policy.ForceCleanup || resourceGroupName == "" || cfg.FakeARM() {
+		t.Error(err)
+		return false
+	}
+
+	t.Logf("terraform destroy failed, deleting resource group %s: %v", resourceGroupName, err)
+	shell.RunCommand(t, shell.Command{
+		Command: "az",
+		Args:    []string{"group", "delete", "--name", resourceGroupName, "--yes"},
+		Env:     terraformOptions.EnvVars,
+	})
+	return true
+}
@@ -0,0 +1,24 @@
+package deploy_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/vanehru/terraform-modules/testkit/deploy"
+	"github.com/vanehru/terraform-modules/testkit/janitor"
+)
+
+func TestCreatedTags(t *testing.T) {
+	t.Parallel()
+
+	tags := map[string]string{"environment": "development"}
+	created := deploy.CreatedTags(tags)
+	assert.Equal(t, "development", created["environment"], "the stamp should keep the other tags")
+	assert.NotContains(t, tags, janitor.CreatedTag, "the tags passed in should not change")
+	stamp, err := time.Parse(time.RFC3339, created[janitor.CreatedTag])
+	require.NoError(t, err)
+	assert.WithinDuration(t, time.Now(), stamp, time.Minute)
+}
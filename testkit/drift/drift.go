@@ -0,0 +1,373 @@
+// Package drift reads the resource_drift and resource_changes sections of a
+// `terraform show -json` plan and sorts every change by what it means for
+// the deployment: security-relevant, tag-only or cosmetic.
+package drift
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	tfjson "github.com/hashicorp/terraform-json"
+)
+
+// Category ranks a change by how much attention it needs
+type Category string
+
+// Categories, from least to most severe
+const (
+	// Tags is a change to tags and nothing else
+	Tags Category = "tags"
+	// Cosmetic is a change that neither tags nor security rules cover, such
+	// as a SKU, a retention period or an app setting
+	Cosmetic Category = "cosmetic"
+	// Security is a change to who can reach or read a resource, or a
+	// resource created or deleted outside Terraform
+	Security Category = "security"
+)
+
+// severity orders the categories, with 0 for none
+var severity = map[Category]int{Tags: 1, Cosmetic: 2, Security: 3}
+
+// securityAttributes govern network exposure, transport security, identity
+// and access. A change to one, or to anything nested under one, is
+// security-relevant.
+var securityAttributes = map[string]bool{
+	"access_policy":                   true,
+	"administrator_login":             true,
+	"administrator_login_password":    true,
+	"allow_nested_items_to_be_public": true,
+	"azuread_administrator":           true,
+	"bypass":                          true,
+	"cors":                            true,
+	"default_action":                  true,
+	"enable_https_traffic_only":       true,
+	"enable_rbac_authorization":       true,
+	"ftps_state":                      true,
+	"https_only":                      true,
+	"https_traffic_only_enabled":      true,
+	"identity":                        true,
+	"ip_restriction":                  true,
+	"ip_rules":                        true,
+	"local_auth_enabled":              true,
+	"min_tls_version":                 true,
+	"minimum_tls_version":             true,
+	"network_acls":                    true,
+	"network_rules":                   true,
+	"public_network_access_enabled":   true,
+	"purge_protection_enabled":        true,
+	"scm_ip_restriction":              true,
+	"shared_access_key_enabled":       true,
+	"soft_delete_retention_days":      true,
+	"virtual_network_subnet_ids":      true,
+}
+
+// securityTypes are resource types that exist to grant or restrict access,
+// so any change to them is security-relevant
+var securityTypes = map[string]bool{
+	"azurerm_key_vault_access_policy":                   true,
+	"azurerm_key_vault_secret":                          true,
+	"azurerm_mssql_firewall_rule":                       true,
+	"azurerm_mssql_virtual_network_rule":                true,
+	"azurerm_network_security_group":                    true,
+	"azurerm_network_security_rule":                     true,
+	"azurerm_private_dns_a_record":                      true,
+	"azurerm_private_endpoint":                          true,
+	"azurerm_role_assignment":                           true,
+	"azurerm_subnet_network_security_group_association": true,
+}
+
+// tagAttributes hold a resource's tags
+var tagAttributes = map[string]bool{"tags": true, "tags_all": true}
+
+// Sensitive stands in for a value the plan marks sensitive
+const Sensitive = "(sensitive)"
+
+// Attribute is one value that differs between before and after
+type Attribute struct {
+	// Path is dotted, with list indexes as segments: "network_acls.0.ip_rules"
+	Path     string      `json:"path"`
+	Before   interface{} `json:"before"`
+	After    interface{} `json:"after"`
+	Category Category    `json:"category"`
+}
+
+func (a Attribute) String() string {
+	return fmt.Sprintf("%s: %s -> %s", a.Path, format(a.Before), format(a.After))
+}
+
+// Change is a resource that drifted or that the plan would change
+type Change struct {
+	Address string `json:"address"`
+	Type    string `json:"type"`
+	// Actions are Terraform's, such as "update" or "delete, create"
+	Actions    string      `json:"actions"`
+	Category   Category    `json:"category"`
+	Attributes []Attribute `json:"attributes"`
+}
+
+// Report is the drift in a plan and the changes the plan would make
+type Report struct {
+	// Drift holds the changes made outside Terraform since the last apply,
+	// from resource_drift
+	Drift []Change `json:"drift"`
+	// Changes holds what applying the plan would do, from resource_changes,
+	// which includes undoing the drift
+	Changes []Change `json:"changes"`
+}
+
+// plan is the part of `terraform show -json` output Parse reads.
+// tfjson.Plan does not have resource_drift.
+type plan struct {
+	FormatVersion   string                   `json:"format_version"`
+	ResourceDrift   []*tfjson.ResourceChange `json:"resource_drift"`
+	ResourceChanges []*tfjson.ResourceChange `json:"resource_changes"`
+}
+
+// Parse reads the output of `terraform show -json` for a plan
+func Parse(r io.Reader) (*Report, error) {
+	var p plan
+	if err := json.NewDecoder(r).Decode(&p); err != nil {
+		return nil, fmt.Errorf("parsing plan JSON: %w", err)
+	}
+	if !strings.HasPrefix(p.FormatVersion, "1.") {
+		return nil, fmt.Errorf("plan JSON format version %q is not 1.x", p.FormatVersion)
+	}
+	return &Report{
+		Drift:   changes(p.ResourceDrift),
+		Changes: changes(p.ResourceChanges),
+	}, nil
+}
+
+// Category returns the most severe category in the report, or "" when
+// nothing drifted and the plan changes nothing
+func (r *Report) Category() Category {
+	var worst Category
+	for _, list := range [][]Change{r.Drift, r.Changes} {
+		for _, c := range list {
+			if severity[c.Category] > severity[worst] {
+				worst = c.Category
+			}
+		}
+	}
+	return worst
+}
+
+// Count returns how many drifted resources and planned changes fall in category
+func (r *Report) Count(category Category) int {
+	n := 0
+	for _, list := range [][]Change{r.Drift, r.Changes} {
+		for _, c := range list {
+			if c.Category == category {
+				n++
+			}
+		}
+	}
+	return n
+}
+
+// WriteText writes the drift and the planned changes as tables, one row per
+// attribute
+func (r *Report) WriteText(w io.Writer) error {
+	for _, section := range []struct {
+		title   string
+		changes []Change
+	}{
+		{"Changed outside Terraform", r.Drift},
+		{"Planned changes", r.Changes},
+	} {
+		if _, err := fmt.Fprintf(w, "%s: %d\n", section.title, len(section.changes)); err != nil {
+			return err
+		}
+		if len(section.changes) == 0 {
+			continue
+		}
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "CATEGORY\tADDRESS\tACTIONS\tATTRIBUTE\tBEFORE\tAFTER")
+		for _, c := range section.changes {
+			if len(c.Attributes) == 0 {
+				fmt.Fprintf(tw, "%s\t%s\t%s\t-\t-\t-\n", c.Category, c.Address, c.Actions)
+			}
+			for _, a := range c.Attributes {
+				fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", a.Category, c.Address, c.Actions, a.Path, format(a.Before), format(a.After))
+			}
+		}
+		if err := tw.Flush(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// changes classifies every managed resource change that does something,
+// sorted by address
+func changes(resourceChanges []*tfjson.ResourceChange) []Change {
+	list := []Change{}
+	for _, rc := range resourceChanges {
+		if rc.Mode != tfjson.ManagedResourceMode || rc.Change == nil || rc.Change.Actions.NoOp() || rc.Change.Actions.Read() {
+			continue
+		}
+		list = append(list, classify(rc))
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Address < list[j].Address })
+	return list
+}
+
+func classify(rc *tfjson.ResourceChange) Change {
+	actions := make([]string, len(rc.Change.Actions))
+	for i, action := range rc.Change.Actions {
+		actions[i] = string(action)
+	}
+	c := Change{Address: rc.Address, Type: rc.Type, Actions: strings.Join(actions, ", "), Attributes: []Attribute{}}
+
+	var paths [][]string
+	diff(nil, rc.Change.Before, rc.Change.After, rc.Change.AfterUnknown, &paths)
+	for _, path := range paths {
+		a := Attribute{Path: strings.Join(path, "."), Category: attributeCategory(rc.Type, path)}
+		a.Before, _ = lookup(rc.Change.Before, path)
+		a.After, _ = lookup(rc.Change.After, path)
+		if marked(rc.Change.BeforeSensitive, path) {
+			a.Before = Sensitive
+		}
+		if marked(rc.Change.AfterSensitive, path) {
+			a.After = Sensitive
+		}
+		c.Attributes = append(c.Attributes, a)
+		if severity[a.Category] > severity[c.Category] {
+			c.Category = a.Category
+		}
+	}
+
+	switch {
+	case rc.Change.Before == nil || rc.Change.After == nil || securityTypes[rc.Type]:
+		// A resource that appeared or vanished is worth a look whatever it is
+		c.Category = Security
+	case c.Category == "":
+		// Only values not known until apply differ
+		c.Category = Cosmetic
+	}
+	return c
+}
+
+func attributeCategory(resourceType string, path []string) Category {
+	if securityTypes[resourceType] {
+		return Security
+	}
+	for _, segment := range path {
+		if securityAttributes[segment] {
+			return Security
+		}
+	}
+	if len(path) > 0 && tagAttributes[path[0]] {
+		return Tags
+	}
+	return Cosmetic
+}
+
+// diff appends the path of every leaf that differs between before and
+// after, descending into objects and into lists of the same length. Values
+// unknown marks as not known until apply are left out.
+func diff(path []string, before, after, unknown interface{}, paths *[][]string) {
+	if b, ok := unknown.(bool); ok && b {
+		return
+	}
+	switch b := before.(type) {
+	case map[string]interface{}:
+		if a, ok := after.(map[string]interface{}); ok {
+			keys := map[string]bool{}
+			for key := range b {
+				keys[key] = true
+			}
+			for key := range a {
+				keys[key] = true
+			}
+			sorted := make([]string, 0, len(keys))
+			for key := range keys {
+				sorted = append(sorted, key)
+			}
+			sort.Strings(sorted)
+			for _, key := range sorted {
+				diff(append(path[:len(path):len(path)], key), b[key], a[key], member(unknown, key), paths)
+			}
+			return
+		}
+	case []interface{}:
+		if a, ok := after.([]interface{}); ok && len(a) == len(b) {
+			for i := range b {
+				diff(append(path[:len(path):len(path)], strconv.Itoa(i)), b[i], a[i], member(unknown, strconv.Itoa(i)), paths)
+			}
+			return
+		}
+	}
+	if before == nil && after == nil || len(path) > 0 && reflect.DeepEqual(before, after) {
+		return
+	}
+	if len(path) > 0 {
+		*paths = append(*paths, path)
+	}
+}
+
+// lookup walks path through objects and lists
+func lookup(value interface{}, path []string) (interface{}, bool) {
+	for _, segment := range path {
+		var ok bool
+		if value, ok = child(value, segment); !ok {
+			return nil, false
+		}
+	}
+	return value, true
+}
+
+// child returns the member of an object or the element of a list
+func child(value interface{}, segment string) (interface{}, bool) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		member, ok := v[segment]
+		return member, ok
+	case []interface{}:
+		index, err := strconv.Atoi(segment)
+		if err != nil || index < 0 || index >= len(v) {
+			return nil, false
+		}
+		return v[index], true
+	}
+	return nil, false
+}
+
+// member is child without the flag, nil when segment is not there
+func member(value interface{}, segment string) interface{} {
+	v, _ := child(value, segment)
+	return v
+}
+
+// marked reports whether a before_sensitive or after_unknown style tree marks
+// path, or an object or list on the way to it, with true
+func marked(tree interface{}, path []string) bool {
+	for _, segment := range path {
+		if b, ok := tree.(bool); ok {
+			return b
+		}
+		var ok bool
+		if tree, ok = child(tree, segment); !ok {
+			return false
+		}
+	}
+	b, ok := tree.(bool)
+	return ok && b
+}
+
+func format(value interface{}) string {
+	if value == Sensitive {
+		return Sensitive
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return string(data)
+}
@@ -0,0 +1,114 @@
+package drift
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func parseFile(t *testing.T, path string) *Report {
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer f.Close()
+	report, err := Parse(f)
+	require.NoError(t, err)
+	return report
+}
+
+func TestParseDrift(t *testing.T) {
+	t.Parallel()
+
+	report := parseFile(t, "testdata/plan.json")
+	require.Len(t, report.Drift, 5)
+
+	var got []string
+	for _, c := range report.Drift {
+		got = append(got, string(c.Category)+" "+c.Address+" "+c.Actions)
+	}
+	assert.Equal(t, []string{
+		"tags azurerm_resource_group.rg update",
+		"cosmetic azurerm_storage_account.cloud_shell update",
+		"security module.key_vault.azurerm_key_vault.kv update",
+		"security module.openai.azurerm_cognitive_account.openai update",
+		"security module.sql_database.azurerm_mssql_firewall_rule.allow_azure delete",
+	}, got)
+
+	assert.Equal(t, []Attribute{{Path: "tags.CostCenter", Before: nil, After: "1234", Category: Tags}}, report.Drift[0].Attributes)
+	assert.Equal(t, []Attribute{
+		{Path: "access_tier", Before: "Hot", After: "Cool", Category: Cosmetic},
+		{Path: "primary_access_key", Before: Sensitive, After: Sensitive, Category: Cosmetic},
+	}, report.Drift[1].Attributes)
+	assert.Equal(t, []Attribute{
+		{Path: "network_acls.0.default_action", Before: "Deny", After: "Allow", Category: Security},
+		{Path: "network_acls.0.ip_rules", Before: []interface{}{"203.0.113.10"}, After: []interface{}{"203.0.113.10", "0.0.0.0/0"}, Category: Security},
+	}, report.Drift[2].Attributes)
+	assert.Equal(t, []Attribute{
+		{Path: "public_network_access_enabled", Before: false, After: true, Category: Security},
+		{Path: "tags.owner", Before: nil, After: "someone", Category: Tags},
+	}, report.Drift[3].Attributes, "a resource takes its most severe attribute's category")
+	assert.Empty(t, report.Drift[4].Attributes)
+	assert.Equal(t, `network_acls.0.default_action: "Deny" -> "Allow"`, report.Drift[2].Attributes[0].String())
+}
+
+func TestParseChanges(t *testing.T) {
+	t.Parallel()
+
+	report := parseFile(t, "testdata/plan.json")
+	require.Len(t, report.Changes, 3, "reads and no-ops are not changes")
+	assert.Equal(t, "azurerm_resource_group.rg", report.Changes[0].Address)
+	assert.Equal(t, Tags, report.Changes[0].Category)
+
+	kv := report.Changes[1]
+	assert.Equal(t, Security, kv.Category)
+	require.Len(t, kv.Attributes, 2, "the unknown id is left out")
+	assert.Equal(t, "network_acls.0.default_action", kv.Attributes[0].Path)
+
+	assert.Equal(t, "create", report.Changes[2].Actions)
+	assert.Equal(t, Security, report.Changes[2].Category)
+
+	assert.Equal(t, Security, report.Category())
+	assert.Equal(t, 5, report.Count(Security))
+	assert.Equal(t, 2, report.Count(Tags))
+	assert.Equal(t, 1, report.Count(Cosmetic))
+}
+
+func TestParseClean(t *testing.T) {
+	t.Parallel()
+
+	report := parseFile(t, "testdata/clean.json")
+	assert.Empty(t, report.Drift)
+	assert.Empty(t, report.Changes)
+	assert.Equal(t, Category(""), report.Category())
+
+	var text bytes.Buffer
+	require.NoError(t, report.WriteText(&text))
+	assert.Equal(t, "Changed outside Terraform: 0\nPlanned changes: 0\n", text.String())
+}
+
+func TestParseErrors(t *testing.T) {
+	t.Parallel()
+
+	_, err := Parse(strings.NewReader("{"))
+	assert.ErrorContains(t, err, "parsing plan JSON")
+	_, err = Parse(strings.NewReader(`{"format_version": "2.0"}`))
+	assert.EqualError(t, err, `plan JSON format version "2.0" is not 1.x`)
+}
+
+func TestWriteText(t *testing.T) {
+	t.Parallel()
+
+	var text bytes.Buffer
+	require.NoError(t, parseFile(t, "testdata/plan.json").WriteText(&text))
+	lines := strings.Split(strings.TrimSpace(text.String()), "\n")
+	require.Len(t, lines, 16)
+	assert.Equal(t, "Changed outside Terraform: 5", lines[0])
+	assert.Regexp(t, `^CATEGORY\s+ADDRESS\s+ACTIONS\s+ATTRIBUTE\s+BEFORE\s+AFTER$`, lines[1])
+	assert.Regexp(t, `^cosmetic\s+azurerm_storage_account.cloud_shell\s+update\s+primary_access_key\s+\(sensitive\)\s+\(sensitive\)$`, lines[4])
+	assert.Regexp(t, `^security\s+module.key_vault.azurerm_key_vault.kv\s+update\s+network_acls.0.ip_rules\s+\["203.0.113.10"\]\s+\["203.0.113.10","0.0.0.0/0"\]$`, lines[6])
+	assert.Regexp(t, `^security\s+module.sql_database.azurerm_mssql_firewall_rule.allow_azure\s+delete\s+-\s+-\s+-$`, lines[9])
+	assert.Equal(t, "Planned changes: 3", lines[10])
+}
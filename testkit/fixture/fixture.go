@@ -0,0 +1,109 @@
+// Package fixture creates the throwaway resource group, VNet and subnets a
+// module test deploys into, so each module can be tested on its own and in
+// parallel with the others
+package fixture
+
+import (
+	"embed"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	"github.com/stretchr/testify/require"
+
+	"github.com/vanehru/terraform-modules/testkit"
+	"github.com/vanehru/terraform-modules/testkit/config"
+	"github.com/vanehru/terraform-modules/testkit/deploy"
+)
+
+//go:embed network/*.tf
+var networkFiles embed.FS
+
+// Outputs are the fixture outputs NewNetwork reads
+var Outputs = []string{
+	"resource_group_name",
+	"resource_group_id",
+	"location",
+	"tenant_id",
+	"virtual_network_id",
+	"virtual_network_name",
+	"subnet_ids",
+}
+
+// Subnet names, the keys of Network.SubnetIDs
+const (
+	// AppSubnet is delegated to Microsoft.Web/serverFarms for VNet integration
+	AppSubnet = "app-subnet"
+	// PrivateEndpointSubnet hosts the modules' private endpoints
+	PrivateEndpointSubnet = "private-endpoint-subnet"
+)
+
+// Tags are the fixture's default tags. Passing the tags variable replaces
+// rather than extends the default, so NewNetwork passes these with
+// janitor.CreatedTag added.
+var Tags = map[string]string{
+	"project_owner": "testkit",
+	"author":        "terratest",
+	"environment":   "development",
+}
+
+// Network is an applied network fixture
+type Network struct {
+	ResourceGroupName  string
+	ResourceGroupID    string
+	Location           string
+	TenantID           string
+	VirtualNetworkID   string
+	VirtualNetworkName string
+	// SubnetIDs is keyed by subnet name
+	SubnetIDs map[string]string
+}
+
+// NewNetwork applies the network fixture in location and destroys it when t
+// and its subtests complete, even if the test fails or panics, as the cleanup
+// policy in test-config.yml allows. Call it before deploying the module, so
+// the module is destroyed first.
+func NewNetwork(t *testing.T, location string) *Network {
+	resourceGroupName := config.ForTest(t).ResourceName(t, "azurerm_resource_group", "rg", testkit.UniqueID())
+	terraformOptions := deploy.Options(t, writeNetwork(t), map[string]interface{}{
+		"resource_group_name": resourceGroupName,
+		"location":            location,
+		"tags":                deploy.CreatedTags(Tags),
+	})
+
+	// Registered before the apply so a partial apply is torn down too
+	t.Cleanup(func() {
+		deploy.Destroy(t, terraformOptions, resourceGroupName)
+	})
+	terraform.InitAndApply(t, terraformOptions)
+
+	return &Network{
+		ResourceGroupName:  terraform.Output(t, terraformOptions, "resource_group_name"),
+		ResourceGroupID:    terraform.Output(t, terraformOptions, "resource_group_id"),
+		Location:           terraform.Output(t, terraformOptions, "location"),
+		TenantID:           terraform.Output(t, terraformOptions, "tenant_id"),
+		VirtualNetworkID:   terraform.Output(t, terraformOptions, "virtual_network_id"),
+		VirtualNetworkName: terraform.Output(t, terraformOptions, "virtual_network_name"),
+		SubnetIDs:          terraform.OutputMap(t, terraformOptions, "subnet_ids"),
+	}
+}
+
+// writeNetwork copies the embedded fixture into a temp dir, which outlives
+// the destroy registered after it
+func writeNetwork(t *testing.T) string {
+	dir := t.TempDir()
+	err := fs.WalkDir(networkFiles, "network", func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		data, err := networkFiles.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(filepath.Join(dir, d.Name()), data, 0o644)
+	})
+	require.NoError(t, err)
+	return dir
+}
@@ -0,0 +1,36 @@
+package fixture
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/vanehru/terraform-modules/testkit/outputcontract"
+)
+
+func TestWriteNetwork(t *testing.T) {
+	t.Parallel()
+
+	dir := writeNetwork(t)
+	for _, name := range []string{"main.tf", "outputs.tf", "providers.tf", "variables.tf"} {
+		assert.FileExists(t, filepath.Join(dir, name))
+	}
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Len(t, entries, 4)
+}
+
+// TestNetworkOutputs verifies that the fixture declares every output
+// NewNetwork reads, since a missing one would only fail after an apply
+func TestNetworkOutputs(t *testing.T) {
+	t.Parallel()
+
+	issues, err := outputcontract.CheckOutputs(writeNetwork(t), "fixture", Outputs)
+	require.NoError(t, err)
+	for _, issue := range issues {
+		t.Error(issue)
+	}
+}
@@ -0,0 +1,37 @@
+output "resource_group_name" {
+  description = "Name of the resource group"
+  value       = azurerm_resource_group.rg.name
+}
+
+output "resource_group_id" {
+  description = "ID of the resource group"
+  value       = azurerm_resource_group.rg.id
+}
+
+output "location" {
+  description = "Location of the resource group"
+  value       = azurerm_resource_group.rg.location
+}
+
+output "tenant_id" {
+  description = "Tenant of the credentials running the tests"
+  value       = data.azurerm_client_config.current.tenant_id
+}
+
+output "virtual_network_id" {
+  description = "ID of the Virtual Network"
+  value       = azurerm_virtual_network.vnet.id
+}
+
+output "virtual_network_name" {
+  description = "Name of the Virtual Network"
+  value       = azurerm_virtual_network.vnet.name
+}
+
+output "subnet_ids" {
+  description = "Subnet IDs keyed by subnet name"
+  value = {
+    (azurerm_subnet.app_subnet.name)              = azurerm_subnet.app_subnet.id
+    (azurerm_subnet.private_endpoint_subnet.name) = azurerm_subnet.private_endpoint_subnet.id
+  }
+}
@@ -0,0 +1,25 @@
+variable "resource_group_name" {
+  description = "Name of the throwaway resource group"
+  type        = string
+}
+
+variable "location" {
+  description = "Azure region for the resource group and VNet"
+  type        = string
+}
+
+variable "vnet_address_space" {
+  description = "Address space for the VNet; each subnet takes a /24 from it"
+  type        = string
+  default     = "172.16.0.0/16"
+}
+
+variable "tags" {
+  description = "Tags applied to the resource group and VNet"
+  type        = map(string)
+  default = {
+    project_owner = "testkit"
+    author        = "terratest"
+    environment   = "development"
+  }
+}
@@ -0,0 +1,108 @@
+// Package functionapp deploys and validates the function-app module
+package functionapp
+
+import (
+	"testing"
+
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/vanehru/terraform-modules/testkit/deploy"
+	"github.com/vanehru/terraform-modules/testkit/naming"
+	"github.com/vanehru/terraform-modules/testkit/privatedns"
+)
+
+// Outputs are the module outputs Validate reads
+var Outputs = []string{
+	"function_app_name",
+	"function_app_default_hostname",
+	"storage_account_name",
+	"function_app_identity_principal_id",
+	"app_service_plan_id",
+}
+
+// Expected describes the Function App a test deploys and expects back
+type Expected struct {
+	Name               string
+	StorageAccountName string
+	AppServicePlanName string
+	ResourceGroupName  string
+	Location           string
+	// VNetIntegrationSubnetID is a subnet delegated to Microsoft.Web/serverFarms,
+	// such as fixture.AppSubnet. When set the app is VNet integrated.
+	VNetIntegrationSubnetID string
+	// PrivateEndpointSubnetID and VirtualNetworkID put the storage account
+	// behind a private endpoint when set
+	PrivateEndpointSubnetID string
+	VirtualNetworkID        string
+}
+
+// Vars returns the module inputs that deploy expected with a managed identity
+func Vars(expected Expected) map[string]interface{} {
+	vars := map[string]interface{}{
+		"function_app_name":                expected.Name,
+		"location":                         expected.Location,
+		"resource_group_name":              expected.ResourceGroupName,
+		"storage_account_name":             expected.StorageAccountName,
+		"storage_account_tier":             "Standard",
+		"storage_account_replication_type": "LRS",
+		"app_service_plan_name":            expected.AppServicePlanName,
+		"app_service_plan_sku":             "P1v2",
+		"create_managed_identity":          true,
+		"enable_vnet_integration":          expected.VNetIntegrationSubnetID != "",
+		"enable_storage_private_endpoint":  expected.PrivateEndpointSubnetID != "",
+	}
+	if expected.VNetIntegrationSubnetID != "" {
+		vars["vnet_integration_subnet_id"] = expected.VNetIntegrationSubnetID
+	}
+	if expected.PrivateEndpointSubnetID != "" {
+		vars["storage_private_endpoint_subnet_id"] = expected.PrivateEndpointSubnetID
+		vars["storage_virtual_network_id"] = expected.VirtualNetworkID
+	}
+	return vars
+}
+
+// Test deploys the function-app module in terraformDir, validates it against
+// expected and destroys it. Names Azure would reject fail the test before
+// anything is deployed.
+func Test(t *testing.T, terraformDir string, expected Expected) {
+	naming.Require(t, "azurerm_linux_function_app", expected.Name)
+	naming.Require(t, "azurerm_storage_account", expected.StorageAccountName)
+	naming.Require(t, "azurerm_service_plan", expected.AppServicePlanName)
+	terraformOptions := deploy.Options(t, terraformDir, Vars(expected))
+	deploy.Run(t, terraformOptions, nil, func(t *testing.T, terraformOptions *terraform.Options) {
+		Validate(t, terraformOptions, expected)
+	})
+}
+
+// Validate runs the standard checks against an applied function-app module
+func Validate(t *testing.T, terraformOptions *terraform.Options, expected Expected) {
+	t.Run("FunctionAppExists", func(t *testing.T) {
+		actualFunctionAppName := terraform.Output(t, terraformOptions, "function_app_name")
+		assert.Equal(t, expected.Name, actualFunctionAppName)
+
+		hostname := terraform.Output(t, terraformOptions, "function_app_default_hostname")
+		assert.Contains(t, hostname, expected.Name)
+	})
+
+	t.Run("StorageAccountExists", func(t *testing.T) {
+		storageAcctName := terraform.Output(t, terraformOptions, "storage_account_name")
+		assert.Equal(t, expected.StorageAccountName, storageAcctName)
+	})
+
+	t.Run("ManagedIdentityEnabled", func(t *testing.T) {
+		principalID := terraform.Output(t, terraformOptions, "function_app_identity_principal_id")
+		assert.NotEmpty(t, principalID, "Function App should have managed identity")
+	})
+
+	t.Run("AppServicePlanExists", func(t *testing.T) {
+		planID := terraform.Output(t, terraformOptions, "app_service_plan_id")
+		assert.Contains(t, planID, expected.AppServicePlanName, "App Service Plan should be created")
+	})
+
+	if expected.PrivateEndpointSubnetID != "" {
+		t.Run("PrivateDNS", func(t *testing.T) {
+			privatedns.ValidateApplied(t, terraformOptions, deploy.ARMClient(t), expected.ResourceGroupName, expected.VirtualNetworkID)
+		})
+	}
+}
@@ -0,0 +1,166 @@
+// Package idempotency checks that applying a configuration twice is a no-op:
+// after an apply, a second plan must not change anything apart from the
+// attributes a caller declares unstable.
+package idempotency
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/stretchr/testify/require"
+
+	"github.com/vanehru/terraform-modules/testkit/drift"
+	"github.com/vanehru/terraform-modules/testkit/planassert"
+	"github.com/vanehru/terraform-modules/testkit/tfconfig"
+)
+
+// Unstable is an attribute a second plan is known to change, and why
+type Unstable struct {
+	// Address is the resource address, with or without instance keys
+	Address string
+	// Attribute is a path such as "network_acls.0.ip_rules", covering it
+	// and everything under it. An empty Attribute covers the whole resource.
+	Attribute string
+	Reason    string
+}
+
+func (u Unstable) covers(address, path string) bool {
+	if u.Address != address && u.Address != planassert.StripIndexes(address) {
+		return false
+	}
+	return u.Attribute == "" || path == u.Attribute || strings.HasPrefix(path, u.Attribute+".")
+}
+
+// Check runs a second plan against terraformOptions, which must have been
+// applied, and fails t with a per-attribute diff of every change that
+// unstable does not cover
+func Check(t *testing.T, terraformOptions *terraform.Options, unstable []Unstable) {
+	t.Helper()
+
+	planFile, err := os.CreateTemp("", "terratest-idempotency-")
+	require.NoError(t, err)
+	require.NoError(t, planFile.Close())
+	defer os.Remove(planFile.Name())
+
+	planOptions := *terraformOptions
+	planOptions.PlanFilePath = planFile.Name()
+	terraform.Plan(t, &planOptions)
+	report, err := drift.Parse(strings.NewReader(terraform.Show(t, &planOptions)))
+	require.NoError(t, err)
+
+	if changes := Unexpected(report, unstable); len(changes) > 0 {
+		t.Errorf("applying %s again would change %d resources:\n%s", terraformOptions.TerraformDir, len(changes), Diff(changes))
+	}
+}
+
+// Unexpected returns the planned changes in report that unstable does not
+// cover, with the covered attributes left out
+func Unexpected(report *drift.Report, unstable []Unstable) []drift.Change {
+	var changes []drift.Change
+	for _, c := range report.Changes {
+		// Only an Unstable for the whole resource covers a create, a delete
+		// or an update of values known only after apply
+		if len(c.Attributes) == 0 && covered(unstable, c.Address, "") {
+			continue
+		}
+		var attributes []drift.Attribute
+		for _, a := range c.Attributes {
+			if !covered(unstable, c.Address, a.Path) {
+				attributes = append(attributes, a)
+			}
+		}
+		if len(c.Attributes) > 0 && len(attributes) == 0 {
+			continue
+		}
+		c.Attributes = attributes
+		changes = append(changes, c)
+	}
+	return changes
+}
+
+func covered(unstable []Unstable, address, path string) bool {
+	for _, u := range unstable {
+		if u.covers(address, path) {
+			return true
+		}
+	}
+	return false
+}
+
+// impure are the Terraform functions that return a new value on every plan
+var impure = map[string]bool{
+	"timestamp":     true,
+	"plantimestamp": true,
+	"uuid":          true,
+	"bcrypt":        true,
+}
+
+// ImpureCalls returns a "file:line: name()" for every call to a function that
+// returns a new value on every plan, such as timestamp(), in a resource,
+// module argument or local of the configuration in dir or a module it calls
+// by a relative source. Anything that depends on one changes on every plan,
+// so Check would fail; record the value in a resource such as time_static
+// instead.
+func ImpureCalls(dir string) ([]string, error) {
+	var calls []string
+	if err := impureCalls(dir, &calls); err != nil {
+		return nil, err
+	}
+	sort.Strings(calls)
+	return calls, nil
+}
+
+func impureCalls(dir string, calls *[]string) error {
+	mod, err := tfconfig.Load(dir)
+	if err != nil {
+		return err
+	}
+	var nodes []hclsyntax.Node
+	for _, attr := range mod.Locals {
+		nodes = append(nodes, attr.Expr)
+	}
+	for _, r := range mod.Resources {
+		nodes = append(nodes, r.Body)
+	}
+	for _, call := range mod.ModuleCalls {
+		nodes = append(nodes, call.Body)
+	}
+	for _, node := range nodes {
+		hclsyntax.VisitAll(node, func(n hclsyntax.Node) hcl.Diagnostics {
+			if call, ok := n.(*hclsyntax.FunctionCallExpr); ok && impure[call.Name] {
+				*calls = append(*calls, fmt.Sprintf("%s:%d: %s()", filepath.ToSlash(call.NameRange.Filename), call.NameRange.Start.Line, call.Name))
+			}
+			return nil
+		})
+	}
+	for _, call := range mod.ModuleCalls {
+		if child, ok := call.LocalDir(dir); ok {
+			if err := impureCalls(child, calls); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Diff formats changes one attribute per line under their resource
+func Diff(changes []drift.Change) string {
+	var b strings.Builder
+	for _, c := range changes {
+		fmt.Fprintf(&b, "  %s (%s):\n", c.Address, c.Actions)
+		if len(c.Attributes) == 0 && c.Actions == "update" {
+			b.WriteString("    values known only after apply\n")
+		}
+		for _, a := range c.Attributes {
+			fmt.Fprintf(&b, "    %s\n", a)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,99 @@
+package idempotency
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/vanehru/terraform-modules/testkit/drift"
+)
+
+func loadReport(t *testing.T) *drift.Report {
+	f, err := os.Open("testdata/plan.json")
+	require.NoError(t, err)
+	defer f.Close()
+	report, err := drift.Parse(f)
+	require.NoError(t, err)
+	return report
+}
+
+func TestUnexpected(t *testing.T) {
+	t.Parallel()
+
+	report := loadReport(t)
+	changes := Unexpected(report, nil)
+	require.Len(t, changes, 4, "the no-op is not a change")
+	assert.Equal(t, `  azurerm_storage_account.cloud_shell (update):
+    values known only after apply
+  module.key_vault.azurerm_key_vault.kv (update):
+    network_acls.0.ip_rules.0: "203.0.113.10/32" -> "203.0.113.10"
+    tags.managed_by: null -> "terraform"
+  module.key_vault.azurerm_key_vault_secret.secrets["openai-key"] (update):
+    value: (sensitive) -> (sensitive)
+  random_password.sql_admin_password (delete, create):
+`, Diff(changes))
+
+	changes = Unexpected(report, []Unstable{
+		{Address: "module.key_vault.azurerm_key_vault.kv", Attribute: "network_acls.0.ip_rules", Reason: "normalized to CIDR"},
+		{Address: "module.key_vault.azurerm_key_vault_secret.secrets", Attribute: "value", Reason: "written from outside"},
+		{Address: "azurerm_storage_account.cloud_shell", Reason: "keys rotate"},
+		{Address: "random_password.sql_admin_password", Attribute: "result", Reason: "does not cover a replacement"},
+	})
+	require.Len(t, changes, 2)
+	assert.Equal(t, "module.key_vault.azurerm_key_vault.kv", changes[0].Address)
+	assert.Equal(t, []drift.Attribute{{Path: "tags.managed_by", After: "terraform", Category: drift.Tags}}, changes[0].Attributes)
+	assert.Equal(t, "random_password.sql_admin_password", changes[1].Address)
+
+	assert.Empty(t, Unexpected(report, []Unstable{
+		{Address: "module.key_vault.azurerm_key_vault.kv", Attribute: "network_acls"},
+		{Address: "module.key_vault.azurerm_key_vault.kv", Attribute: "tags"},
+		{Address: `module.key_vault.azurerm_key_vault_secret.secrets["openai-key"]`},
+		{Address: "azurerm_storage_account.cloud_shell"},
+		{Address: "random_password.sql_admin_password"},
+	}))
+}
+
+func TestUnstableCovers(t *testing.T) {
+	t.Parallel()
+
+	u := Unstable{Address: "module.kv.azurerm_key_vault.kv", Attribute: "network_acls.0"}
+	assert.True(t, u.covers("module.kv.azurerm_key_vault.kv", "network_acls.0.ip_rules"))
+	assert.True(t, u.covers("module.kv.azurerm_key_vault.kv", "network_acls.0"))
+	assert.False(t, u.covers("module.kv.azurerm_key_vault.kv", "network_acls.00"))
+	assert.False(t, u.covers("module.kv.azurerm_key_vault.kv", ""))
+	assert.False(t, u.covers("module.other.azurerm_key_vault.kv", "network_acls.0"))
+}
+
+func TestImpureCalls(t *testing.T) {
+	t.Parallel()
+
+	calls, err := ImpureCalls("testdata/impure")
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"testdata/impure/child/main.tf:6: uuid()",
+		"testdata/impure/main.tf:3: timestamp()",
+	}, calls)
+}
+
+// TestNoImpureCalls verifies that the roots and modules in this repository
+// plan the same values twice, which is why neither the stack nor the module
+// helpers allowlist any per-plan churn
+func TestNoImpureCalls(t *testing.T) {
+	t.Parallel()
+
+	roots := []string{"../../rpg-aiapp-infra", "../../demo-rpg-aiapp/infra"}
+	dirs := append([]string{}, roots...)
+	for _, root := range roots {
+		modules, err := filepath.Glob(filepath.Join(root, "modules", "*"))
+		require.NoError(t, err)
+		dirs = append(dirs, modules...)
+	}
+	for _, dir := range dirs {
+		calls, err := ImpureCalls(dir)
+		require.NoError(t, err)
+		assert.Empty(t, calls, dir)
+	}
+}
@@ -0,0 +1,7 @@
+variable "name" {
+  type = string
+}
+
+resource "azurerm_storage_account" "sa" {
+  name = "${var.name}${substr(uuid(), 0, 8)}"
+}
@@ -0,0 +1,18 @@
+locals {
+  tags = {
+    created_date = formatdate("YYYY-MM-DD", timestamp())
+  }
+}
+
+resource "time_static" "created" {}
+
+resource "azurerm_resource_group" "rg" {
+  name     = "rg"
+  location = "japaneast"
+  tags     = merge(local.tags, { created = time_static.created.rfc3339 })
+}
+
+module "child" {
+  source = "./child"
+  name   = "child"
+}
@@ -0,0 +1,203 @@
+// Package janitor deletes the resource groups a test left behind, such as when
+// go test was killed before its cleanups ran. It only touches groups whose
+// names start with a test prefix, and decides their age from CreatedTag.
+package janitor
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/vanehru/terraform-modules/testkit/arm"
+	"github.com/vanehru/terraform-modules/testkit/config"
+)
+
+// CreatedTag is the tag the harness stamps on the resource groups it creates,
+// holding the creation time in RFC 3339
+const CreatedTag = "testkit-created"
+
+// DefaultTTL is how old a group must be before Run deletes it. It is longer
+// than the full_test timeout, so a running test keeps its groups.
+const DefaultTTL = 6 * time.Hour
+
+// LegacyPrefixes start the resource group names the suites generated before
+// names came from test-config.yml
+var LegacyPrefixes = []string{
+	"rpg-aiapp-rg-test-",
+	"rpg-aiapp-integration-",
+	"test-kv-rg-",
+	"test-sql-rg-",
+	"test-openai-rg-",
+	"test-func-rg-",
+}
+
+// Prefixes returns the name prefixes of the groups the suites create with
+// cfg: its resource_prefix and LegacyPrefixes
+func Prefixes(cfg *config.Config) []string {
+	return append([]string{cfg.NamePrefix() + "-"}, LegacyPrefixes...)
+}
+
+// Options configure Run
+type Options struct {
+	// Prefixes are the name prefixes of the groups to consider. Run
+	// considers none without them.
+	Prefixes []string
+	// TTL defaults to DefaultTTL
+	TTL time.Duration
+	// DryRun reports what Run would delete without deleting it
+	DryRun bool
+	// IncludeUntagged deletes matching groups without CreatedTag too, such as
+	// a group created outside the harness or by a configuration without a
+	// tags variable
+	IncludeUntagged bool
+	// Now defaults to time.Now
+	Now func() time.Time
+}
+
+// Action is what Run did with a resource group
+type Action string
+
+// Actions
+const (
+	Deleted     Action = "deleted"
+	WouldDelete Action = "would-delete"
+	Kept        Action = "kept"
+	Failed      Action = "failed"
+)
+
+// Result is Run's decision about one resource group
+type Result struct {
+	Name     string     `json:"name"`
+	Location string     `json:"location"`
+	Created  *time.Time `json:"created,omitempty"`
+	// Age is how long ago Created was, rounded to the second
+	Age    string `json:"age,omitempty"`
+	Action Action `json:"action"`
+	Reason string `json:"reason"`
+	Error  string `json:"error,omitempty"`
+}
+
+// Report is the outcome of a Run
+type Report struct {
+	DryRun   bool     `json:"dry_run"`
+	TTL      string   `json:"ttl"`
+	Prefixes []string `json:"prefixes"`
+	// Results holds the groups that matched a prefix, by name
+	Results []Result `json:"results"`
+}
+
+// Failed returns the results whose delete failed
+func (r *Report) Failed() []Result {
+	var failed []Result
+	for _, result := range r.Results {
+		if result.Action == Failed {
+			failed = append(failed, result)
+		}
+	}
+	return failed
+}
+
+// WriteText writes the report as a table
+func (r *Report) WriteText(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tACTION\tAGE\tREASON")
+	for _, result := range r.Results {
+		age := result.Age
+		if age == "" {
+			age = "-"
+		}
+		reason := result.Reason
+		if result.Error != "" {
+			reason += ": " + result.Error
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", result.Name, result.Action, age, reason)
+	}
+	return tw.Flush()
+}
+
+// Run lists the resource groups client can see and deletes those that match
+// a prefix and are older than the TTL. It starts each delete without waiting
+// for it, and carries on past a delete that fails, reporting it as Failed.
+func Run(ctx context.Context, client arm.ResourceGroupClient, opts Options) (*Report, error) {
+	if opts.TTL <= 0 {
+		opts.TTL = DefaultTTL
+	}
+	now := time.Now
+	if opts.Now != nil {
+		now = opts.Now
+	}
+
+	groups, err := client.ListResourceGroups(ctx)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i].Name < groups[j].Name })
+
+	report := &Report{DryRun: opts.DryRun, TTL: opts.TTL.String(), Prefixes: opts.Prefixes, Results: []Result{}}
+	for _, group := range groups {
+		if !hasPrefix(group.Name, opts.Prefixes) {
+			continue
+		}
+		result, expired := decide(group, opts, now())
+		switch {
+		case !expired:
+		case opts.DryRun:
+			result.Action = WouldDelete
+		default:
+			result.Action = Deleted
+			if err := client.DeleteResourceGroup(ctx, group.Name); err != nil {
+				result.Action, result.Error = Failed, err.Error()
+			}
+		}
+		report.Results = append(report.Results, result)
+	}
+	return report, nil
+}
+
+// decide reports whether group is old enough to delete, with the reason in
+// a Kept result
+func decide(group arm.ResourceGroup, opts Options, now time.Time) (Result, bool) {
+	result := Result{Name: group.Name, Location: group.Location, Action: Kept}
+	if strings.EqualFold(group.Properties.ProvisioningState, "Deleting") {
+		result.Reason = "already being deleted"
+		return result, false
+	}
+
+	value, ok := group.Tags[CreatedTag]
+	if !ok {
+		if opts.IncludeUntagged {
+			result.Reason = "no " + CreatedTag + " tag"
+			return result, true
+		}
+		result.Reason = "no " + CreatedTag + " tag; untagged groups are only deleted on request"
+		return result, false
+	}
+	created, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		result.Reason = fmt.Sprintf("%s tag %q is not an RFC 3339 time", CreatedTag, value)
+		return result, false
+	}
+
+	age := now.Sub(created)
+	result.Created = &created
+	result.Age = age.Round(time.Second).String()
+	if age < opts.TTL {
+		result.Reason = "younger than the TTL of " + opts.TTL.String()
+		return result, false
+	}
+	result.Reason = "older than the TTL of " + opts.TTL.String()
+	return result, true
+}
+
+func hasPrefix(name string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if prefix != "" && strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,153 @@
+package janitor
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/vanehru/terraform-modules/testkit/arm"
+	"github.com/vanehru/terraform-modules/testkit/armtest"
+	"github.com/vanehru/terraform-modules/testkit/config"
+)
+
+var now = time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+// newClient returns a client for an armtest server holding groups, keyed by
+// name, with CreatedTag set to the given age unless it is negative
+func newClient(t *testing.T, groups map[string]time.Duration) (*arm.Client, *armtest.Server) {
+	server := armtest.NewServer(t)
+	for name, age := range groups {
+		tags := map[string]string{"environment": "development"}
+		if age >= 0 {
+			tags[CreatedTag] = now.Add(-age).Format(time.RFC3339)
+		}
+		require.NoError(t, server.Put("/subscriptions/"+armtest.SubscriptionID+"/resourceGroups/"+name,
+			map[string]interface{}{"location": "japaneast", "tags": tags}))
+	}
+	client := arm.NewClient(server.URL, armtest.SubscriptionID, func(ctx context.Context) (string, error) {
+		return server.Token(), nil
+	})
+	client.HTTPClient = server.Client()
+	return client, server
+}
+
+func actions(report *Report) map[string]Action {
+	got := map[string]Action{}
+	for _, result := range report.Results {
+		got[result.Name] = result.Action
+	}
+	return got
+}
+
+func TestRun(t *testing.T) {
+	t.Parallel()
+
+	client, server := newClient(t, map[string]time.Duration{
+		"test-rpg-aiapp-rg-old":    7 * time.Hour,
+		"test-rg-new":              time.Hour,
+		"test-rg-untagged":         -1,
+		"rpg-aiapp-rg-test-legacy": 48 * time.Hour,
+		"production-rg":            48 * time.Hour,
+	})
+	opts := Options{Prefixes: Prefixes(config.Default()), Now: func() time.Time { return now }}
+
+	opts.DryRun = true
+	report, err := Run(context.Background(), client, opts)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]Action{
+		"rpg-aiapp-rg-test-legacy": WouldDelete,
+		"test-rg-new":              Kept,
+		"test-rg-untagged":         Kept,
+		"test-rpg-aiapp-rg-old":    WouldDelete,
+	}, actions(report), "production-rg does not match a prefix")
+	assert.Len(t, server.ResourceIDs(), 5, "a dry run should delete nothing")
+	assert.Equal(t, "7h0m0s", report.Results[3].Age)
+	assert.Equal(t, "younger than the TTL of 6h0m0s", report.Results[1].Reason)
+
+	opts.DryRun = false
+	report, err = Run(context.Background(), client, opts)
+	require.NoError(t, err)
+	assert.Empty(t, report.Failed())
+	assert.Equal(t, Deleted, actions(report)["test-rpg-aiapp-rg-old"])
+	group, err := client.GetResourceGroup(context.Background(), "test-rpg-aiapp-rg-old")
+	require.NoError(t, err)
+	assert.Equal(t, "Deleting", group.Properties.ProvisioningState)
+
+	// A group being deleted is left alone, and untagged ones go on request
+	opts.IncludeUntagged = true
+	report, err = Run(context.Background(), client, opts)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]Action{
+		"rpg-aiapp-rg-test-legacy": Kept,
+		"test-rg-new":              Kept,
+		"test-rg-untagged":         Deleted,
+		"test-rpg-aiapp-rg-old":    Kept,
+	}, actions(report))
+	assert.Equal(t, "already being deleted", report.Results[0].Reason)
+}
+
+func TestRunTTL(t *testing.T) {
+	t.Parallel()
+
+	client, _ := newClient(t, map[string]time.Duration{"ci-rg-a": 90 * time.Minute})
+	report, err := Run(context.Background(), client, Options{
+		Prefixes: []string{"ci-"},
+		TTL:      time.Hour,
+		DryRun:   true,
+		Now:      func() time.Time { return now },
+	})
+	require.NoError(t, err)
+	require.Len(t, report.Results, 1)
+	assert.Equal(t, WouldDelete, report.Results[0].Action)
+	assert.Equal(t, "older than the TTL of 1h0m0s", report.Results[0].Reason)
+	assert.True(t, report.Results[0].Created.Equal(now.Add(-90*time.Minute)))
+}
+
+// failingClient fails every delete
+type failingClient struct {
+	groups []arm.ResourceGroup
+}
+
+func (c failingClient) ListResourceGroups(ctx context.Context) ([]arm.ResourceGroup, error) {
+	return c.groups, nil
+}
+
+func (c failingClient) GetResourceGroup(ctx context.Context, name string) (*arm.ResourceGroup, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (c failingClient) SetTags(ctx context.Context, name string, tags map[string]string) (*arm.ResourceGroup, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (c failingClient) DeleteResourceGroup(ctx context.Context, name string) error {
+	return &arm.Error{StatusCode: 409, Code: "ScopeLocked", Message: "The scope is locked."}
+}
+
+func TestRunReportsFailures(t *testing.T) {
+	t.Parallel()
+
+	client := failingClient{groups: []arm.ResourceGroup{
+		{Name: "test-rg-a", Tags: map[string]string{CreatedTag: "2024-04-01T00:00:00Z"}},
+		{Name: "test-rg-b", Tags: map[string]string{CreatedTag: "yesterday"}},
+	}}
+	report, err := Run(context.Background(), client, Options{Prefixes: []string{"test-"}, Now: func() time.Time { return now }})
+	require.NoError(t, err)
+	require.Len(t, report.Failed(), 1)
+	assert.Equal(t, "arm: 409 ScopeLocked: The scope is locked.", report.Failed()[0].Error)
+	assert.Equal(t, `testkit-created tag "yesterday" is not an RFC 3339 time`, report.Results[1].Reason)
+
+	var text bytes.Buffer
+	require.NoError(t, report.WriteText(&text))
+	lines := strings.Split(strings.TrimSpace(text.String()), "\n")
+	require.Len(t, lines, 3)
+	assert.Regexp(t, `^NAME\s+ACTION\s+AGE\s+REASON$`, lines[0])
+	assert.Regexp(t, `^test-rg-a\s+failed\s+732h0m0s\s+older than the TTL of 6h0m0s: arm: 409 ScopeLocked`, lines[1])
+	assert.Regexp(t, `^test-rg-b\s+kept\s+-\s+`, lines[2])
+}
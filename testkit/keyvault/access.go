@@ -0,0 +1,526 @@
+package keyvault
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/stretchr/testify/require"
+
+	"github.com/vanehru/terraform-modules/testkit/arm"
+	"github.com/vanehru/terraform-modules/testkit/keyvault/kvroles"
+	"github.com/vanehru/terraform-modules/testkit/tfconfig"
+)
+
+// ManagementAPIVersion is the Microsoft.KeyVault/vaults API version
+// ARMVaults reads with
+const ManagementAPIVersion = "2022-07-01"
+
+// RoleAssignmentAPIVersion is the Microsoft.Authorization/roleAssignments API
+// version ARMVaults lists with
+const RoleAssignmentAPIVersion = "2022-04-01"
+
+// DeployerObjectID is the reference a root declares the deploying
+// principal's access policy with
+const DeployerObjectID = "data.azurerm_client_config.current.object_id"
+
+// ReaderSecretPermissions are the only permissions an application that reads
+// its configuration from the vault, such as the Function App, should hold
+var ReaderSecretPermissions = []string{"Get", "List"}
+
+// DeletionPermissions are the permissions whose grant to the deploying
+// principal has to match the configuration, since they decide whether a
+// destroy can delete and purge what it created
+var DeletionPermissions = []string{"Delete", "Purge"}
+
+// OfficerSecretPermissions are the permissions the deploying principal needs,
+// besides DeletionPermissions, to manage the secrets the configuration writes,
+// as a Key Vault Secrets Officer can
+var OfficerSecretPermissions = []string{"Get", "List", "Set", "Recover"}
+
+// VaultClient reads Key Vaults and the role assignments on them through
+// Resource Manager
+type VaultClient interface {
+	// Vault returns the named vault
+	Vault(ctx context.Context, resourceGroup, name string) (*Vault, error)
+	// RoleAssignments returns the role assignments Resource Manager lists for
+	// scope, which include those above and below it
+	RoleAssignments(ctx context.Context, scope string) ([]RoleAssignment, error)
+}
+
+// Vault is a vault as Resource Manager returns it. With
+// EnableRBACAuthorization set, Azure ignores AccessPolicies and authorizes
+// data-plane calls with role assignments.
+type Vault struct {
+	ID         string `json:"id"`
+	Name       string `json:"name"`
+	Properties struct {
+		EnableRBACAuthorization bool           `json:"enableRbacAuthorization"`
+		AccessPolicies          []AccessPolicy `json:"accessPolicies"`
+	} `json:"properties"`
+}
+
+// RoleAssignment is a role assignment as Resource Manager returns it
+type RoleAssignment struct {
+	ID         string `json:"id"`
+	Properties struct {
+		RoleDefinitionID string `json:"roleDefinitionId"`
+		PrincipalID      string `json:"principalId"`
+		Scope            string `json:"scope"`
+	} `json:"properties"`
+}
+
+// Permissions are the operations an access policy grants, per kind of object
+type Permissions struct {
+	Keys         []string `json:"keys,omitempty"`
+	Secrets      []string `json:"secrets,omitempty"`
+	Certificates []string `json:"certificates,omitempty"`
+	Storage      []string `json:"storage,omitempty"`
+}
+
+// kinds pairs each kind of object with its permissions, in the order
+// problems report them
+func (p Permissions) kinds() []struct {
+	name        string
+	permissions []string
+} {
+	return []struct {
+		name        string
+		permissions []string
+	}{
+		{"secret", p.Secrets},
+		{"key", p.Keys},
+		{"certificate", p.Certificates},
+		{"storage", p.Storage},
+	}
+}
+
+// AccessPolicy is an entry of a vault's accessPolicies as Resource Manager
+// returns it
+type AccessPolicy struct {
+	TenantID    string      `json:"tenantId"`
+	ObjectID    string      `json:"objectId"`
+	Permissions Permissions `json:"permissions"`
+}
+
+// ARMVaults is a VaultClient for the Resource Manager REST API
+type ARMVaults struct {
+	Client *arm.Client
+}
+
+// Vault reads the vault in resourceGroup of the client's subscription
+func (v *ARMVaults) Vault(ctx context.Context, resourceGroup, name string) (*Vault, error) {
+	id := fmt.Sprintf("/subscriptions/%s/resourceGroups/%s/providers/Microsoft.KeyVault/vaults/%s",
+		url.PathEscape(v.Client.SubscriptionID), url.PathEscape(resourceGroup), url.PathEscape(name))
+	vault := &Vault{}
+	if err := v.Client.GetResource(ctx, id, ManagementAPIVersion, vault); err != nil {
+		return nil, err
+	}
+	return vault, nil
+}
+
+// RoleAssignments lists the role assignments for the resource at scope,
+// following nextLink
+func (v *ARMVaults) RoleAssignments(ctx context.Context, scope string) ([]RoleAssignment, error) {
+	resources, err := v.Client.ListResources(ctx, strings.TrimSuffix(scope, "/")+"/providers/Microsoft.Authorization/roleAssignments", RoleAssignmentAPIVersion)
+	if err != nil {
+		return nil, err
+	}
+	assignments := make([]RoleAssignment, len(resources))
+	for i, data := range resources {
+		if err := json.Unmarshal(data, &assignments[i]); err != nil {
+			return nil, err
+		}
+	}
+	return assignments, nil
+}
+
+// DeclaredPolicy is an entry of the access_policies a root passes the
+// key-vault module. ObjectID is the reference it is set with, such as
+// DeployerObjectID, or the literal object ID.
+type DeclaredPolicy struct {
+	ObjectID    string
+	Permissions Permissions
+}
+
+// DeclaredPolicies reads the access_policies the module block named module
+// in the root at dir passes, which has to be a literal list of objects whose
+// permissions are literal. Commented-out entries are not declared.
+func DeclaredPolicies(dir, module string) ([]DeclaredPolicy, error) {
+	root, err := tfconfig.Load(dir)
+	if err != nil {
+		return nil, err
+	}
+	var call *tfconfig.ModuleCall
+	for _, c := range root.ModuleCalls {
+		if c.Name == module {
+			call = c
+		}
+	}
+	if call == nil {
+		return nil, fmt.Errorf("%s has no module %q", dir, module)
+	}
+	attr, ok := call.Body.Attributes["access_policies"]
+	if !ok {
+		return nil, nil
+	}
+	list, ok := attr.Expr.(*hclsyntax.TupleConsExpr)
+	if !ok {
+		return nil, fmt.Errorf("%s: module.%s.access_policies is not a literal list", attr.SrcRange, module)
+	}
+
+	var policies []DeclaredPolicy
+	for _, expr := range list.Exprs {
+		object, ok := expr.(*hclsyntax.ObjectConsExpr)
+		if !ok {
+			return nil, fmt.Errorf("%s: an access policy is not a literal object", expr.Range())
+		}
+		var policy DeclaredPolicy
+		for _, item := range object.Items {
+			name := hcl.ExprAsKeyword(item.KeyExpr)
+			var target *[]string
+			switch name {
+			case "object_id":
+				if policy.ObjectID, ok = reference(item.ValueExpr); !ok {
+					return nil, fmt.Errorf("%s: object_id is neither a reference nor a literal", item.ValueExpr.Range())
+				}
+				continue
+			case "secret_permissions":
+				target = &policy.Permissions.Secrets
+			case "key_permissions":
+				target = &policy.Permissions.Keys
+			case "certificate_permissions":
+				target = &policy.Permissions.Certificates
+			case "storage_permissions":
+				target = &policy.Permissions.Storage
+			default:
+				continue
+			}
+			if *target, ok = tfconfig.StaticStrings(item.ValueExpr); !ok {
+				return nil, fmt.Errorf("%s: %s is not a literal list of strings", item.ValueExpr.Range(), name)
+			}
+		}
+		policies = append(policies, policy)
+	}
+	return policies, nil
+}
+
+// reference returns expr as a dotted reference, such as
+// module.function_app.function_app_identity_principal_id, or as its literal
+// string value
+func reference(expr hcl.Expression) (string, bool) {
+	traversal, diags := hcl.AbsTraversalForExpr(expr)
+	if diags.HasErrors() {
+		return tfconfig.StaticString(expr)
+	}
+	parts := []string{traversal.RootName()}
+	for _, step := range traversal[1:] {
+		attr, ok := step.(hcl.TraverseAttr)
+		if !ok {
+			return "", false
+		}
+		parts = append(parts, attr.Name)
+	}
+	return strings.Join(parts, "."), true
+}
+
+// DeclaredDeployer returns the permissions policies declare for
+// DeployerObjectID, or an error if more than one entry does
+func DeclaredDeployer(policies []DeclaredPolicy) (Permissions, error) {
+	var found []Permissions
+	for _, policy := range policies {
+		if policy.ObjectID == DeployerObjectID {
+			found = append(found, policy.Permissions)
+		}
+	}
+	switch len(found) {
+	case 0:
+		return Permissions{}, nil
+	case 1:
+		return found[0], nil
+	default:
+		return Permissions{}, errors.New("more than one access policy is declared for " + DeployerObjectID)
+	}
+}
+
+// DeclaredRoleAssignment is an azurerm_role_assignment in a root whose scope
+// is a key-vault module's vault. PrincipalID is the reference it is set with,
+// like DeclaredPolicy.ObjectID, and Role the built-in role it assigns.
+type DeclaredRoleAssignment struct {
+	Address     string
+	PrincipalID string
+	Role        kvroles.Role
+}
+
+// DeclaredRoleAssignments reads the azurerm_role_assignment resources in the
+// root at dir whose scope refers to the module block named module. Their
+// principal_id has to be a reference or literal, and they have to assign a
+// built-in role by literal role_definition_name or role_definition_id.
+func DeclaredRoleAssignments(dir, module string) ([]DeclaredRoleAssignment, error) {
+	root, err := tfconfig.Load(dir)
+	if err != nil {
+		return nil, err
+	}
+	var assignments []DeclaredRoleAssignment
+	for _, r := range root.ResourcesOfType("azurerm_role_assignment") {
+		scope, ok := r.Body.Attributes["scope"]
+		if !ok || !refersToModule(scope.Expr, module) {
+			continue
+		}
+		assignment := DeclaredRoleAssignment{Address: r.Address()}
+		principal, ok := r.Body.Attributes["principal_id"]
+		if ok {
+			assignment.PrincipalID, ok = reference(principal.Expr)
+		}
+		if !ok {
+			return nil, fmt.Errorf("%s: %s: principal_id is neither a reference nor a literal", r.Range, r.Address())
+		}
+		if assignment.Role, err = declaredRole(r); err != nil {
+			return nil, fmt.Errorf("%s: %s: %w", r.Range, r.Address(), err)
+		}
+		assignments = append(assignments, assignment)
+	}
+	return assignments, nil
+}
+
+// declaredRole returns the built-in role r assigns
+func declaredRole(r *tfconfig.Resource) (kvroles.Role, error) {
+	if attr, ok := r.Body.Attributes["role_definition_name"]; ok {
+		name, ok := tfconfig.StaticString(attr.Expr)
+		if !ok {
+			return kvroles.Role{}, errors.New("role_definition_name is not a literal")
+		}
+		if role, ok := kvroles.ByName(name); ok {
+			return role, nil
+		}
+		return kvroles.Role{}, fmt.Errorf("%q is not a built-in role kvroles knows", name)
+	}
+	if attr, ok := r.Body.Attributes["role_definition_id"]; ok {
+		id, ok := tfconfig.StaticString(attr.Expr)
+		if !ok {
+			return kvroles.Role{}, errors.New("role_definition_id is not a literal")
+		}
+		if role, ok := kvroles.ByDefinitionID(id); ok {
+			return role, nil
+		}
+		return kvroles.Role{}, fmt.Errorf("%q is not a built-in role kvroles knows", id)
+	}
+	return kvroles.Role{}, errors.New("it sets neither role_definition_name nor role_definition_id")
+}
+
+// refersToModule reports whether expr refers to an output of module.<name>
+func refersToModule(expr hcl.Expression, name string) bool {
+	for _, traversal := range expr.Variables() {
+		if traversal.RootName() != "module" || len(traversal) < 2 {
+			continue
+		}
+		if attr, ok := traversal[1].(hcl.TraverseAttr); ok && attr.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// DeclaredDeployerRoles returns what the roles assignments give
+// DeployerObjectID amount to
+func DeclaredDeployerRoles(assignments []DeclaredRoleAssignment) Permissions {
+	var permissions Permissions
+	for _, assignment := range assignments {
+		if assignment.PrincipalID == DeployerObjectID {
+			permissions = permissions.add(rolePermissions(assignment.Role))
+		}
+	}
+	return permissions
+}
+
+// ExpectedAccess describes the principals CheckAccessPolicies and
+// CheckRoleAssignments look for
+type ExpectedAccess struct {
+	// FunctionAppPrincipalID is the Function App's managed identity, which
+	// should hold exactly ReaderSecretPermissions
+	FunctionAppPrincipalID string
+	// DeployerObjectID is the principal that applied the configuration. It
+	// should hold OfficerSecretPermissions.
+	DeployerObjectID string
+	// Deployer are the permissions the configuration's access policies
+	// declare for it. Their DeletionPermissions have to match what the
+	// vault grants.
+	Deployer Permissions
+	// DeployerRoles are what the roles the configuration assigns it on the
+	// vault amount to, which take the place of Deployer for a vault with
+	// RBAC authorization
+	DeployerRoles Permissions
+}
+
+// add returns p with the permissions of other appended
+func (p Permissions) add(other Permissions) Permissions {
+	p.Secrets = append(p.Secrets, other.Secrets...)
+	p.Keys = append(p.Keys, other.Keys...)
+	p.Certificates = append(p.Certificates, other.Certificates...)
+	p.Storage = append(p.Storage, other.Storage...)
+	return p
+}
+
+// rolePermissions returns the access policy permissions role amounts to
+func rolePermissions(role kvroles.Role) Permissions {
+	return Permissions{Secrets: role.Secrets, Keys: role.Keys, Certificates: role.Certificates}
+}
+
+// CheckAccessPolicies compares the access policies of a vault with expected
+// and returns a problem for each difference. Permissions compare
+// case-insensitively, as Resource Manager returns them in lower case, and
+// "all" counts as every permission. Policies for the same object are merged.
+func CheckAccessPolicies(policies []AccessPolicy, expected ExpectedAccess) []string {
+	granted := map[string]Permissions{}
+	for _, policy := range policies {
+		id := strings.ToLower(policy.ObjectID)
+		granted[id] = granted[id].add(policy.Permissions)
+	}
+	return checkAccess(granted, expected.Deployer, expected, "access policy")
+}
+
+// CheckRoleAssignments compares what the role assignments on the vault at
+// vaultID, and on the scopes above it, grant with expected, as
+// CheckAccessPolicies does for access policies. Assignments below the vault,
+// on a single secret, are left out. A Function App or deployer assignment of
+// a role kvroles does not know is a problem, as its rights cannot be checked.
+func CheckRoleAssignments(vaultID string, assignments []RoleAssignment, expected ExpectedAccess) []string {
+	granted := map[string]Permissions{}
+	var problems []string
+	for _, assignment := range assignments {
+		scope := strings.ToLower(strings.TrimSuffix(assignment.Properties.Scope, "/"))
+		vault := strings.ToLower(vaultID)
+		if scope != vault && !strings.HasPrefix(vault, scope+"/") {
+			continue
+		}
+		id := strings.ToLower(assignment.Properties.PrincipalID)
+		role, ok := kvroles.ByDefinitionID(assignment.Properties.RoleDefinitionID)
+		if !ok {
+			if id == strings.ToLower(expected.FunctionAppPrincipalID) || id == strings.ToLower(expected.DeployerObjectID) {
+				problems = append(problems, fmt.Sprintf("principal %s has role %s, whose rights are not known", assignment.Properties.PrincipalID, assignment.Properties.RoleDefinitionID))
+			}
+			continue
+		}
+		granted[id] = granted[id].add(rolePermissions(role))
+	}
+	return append(problems, checkAccess(granted, expected.DeployerRoles, expected, "role on the vault")...)
+}
+
+// checkAccess compares the permissions granted to each object ID with
+// expected. grant names what grants them in problems.
+func checkAccess(granted map[string]Permissions, declaredDeployer Permissions, expected ExpectedAccess, grant string) []string {
+	var problems []string
+	app, ok := granted[strings.ToLower(expected.FunctionAppPrincipalID)]
+	if !ok {
+		problems = append(problems, fmt.Sprintf("Function App identity %s has no %s", expected.FunctionAppPrincipalID, grant))
+	} else {
+		for _, kind := range app.kinds() {
+			want := []string(nil)
+			if kind.name == "secret" {
+				want = ReaderSecretPermissions
+			}
+			if !samePermissions(kind.permissions, want) {
+				problems = append(problems, fmt.Sprintf("Function App identity %s has %s permissions %s, want %s",
+					expected.FunctionAppPrincipalID, kind.name, describe(kind.permissions), describe(want)))
+			}
+		}
+	}
+
+	// A deployer without a grant holds nothing, which is what a
+	// configuration that declares none expects
+	deployer := granted[strings.ToLower(expected.DeployerObjectID)]
+	for _, permission := range OfficerSecretPermissions {
+		if !hasPermission(deployer.Secrets, permission) {
+			problems = append(problems, fmt.Sprintf("deploying principal %s lacks secret permission %s, which it needs to manage the secrets",
+				expected.DeployerObjectID, permission))
+		}
+	}
+	declared := declaredDeployer.kinds()
+	for i, kind := range deployer.kinds() {
+		for _, permission := range DeletionPermissions {
+			has, declares := hasPermission(kind.permissions, permission), hasPermission(declared[i].permissions, permission)
+			switch {
+			case has && !declares:
+				problems = append(problems, fmt.Sprintf("deploying principal %s has %s permission %s, which the configuration does not declare",
+					expected.DeployerObjectID, kind.name, permission))
+			case !has && declares:
+				problems = append(problems, fmt.Sprintf("deploying principal %s lacks %s permission %s, which the configuration declares",
+					expected.DeployerObjectID, kind.name, permission))
+			}
+		}
+	}
+	return problems
+}
+
+// accessTimeout bounds the calls ValidateAccess makes
+const accessTimeout = 2 * time.Minute
+
+// ValidateAccess reads the named vault and fails t for every problem
+// CheckAccessPolicies finds in its access policies, or, if it uses RBAC
+// authorization, that CheckRoleAssignments finds in the role assignments on
+// it. Either model has to give the same effective rights.
+func ValidateAccess(t *testing.T, client VaultClient, resourceGroup, name string, expected ExpectedAccess) {
+	ctx, cancel := context.WithTimeout(context.Background(), accessTimeout)
+	defer cancel()
+
+	require.NotEmpty(t, expected.FunctionAppPrincipalID, "the Function App should have a managed identity")
+	require.NotEmpty(t, expected.DeployerObjectID, "the deploying principal's object ID should be known")
+	vault, err := client.Vault(ctx, resourceGroup, name)
+	require.NoError(t, err)
+
+	var problems []string
+	if vault.Properties.EnableRBACAuthorization {
+		t.Logf("Key Vault %s uses RBAC authorization", name)
+		assignments, err := client.RoleAssignments(ctx, vault.ID)
+		require.NoError(t, err)
+		problems = CheckRoleAssignments(vault.ID, assignments, expected)
+	} else {
+		t.Logf("Key Vault %s uses access policies", name)
+		problems = CheckAccessPolicies(vault.Properties.AccessPolicies, expected)
+	}
+	for _, problem := range problems {
+		t.Error(problem)
+	}
+}
+
+func hasPermission(permissions []string, permission string) bool {
+	for _, p := range permissions {
+		if strings.EqualFold(p, permission) || strings.EqualFold(p, "all") {
+			return true
+		}
+	}
+	return false
+}
+
+// samePermissions reports whether got and want hold the same permissions,
+// ignoring case, order and repeats. "all" only matches itself.
+func samePermissions(got, want []string) bool {
+	set := func(permissions []string) string {
+		seen := map[string]bool{}
+		for _, p := range permissions {
+			seen[strings.ToLower(p)] = true
+		}
+		keys := make([]string, 0, len(seen))
+		for p := range seen {
+			keys = append(keys, p)
+		}
+		sort.Strings(keys)
+		return strings.Join(keys, ",")
+	}
+	return set(got) == set(want)
+}
+
+func describe(permissions []string) string {
+	if len(permissions) == 0 {
+		return "none"
+	}
+	return "[" + strings.Join(permissions, ", ") + "]"
+}
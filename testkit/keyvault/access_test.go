@@ -0,0 +1,207 @@
+package keyvault
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/vanehru/terraform-modules/testkit/arm"
+	"github.com/vanehru/terraform-modules/testkit/arm/armreplay"
+	"github.com/vanehru/terraform-modules/testkit/keyvault/kvroles"
+)
+
+// The principals and vault in testdata/recordings
+const (
+	recordedSubscription  = "00000000-0000-0000-0000-0000000000aa"
+	recordedResourceGroup = "rpg-aiapp-rg-test-abc123"
+	recordedVault         = "rpgkvabc123"
+	functionAppPrincipal  = "11111111-1111-1111-1111-111111111111"
+	deployerPrincipal     = "22222222-2222-2222-2222-222222222222"
+)
+
+func recordedVaults(t *testing.T, recording string) *ARMVaults {
+	server := armreplay.NewServer(t, "testdata/recordings/"+recording)
+	return &ARMVaults{Client: server.Client(recordedSubscription)}
+}
+
+func recordedPolicies(t *testing.T, recording string) []AccessPolicy {
+	vault, err := recordedVaults(t, recording).Vault(context.Background(), recordedResourceGroup, recordedVault)
+	require.NoError(t, err)
+	require.False(t, vault.Properties.EnableRBACAuthorization)
+	return vault.Properties.AccessPolicies
+}
+
+func declaredAccess(t *testing.T) ExpectedAccess {
+	declared, err := DeclaredPolicies("testdata/stack", "key_vault")
+	require.NoError(t, err)
+	deployer, err := DeclaredDeployer(declared)
+	require.NoError(t, err)
+	return ExpectedAccess{
+		FunctionAppPrincipalID: functionAppPrincipal,
+		DeployerObjectID:       deployerPrincipal,
+		Deployer:               deployer,
+	}
+}
+
+func TestDeclaredPolicies(t *testing.T) {
+	t.Parallel()
+
+	declared, err := DeclaredPolicies("testdata/stack", "key_vault")
+	require.NoError(t, err)
+	assert.Equal(t, []DeclaredPolicy{
+		{
+			ObjectID:    "module.function_app.function_app_identity_principal_id",
+			Permissions: Permissions{Secrets: []string{"Get", "List"}},
+		},
+		{
+			ObjectID:    DeployerObjectID,
+			Permissions: Permissions{Secrets: []string{"Get", "List", "Set", "Delete", "Purge", "Recover"}},
+		},
+	}, declared, "the commented-out policy should not be declared")
+
+	_, err = DeclaredPolicies("testdata/stack", "missing")
+	assert.Error(t, err)
+}
+
+func TestAccessPoliciesCompliant(t *testing.T) {
+	t.Parallel()
+
+	policies := recordedPolicies(t, "compliant")
+	require.Len(t, policies, 2)
+	assert.Equal(t, functionAppPrincipal, policies[0].ObjectID)
+	assert.Equal(t, []string{"get", "list"}, policies[0].Permissions.Secrets)
+
+	assert.Empty(t, CheckAccessPolicies(policies, declaredAccess(t)))
+}
+
+func TestAccessPoliciesOverprivileged(t *testing.T) {
+	t.Parallel()
+
+	problems := CheckAccessPolicies(recordedPolicies(t, "overprivileged"), declaredAccess(t))
+	assert.Equal(t, []string{
+		"Function App identity " + functionAppPrincipal + " has secret permissions [get, list, set], want [Get, List]",
+		"Function App identity " + functionAppPrincipal + " has key permissions [get], want none",
+		"deploying principal " + deployerPrincipal + " lacks secret permission Delete, which the configuration declares",
+		"deploying principal " + deployerPrincipal + " lacks secret permission Purge, which the configuration declares",
+		"deploying principal " + deployerPrincipal + " has certificate permission Delete, which the configuration does not declare",
+		"deploying principal " + deployerPrincipal + " has certificate permission Purge, which the configuration does not declare",
+	}, problems)
+}
+
+func TestCheckAccessPolicies(t *testing.T) {
+	t.Parallel()
+
+	expected := ExpectedAccess{FunctionAppPrincipalID: functionAppPrincipal, DeployerObjectID: deployerPrincipal}
+
+	problems := CheckAccessPolicies([]AccessPolicy{
+		{ObjectID: deployerPrincipal, Permissions: Permissions{Secrets: []string{"Get", "List", "Set"}}},
+	}, expected)
+	assert.Equal(t, []string{
+		"Function App identity " + functionAppPrincipal + " has no access policy",
+		"deploying principal " + deployerPrincipal + " lacks secret permission Recover, which it needs to manage the secrets",
+	}, problems, "a deployer needs no Delete or Purge the configuration does not declare")
+
+	problems = CheckAccessPolicies([]AccessPolicy{
+		{ObjectID: functionAppPrincipal, Permissions: Permissions{Secrets: []string{"Get"}}},
+		{ObjectID: functionAppPrincipal, Permissions: Permissions{Secrets: []string{"list", "Get"}}},
+		{ObjectID: deployerPrincipal, Permissions: Permissions{Secrets: OfficerSecretPermissions}},
+		{ObjectID: deployerPrincipal, Permissions: Permissions{Keys: []string{"all"}}},
+	}, expected)
+	assert.Equal(t, []string{
+		"deploying principal " + deployerPrincipal + " has key permission Delete, which the configuration does not declare",
+		"deploying principal " + deployerPrincipal + " has key permission Purge, which the configuration does not declare",
+	}, problems, "policies for one object should merge, and all should grant Delete and Purge")
+}
+
+func TestAccessPoliciesNotFound(t *testing.T) {
+	t.Parallel()
+
+	_, err := recordedVaults(t, "compliant").Vault(context.Background(), recordedResourceGroup, "other")
+	assert.True(t, arm.IsNotFound(err), "a request without a recording should be a 404: %v", err)
+}
+
+func TestDeclaredRoleAssignments(t *testing.T) {
+	t.Parallel()
+
+	assignments, err := DeclaredRoleAssignments("testdata/rbac", "key_vault")
+	require.NoError(t, err)
+	require.Len(t, assignments, 2, "the storage account assignment is not on the vault")
+	assert.Equal(t, "azurerm_role_assignment.function_app_secrets", assignments[0].Address)
+	assert.Equal(t, "module.function_app.function_app_identity_principal_id", assignments[0].PrincipalID)
+	assert.Equal(t, kvroles.SecretsUser, assignments[0].Role.Name)
+	assert.Equal(t, DeployerObjectID, assignments[1].PrincipalID)
+	assert.Equal(t, kvroles.SecretsOfficer, assignments[1].Role.Name, "role_definition_id should resolve too")
+
+	deployer := DeclaredDeployerRoles(assignments)
+	assert.Contains(t, deployer.Secrets, "Purge")
+	assert.Empty(t, deployer.Keys)
+
+	none, err := DeclaredRoleAssignments("testdata/stack", "key_vault")
+	require.NoError(t, err)
+	assert.Empty(t, none)
+}
+
+func TestRoleAssignmentsCompliant(t *testing.T) {
+	t.Parallel()
+
+	vaults := recordedVaults(t, "rbac")
+	ctx := context.Background()
+	vault, err := vaults.Vault(ctx, recordedResourceGroup, recordedVault)
+	require.NoError(t, err)
+	require.True(t, vault.Properties.EnableRBACAuthorization)
+	assignments, err := vaults.RoleAssignments(ctx, vault.ID)
+	require.NoError(t, err)
+	require.Len(t, assignments, 4)
+
+	declared, err := DeclaredRoleAssignments("testdata/rbac", "key_vault")
+	require.NoError(t, err)
+	expected := ExpectedAccess{
+		FunctionAppPrincipalID: functionAppPrincipal,
+		DeployerObjectID:       deployerPrincipal,
+		DeployerRoles:          DeclaredDeployerRoles(declared),
+	}
+	assert.Empty(t, CheckRoleAssignments(vault.ID, assignments, expected),
+		"Owner grants no data-plane rights, and the Administrator assignment on one secret is below the vault")
+}
+
+func TestCheckRoleAssignments(t *testing.T) {
+	t.Parallel()
+
+	vaultID := "/subscriptions/" + recordedSubscription + "/resourceGroups/" + recordedResourceGroup + "/providers/Microsoft.KeyVault/vaults/" + recordedVault
+	assign := func(scope, roleID, principal string) RoleAssignment {
+		var a RoleAssignment
+		a.Properties.Scope, a.Properties.RoleDefinitionID, a.Properties.PrincipalID = scope, roleID, principal
+		return a
+	}
+	administrator, _ := kvroles.ByName("Key Vault Administrator")
+	user, _ := kvroles.ByName(kvroles.SecretsUser)
+	expected := ExpectedAccess{FunctionAppPrincipalID: functionAppPrincipal, DeployerObjectID: deployerPrincipal}
+
+	problems := CheckRoleAssignments(vaultID, []RoleAssignment{
+		assign("/subscriptions/"+recordedSubscription+"/resourceGroups/"+recordedResourceGroup, administrator.ID, functionAppPrincipal),
+		assign(vaultID, user.ID, deployerPrincipal),
+		assign(vaultID, "/providers/Microsoft.Authorization/roleDefinitions/custom", deployerPrincipal),
+	}, expected)
+	require.NotEmpty(t, problems)
+	assert.Equal(t, "principal "+deployerPrincipal+" has role /providers/Microsoft.Authorization/roleDefinitions/custom, whose rights are not known", problems[0])
+	assert.Contains(t, problems, "Function App identity "+functionAppPrincipal+" has key permissions "+describe(administrator.Keys)+", want none",
+		"a role inherited from the resource group applies to the vault")
+	assert.Contains(t, problems, "deploying principal "+deployerPrincipal+" lacks secret permission Set, which it needs to manage the secrets")
+
+	problems = CheckRoleAssignments(vaultID, nil, expected)
+	assert.Contains(t, problems, "Function App identity "+functionAppPrincipal+" has no role on the vault")
+}
+
+func TestRPGDeclaresDeployerDeletion(t *testing.T) {
+	t.Parallel()
+
+	declared, err := DeclaredPolicies("../../rpg-aiapp-infra", "key_vault")
+	require.NoError(t, err)
+	deployer, err := DeclaredDeployer(declared)
+	require.NoError(t, err)
+	for _, permission := range DeletionPermissions {
+		assert.Contains(t, deployer.Secrets, permission)
+	}
+}
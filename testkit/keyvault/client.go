@@ -0,0 +1,210 @@
+package keyvault
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/vanehru/terraform-modules/testkit/arm"
+	"github.com/vanehru/terraform-modules/testkit/config"
+	"github.com/vanehru/terraform-modules/testkit/deploy"
+)
+
+// APIVersion is the Key Vault REST API version Client speaks
+const APIVersion = "7.4"
+
+// Resource is the audience of the tokens the Key Vault data plane accepts
+const Resource = "https://vault.azure.net"
+
+// SecretClient lists and reads Key Vault secrets
+type SecretClient interface {
+	// ListSecrets returns every secret in the vault, without values
+	ListSecrets(ctx context.Context) ([]SecretItem, error)
+	// GetSecret returns the current version of a secret
+	GetSecret(ctx context.Context, name string) (*Secret, error)
+}
+
+// SecretAttributes are the management attributes of a secret
+type SecretAttributes struct {
+	Enabled bool `json:"enabled"`
+	// Created and Updated are Unix times in seconds
+	Created int64 `json:"created,omitempty"`
+	Updated int64 `json:"updated,omitempty"`
+}
+
+// SecretItem is a secret as ListSecrets returns it
+type SecretItem struct {
+	ID          string           `json:"id"`
+	ContentType string           `json:"contentType,omitempty"`
+	Attributes  SecretAttributes `json:"attributes"`
+}
+
+// Name returns the secret name from its ID
+func (s SecretItem) Name() string {
+	return secretName(s.ID)
+}
+
+// Secret is a secret version and its value
+type Secret struct {
+	ID          string           `json:"id"`
+	Value       string           `json:"value"`
+	ContentType string           `json:"contentType,omitempty"`
+	Attributes  SecretAttributes `json:"attributes"`
+}
+
+// Name returns the secret name from its ID
+func (s Secret) Name() string {
+	return secretName(s.ID)
+}
+
+// secretName returns the segment after /secrets/ in a secret ID such as
+// https://kv.vault.azure.net/secrets/name/version
+func secretName(id string) string {
+	_, rest, ok := strings.Cut(id, "/secrets/")
+	if !ok {
+		return ""
+	}
+	name, _, _ := strings.Cut(rest, "/")
+	return name
+}
+
+// Service names the Key Vault REST API in its errors, which are *arm.Error
+// values; arm.IsNotFound reports a missing secret
+const Service = "key vault"
+
+// Credential returns a token for Resource, authenticating as Terraform does
+// with test-config.yml
+func Credential(t *testing.T) arm.TokenFunc {
+	return arm.Credential(config.ForTest(t), Resource)
+}
+
+// ClientFor returns a Client for the vault at baseURL where deploy.Options
+// deploys it: Azure, authenticating with Credential, or deploy.FakeARM,
+// which serves the vault itself and accepts its own token
+func ClientFor(t *testing.T, baseURL string) *Client {
+	if !config.ForTest(t).FakeARM() {
+		return NewClient(baseURL, Credential(t))
+	}
+	server := deploy.FakeARM(t)
+	client := NewClient(baseURL, func(ctx context.Context) (string, error) {
+		return server.Token(), nil
+	})
+	client.HTTPClient = server.Client()
+	client.HTTPClient.Timeout = 30 * time.Second
+	return client
+}
+
+// Client is a SecretClient for the Key Vault REST API
+type Client struct {
+	// BaseURL is the vault URI, such as the key_vault_uri output, or the URL
+	// of a stand-in like vaulttest.Server
+	BaseURL string
+	// Token returns tokens for Resource, such as Credential or
+	// arm.AzureCLITokenFor(Resource)
+	Token arm.TokenFunc
+	// HTTPClient defaults to a client with a 30 second timeout
+	HTTPClient *http.Client
+}
+
+// NewClient returns a Client for the vault at baseURL
+func NewClient(baseURL string, token arm.TokenFunc) *Client {
+	return &Client{
+		BaseURL:    strings.TrimSuffix(baseURL, "/"),
+		Token:      token,
+		HTTPClient: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// ListSecrets follows nextLink through every page of secrets
+func (c *Client) ListSecrets(ctx context.Context) ([]SecretItem, error) {
+	var items []SecretItem
+	next := c.url("secrets")
+	for next != "" {
+		var page struct {
+			Value    []SecretItem `json:"value"`
+			NextLink string       `json:"nextLink"`
+		}
+		if err := c.get(ctx, next, &page); err != nil {
+			return nil, err
+		}
+		items = append(items, page.Value...)
+
+		if page.NextLink != "" {
+			if err := c.sameHost(page.NextLink); err != nil {
+				return nil, err
+			}
+		}
+		next = page.NextLink
+	}
+	return items, nil
+}
+
+// GetSecret returns the current version of the named secret
+func (c *Client) GetSecret(ctx context.Context, name string) (*Secret, error) {
+	secret := &Secret{}
+	if err := c.get(ctx, c.url("secrets", url.PathEscape(name)), secret); err != nil {
+		return nil, err
+	}
+	return secret, nil
+}
+
+func (c *Client) url(segments ...string) string {
+	return strings.TrimSuffix(c.BaseURL, "/") + "/" + strings.Join(segments, "/") + "?api-version=" + APIVersion
+}
+
+// sameHost keeps the bearer token from being sent anywhere but the vault
+func (c *Client) sameHost(link string) error {
+	base, err := url.Parse(c.BaseURL)
+	if err != nil {
+		return err
+	}
+	next, err := url.Parse(link)
+	if err != nil {
+		return err
+	}
+	if next.Scheme != base.Scheme || next.Host != base.Host {
+		return fmt.Errorf("key vault: nextLink %s leaves %s", link, c.BaseURL)
+	}
+	return nil
+}
+
+func (c *Client) get(ctx context.Context, rawURL string, out interface{}) error {
+	token, err := c.Token(ctx)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Accept", "application/json")
+
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return arm.ResponseError(Service, resp.StatusCode, body)
+	}
+	if err := json.Unmarshal(body, out); err != nil {
+		return fmt.Errorf("key vault: decoding %s: %w", req.URL.Path, err)
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+package keyvault
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/vanehru/terraform-modules/testkit/arm"
+	"github.com/vanehru/terraform-modules/testkit/keyvault/vaulttest"
+)
+
+func vaultToken(ctx context.Context) (string, error) {
+	return vaulttest.Token, nil
+}
+
+func TestClient(t *testing.T) {
+	t.Parallel()
+
+	server := vaulttest.NewServer(t)
+	server.PageSize = 2
+	for _, name := range []string{"sql-username", "openai-key", "openai-endpoint"} {
+		server.SetSecret(name, "value-of-"+name)
+	}
+	client := NewClient(server.URL+"/", vaultToken)
+	ctx := context.Background()
+
+	items, err := client.ListSecrets(ctx)
+	require.NoError(t, err)
+	var names []string
+	for _, item := range items {
+		names = append(names, item.Name())
+		assert.True(t, item.Attributes.Enabled)
+	}
+	assert.Equal(t, []string{"openai-endpoint", "openai-key", "sql-username"}, names, "Every page should be listed")
+
+	secret, err := client.GetSecret(ctx, "openai-key")
+	require.NoError(t, err)
+	assert.Equal(t, "openai-key", secret.Name())
+	assert.Equal(t, "value-of-openai-key", secret.Value)
+
+	_, err = client.GetSecret(ctx, "sql-password")
+	assert.True(t, arm.IsNotFound(err))
+	assert.EqualError(t, err, "key vault: 404 SecretNotFound: A secret with (name/id) sql-password was not found in this key vault.")
+
+	client.Token = func(ctx context.Context) (string, error) { return "expired", nil }
+	_, err = client.ListSecrets(ctx)
+	var vaultErr *arm.Error
+	require.ErrorAs(t, err, &vaultErr)
+	assert.Equal(t, "Unauthorized", vaultErr.Code)
+}
+
+func TestCheckSecrets(t *testing.T) {
+	t.Parallel()
+
+	server := vaulttest.NewServer(t)
+	server.SetSecret("sql-username", "sqladmin")
+	server.SetSecret("sql-server-fqdn", "rpg-sql.database.windows.net")
+	server.SetSecret("openai-endpoint", "https://rpg-openai.openai.azure.com/")
+	server.SetSecret("openai-key", "")
+	server.SetSecret("sql-connection-string", "Server=tcp:old")
+	server.Disable("sql-connection-string")
+
+	problems, err := CheckSecrets(context.Background(), NewClient(server.URL, vaultToken), map[string]string{
+		"sql-connection-string": "Server=tcp:rpg-sql",
+		"sql-username":          "sqladmin",
+		"sql-server-fqdn":       "rpg-sql.database.windows.net",
+		"sql-database-name":     "",
+		"openai-endpoint":       "https://other.openai.azure.com/",
+		"openai-key":            "",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		`secret "openai-endpoint" does not hold the expected value`,
+		`secret "openai-key" is empty`,
+		`secret "sql-connection-string" is disabled`,
+		`secret "sql-database-name" is missing`,
+	}, problems)
+}
+
+func TestSecretName(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, "openai-key", secretName("https://kv.vault.azure.net/secrets/openai-key"))
+	assert.Equal(t, "openai-key", secretName("https://kv.vault.azure.net/secrets/openai-key/0123abcd"))
+	assert.Empty(t, secretName("https://kv.vault.azure.net/keys/openai-key"))
+}
@@ -0,0 +1,120 @@
+// Package keyvault deploys and validates the key-vault module, and reads
+// secrets back through the Key Vault REST API
+package keyvault
+
+import (
+	"context"
+	"testing"
+
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/vanehru/terraform-modules/testkit/deploy"
+	"github.com/vanehru/terraform-modules/testkit/naming"
+	"github.com/vanehru/terraform-modules/testkit/privatedns"
+)
+
+// Outputs are the module outputs Validate reads
+var Outputs = []string{"key_vault_name", "key_vault_uri", "secret_ids"}
+
+// Expected describes the Key Vault a test deploys and expects back
+type Expected struct {
+	Name              string
+	ResourceGroupName string
+	Location          string
+	TenantID          string
+	Secrets           map[string]string
+	// PrivateEndpointSubnetID and VirtualNetworkID, such as a fixture.Network
+	// provides, put the vault behind a private endpoint when set
+	PrivateEndpointSubnetID string
+	VirtualNetworkID        string
+	// RBACAuthorization deploys the vault with enable_rbac_authorization and
+	// expects the vault to use it
+	RBACAuthorization bool
+}
+
+// Vars returns the module inputs that deploy expected. The network ACLs allow
+// public access so the test runner can reach the vault.
+func Vars(expected Expected) map[string]interface{} {
+	secrets := map[string]interface{}{}
+	for name, value := range expected.Secrets {
+		secrets[name] = value
+	}
+	vars := map[string]interface{}{
+		"key_vault_name":              expected.Name,
+		"location":                    expected.Location,
+		"resource_group_name":         expected.ResourceGroupName,
+		"tenant_id":                   expected.TenantID,
+		"sku_name":                    "standard",
+		"purge_protection_enabled":    false,
+		"network_acls_default_action": "Allow", // For testing
+		"network_acls_bypass":         "AzureServices",
+		"secrets":                     secrets,
+		"enable_private_endpoint":     expected.PrivateEndpointSubnetID != "",
+	}
+	if expected.PrivateEndpointSubnetID != "" {
+		vars["private_endpoint_subnet_id"] = expected.PrivateEndpointSubnetID
+		vars["virtual_network_id"] = expected.VirtualNetworkID
+	}
+	if expected.RBACAuthorization {
+		vars["enable_rbac_authorization"] = true
+	}
+	return vars
+}
+
+// Test deploys the key-vault module in terraformDir, validates it against
+// expected and destroys it. Names Azure would reject fail the test before
+// anything is deployed.
+func Test(t *testing.T, terraformDir string, expected Expected) {
+	naming.Require(t, "azurerm_key_vault", expected.Name)
+	for name := range expected.Secrets {
+		naming.Require(t, "azurerm_key_vault_secret", name)
+	}
+	terraformOptions := deploy.Options(t, terraformDir, Vars(expected))
+	deploy.Run(t, terraformOptions, nil, func(t *testing.T, terraformOptions *terraform.Options) {
+		Validate(t, terraformOptions, expected)
+	})
+}
+
+// Validate runs the standard checks against an applied key-vault module
+func Validate(t *testing.T, terraformOptions *terraform.Options, expected Expected) {
+	t.Run("KeyVaultExists", func(t *testing.T) {
+		actualKVName := terraform.Output(t, terraformOptions, "key_vault_name")
+		assert.Equal(t, expected.Name, actualKVName)
+	})
+
+	t.Run("KeyVaultURI", func(t *testing.T) {
+		kvURI := terraform.Output(t, terraformOptions, "key_vault_uri")
+		assert.Contains(t, kvURI, expected.Name)
+		assert.Contains(t, kvURI, "vault.azure.net")
+	})
+
+	t.Run("AuthorizationModel", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), accessTimeout)
+		defer cancel()
+		vaults := &ARMVaults{Client: deploy.ARMClient(t)}
+		vault, err := vaults.Vault(ctx, expected.ResourceGroupName, expected.Name)
+		require.NoError(t, err)
+		assert.Equal(t, expected.RBACAuthorization, vault.Properties.EnableRBACAuthorization,
+			"the vault should authorize with RBAC only if expected")
+	})
+
+	t.Run("SecretsCreated", func(t *testing.T) {
+		secretIDs := terraform.OutputMap(t, terraformOptions, "secret_ids")
+		for name := range expected.Secrets {
+			assert.Contains(t, secretIDs, name, "Secret %s should be created", name)
+		}
+	})
+
+	t.Run("SecretValues", func(t *testing.T) {
+		kvURI := terraform.Output(t, terraformOptions, "key_vault_uri")
+		ValidateSecrets(t, ClientFor(t, kvURI), expected.Secrets)
+	})
+
+	if expected.PrivateEndpointSubnetID != "" {
+		t.Run("PrivateDNS", func(t *testing.T) {
+			privatedns.ValidateApplied(t, terraformOptions, deploy.ARMClient(t), expected.ResourceGroupName, expected.VirtualNetworkID)
+		})
+	}
+}
@@ -0,0 +1,66 @@
+package keyvault
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/vanehru/terraform-modules/testkit/arm"
+	"github.com/vanehru/terraform-modules/testkit/armtest"
+	"github.com/vanehru/terraform-modules/testkit/tfconfig"
+)
+
+// TestVarsDeclared verifies that both key-vault modules declare every input
+// Vars passes, so Terraform does not reject a -var, and that the RBAC input
+// reaches the vault
+func TestVarsDeclared(t *testing.T) {
+	t.Parallel()
+
+	vars := Vars(Expected{
+		Name:                    "rpgkvabc123",
+		Secrets:                 map[string]string{"openai-key": "value"},
+		PrivateEndpointSubnetID: "subnet",
+		VirtualNetworkID:        "vnet",
+		RBACAuthorization:       true,
+	})
+	assert.Equal(t, true, vars["enable_rbac_authorization"])
+	assert.NotContains(t, Vars(Expected{Name: "rpgkvabc123"}), "enable_rbac_authorization")
+
+	for _, dir := range []string{"../../rpg-aiapp-infra/modules/key-vault", "../../demo-rpg-aiapp/infra/modules/key-vault"} {
+		mod, err := tfconfig.Load(dir)
+		require.NoError(t, err)
+		for name := range vars {
+			assert.Contains(t, mod.Variables, name, "%s should declare the %s Vars passes", dir, name)
+		}
+
+		vaults := mod.ResourcesOfType("azurerm_key_vault")
+		require.Len(t, vaults, 1, dir)
+		attr, ok := vaults[0].Body.Attributes["enable_rbac_authorization"]
+		require.True(t, ok, "%s should set enable_rbac_authorization, the azurerm 3.x name", dir)
+		assert.Equal(t, []string{"enable_rbac_authorization"}, tfconfig.VariableRefs(attr.Expr), dir)
+	}
+}
+
+// TestAuthorizationModelFakeARM verifies that the vault Validate reads back
+// reports RBAC authorization when it is deployed to the fake Resource Manager
+func TestAuthorizationModelFakeARM(t *testing.T) {
+	t.Parallel()
+
+	server := armtest.NewServer(t)
+	group := "/subscriptions/" + armtest.SubscriptionID + "/resourceGroups/rg"
+	require.NoError(t, server.Put(group, map[string]interface{}{"location": "japaneast"}))
+	require.NoError(t, server.Put(group+"/providers/Microsoft.KeyVault/vaults/rpgkvabc123", map[string]interface{}{
+		"location":   "japaneast",
+		"properties": map[string]interface{}{"tenantId": armtest.TenantID, "enableRbacAuthorization": true},
+	}))
+
+	client := arm.NewClient(server.URL, armtest.SubscriptionID, func(ctx context.Context) (string, error) {
+		return server.Token(), nil
+	})
+	client.HTTPClient = server.Client()
+	vault, err := (&ARMVaults{Client: client}).Vault(context.Background(), "rg", "rpgkvabc123")
+	require.NoError(t, err)
+	assert.True(t, vault.Properties.EnableRBACAuthorization)
+}
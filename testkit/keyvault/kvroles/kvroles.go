@@ -0,0 +1,91 @@
+// Package kvroles maps the built-in Azure roles that matter to a Key Vault
+// with RBAC authorization to the access policy permissions they amount to, so
+// a vault is held to the same expectations whichever authorization model it
+// uses
+package kvroles
+
+import (
+	"path"
+	"strings"
+)
+
+// Role is a built-in role and the data-plane rights it grants on a vault,
+// named as access policy permissions
+type Role struct {
+	Name string
+	// ID is the role definition GUID, the same in every tenant
+	ID           string
+	Secrets      []string
+	Keys         []string
+	Certificates []string
+}
+
+// The permissions the officer roles grant on each kind of object
+var (
+	secretsOfficer = []string{"Get", "List", "Set", "Delete", "Recover", "Backup", "Restore", "Purge"}
+	cryptoOfficer  = []string{
+		"Get", "List", "Update", "Create", "Import", "Delete", "Recover", "Backup", "Restore", "Purge",
+		"Decrypt", "Encrypt", "UnwrapKey", "WrapKey", "Verify", "Sign", "Release", "Rotate",
+		"GetRotationPolicy", "SetRotationPolicy",
+	}
+	certificatesOfficer = []string{
+		"Get", "List", "Update", "Create", "Import", "Delete", "Recover", "Backup", "Restore", "Purge",
+		"ManageContacts", "ManageIssuers", "GetIssuers", "ListIssuers", "SetIssuers", "DeleteIssuers",
+	}
+)
+
+// The roles the stacks assign on a vault
+const (
+	SecretsUser    = "Key Vault Secrets User"
+	SecretsOfficer = "Key Vault Secrets Officer"
+)
+
+// Builtin are the roles Lookup knows. The management roles, such as Owner,
+// grant no data-plane rights: with RBAC authorization an Owner cannot read a
+// secret without another role.
+var Builtin = []Role{
+	{Name: "Key Vault Administrator", ID: "00482a5a-887f-4fb3-b363-3b7fe8e74483",
+		Secrets: secretsOfficer, Keys: cryptoOfficer, Certificates: certificatesOfficer},
+	{Name: "Key Vault Certificates Officer", ID: "a4417e6f-fecd-4de8-b567-7b0420556985",
+		Certificates: certificatesOfficer},
+	{Name: "Key Vault Certificate User", ID: "db79e9a7-68ee-4b58-9aeb-b90e7c24fcba",
+		Certificates: []string{"Get", "List"}},
+	{Name: "Key Vault Crypto Officer", ID: "14b46e9e-c2b7-41b4-b07b-48a6ebf60603",
+		Keys: cryptoOfficer},
+	{Name: "Key Vault Crypto User", ID: "12338af0-0e69-4776-bea7-57ae8d297424",
+		Keys: []string{"Get", "List", "Decrypt", "Encrypt", "UnwrapKey", "WrapKey", "Verify", "Sign"}},
+	{Name: "Key Vault Reader", ID: "21090545-7ca7-4776-b22c-e363652d74d2",
+		Secrets: []string{"List"}, Keys: []string{"List"}, Certificates: []string{"List"}},
+	{Name: SecretsOfficer, ID: "b86a8fe4-44ce-4948-aee5-eccb2c155cd7",
+		Secrets: secretsOfficer},
+	{Name: SecretsUser, ID: "4633458b-17de-408a-b874-0445c86b69e6",
+		Secrets: []string{"Get", "List"}},
+	{Name: "Key Vault Contributor", ID: "f25e0fa2-a7c8-4377-a976-54943a77a395"},
+	{Name: "Owner", ID: "8e3af657-a8ff-443c-a75c-2fe8c4bcb635"},
+	{Name: "Contributor", ID: "b24988ac-6180-42a0-ab88-20f7382dd24c"},
+	{Name: "Reader", ID: "acdd72a7-3385-48ef-bd42-f606fba81ae7"},
+	{Name: "User Access Administrator", ID: "18d7d88d-d35e-4fb5-a5c3-7773c20a72d9"},
+}
+
+// ByName returns the built-in role with name, ignoring case
+func ByName(name string) (Role, bool) {
+	for _, role := range Builtin {
+		if strings.EqualFold(role.Name, strings.TrimSpace(name)) {
+			return role, true
+		}
+	}
+	return Role{}, false
+}
+
+// ByDefinitionID returns the built-in role a role definition ID names, either
+// the bare GUID or a resource ID that ends in it, such as
+// /subscriptions/.../providers/Microsoft.Authorization/roleDefinitions/<guid>
+func ByDefinitionID(id string) (Role, bool) {
+	guid := path.Base(strings.TrimSuffix(id, "/"))
+	for _, role := range Builtin {
+		if strings.EqualFold(role.ID, guid) {
+			return role, true
+		}
+	}
+	return Role{}, false
+}
@@ -0,0 +1,41 @@
+package kvroles
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLookup(t *testing.T) {
+	t.Parallel()
+
+	user, ok := ByName("key vault secrets user")
+	require.True(t, ok)
+	assert.Equal(t, SecretsUser, user.Name)
+	assert.Equal(t, []string{"Get", "List"}, user.Secrets)
+
+	officer, ok := ByDefinitionID("/subscriptions/00000000-0000-0000-0000-000000000000/providers/Microsoft.Authorization/roleDefinitions/B86A8FE4-44CE-4948-AEE5-ECCB2C155CD7")
+	require.True(t, ok)
+	assert.Equal(t, SecretsOfficer, officer.Name)
+	assert.Contains(t, officer.Secrets, "Purge")
+
+	owner, ok := ByDefinitionID("8e3af657-a8ff-443c-a75c-2fe8c4bcb635")
+	require.True(t, ok)
+	assert.Empty(t, owner.Secrets, "management roles grant no data-plane rights")
+
+	_, ok = ByName("Storage Blob Data Owner")
+	assert.False(t, ok)
+}
+
+func TestBuiltinUnique(t *testing.T) {
+	t.Parallel()
+
+	names, ids := map[string]bool{}, map[string]bool{}
+	for _, role := range Builtin {
+		assert.False(t, names[role.Name], "%s is listed twice", role.Name)
+		assert.False(t, ids[role.ID], "%s is listed twice", role.ID)
+		assert.Regexp(t, `^[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}$`, role.ID)
+		names[role.Name], ids[role.ID] = true, true
+	}
+}
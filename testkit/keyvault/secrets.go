@@ -0,0 +1,76 @@
+package keyvault
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/vanehru/terraform-modules/testkit/arm"
+)
+
+// secretsTimeout bounds the calls ValidateSecrets makes to the vault
+const secretsTimeout = 2 * time.Minute
+
+// CheckSecrets compares the secrets in the vault with want, which maps each
+// expected secret name to the value it should hold, or to "" when any
+// non-empty value will do. It returns a problem per secret that is missing,
+// disabled, empty or holds another value, sorted by name. Problems never
+// include secret values.
+func CheckSecrets(ctx context.Context, client SecretClient, want map[string]string) ([]string, error) {
+	items, err := client.ListSecrets(ctx)
+	if err != nil {
+		return nil, err
+	}
+	listed := map[string]SecretItem{}
+	for _, item := range items {
+		listed[item.Name()] = item
+	}
+
+	names := make([]string, 0, len(want))
+	for name := range want {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var problems []string
+	for _, name := range names {
+		item, ok := listed[name]
+		if !ok {
+			problems = append(problems, fmt.Sprintf("secret %q is missing", name))
+			continue
+		}
+		if !item.Attributes.Enabled {
+			problems = append(problems, fmt.Sprintf("secret %q is disabled", name))
+			continue
+		}
+
+		secret, err := client.GetSecret(ctx, name)
+		switch {
+		case arm.IsNotFound(err):
+			problems = append(problems, fmt.Sprintf("secret %q is missing", name))
+		case err != nil:
+			return nil, fmt.Errorf("secret %q: %w", name, err)
+		case secret.Value == "":
+			problems = append(problems, fmt.Sprintf("secret %q is empty", name))
+		case want[name] != "" && secret.Value != want[name]:
+			problems = append(problems, fmt.Sprintf("secret %q does not hold the expected value", name))
+		}
+	}
+	return problems, nil
+}
+
+// ValidateSecrets fails t for every problem CheckSecrets finds
+func ValidateSecrets(t *testing.T, client SecretClient, want map[string]string) {
+	ctx, cancel := context.WithTimeout(context.Background(), secretsTimeout)
+	defer cancel()
+
+	problems, err := CheckSecrets(ctx, client, want)
+	require.NoError(t, err)
+	for _, problem := range problems {
+		t.Error(problem)
+	}
+}
@@ -0,0 +1,27 @@
+data "azurerm_client_config" "current" {}
+
+module "key_vault" {
+  source = "./modules/key-vault"
+
+  key_vault_name            = "rpgkvabc123"
+  tenant_id                 = data.azurerm_client_config.current.tenant_id
+  enable_rbac_authorization = true
+}
+
+resource "azurerm_role_assignment" "function_app_secrets" {
+  scope                = module.key_vault.key_vault_id
+  role_definition_name = "Key Vault Secrets User"
+  principal_id         = module.function_app.function_app_identity_principal_id
+}
+
+resource "azurerm_role_assignment" "deployer_secrets" {
+  scope              = module.key_vault.key_vault_id
+  role_definition_id = "/providers/Microsoft.Authorization/roleDefinitions/b86a8fe4-44ce-4948-aee5-eccb2c155cd7"
+  principal_id       = data.azurerm_client_config.current.object_id
+}
+
+resource "azurerm_role_assignment" "deployer_storage" {
+  scope                = azurerm_storage_account.sa.id
+  role_definition_name = "Storage Blob Data Owner"
+  principal_id         = data.azurerm_client_config.current.object_id
+}
@@ -0,0 +1,23 @@
+data "azurerm_client_config" "current" {}
+
+module "key_vault" {
+  source = "./modules/key-vault"
+
+  key_vault_name = "rpgkvabc123"
+  tenant_id      = data.azurerm_client_config.current.tenant_id
+
+  access_policies = [
+    {
+      object_id          = module.function_app.function_app_identity_principal_id
+      secret_permissions = ["Get", "List"]
+    },
+    # {
+    #   object_id          = "33333333-3333-3333-3333-333333333333"
+    #   secret_permissions = ["Get"]
+    # },
+    {
+      object_id          = data.azurerm_client_config.current.object_id
+      secret_permissions = ["Get", "List", "Set", "Delete", "Purge", "Recover"]
+    }
+  ]
+}
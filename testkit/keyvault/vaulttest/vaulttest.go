@@ -0,0 +1,189 @@
+// Package vaulttest is an httptest stand-in for the secrets part of the Key
+// Vault REST API, so code that reads secrets can be exercised offline
+package vaulttest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Token is the only bearer token the server accepts
+const Token = "vaulttest-token"
+
+// APIVersion is the api-version the server requires on every request
+const APIVersion = "7.4"
+
+// Server serves the secrets set on it at its URL
+type Server struct {
+	*httptest.Server
+	// PageSize is how many secrets a list page holds, so clients have to
+	// follow nextLink. Set it before the first request.
+	PageSize int
+
+	mu      sync.Mutex
+	secrets map[string]*secret
+}
+
+type secret struct {
+	value   string
+	enabled bool
+	version int
+	created int64
+	updated int64
+}
+
+type attributes struct {
+	Enabled bool  `json:"enabled"`
+	Created int64 `json:"created"`
+	Updated int64 `json:"updated"`
+}
+
+// NewServer starts a server with no secrets and closes it when t completes
+func NewServer(t testing.TB) *Server {
+	s := &Server{PageSize: 25, secrets: map[string]*secret{}}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// SetSecret adds an enabled secret or a new version of an existing one
+func (s *Server) SetSecret(name, value string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	existing, ok := s.secrets[name]
+	if !ok {
+		existing = &secret{created: time.Now().Unix()}
+		s.secrets[name] = existing
+	}
+	existing.value = value
+	existing.enabled = true
+	existing.version++
+	existing.updated = time.Now().Unix()
+}
+
+// Disable disables a secret, as az keyvault secret set-attributes --enabled false does
+func (s *Server) Disable(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if existing, ok := s.secrets[name]; ok {
+		existing.enabled = false
+	}
+}
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Authorization") != "Bearer "+Token {
+		writeError(w, http.StatusUnauthorized, "Unauthorized", "AKV10000: Request is missing a Bearer or PoP token.")
+		return
+	}
+	if r.URL.Query().Get("api-version") != APIVersion {
+		writeError(w, http.StatusBadRequest, "BadParameter", "The specified version is not supported.")
+		return
+	}
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "BadParameter", "Only GET is supported by vaulttest.")
+		return
+	}
+
+	segments := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	switch {
+	case len(segments) == 1 && segments[0] == "secrets":
+		s.list(w, r)
+	case len(segments) == 2 && segments[0] == "secrets":
+		s.get(w, segments[1])
+	default:
+		writeError(w, http.StatusNotFound, "NotFound", fmt.Sprintf("No route for %s.", r.URL.Path))
+	}
+}
+
+func (s *Server) list(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	names := make([]string, 0, len(s.secrets))
+	for name := range s.secrets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	skip, _ := strconv.Atoi(r.URL.Query().Get("$skiptoken"))
+	if skip > len(names) {
+		skip = len(names)
+	}
+	end := skip + s.PageSize
+	if end > len(names) {
+		end = len(names)
+	}
+
+	type item struct {
+		ID         string     `json:"id"`
+		Attributes attributes `json:"attributes"`
+	}
+	page := struct {
+		Value    []item `json:"value"`
+		NextLink string `json:"nextLink,omitempty"`
+	}{Value: []item{}}
+	for _, name := range names[skip:end] {
+		page.Value = append(page.Value, item{
+			ID:         s.URL + "/secrets/" + name,
+			Attributes: s.secrets[name].attributes(),
+		})
+	}
+	if end < len(names) {
+		page.NextLink = fmt.Sprintf("%s/secrets?api-version=%s&$skiptoken=%d", s.URL, APIVersion, end)
+	}
+	writeJSON(w, http.StatusOK, page)
+}
+
+func (s *Server) get(w http.ResponseWriter, name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	existing, ok := s.secrets[name]
+	if !ok {
+		writeError(w, http.StatusNotFound, "SecretNotFound", fmt.Sprintf("A secret with (name/id) %s was not found in this key vault.", name))
+		return
+	}
+	if !existing.enabled {
+		writeError(w, http.StatusForbidden, "Forbidden", "Operation get is not allowed on a disabled secret.")
+		return
+	}
+	writeJSON(w, http.StatusOK, struct {
+		ID         string     `json:"id"`
+		Value      string     `json:"value"`
+		Attributes attributes `json:"attributes"`
+	}{
+		ID:         fmt.Sprintf("%s/secrets/%s/%d", s.URL, name, existing.version),
+		Value:      existing.value,
+		Attributes: existing.attributes(),
+	})
+}
+
+func (s *secret) attributes() attributes {
+	return attributes{Enabled: s.enabled, Created: s.created, Updated: s.updated}
+}
+
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	type body struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	}
+	writeJSON(w, status, struct {
+		Error body `json:"error"`
+	}{body{code, message}})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,269 @@
+// Package migrate applies versioned SQL files to a SQL Server database and
+// records each one in a history table, so a database is bootstrapped once and
+// only new files run on the next deployment. It also reads the resulting
+// schema back, to check it against what an application queries.
+package migrate
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// HistoryTable records the migrations applied to a database
+const HistoryTable = "SchemaMigrations"
+
+// filePattern is a migration file name: a version, an underscore and a name
+// in lower case, such as 0001_create_user_data.sql
+var filePattern = regexp.MustCompile(`^(\d+)_([a-z0-9_]+)\.sql$`)
+
+// Migration is one versioned SQL file. Its SQL runs as a single batch, so it
+// must not contain GO separators.
+type Migration struct {
+	Version int
+	Name    string
+	SQL     string
+	// Checksum is the SHA-256 of SQL, recorded when it is applied so a file
+	// edited afterwards is caught
+	Checksum string
+}
+
+func (m Migration) String() string {
+	return fmt.Sprintf("%04d_%s", m.Version, m.Name)
+}
+
+// Load reads every .sql file in fsys, sorted by version. Another file name
+// or two files with the same version are errors.
+func Load(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+	var migrations []Migration
+	versions := map[int]string{}
+	for _, entry := range entries {
+		if entry.IsDir() || path.Ext(entry.Name()) != ".sql" {
+			continue
+		}
+		match := filePattern.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf("%s: name migrations <version>_<name>.sql, such as 0001_create_user_data.sql", entry.Name())
+		}
+		version, err := strconv.Atoi(match[1])
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", entry.Name(), err)
+		}
+		if other, ok := versions[version]; ok {
+			return nil, fmt.Errorf("%s and %s have the same version", other, entry.Name())
+		}
+		versions[version] = entry.Name()
+
+		data, err := fs.ReadFile(fsys, entry.Name())
+		if err != nil {
+			return nil, err
+		}
+		sum := sha256.Sum256(data)
+		migrations = append(migrations, Migration{
+			Version:  version,
+			Name:     match[2],
+			SQL:      string(data),
+			Checksum: hex.EncodeToString(sum[:]),
+		})
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// applied is a row of HistoryTable
+type applied struct {
+	name     string
+	checksum string
+}
+
+// lockTimeout is how long Run waits for another run to release the lock
+const lockTimeout = 2 * time.Minute
+
+// Run creates HistoryTable if it is missing and applies, in order, each
+// migration it does not record, each in its own transaction with its history
+// row. It returns the migrations it applied. A recorded migration whose file
+// changed, or that is missing from migrations, stops it before anything runs.
+// It holds an application lock on HistoryTable throughout, so a concurrent run
+// waits and then finds the migrations applied instead of applying them again.
+func Run(ctx context.Context, db *sql.DB, migrations []Migration) ([]Migration, error) {
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if err := lock(ctx, conn); err != nil {
+		return nil, err
+	}
+	// A session lock outlives a cancelled ctx, and would stay held by the
+	// pooled connection, so release it regardless
+	defer conn.ExecContext(context.Background(), "EXEC sp_releaseapplock @Resource = @p1, @LockOwner = 'Session'", HistoryTable)
+
+	if _, err := conn.ExecContext(ctx, `IF OBJECT_ID(N'dbo.`+HistoryTable+`', N'U') IS NULL
+CREATE TABLE dbo.`+HistoryTable+` (
+    Version INT NOT NULL PRIMARY KEY,
+    Name NVARCHAR(255) NOT NULL,
+    Checksum CHAR(64) NOT NULL,
+    AppliedAt DATETIME2 NOT NULL DEFAULT SYSUTCDATETIME()
+)`); err != nil {
+		return nil, fmt.Errorf("creating %s: %w", HistoryTable, err)
+	}
+
+	history, err := readHistory(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+	known := map[int]bool{}
+	var problems []string
+	for _, m := range migrations {
+		known[m.Version] = true
+		if h, ok := history[m.Version]; ok && h.checksum != m.Checksum {
+			problems = append(problems, fmt.Sprintf("%s changed after it was applied", m))
+		}
+	}
+	for version, h := range history {
+		if !known[version] {
+			problems = append(problems, fmt.Sprintf("%04d_%s is applied but has no file", version, h.name))
+		}
+	}
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return nil, errors.New(strings.Join(problems, "; "))
+	}
+
+	var ran []Migration
+	for _, m := range migrations {
+		if _, ok := history[m.Version]; ok {
+			continue
+		}
+		if err := apply(ctx, conn, m); err != nil {
+			return ran, err
+		}
+		ran = append(ran, m)
+	}
+	return ran, nil
+}
+
+// lock takes the exclusive application lock on HistoryTable for conn's
+// session, waiting up to lockTimeout for another run to release it
+func lock(ctx context.Context, conn *sql.Conn) error {
+	var result int
+	if err := conn.QueryRowContext(ctx, `DECLARE @result INT
+EXEC @result = sp_getapplock @Resource = @p1, @LockMode = 'Exclusive', @LockOwner = 'Session', @LockTimeout = @p2
+SELECT @result`, HistoryTable, lockTimeout.Milliseconds()).Scan(&result); err != nil {
+		return fmt.Errorf("locking %s: %w", HistoryTable, err)
+	}
+	// 0 is granted at once and 1 after waiting; -1 is a timeout, -2 a
+	// cancellation, -3 a deadlock and -999 an error
+	if result < 0 {
+		return fmt.Errorf("locking %s: sp_getapplock returned %d after waiting up to %s", HistoryTable, result, lockTimeout)
+	}
+	return nil
+}
+
+func readHistory(ctx context.Context, conn *sql.Conn) (map[int]applied, error) {
+	rows, err := conn.QueryContext(ctx, "SELECT Version, Name, Checksum FROM dbo."+HistoryTable)
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", HistoryTable, err)
+	}
+	defer rows.Close()
+	history := map[int]applied{}
+	for rows.Next() {
+		var version int
+		var h applied
+		if err := rows.Scan(&version, &h.name, &h.checksum); err != nil {
+			return nil, fmt.Errorf("reading %s: %w", HistoryTable, err)
+		}
+		history[version] = h
+	}
+	return history, rows.Err()
+}
+
+func apply(ctx context.Context, conn *sql.Conn, m Migration) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.ExecContext(ctx, m.SQL); err != nil {
+		return fmt.Errorf("%s: %w", m, err)
+	}
+	if _, err := tx.ExecContext(ctx, "INSERT INTO dbo."+HistoryTable+" (Version, Name, Checksum) VALUES (@p1, @p2, @p3)",
+		m.Version, m.Name, m.Checksum); err != nil {
+		return fmt.Errorf("%s: recording it in %s: %w", m, HistoryTable, err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s: %w", m, err)
+	}
+	return nil
+}
+
+// migrateTimeout bounds the migrations and schema reads Validate runs
+const migrateTimeout = 5 * time.Minute
+
+// Validate applies the migrations in dir to db from two runs at once, checks
+// that between them each pending migration ran once, that running them again
+// applies nothing and that the schema has the want tables, and fails t with
+// each difference
+func Validate(t *testing.T, db *sql.DB, dir string, want []Table) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), migrateTimeout)
+	defer cancel()
+
+	migrations, err := Load(os.DirFS(dir))
+	require.NoError(t, err)
+	require.NotEmpty(t, migrations, "no migrations in %s", dir)
+
+	// Two deployments can migrate the same database at once; the lock in Run
+	// leaves the second nothing to do
+	var (
+		wg      sync.WaitGroup
+		ran     [2][]Migration
+		runErrs [2]error
+	)
+	for i := range ran {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			ran[i], runErrs[i] = Run(ctx, db, migrations)
+		}(i)
+	}
+	wg.Wait()
+	require.NoError(t, errors.Join(runErrs[:]...))
+	count := map[string]int{}
+	for _, m := range append(ran[0], ran[1]...) {
+		t.Logf("Applied %s", m)
+		count[m.String()]++
+	}
+	for name, n := range count {
+		assert.Equal(t, 1, n, "%s should be applied once, not by both runs", name)
+	}
+	again, err := Run(ctx, db, migrations)
+	require.NoError(t, err)
+	require.Empty(t, again, "a second run should apply nothing")
+
+	got, err := ReadSchema(ctx, db)
+	require.NoError(t, err)
+	for _, problem := range CheckSchema(want, got) {
+		t.Error(problem)
+	}
+}
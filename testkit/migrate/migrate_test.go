@@ -0,0 +1,81 @@
+package migrate
+
+import (
+	"os"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoad(t *testing.T) {
+	t.Parallel()
+
+	migrations, err := Load(fstest.MapFS{
+		"0002_create_player_data.sql": {Data: []byte("CREATE TABLE PlayerData (UserId NVARCHAR(100))")},
+		"0001_create_user_data.sql":   {Data: []byte("CREATE TABLE UserData (UserId NVARCHAR(100))")},
+		"README.md":                   {Data: []byte("not a migration")},
+	})
+	require.NoError(t, err)
+	require.Len(t, migrations, 2)
+	assert.Equal(t, 1, migrations[0].Version)
+	assert.Equal(t, "create_user_data", migrations[0].Name)
+	assert.Equal(t, "0001_create_user_data", migrations[0].String())
+	assert.Len(t, migrations[0].Checksum, 64)
+	assert.NotEqual(t, migrations[0].Checksum, migrations[1].Checksum)
+}
+
+func TestLoadErrors(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		files fstest.MapFS
+		want  string
+	}{
+		{
+			fstest.MapFS{"create_user_data.sql": {}},
+			"create_user_data.sql: name migrations <version>_<name>.sql, such as 0001_create_user_data.sql",
+		},
+		{
+			fstest.MapFS{"0001_a.sql": {}, "1_b.sql": {}},
+			"0001_a.sql and 1_b.sql have the same version",
+		},
+	}
+	for _, tc := range tests {
+		_, err := Load(tc.files)
+		assert.EqualError(t, err, tc.want)
+	}
+}
+
+// TestLoadBackendMigrations checks the file names of the backend migrations
+func TestLoadBackendMigrations(t *testing.T) {
+	t.Parallel()
+
+	migrations, err := Load(os.DirFS("../../demo-rpg-aiapp/dev/rpg-backend-python/migrations"))
+	require.NoError(t, err)
+	require.NotEmpty(t, migrations)
+	for i, m := range migrations {
+		assert.Equal(t, i+1, m.Version, "%s: versions should count up from 1 without gaps", m)
+	}
+}
+
+func TestCheckSchema(t *testing.T) {
+	t.Parallel()
+
+	want := []Table{
+		{Name: "UserData", Columns: []Column{{"UserId", "nvarchar"}, {"Password", "nvarchar"}}, PrimaryKey: []string{"UserId"}},
+		{Name: "PlayerData", Columns: []Column{{"UserId", "nvarchar"}, {"CharId", "int"}}, PrimaryKey: []string{"UserId", "CharId"}},
+		{Name: "EventData", Columns: []Column{{"EventId", "int"}}},
+	}
+	got := map[string]Table{
+		"userdata":   {Name: "userdata", Columns: []Column{{"USERID", "NVARCHAR"}, {"Password", "nvarchar"}, {"Extra", "int"}}, PrimaryKey: []string{"UserId"}},
+		"PlayerData": {Name: "PlayerData", Columns: []Column{{"UserId", "nvarchar"}, {"CharId", "nvarchar"}}, PrimaryKey: []string{"UserId"}},
+	}
+	assert.Equal(t, []string{
+		"PlayerData.CharId is nvarchar, want int",
+		"PlayerData has primary key (UserId), want (UserId, CharId)",
+		"table EventData is missing",
+	}, CheckSchema(want, got))
+	assert.Empty(t, CheckSchema(want[:1], got))
+}
@@ -0,0 +1,108 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// Column is a column and its type as INFORMATION_SCHEMA.COLUMNS names it,
+// such as int or nvarchar
+type Column struct {
+	Name string
+	Type string
+}
+
+// Table is a table in the dbo schema
+type Table struct {
+	Name    string
+	Columns []Column
+	// PrimaryKey lists the key columns in key order
+	PrimaryKey []string
+}
+
+// ReadSchema returns the tables in the dbo schema of db, keyed by name
+func ReadSchema(ctx context.Context, db *sql.DB) (map[string]Table, error) {
+	tables := map[string]Table{}
+	rows, err := db.QueryContext(ctx, `SELECT TABLE_NAME, COLUMN_NAME, DATA_TYPE
+FROM INFORMATION_SCHEMA.COLUMNS
+WHERE TABLE_SCHEMA = 'dbo'
+ORDER BY TABLE_NAME, ORDINAL_POSITION`)
+	if err != nil {
+		return nil, fmt.Errorf("reading columns: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var table string
+		var column Column
+		if err := rows.Scan(&table, &column.Name, &column.Type); err != nil {
+			return nil, fmt.Errorf("reading columns: %w", err)
+		}
+		t := tables[table]
+		t.Name = table
+		t.Columns = append(t.Columns, column)
+		tables[table] = t
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	keys, err := db.QueryContext(ctx, `SELECT tc.TABLE_NAME, kcu.COLUMN_NAME
+FROM INFORMATION_SCHEMA.TABLE_CONSTRAINTS tc
+JOIN INFORMATION_SCHEMA.KEY_COLUMN_USAGE kcu
+  ON kcu.CONSTRAINT_SCHEMA = tc.CONSTRAINT_SCHEMA AND kcu.CONSTRAINT_NAME = tc.CONSTRAINT_NAME
+WHERE tc.CONSTRAINT_TYPE = 'PRIMARY KEY' AND tc.TABLE_SCHEMA = 'dbo'
+ORDER BY tc.TABLE_NAME, kcu.ORDINAL_POSITION`)
+	if err != nil {
+		return nil, fmt.Errorf("reading primary keys: %w", err)
+	}
+	defer keys.Close()
+	for keys.Next() {
+		var table, column string
+		if err := keys.Scan(&table, &column); err != nil {
+			return nil, fmt.Errorf("reading primary keys: %w", err)
+		}
+		t := tables[table]
+		t.PrimaryKey = append(t.PrimaryKey, column)
+		tables[table] = t
+	}
+	return tables, keys.Err()
+}
+
+// CheckSchema returns a problem for each table in want that got lacks, each
+// column it lacks or has with another type, and each primary key that
+// differs. Names compare case-insensitively, as SQL Server's default
+// collation does; extra tables and columns are fine.
+func CheckSchema(want []Table, got map[string]Table) []string {
+	byName := map[string]Table{}
+	for name, table := range got {
+		byName[strings.ToLower(name)] = table
+	}
+
+	var problems []string
+	for _, w := range want {
+		g, ok := byName[strings.ToLower(w.Name)]
+		if !ok {
+			problems = append(problems, fmt.Sprintf("table %s is missing", w.Name))
+			continue
+		}
+		columns := map[string]Column{}
+		for _, c := range g.Columns {
+			columns[strings.ToLower(c.Name)] = c
+		}
+		for _, c := range w.Columns {
+			actual, ok := columns[strings.ToLower(c.Name)]
+			switch {
+			case !ok:
+				problems = append(problems, fmt.Sprintf("%s.%s is missing", w.Name, c.Name))
+			case !strings.EqualFold(actual.Type, c.Type):
+				problems = append(problems, fmt.Sprintf("%s.%s is %s, want %s", w.Name, c.Name, actual.Type, c.Type))
+			}
+		}
+		if w.PrimaryKey != nil && !strings.EqualFold(strings.Join(g.PrimaryKey, ","), strings.Join(w.PrimaryKey, ",")) {
+			problems = append(problems, fmt.Sprintf("%s has primary key (%s), want (%s)", w.Name, strings.Join(g.PrimaryKey, ", "), strings.Join(w.PrimaryKey, ", ")))
+		}
+	}
+	return problems
+}
@@ -0,0 +1,140 @@
+package naming
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/zclconf/go-cty/cty"
+
+	"github.com/vanehru/terraform-modules/testkit/tfconfig"
+)
+
+// randomClasses are sample characters for the classes random_string draws
+// from, in the order the sample cycles through them
+var randomClasses = []struct {
+	argument string
+	sample   string
+}{
+	{"lower", "a"},
+	{"upper", "A"},
+	{"numeric", "0"},
+	{"special", "!"},
+}
+
+// Violation is a resource whose name breaks its type's rule
+type Violation struct {
+	Address string
+	Type    string
+	Name    string
+	Message string
+	File    string
+	Line    int
+}
+
+func (v Violation) String() string {
+	return fmt.Sprintf("%s:%d: %s: name %q %s", v.File, v.Line, v.Address, v.Name, v.Message)
+}
+
+// CheckConfig checks the name of every resource with a rule in the
+// configuration in dir and the local modules it calls. A random_string result
+// stands in as a sample of its length and character classes, so a name like
+// "cloudshell${random_string.suffix.result}" is checked at its real length.
+// Names computed from anything else not known before apply are skipped.
+func CheckConfig(dir string, varFiles ...string) ([]Violation, error) {
+	instances, err := tfconfig.LoadTreeResolving(dir, resolveRandomStrings, varFiles...)
+	if err != nil {
+		return nil, err
+	}
+
+	var violations []Violation
+	for _, inst := range instances {
+		for _, r := range inst.Module.Resources {
+			rule, ok := rules[r.Type]
+			if r.Mode != "managed" || !ok {
+				continue
+			}
+			attr, ok := r.Body.Attributes["name"]
+			if !ok {
+				continue
+			}
+			value, ok := inst.Eval(attr.Expr)
+			if !ok || value.IsNull() || value.Type() != cty.String {
+				continue
+			}
+
+			name := value.AsString()
+			if problems := rule.Problems(name); len(problems) > 0 {
+				violations = append(violations, Violation{
+					Address: inst.Address(r),
+					Type:    r.Type,
+					Name:    name,
+					Message: strings.Join(problems, "; "),
+					File:    r.Range.Filename,
+					Line:    r.Range.Start.Line,
+				})
+			}
+		}
+	}
+	return violations, nil
+}
+
+// resolveRandomStrings stands in for the result of each random_string in mod
+// whose length is known
+func resolveRandomStrings(mod *tfconfig.Module, ctx *hcl.EvalContext) map[string]cty.Value {
+	samples := map[string]cty.Value{}
+	for _, r := range mod.ResourcesOfType("random_string") {
+		if sample, ok := randomSample(r, ctx); ok {
+			samples[r.Name] = cty.ObjectVal(map[string]cty.Value{
+				"id":     cty.StringVal(sample),
+				"result": cty.StringVal(sample),
+			})
+		}
+	}
+	if len(samples) == 0 {
+		return nil
+	}
+	return map[string]cty.Value{"random_string": cty.ObjectVal(samples)}
+}
+
+// randomSample returns a string of the resource's length that cycles through
+// every character class it may draw from. Classes the provider enables by
+// default stay enabled unless they are statically turned off.
+func randomSample(r *tfconfig.Resource, ctx *hcl.EvalContext) (string, bool) {
+	attr, ok := r.Body.Attributes["length"]
+	if !ok {
+		return "", false
+	}
+	value, diags := attr.Expr.Value(ctx)
+	if diags.HasErrors() || !value.IsKnown() || value.IsNull() || value.Type() != cty.Number {
+		return "", false
+	}
+	length, accuracy := value.AsBigFloat().Int64()
+	if accuracy != big.Exact || length < 1 {
+		return "", false
+	}
+
+	var samples []string
+	for _, class := range randomClasses {
+		enabled := true
+		if attr, ok := r.Body.Attributes[class.argument]; ok {
+			value, diags := attr.Expr.Value(ctx)
+			if !diags.HasErrors() && value.IsKnown() && !value.IsNull() && value.Type() == cty.Bool {
+				enabled = value.True()
+			}
+		}
+		if enabled {
+			samples = append(samples, class.sample)
+		}
+	}
+	if len(samples) == 0 {
+		return "", false
+	}
+
+	var b strings.Builder
+	for i := 0; i < int(length); i++ {
+		b.WriteString(samples[i%len(samples)])
+	}
+	return b.String(), true
+}
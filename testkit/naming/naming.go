@@ -0,0 +1,285 @@
+// Package naming encodes Azure's naming rules for the azurerm resource types
+// the modules create. It validates the names tests generate and the name
+// literals in a configuration, and generates names that satisfy the rules.
+package naming
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/stretchr/testify/require"
+)
+
+// Character classes shared by several rules, as regexp class bodies
+const (
+	alphanumeric = `a-zA-Z0-9`
+	lowerAlnum   = `a-z0-9`
+	// networkChars are allowed in most Microsoft.Network names
+	networkChars = `a-zA-Z0-9_.-`
+	networkLast  = `a-zA-Z0-9_`
+	// sqlChars excludes the characters SQL database names may not contain
+	sqlChars = `^<>*%&:\\/?\x00-\x1f`
+	// vmChars excludes the characters virtual machine names may not contain
+	vmChars = `^\\/"'\[\]:|<>+=;,?*@&\s`
+)
+
+// maxLabel is the longest label a DNS name may have
+const maxLabel = 63
+
+// padding lengthens generated names that are shorter than a rule's minimum.
+// Every rule accepts it in any position.
+const padding = "x"
+
+// Rule is the naming rule of one resource type. The classes are regexp
+// character class bodies, such as a-z0-9, that each character must match.
+type Rule struct {
+	Min, Max int
+	Chars    string
+	// First and Last further restrict the first and last character, when set
+	First, Last string
+	// NoDoubleHyphen forbids consecutive hyphens
+	NoDoubleHyphen bool
+	// Labels requires a DNS name of at least two dot-separated labels
+	Labels bool
+	// Separator joins the parts of a generated name
+	Separator string
+
+	chars, first, last *regexp.Regexp
+}
+
+// rules covers every named azurerm resource type in this repository's
+// modules, following the Azure resource naming rules and the provider's own
+// validation where that is stricter
+var rules = map[string]*Rule{
+	"azurerm_bastion_host":                          {Min: 1, Max: 80, Chars: networkChars, First: alphanumeric, Last: networkLast, Separator: "-"},
+	"azurerm_cognitive_account":                     {Min: 2, Max: 64, Chars: alphanumeric + "-", First: alphanumeric, Last: alphanumeric, Separator: "-"},
+	"azurerm_cognitive_deployment":                  {Min: 2, Max: 64, Chars: networkChars, First: alphanumeric, Separator: "-"},
+	"azurerm_container_group":                       {Min: 1, Max: 63, Chars: lowerAlnum + "-", First: lowerAlnum, Last: lowerAlnum, NoDoubleHyphen: true, Separator: "-"},
+	"azurerm_key_vault":                             {Min: 3, Max: 24, Chars: alphanumeric + "-", First: `a-zA-Z`, Last: alphanumeric, NoDoubleHyphen: true, Separator: "-"},
+	"azurerm_key_vault_secret":                      {Min: 1, Max: 127, Chars: alphanumeric + "-", Separator: "-"},
+	"azurerm_linux_function_app":                    {Min: 2, Max: 60, Chars: alphanumeric + "-", First: alphanumeric, Last: alphanumeric, Separator: "-"},
+	"azurerm_linux_virtual_machine":                 {Min: 1, Max: 64, Chars: vmChars, First: vmChars + "_", Last: vmChars + ".-", Separator: "-"},
+	"azurerm_mssql_database":                        {Min: 1, Max: 128, Chars: sqlChars, Last: sqlChars + ". ", Separator: "-"},
+	"azurerm_mssql_firewall_rule":                   {Min: 1, Max: 128, Chars: sqlChars + ";", Last: sqlChars + ";.", Separator: "-"},
+	"azurerm_mssql_server":                          {Min: 1, Max: 63, Chars: lowerAlnum + "-", First: lowerAlnum, Last: lowerAlnum, Separator: "-"},
+	"azurerm_mssql_virtual_network_rule":            {Min: 1, Max: 64, Chars: networkChars, First: alphanumeric, Last: networkLast, Separator: "-"},
+	"azurerm_network_interface":                     {Min: 1, Max: 80, Chars: networkChars, First: alphanumeric, Last: networkLast, Separator: "-"},
+	"azurerm_network_security_group":                {Min: 1, Max: 80, Chars: networkChars, First: alphanumeric, Last: networkLast, Separator: "-"},
+	"azurerm_private_dns_a_record":                  {Min: 1, Max: 63, Chars: `a-zA-Z0-9_.*@-`, Separator: "-"},
+	"azurerm_private_dns_zone":                      {Min: 1, Max: 253, Chars: alphanumeric + ".-", First: alphanumeric, Last: alphanumeric, Labels: true, Separator: "."},
+	"azurerm_private_dns_zone_virtual_network_link": {Min: 1, Max: 80, Chars: networkChars, First: alphanumeric, Last: networkLast, Separator: "-"},
+	"azurerm_private_endpoint":                      {Min: 2, Max: 64, Chars: networkChars, First: alphanumeric, Last: networkLast, Separator: "-"},
+	"azurerm_public_ip":                             {Min: 1, Max: 80, Chars: networkChars, First: alphanumeric, Last: networkLast, Separator: "-"},
+	"azurerm_resource_group":                        {Min: 1, Max: 90, Chars: `a-zA-Z0-9_().-`, Last: `a-zA-Z0-9_()-`, Separator: "-"},
+	"azurerm_service_plan":                          {Min: 1, Max: 60, Chars: alphanumeric + "-", Separator: "-"},
+	"azurerm_static_web_app":                        {Min: 2, Max: 60, Chars: alphanumeric + "-", First: alphanumeric, Last: alphanumeric, Separator: "-"},
+	"azurerm_storage_account":                       {Min: 3, Max: 24, Chars: lowerAlnum},
+	"azurerm_storage_share":                         {Min: 3, Max: 63, Chars: lowerAlnum + "-", First: lowerAlnum, Last: lowerAlnum, NoDoubleHyphen: true, Separator: "-"},
+	"azurerm_subnet":                                {Min: 1, Max: 80, Chars: networkChars, First: alphanumeric, Last: networkLast, Separator: "-"},
+	"azurerm_user_assigned_identity":                {Min: 3, Max: 128, Chars: alphanumeric + "_-", First: alphanumeric, Separator: "-"},
+	"azurerm_virtual_network":                       {Min: 2, Max: 64, Chars: networkChars, First: alphanumeric, Last: networkLast, Separator: "-"},
+	"azurerm_windows_virtual_machine":               {Min: 1, Max: 15, Chars: vmChars, First: vmChars + "_", Last: vmChars + ".-", Separator: "-"},
+}
+
+func init() {
+	for _, rule := range rules {
+		rule.chars = class(rule.Chars)
+		rule.first = class(rule.First)
+		rule.last = class(rule.Last)
+	}
+}
+
+// class compiles a character class body, nil when it is empty
+func class(body string) *regexp.Regexp {
+	if body == "" {
+		return nil
+	}
+	return regexp.MustCompile(`^[` + body + `]$`)
+}
+
+// Lookup returns the rule for resourceType
+func Lookup(resourceType string) (*Rule, bool) {
+	rule, ok := rules[resourceType]
+	return rule, ok
+}
+
+// Types returns the sorted resource types that have a rule
+func Types() []string {
+	types := make([]string, 0, len(rules))
+	for resourceType := range rules {
+		types = append(types, resourceType)
+	}
+	sort.Strings(types)
+	return types
+}
+
+// Validate checks name against the rule for resourceType
+func Validate(resourceType, name string) error {
+	rule, ok := rules[resourceType]
+	if !ok {
+		return fmt.Errorf("no naming rule for %s", resourceType)
+	}
+	if problems := rule.Problems(name); len(problems) > 0 {
+		return fmt.Errorf("%s name %q %s", resourceType, name, strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// Require fails t unless name is valid for resourceType, so a test stops
+// before it spends minutes deploying a name Azure rejects
+func Require(t testing.TB, resourceType, name string) {
+	t.Helper()
+	require.NoError(t, Validate(resourceType, name))
+}
+
+// Problems returns every way name breaks the rule
+func (r *Rule) Problems(name string) []string {
+	var problems []string
+	if n := utf8.RuneCountInString(name); n < r.Min || n > r.Max {
+		problems = append(problems, fmt.Sprintf("is %d characters, must be %d-%d", n, r.Min, r.Max))
+	}
+	if invalid := r.invalid(name); invalid != "" {
+		problems = append(problems, fmt.Sprintf("contains %q, allowed characters are [%s]", invalid, r.Chars))
+	}
+	if name == "" {
+		return problems
+	}
+
+	first, _ := utf8.DecodeRuneInString(name)
+	if !matches(r.first, first) {
+		problems = append(problems, fmt.Sprintf("must start with [%s]", r.First))
+	}
+	last, _ := utf8.DecodeLastRuneInString(name)
+	if !matches(r.last, last) {
+		problems = append(problems, fmt.Sprintf("must end with [%s]", r.Last))
+	}
+	if r.NoDoubleHyphen && strings.Contains(name, "--") {
+		problems = append(problems, "must not contain consecutive hyphens")
+	}
+	if r.Labels {
+		labels := strings.Split(name, ".")
+		if len(labels) < 2 {
+			problems = append(problems, "must have at least two dot-separated labels")
+		}
+		for _, label := range labels {
+			if label == "" || len(label) > maxLabel {
+				problems = append(problems, fmt.Sprintf("has label %q, labels must be 1-%d characters", label, maxLabel))
+			}
+		}
+	}
+	return problems
+}
+
+// invalid returns the distinct characters of name the rule does not allow
+func (r *Rule) invalid(name string) string {
+	var invalid []rune
+	for _, c := range name {
+		if !matches(r.chars, c) && !strings.ContainsRune(string(invalid), c) {
+			invalid = append(invalid, c)
+		}
+	}
+	return string(invalid)
+}
+
+func matches(class *regexp.Regexp, c rune) bool {
+	return class == nil || class.MatchString(string(c))
+}
+
+// Generate returns a name for resourceType built from parts, such as a
+// prefix, a kind and a unique ID. Characters the rule does not allow are
+// lower-cased or dropped, the parts are joined with the rule's separator and
+// the leading parts are shortened first, so the last part, usually the
+// unique ID, survives truncation. It fails only for a type without a rule.
+func Generate(resourceType string, parts ...string) (string, error) {
+	rule, ok := rules[resourceType]
+	if !ok {
+		return "", fmt.Errorf("no naming rule for %s", resourceType)
+	}
+
+	var kept []string
+	for _, part := range parts {
+		if part = rule.sanitize(part); part != "" {
+			kept = append(kept, part)
+		}
+	}
+
+	// A DNS name may need a label appended below
+	max := rule.Max
+	if rule.Labels {
+		max -= len(rule.Separator + padding)
+	}
+
+	var name string
+	if len(kept) > 0 {
+		last := kept[len(kept)-1]
+		if len(last) > max {
+			last = last[:max]
+		}
+		head := ""
+		if len(kept) > 1 {
+			head = strings.Join(kept[:len(kept)-1], rule.Separator) + rule.Separator
+		}
+		if len(head)+len(last) > max {
+			if keep := max - len(last) - len(rule.Separator); keep > 0 {
+				head = head[:keep] + rule.Separator
+			} else {
+				head = ""
+			}
+		}
+		name = head + last
+	}
+
+	if rule.Separator != "" {
+		double := rule.Separator + rule.Separator
+		for strings.Contains(name, double) {
+			name = strings.ReplaceAll(name, double, rule.Separator)
+		}
+	}
+	name = strings.TrimLeftFunc(name, func(c rune) bool { return !matches(rule.first, c) })
+	name = strings.TrimRightFunc(name, func(c rune) bool { return !matches(rule.last, c) })
+	for len(name) < rule.Min {
+		name += padding
+	}
+	if rule.Labels && !strings.Contains(name, rule.Separator) {
+		name += rule.Separator + padding
+	}
+
+	if err := Validate(resourceType, name); err != nil {
+		return "", fmt.Errorf("cannot generate a name from %q: %w", parts, err)
+	}
+	return name, nil
+}
+
+// sanitize keeps the characters of part the rule allows, lower-casing those
+// only allowed in lower case, and shortens over-long DNS labels. Generated
+// names are ASCII, whatever the rule.
+func (r *Rule) sanitize(part string) string {
+	var b strings.Builder
+	for _, c := range part {
+		if c > unicode.MaxASCII {
+			continue
+		}
+		if !matches(r.chars, c) {
+			c = unicode.ToLower(c)
+		}
+		if matches(r.chars, c) {
+			b.WriteRune(c)
+		}
+	}
+	if !r.Labels {
+		return b.String()
+	}
+
+	labels := strings.Split(b.String(), ".")
+	for i, label := range labels {
+		if len(label) > maxLabel {
+			labels[i] = label[:maxLabel]
+		}
+	}
+	return strings.Join(labels, ".")
+}
@@ -0,0 +1,126 @@
+package naming
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidate(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		resourceType string
+		name         string
+		want         string
+	}{
+		{"azurerm_key_vault", "demo-rpgkv123", ""},
+		{"azurerm_key_vault", "kv", "is 2 characters, must be 3-24"},
+		{"azurerm_key_vault", "1rpg--kv-", "must start with [a-zA-Z]; must end with [a-zA-Z0-9]; must not contain consecutive hyphens"},
+		{"azurerm_storage_account", "cloudshellstorage123", ""},
+		{"azurerm_storage_account", "Test-stg", `contains "T-", allowed characters are [a-z0-9]`},
+		{"azurerm_mssql_server", "rpg-sql-server", ""},
+		{"azurerm_mssql_server", "RPG_sql", `contains "RPG_", allowed characters are [a-z0-9-]; must start with [a-z0-9]`},
+		{"azurerm_mssql_database", "rpg gaming db", ""},
+		{"azurerm_mssql_database", "rpg/db.", `contains "/", allowed characters are [^<>*%&:\\/?\x00-\x1f]; must end with [^<>*%&:\\/?\x00-\x1f. ]`},
+		{"azurerm_private_dns_zone", "privatelink.vaultcore.azure.net", ""},
+		{"azurerm_private_dns_zone", "privatelink", "must have at least two dot-separated labels"},
+		{"azurerm_subnet", "app-subnet.", "must end with [a-zA-Z0-9_]"},
+		{"azurerm_windows_virtual_machine", "deployment-vm-01", "is 16 characters, must be 1-15"},
+	}
+	for _, tc := range tests {
+		err := Validate(tc.resourceType, tc.name)
+		if tc.want == "" {
+			assert.NoError(t, err, tc.name)
+			continue
+		}
+		require.Error(t, err, tc.name)
+		assert.Equal(t, tc.resourceType+" name "+quote(tc.name)+" "+tc.want, err.Error())
+	}
+
+	assert.EqualError(t, Validate("azurerm_unknown", "name"), "no naming rule for azurerm_unknown")
+}
+
+func quote(s string) string {
+	return `"` + strings.ReplaceAll(s, `"`, `\"`) + `"`
+}
+
+func TestGenerate(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		resourceType string
+		parts        []string
+		want         string
+	}{
+		{"azurerm_key_vault", []string{"test", "kv", "abc123"}, "test-kv-abc123"},
+		{"azurerm_storage_account", []string{"Test", "stg", "abc123"}, "teststgabc123"},
+		{"azurerm_storage_account", []string{"a-very-long-prefix", "stg", "abc123"}, "averylongprefixstgabc123"},
+		{"azurerm_key_vault", []string{"a-very-long-prefix", "kv", "abc123"}, "a-very-long-prefi-abc123"},
+		{"azurerm_key_vault", []string{"1", "kv"}, "kvx"},
+		{"azurerm_mssql_server", []string{"CI_Run", "sql", "abc123"}, "cirun-sql-abc123"},
+		{"azurerm_private_dns_zone", []string{"privatelink", "vaultcore.azure.net"}, "privatelink.vaultcore.azure.net"},
+		{"azurerm_windows_virtual_machine", []string{"test", "vm", "abc123"}, "test-vm-abc123"},
+		{"azurerm_resource_group", nil, "x"},
+	}
+	for _, tc := range tests {
+		name, err := Generate(tc.resourceType, tc.parts...)
+		require.NoError(t, err, tc.parts)
+		assert.Equal(t, tc.want, name, tc.parts)
+	}
+
+	_, err := Generate("azurerm_unknown", "name")
+	assert.EqualError(t, err, "no naming rule for azurerm_unknown")
+}
+
+// TestGenerateAlwaysValid generates names for every rule from awkward parts
+func TestGenerateAlwaysValid(t *testing.T) {
+	t.Parallel()
+
+	inputs := [][]string{
+		nil,
+		{""},
+		{"-", "_", "."},
+		{"test", "kv", "abc123"},
+		{"UPPER", "Case", "ID"},
+		{"--leading", "trailing--"},
+		{strings.Repeat("long", 40), "abc123"},
+		{"prefix", strings.Repeat("x", 300)},
+		{"ünïcödé", "名前", "id"},
+		{"with space", "semi;colon", "at@sign"},
+	}
+	for _, resourceType := range Types() {
+		for _, parts := range inputs {
+			name, err := Generate(resourceType, parts...)
+			if assert.NoError(t, err, "%s %q", resourceType, parts) {
+				assert.NoError(t, Validate(resourceType, name))
+			}
+		}
+	}
+}
+
+func TestCheckConfig(t *testing.T) {
+	t.Parallel()
+
+	violations, err := CheckConfig("testdata/stack")
+	require.NoError(t, err)
+
+	var got []string
+	for _, v := range violations {
+		got = append(got, v.String())
+	}
+	assert.Equal(t, []string{
+		`testdata/stack/main.tf:11: azurerm_storage_account.logs: name "logsaA0aA0" contains "A", allowed characters are [a-z0-9]`,
+		`testdata/stack/main.tf:16: azurerm_mssql_server.sql: name "rpg-sql-aA0aA0" contains "A", allowed characters are [a-z0-9-]`,
+		`testdata/stack/modules/vault/main.tf:5: module.vault.azurerm_key_vault.kv: name "rpg-key-vault-for-the-naming-tests" is 34 characters, must be 3-24`,
+		`testdata/stack/modules/vault/main.tf:9: module.vault.azurerm_key_vault_secret.secret: name "sql_password" contains "_", allowed characters are [a-zA-Z0-9-]`,
+	}, got)
+
+	violations, err = CheckConfig("testdata/stack", "testdata/names.tfvars")
+	require.NoError(t, err)
+	require.Len(t, violations, 3)
+	assert.Equal(t, "azurerm_storage_account", violations[0].Type)
+	assert.Equal(t, "sql_password", violations[2].Name)
+}
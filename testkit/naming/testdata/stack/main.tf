@@ -0,0 +1,30 @@
+resource "random_string" "suffix" {
+  length  = 6
+  special = false
+}
+
+resource "azurerm_resource_group" "rg" {
+  name     = "naming-rg"
+  location = "Japan East"
+}
+
+resource "azurerm_storage_account" "logs" {
+  name                = "logs${random_string.suffix.result}"
+  resource_group_name = azurerm_resource_group.rg.name
+}
+
+resource "azurerm_mssql_server" "sql" {
+  name                = "rpg-sql-${random_string.suffix.result}"
+  resource_group_name = azurerm_resource_group.rg.name
+}
+
+resource "azurerm_linux_function_app" "func" {
+  name                = "${azurerm_resource_group.rg.id}-func"
+  resource_group_name = azurerm_resource_group.rg.name
+}
+
+module "vault" {
+  source = "./modules/vault"
+
+  key_vault_name = var.key_vault_name
+}
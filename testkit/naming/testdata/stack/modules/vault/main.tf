@@ -0,0 +1,12 @@
+variable "key_vault_name" {
+  type = string
+}
+
+resource "azurerm_key_vault" "kv" {
+  name = var.key_vault_name
+}
+
+resource "azurerm_key_vault_secret" "secret" {
+  name  = "sql_password"
+  value = "unused"
+}
@@ -0,0 +1,4 @@
+variable "key_vault_name" {
+  type    = string
+  default = "rpg-key-vault-for-the-naming-tests"
+}
@@ -0,0 +1,112 @@
+// Package openai deploys and validates the openai module
+package openai
+
+import (
+	"testing"
+
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/vanehru/terraform-modules/testkit/deploy"
+	"github.com/vanehru/terraform-modules/testkit/naming"
+	"github.com/vanehru/terraform-modules/testkit/privatedns"
+)
+
+// Outputs are the module outputs Validate reads
+var Outputs = []string{"openai_account_name", "openai_endpoint", "openai_primary_key", "deployment_ids"}
+
+// Deployment is a model deployment on the OpenAI account
+type Deployment struct {
+	ModelName    string
+	ModelVersion string
+	ScaleType    string
+	Capacity     int
+}
+
+// Expected describes the OpenAI account a test deploys and expects back
+type Expected struct {
+	Name              string
+	ResourceGroupName string
+	Location          string
+	// Deployments is keyed by deployment name
+	Deployments map[string]Deployment
+	// PrivateEndpointSubnetID and VirtualNetworkID, such as a fixture.Network
+	// provides, put the account behind a private endpoint when set
+	PrivateEndpointSubnetID string
+	VirtualNetworkID        string
+}
+
+// Vars returns the module inputs that deploy expected, with public network
+// access so the test runner can reach the endpoint
+func Vars(expected Expected) map[string]interface{} {
+	deployments := map[string]interface{}{}
+	for name, d := range expected.Deployments {
+		deployments[name] = map[string]interface{}{
+			"model_name":    d.ModelName,
+			"model_version": d.ModelVersion,
+			"scale_type":    d.ScaleType,
+			"capacity":      d.Capacity,
+		}
+	}
+	vars := map[string]interface{}{
+		"openai_account_name":           expected.Name,
+		"location":                      expected.Location,
+		"resource_group_name":           expected.ResourceGroupName,
+		"sku_name":                      "S0",
+		"public_network_access_enabled": true, // For testing
+		"custom_subdomain_name":         expected.Name,
+		"deployments":                   deployments,
+		"enable_private_endpoint":       expected.PrivateEndpointSubnetID != "",
+	}
+	if expected.PrivateEndpointSubnetID != "" {
+		vars["private_endpoint_subnet_id"] = expected.PrivateEndpointSubnetID
+		vars["virtual_network_id"] = expected.VirtualNetworkID
+	}
+	return vars
+}
+
+// Test deploys the openai module in terraformDir, validates it against
+// expected and destroys it. Names Azure would reject fail the test before
+// anything is deployed.
+func Test(t *testing.T, terraformDir string, expected Expected) {
+	naming.Require(t, "azurerm_cognitive_account", expected.Name)
+	for name := range expected.Deployments {
+		naming.Require(t, "azurerm_cognitive_deployment", name)
+	}
+	terraformOptions := deploy.Options(t, terraformDir, Vars(expected))
+	deploy.Run(t, terraformOptions, nil, func(t *testing.T, terraformOptions *terraform.Options) {
+		Validate(t, terraformOptions, expected)
+	})
+}
+
+// Validate runs the standard checks against an applied openai module
+func Validate(t *testing.T, terraformOptions *terraform.Options, expected Expected) {
+	t.Run("OpenAIAccountName", func(t *testing.T) {
+		actualName := terraform.Output(t, terraformOptions, "openai_account_name")
+		assert.Equal(t, expected.Name, actualName)
+	})
+
+	t.Run("OpenAIEndpoint", func(t *testing.T) {
+		endpoint := terraform.Output(t, terraformOptions, "openai_endpoint")
+		assert.Contains(t, endpoint, expected.Name)
+		assert.Contains(t, endpoint, "openai.azure.com")
+	})
+
+	t.Run("PrimaryKeyExists", func(t *testing.T) {
+		primaryKey := terraform.Output(t, terraformOptions, "openai_primary_key")
+		assert.NotEmpty(t, primaryKey, "Primary key should exist")
+	})
+
+	t.Run("DeploymentsCreated", func(t *testing.T) {
+		deploymentIDs := terraform.OutputMap(t, terraformOptions, "deployment_ids")
+		for name := range expected.Deployments {
+			assert.Contains(t, deploymentIDs, name, "Deployment %s should be created", name)
+		}
+	})
+
+	if expected.PrivateEndpointSubnetID != "" {
+		t.Run("PrivateDNS", func(t *testing.T) {
+			privatedns.ValidateApplied(t, terraformOptions, deploy.ARMClient(t), expected.ResourceGroupName, expected.VirtualNetworkID)
+		})
+	}
+}
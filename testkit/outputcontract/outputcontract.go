@@ -0,0 +1,395 @@
+// Package outputcontract cross-references the Terraform outputs read by the
+// test suite with the outputs declared by the configuration they are read
+// from, so a missing or misspelled output is reported without an apply.
+package outputcontract
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"path/filepath"
+	"sort"
+	"strconv"
+
+	"github.com/agext/levenshtein"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclparse"
+)
+
+const terratestImportPath = "github.com/gruntwork-io/terratest/modules/terraform"
+
+// outputFuncs lists the terratest functions whose third argument is an output name
+var outputFuncs = map[string]bool{
+	"Output":               true,
+	"OutputE":              true,
+	"OutputList":           true,
+	"OutputListE":          true,
+	"OutputMap":            true,
+	"OutputMapE":           true,
+	"OutputMapOfObjects":   true,
+	"OutputMapOfObjectsE":  true,
+	"OutputListOfObjects":  true,
+	"OutputListOfObjectsE": true,
+	"OutputRequired":       true,
+	"OutputRequiredE":      true,
+	"OutputJson":           true,
+	"OutputJsonE":          true,
+	"OutputStruct":         true,
+	"OutputStructE":        true,
+}
+
+// Output is an output block declared in a Terraform configuration
+type Output struct {
+	Name string
+	File string
+	Line int
+}
+
+// Reference is a literal output name read through terratest in a test file
+type Reference struct {
+	Name         string
+	Func         string
+	File         string
+	Line         int
+	TerraformDir string
+}
+
+// Issue is a reference to an output the configuration does not declare
+type Issue struct {
+	Reference
+	Suggestion string
+}
+
+func (i Issue) String() string {
+	location := fmt.Sprintf("%s:%d", i.File, i.Line)
+	if i.Line == 0 {
+		location = i.File
+	}
+	msg := fmt.Sprintf("%s: terraform.%s reads %q but %s declares no such output",
+		location, i.Func, i.Name, i.TerraformDir)
+	if i.Suggestion != "" {
+		msg += fmt.Sprintf(" (did you mean %q?)", i.Suggestion)
+	}
+	return msg
+}
+
+// Options controls how test files are scanned
+type Options struct {
+	// DefaultTerraformDir is used for references whose terraform.Options
+	// literal cannot be traced, relative to the test directory.
+	DefaultTerraformDir string
+
+	// Exclude lists test file base names that are not scanned.
+	Exclude []string
+
+	// Pattern selects the files to scan, *_test.go when empty. Shared helper
+	// packages are scanned with *.go.
+	Pattern string
+}
+
+// DeclaredOutputs returns the outputs declared by the .tf files in dir, keyed by name
+func DeclaredOutputs(dir string) (map[string]Output, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.tf"))
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no Terraform files found in %s", dir)
+	}
+
+	schema := &hcl.BodySchema{
+		Blocks: []hcl.BlockHeaderSchema{{Type: "output", LabelNames: []string{"name"}}},
+	}
+
+	parser := hclparse.NewParser()
+	outputs := map[string]Output{}
+	for _, file := range files {
+		f, diags := parser.ParseHCLFile(file)
+		if diags.HasErrors() {
+			return nil, diags
+		}
+		content, _, diags := f.Body.PartialContent(schema)
+		if diags.HasErrors() {
+			return nil, diags
+		}
+		for _, block := range content.Blocks {
+			outputs[block.Labels[0]] = Output{
+				Name: block.Labels[0],
+				File: file,
+				Line: block.DefRange.Start.Line,
+			}
+		}
+	}
+	return outputs, nil
+}
+
+// ReferencedOutputs collects every literal output name passed to a terratest
+// Output function in the *_test.go files of testDir. Each reference is
+// attributed to the TerraformDir of the terraform.Options literal built in
+// the same function, or in the test function that calls it.
+func ReferencedOutputs(testDir string, opts Options) ([]Reference, error) {
+	pattern := opts.Pattern
+	if pattern == "" {
+		pattern = "*_test.go"
+	}
+	files, err := filepath.Glob(filepath.Join(testDir, pattern))
+	if err != nil {
+		return nil, err
+	}
+
+	excluded := map[string]bool{}
+	for _, name := range opts.Exclude {
+		excluded[name] = true
+	}
+
+	fset := token.NewFileSet()
+	funcs := map[string]*funcInfo{}
+	for _, file := range files {
+		if excluded[filepath.Base(file)] {
+			continue
+		}
+		f, err := parser.ParseFile(fset, file, nil, 0)
+		if err != nil {
+			return nil, err
+		}
+		pkgName, ok := terraformImportName(f)
+		if !ok {
+			continue
+		}
+		for _, decl := range f.Decls {
+			fn, ok := decl.(*ast.FuncDecl)
+			if !ok || fn.Body == nil || fn.Recv != nil {
+				continue
+			}
+			funcs[fn.Name.Name] = inspectFunc(fset, fn, pkgName)
+		}
+	}
+
+	resolveDirs(funcs)
+
+	var refs []Reference
+	for _, info := range funcs {
+		dirs := sortedKeys(info.dirs)
+		if len(dirs) == 0 {
+			dirs = []string{opts.DefaultTerraformDir}
+		}
+		for _, ref := range info.refs {
+			for _, dir := range dirs {
+				ref.TerraformDir = dir
+				refs = append(refs, ref)
+			}
+		}
+	}
+
+	sort.Slice(refs, func(i, j int) bool {
+		if refs[i].File != refs[j].File {
+			return refs[i].File < refs[j].File
+		}
+		if refs[i].Line != refs[j].Line {
+			return refs[i].Line < refs[j].Line
+		}
+		return refs[i].TerraformDir < refs[j].TerraformDir
+	})
+	return refs, nil
+}
+
+// Check returns an issue for every output referenced in testDir that its
+// Terraform configuration does not declare
+func Check(testDir string, opts Options) ([]Issue, error) {
+	refs, err := ReferencedOutputs(testDir, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	declared := map[string]map[string]Output{}
+	var issues []Issue
+	for _, ref := range refs {
+		outputs, ok := declared[ref.TerraformDir]
+		if !ok {
+			outputs, err = DeclaredOutputs(filepath.Join(testDir, ref.TerraformDir))
+			if err != nil {
+				return nil, err
+			}
+			declared[ref.TerraformDir] = outputs
+		}
+		if _, ok := outputs[ref.Name]; ok {
+			continue
+		}
+		issues = append(issues, Issue{
+			Reference:  ref,
+			Suggestion: suggest(ref.Name, outputs),
+		})
+	}
+	return issues, nil
+}
+
+// CheckOutputs returns an issue for each of names that terraformDir does not
+// declare. It covers outputs read by shared helpers, whose TerraformDir is
+// only known to the caller; source names the helper in the issue.
+func CheckOutputs(terraformDir, source string, names []string) ([]Issue, error) {
+	outputs, err := DeclaredOutputs(terraformDir)
+	if err != nil {
+		return nil, err
+	}
+
+	var issues []Issue
+	for _, name := range names {
+		if _, ok := outputs[name]; ok {
+			continue
+		}
+		issues = append(issues, Issue{
+			Reference:  Reference{Name: name, Func: "Output", File: source, TerraformDir: terraformDir},
+			Suggestion: suggest(name, outputs),
+		})
+	}
+	return issues, nil
+}
+
+type funcInfo struct {
+	dirs    map[string]bool
+	callees []string
+	refs    []Reference
+}
+
+// inspectFunc records the TerraformDir literals, local calls and output
+// references found in the body of fn, including its closures
+func inspectFunc(fset *token.FileSet, fn *ast.FuncDecl, pkgName string) *funcInfo {
+	info := &funcInfo{dirs: map[string]bool{}}
+
+	ast.Inspect(fn.Body, func(n ast.Node) bool {
+		switch node := n.(type) {
+		case *ast.CompositeLit:
+			if isSelector(node.Type, pkgName, "Options") {
+				if dir, ok := terraformDir(node); ok {
+					info.dirs[dir] = true
+				}
+			}
+		case *ast.CallExpr:
+			if ident, ok := node.Fun.(*ast.Ident); ok {
+				info.callees = append(info.callees, ident.Name)
+				return true
+			}
+			sel, ok := node.Fun.(*ast.SelectorExpr)
+			if !ok || !isSelector(sel, pkgName, sel.Sel.Name) || !outputFuncs[sel.Sel.Name] {
+				return true
+			}
+			if len(node.Args) < 3 {
+				return true
+			}
+			lit, ok := node.Args[2].(*ast.BasicLit)
+			if !ok || lit.Kind != token.STRING {
+				return true
+			}
+			name, err := strconv.Unquote(lit.Value)
+			if err != nil {
+				return true
+			}
+			pos := fset.Position(lit.Pos())
+			info.refs = append(info.refs, Reference{
+				Name: name,
+				Func: sel.Sel.Name,
+				File: filepath.Base(pos.Filename),
+				Line: pos.Line,
+			})
+		}
+		return true
+	})
+
+	return info
+}
+
+// resolveDirs propagates TerraformDir values from callers to helper
+// functions that do not build their own terraform.Options
+func resolveDirs(funcs map[string]*funcInfo) {
+	own := map[string]bool{}
+	for name, info := range funcs {
+		own[name] = len(info.dirs) > 0
+	}
+
+	for changed := true; changed; {
+		changed = false
+		for _, caller := range funcs {
+			for _, name := range caller.callees {
+				callee, ok := funcs[name]
+				if !ok || own[name] {
+					continue
+				}
+				for dir := range caller.dirs {
+					if !callee.dirs[dir] {
+						callee.dirs[dir] = true
+						changed = true
+					}
+				}
+			}
+		}
+	}
+}
+
+// terraformImportName returns the local name of the terratest terraform package in f
+func terraformImportName(f *ast.File) (string, bool) {
+	for _, imp := range f.Imports {
+		path, err := strconv.Unquote(imp.Path.Value)
+		if err != nil || path != terratestImportPath {
+			continue
+		}
+		if imp.Name != nil {
+			return imp.Name.Name, true
+		}
+		return "terraform", true
+	}
+	return "", false
+}
+
+func isSelector(expr ast.Expr, pkgName, name string) bool {
+	sel, ok := expr.(*ast.SelectorExpr)
+	if !ok || sel.Sel.Name != name {
+		return false
+	}
+	ident, ok := sel.X.(*ast.Ident)
+	return ok && ident.Name == pkgName
+}
+
+func terraformDir(lit *ast.CompositeLit) (string, bool) {
+	for _, elt := range lit.Elts {
+		kv, ok := elt.(*ast.KeyValueExpr)
+		if !ok {
+			continue
+		}
+		key, ok := kv.Key.(*ast.Ident)
+		if !ok || key.Name != "TerraformDir" {
+			continue
+		}
+		value, ok := kv.Value.(*ast.BasicLit)
+		if !ok || value.Kind != token.STRING {
+			return "", false
+		}
+		dir, err := strconv.Unquote(value.Value)
+		if err != nil {
+			return "", false
+		}
+		return dir, true
+	}
+	return "", false
+}
+
+// suggest returns the declared output closest to name, if any is close enough
+// to be a likely misspelling
+func suggest(name string, outputs map[string]Output) string {
+	best, bestDist := "", 3
+	for _, candidate := range sortedKeys(outputs) {
+		if dist := levenshtein.Distance(name, candidate, nil); dist < bestDist {
+			best, bestDist = candidate, dist
+		}
+	}
+	return best
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
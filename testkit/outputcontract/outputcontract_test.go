@@ -0,0 +1,113 @@
+package outputcontract
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeclaredOutputs(t *testing.T) {
+	t.Parallel()
+
+	outputs, err := DeclaredOutputs("testdata/stack")
+	require.NoError(t, err)
+
+	assert.Contains(t, outputs, "resource_group_name")
+	assert.Contains(t, outputs, "vnet_name")
+	assert.NotContains(t, outputs, "key_vault_name", "Module outputs should not leak into the root")
+	assert.Equal(t, 1, outputs["resource_group_name"].Line)
+}
+
+func TestDeclaredOutputsMissingDir(t *testing.T) {
+	t.Parallel()
+
+	_, err := DeclaredOutputs("testdata/missing")
+	assert.Error(t, err)
+}
+
+func TestReferencedOutputs(t *testing.T) {
+	t.Parallel()
+
+	refs, err := ReferencedOutputs("testdata/suite", Options{
+		DefaultTerraformDir: "../stack",
+		Exclude:             []string{"ignored_test.go"},
+	})
+	require.NoError(t, err)
+
+	dirs := map[string]string{}
+	for _, ref := range refs {
+		dirs[ref.Name] = ref.TerraformDir
+	}
+
+	assert.Equal(t, map[string]string{
+		"resource_group_name": "../stack",
+		"vnet_nme":            "../stack",
+		"vnet_address_space":  "../stack",
+		"key_vault_uri":       "../stack/modules/vault",
+		"secret_ids":          "../stack/modules/vault",
+	}, dirs)
+}
+
+func TestCheck(t *testing.T) {
+	t.Parallel()
+
+	issues, err := Check("testdata/suite", Options{
+		DefaultTerraformDir: "../stack",
+		Exclude:             []string{"ignored_test.go"},
+	})
+	require.NoError(t, err)
+	require.Len(t, issues, 3)
+
+	assert.Equal(t, "vnet_nme", issues[0].Name)
+	assert.Equal(t, "vnet_name", issues[0].Suggestion, "Misspelled outputs should suggest the declared name")
+	assert.Equal(t, "vnet_address_space", issues[1].Name)
+	assert.Empty(t, issues[1].Suggestion)
+	assert.Equal(t, "secret_ids", issues[2].Name)
+	assert.Equal(t, "../stack/modules/vault", issues[2].TerraformDir)
+
+	assert.Equal(t,
+		`stack_test.go:19: terraform.Output reads "vnet_nme" but ../stack declares no such output (did you mean "vnet_name"?)`,
+		issues[0].String())
+}
+
+func TestCheckExclude(t *testing.T) {
+	t.Parallel()
+
+	issues, err := Check("testdata/suite", Options{DefaultTerraformDir: "../stack"})
+	require.NoError(t, err)
+
+	var names []string
+	for _, issue := range issues {
+		names = append(names, issue.Name)
+	}
+	assert.Contains(t, names, "not_declared")
+}
+
+func TestReferencedOutputsPattern(t *testing.T) {
+	t.Parallel()
+
+	refs, err := ReferencedOutputs("testdata/suite", Options{
+		DefaultTerraformDir: "../stack",
+		Pattern:             "ignored_*.go",
+	})
+	require.NoError(t, err)
+	require.Len(t, refs, 1)
+	assert.Equal(t, "not_declared", refs[0].Name)
+}
+
+func TestCheckOutputs(t *testing.T) {
+	t.Parallel()
+
+	issues, err := CheckOutputs("testdata/stack", "testkit/stack", []string{"vnet_name", "vnet_nam", "key_vault_uri"})
+	require.NoError(t, err)
+	require.Len(t, issues, 2)
+
+	assert.Equal(t,
+		`testkit/stack: terraform.Output reads "vnet_nam" but testdata/stack declares no such output (did you mean "vnet_name"?)`,
+		issues[0].String())
+	assert.Equal(t, "key_vault_uri", issues[1].Name)
+
+	_, err = CheckOutputs("testdata/missing", "testkit/stack", []string{"vnet_name"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,7 @@
+output "key_vault_name" {
+  value = "kv"
+}
+
+output "key_vault_uri" {
+  value = "https://kv.vault.azure.net/"
+}
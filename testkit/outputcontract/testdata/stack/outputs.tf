@@ -0,0 +1,7 @@
+output "resource_group_name" {
+  value = "rg"
+}
+
+output "vnet_name" {
+  value = "vnet"
+}
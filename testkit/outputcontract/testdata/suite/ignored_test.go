@@ -0,0 +1,11 @@
+package suite
+
+import (
+	"testing"
+
+	"github.com/gruntwork-io/terratest/modules/terraform"
+)
+
+func TestIgnored(t *testing.T) {
+	terraform.Output(t, &terraform.Options{TerraformDir: "../stack"}, "not_declared")
+}
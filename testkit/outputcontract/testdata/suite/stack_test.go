@@ -0,0 +1,36 @@
+package suite
+
+import (
+	"testing"
+
+	"github.com/gruntwork-io/terratest/modules/terraform"
+)
+
+func TestStack(t *testing.T) {
+	terraformOptions := &terraform.Options{
+		TerraformDir: "../stack",
+	}
+
+	terraform.Output(t, terraformOptions, "resource_group_name")
+	checkNetwork(t, terraformOptions)
+}
+
+func checkNetwork(t *testing.T, terraformOptions *terraform.Options) {
+	terraform.Output(t, terraformOptions, "vnet_nme")
+	terraform.OutputList(t, terraformOptions, "vnet_address_space")
+}
+
+func TestVault(t *testing.T) {
+	terraformOptions := &terraform.Options{
+		TerraformDir: "../stack/modules/vault",
+	}
+
+	t.Run("URI", func(t *testing.T) {
+		terraform.Output(t, terraformOptions, "key_vault_uri")
+		terraform.OutputMap(t, terraformOptions, "secret_ids")
+	})
+}
+
+func orphanHelper(t *testing.T, terraformOptions *terraform.Options) {
+	terraform.Output(t, terraformOptions, "resource_group_name")
+}
@@ -0,0 +1,228 @@
+// Package planassert provides assertions over the JSON plan produced by
+// `terraform show -json`, so plan-only tests can check resource addresses,
+// attribute values and counts without deploying anything.
+package planassert
+
+import (
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	"github.com/gruntwork-io/terratest/modules/testing"
+	tfjson "github.com/hashicorp/terraform-json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Plan wraps a parsed plan with address-based lookups
+type Plan struct {
+	*terraform.PlanStruct
+}
+
+// Load reads a plan JSON file, such as a fixture checked in under testdata/
+func Load(t testing.TestingT, path string) *Plan {
+	plan, err := LoadE(path)
+	require.NoError(t, err)
+	return plan
+}
+
+// LoadE reads a plan JSON file, such as a fixture checked in under testdata/
+func LoadE(path string) (*Plan, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(data)
+}
+
+// Parse parses the output of `terraform show -json`
+func Parse(data []byte) (*Plan, error) {
+	plan, err := terraform.ParsePlanJSON(string(data))
+	if err != nil {
+		return nil, err
+	}
+	return &Plan{PlanStruct: plan}, nil
+}
+
+// InitAndPlan runs terraform init, plan and show against options and parses the result
+func InitAndPlan(t testing.TestingT, options *terraform.Options) *Plan {
+	return InitAndPlanToFile(t, options, "")
+}
+
+// InitAndPlanToFile is InitAndPlan that also writes the plan JSON to path,
+// which is how checked-in fixtures are regenerated
+func InitAndPlanToFile(t testing.TestingT, options *terraform.Options, path string) *Plan {
+	if options.PlanFilePath == "" {
+		planFile, err := os.CreateTemp("", "terratest-plan-")
+		require.NoError(t, err)
+		require.NoError(t, planFile.Close())
+		defer os.Remove(planFile.Name())
+
+		planOptions := *options
+		planOptions.PlanFilePath = planFile.Name()
+		options = &planOptions
+	}
+
+	jsonOut := terraform.InitAndPlanAndShow(t, options)
+	if path != "" {
+		require.NoError(t, os.WriteFile(path, []byte(jsonOut+"\n"), 0o644))
+	}
+
+	plan, err := Parse([]byte(jsonOut))
+	require.NoError(t, err)
+	return plan
+}
+
+// Resource returns the planned values of the resource at address, failing the test if it is not planned
+func (p *Plan) Resource(t testing.TestingT, address string) *tfjson.StateResource {
+	resource, ok := p.ResourcePlannedValuesMap[address]
+	require.Truef(t, ok, "Resource %s should be planned", address)
+	return resource
+}
+
+// Resources returns the planned resources whose type or index-less address
+// equals query, sorted by address
+func (p *Plan) Resources(query string) []*tfjson.StateResource {
+	var resources []*tfjson.StateResource
+	for address, resource := range p.ResourcePlannedValuesMap {
+		if resource.Type == query || StripIndex(address) == query {
+			resources = append(resources, resource)
+		}
+	}
+	sort.Slice(resources, func(i, j int) bool {
+		return resources[i].Address < resources[j].Address
+	})
+	return resources
+}
+
+// Attribute returns the planned value at path for the resource at address.
+// Values that are only known after apply are reported as absent.
+func (p *Plan) Attribute(address, path string) (interface{}, bool) {
+	resource, ok := p.ResourcePlannedValuesMap[address]
+	if !ok {
+		return nil, false
+	}
+	return Lookup(resource.AttributeValues, path)
+}
+
+// AssertResourceExists checks that the resource at address is planned
+func (p *Plan) AssertResourceExists(t testing.TestingT, address string) bool {
+	_, ok := p.ResourcePlannedValuesMap[address]
+	return assert.Truef(t, ok, "Resource %s should be planned", address)
+}
+
+// AssertResourceAbsent checks that the resource at address is not planned
+func (p *Plan) AssertResourceAbsent(t testing.TestingT, address string) bool {
+	_, ok := p.ResourcePlannedValuesMap[address]
+	return assert.Falsef(t, ok, "Resource %s should not be planned", address)
+}
+
+// AssertResourceCount checks how many resources match query, which is either
+// a resource type or an address without its index
+func (p *Plan) AssertResourceCount(t testing.TestingT, query string, expected int) bool {
+	return assert.Lenf(t, p.Resources(query), expected, "Planned resource count for %s", query)
+}
+
+// AssertAttribute checks the planned value at path, using a dotted path with
+// numeric list indexes such as "delegation.0.service_delegation.0.name"
+func (p *Plan) AssertAttribute(t testing.TestingT, address, path string, expected interface{}) bool {
+	if !p.AssertResourceExists(t, address) {
+		return false
+	}
+	actual, ok := p.Attribute(address, path)
+	if !assert.Truef(t, ok, "%s should have a known planned value for %s", address, path) {
+		return false
+	}
+	return assert.EqualValuesf(t, normalize(expected), actual, "%s: unexpected planned value for %s", address, path)
+}
+
+// AssertAttributeContains checks that the planned list, map or string at path contains element
+func (p *Plan) AssertAttributeContains(t testing.TestingT, address, path string, element interface{}) bool {
+	if !p.AssertResourceExists(t, address) {
+		return false
+	}
+	actual, ok := p.Attribute(address, path)
+	if !assert.Truef(t, ok, "%s should have a known planned value for %s", address, path) {
+		return false
+	}
+	return assert.Containsf(t, actual, normalize(element), "%s: planned value for %s", address, path)
+}
+
+// AssertAction checks the actions terraform plans for the resource at address,
+// e.g. tfjson.ActionCreate, or tfjson.ActionDelete and tfjson.ActionCreate for a replacement
+func (p *Plan) AssertAction(t testing.TestingT, address string, expected ...tfjson.Action) bool {
+	change, ok := p.ResourceChangesMap[address]
+	if !assert.Truef(t, ok, "Resource %s should have a planned change", address) {
+		return false
+	}
+	return assert.Equalf(t, tfjson.Actions(expected), change.Change.Actions, "%s: unexpected planned actions", address)
+}
+
+// Lookup walks a decoded JSON value along a dotted path. Numeric segments
+// index into lists; other segments select map keys.
+func Lookup(value interface{}, path string) (interface{}, bool) {
+	if path == "" {
+		return value, true
+	}
+	for _, segment := range strings.Split(path, ".") {
+		switch node := value.(type) {
+		case map[string]interface{}:
+			next, ok := node[segment]
+			if !ok {
+				return nil, false
+			}
+			value = next
+		case []interface{}:
+			index, err := strconv.Atoi(segment)
+			if err != nil || index < 0 || index >= len(node) {
+				return nil, false
+			}
+			value = node[index]
+		default:
+			return nil, false
+		}
+	}
+	return value, true
+}
+
+var indexSuffix = regexp.MustCompile(`\[[^\]]*\]$`)
+
+// StripIndex removes a trailing count or for_each index from a resource address
+func StripIndex(address string) string {
+	return indexSuffix.ReplaceAllString(address, "")
+}
+
+// instanceKeys matches every count or for_each index in an address
+var instanceKeys = regexp.MustCompile(`\[("[^"]*"|\d+)\]`)
+
+// StripIndexes removes every count or for_each index from a resource or
+// module address, the module instances' as well as the resource's, giving
+// the address of its configuration
+func StripIndexes(address string) string {
+	return instanceKeys.ReplaceAllString(address, "")
+}
+
+// normalize converts expected values to the types encoding/json decodes plan values into
+func normalize(value interface{}) interface{} {
+	switch v := value.(type) {
+	case int:
+		return float64(v)
+	case []string:
+		out := make([]interface{}, len(v))
+		for i, s := range v {
+			out[i] = s
+		}
+		return out
+	case map[string]string:
+		out := make(map[string]interface{}, len(v))
+		for k, s := range v {
+			out[k] = s
+		}
+		return out
+	default:
+		return value
+	}
+}
@@ -0,0 +1,114 @@
+package planassert
+
+import (
+	"fmt"
+	"testing"
+
+	tfjson "github.com/hashicorp/terraform-json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recordingT captures assertion failures so failing assertions can be tested
+type recordingT struct {
+	failed   bool
+	messages []string
+}
+
+func (r *recordingT) Fail()                                     { r.failed = true }
+func (r *recordingT) FailNow()                                  { r.failed = true }
+func (r *recordingT) Fatal(args ...interface{})                 { r.Error(args...) }
+func (r *recordingT) Fatalf(format string, args ...interface{}) { r.Errorf(format, args...) }
+func (r *recordingT) Error(args ...interface{})                 { r.Errorf("%s", fmt.Sprint(args...)) }
+func (r *recordingT) Name() string                              { return "recordingT" }
+
+func (r *recordingT) Errorf(format string, args ...interface{}) {
+	r.failed = true
+	r.messages = append(r.messages, fmt.Sprintf(format, args...))
+}
+
+func TestLoad(t *testing.T) {
+	t.Parallel()
+
+	plan := Load(t, "testdata/plan.json")
+	assert.Len(t, plan.ResourcePlannedValuesMap, 4)
+	assert.Len(t, plan.ResourceChangesMap, 2)
+
+	_, err := LoadE("testdata/missing.json")
+	assert.Error(t, err)
+}
+
+func TestAttributeAssertions(t *testing.T) {
+	t.Parallel()
+
+	plan := Load(t, "testdata/plan.json")
+
+	plan.AssertAttribute(t, "azurerm_subnet.app_subnet", "name", "app-subnet")
+	plan.AssertAttribute(t, "azurerm_subnet.app_subnet", "address_prefixes", []string{"172.16.1.0/24"})
+	plan.AssertAttribute(t, "azurerm_subnet.app_subnet",
+		"delegation.0.service_delegation.0.name", "Microsoft.Web/serverFarms")
+	plan.AssertAttributeContains(t, "azurerm_subnet.app_subnet", "service_endpoints", "Microsoft.Web")
+	plan.AssertAttribute(t, "azurerm_subnet.storage_subnet", "delegation", []interface{}{})
+
+	rec := &recordingT{}
+	plan.AssertAttribute(rec, "azurerm_subnet.storage_subnet", "delegation.0.name", "delegation")
+	assert.True(t, rec.failed, "Missing nested values should fail the assertion")
+
+	rec = &recordingT{}
+	plan.AssertAttribute(rec, "azurerm_subnet.app_subnet", "name", "storage-subnet")
+	assert.True(t, rec.failed, "Mismatched values should fail the assertion")
+}
+
+func TestResourceAssertions(t *testing.T) {
+	t.Parallel()
+
+	plan := Load(t, "testdata/plan.json")
+
+	plan.AssertResourceExists(t, `module.key_vault.azurerm_key_vault_secret.secrets["openai-key"]`)
+	plan.AssertResourceAbsent(t, "azurerm_subnet.openai_subnet")
+	plan.AssertResourceCount(t, "azurerm_subnet", 2)
+	plan.AssertResourceCount(t, "module.key_vault.azurerm_key_vault_secret.secrets", 2)
+	plan.AssertAction(t, "azurerm_subnet.app_subnet", tfjson.ActionCreate)
+	plan.AssertAction(t, "azurerm_subnet.storage_subnet", tfjson.ActionNoop)
+
+	secrets := plan.Resources("azurerm_key_vault_secret")
+	require.Len(t, secrets, 2)
+	assert.Equal(t, "openai-key", secrets[0].Index, "Resources should be sorted by address")
+
+	rec := &recordingT{}
+	plan.AssertResourceExists(rec, "azurerm_subnet.openai_subnet")
+	assert.True(t, rec.failed)
+}
+
+func TestLookup(t *testing.T) {
+	t.Parallel()
+
+	value := map[string]interface{}{
+		"network_acls": []interface{}{
+			map[string]interface{}{"default_action": "Deny"},
+		},
+	}
+
+	actual, ok := Lookup(value, "network_acls.0.default_action")
+	assert.True(t, ok)
+	assert.Equal(t, "Deny", actual)
+
+	_, ok = Lookup(value, "network_acls.1.default_action")
+	assert.False(t, ok)
+
+	_, ok = Lookup(value, "network_acls.first")
+	assert.False(t, ok)
+}
+
+func TestStripIndex(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, "module.key_vault.azurerm_private_endpoint.kv_endpoint",
+		StripIndex("module.key_vault.azurerm_private_endpoint.kv_endpoint[0]"))
+	assert.Equal(t, "module.key_vault.azurerm_key_vault_secret.secrets",
+		StripIndex(`module.key_vault.azurerm_key_vault_secret.secrets["sql-username"]`))
+	assert.Equal(t, "azurerm_subnet.app_subnet", StripIndex("azurerm_subnet.app_subnet"))
+	assert.Equal(t, "module.vault.azurerm_key_vault_secret.secrets",
+		StripIndexes(`module.vault["a]b"].azurerm_key_vault_secret.secrets["sql-username"]`))
+	assert.Equal(t, "module.vault.azurerm_key_vault.kv", StripIndexes("module.vault[0].azurerm_key_vault.kv"))
+}
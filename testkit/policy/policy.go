@@ -0,0 +1,512 @@
+// Package policy evaluates `terraform show -json` plans against security
+// rules: a built-in Azure baseline plus custom rules and justified
+// suppressions read from YAML.
+package policy
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	tfjson "github.com/hashicorp/terraform-json"
+	"gopkg.in/yaml.v3"
+
+	"github.com/vanehru/terraform-modules/testkit/planassert"
+	"github.com/vanehru/terraform-modules/testkit/tfconfig"
+)
+
+//go:embed builtin.yml
+var builtin []byte
+
+// versionPattern matches the numeric part of a TLS version, "1.2" in both
+// "1.2" and "TLS1_2"
+var versionPattern = regexp.MustCompile(`(\d+)[._](\d+)$`)
+
+// Check is a test on one attribute of a planned resource. Exactly one of
+// Equals, OneOf, NotOneOf and MinVersion is set.
+type Check struct {
+	// Attribute is a dotted path into the resource's planned values, with
+	// list indexes as segments: "network_acls.0.default_action"
+	Attribute  string        `yaml:"attribute"`
+	Equals     interface{}   `yaml:"equals"`
+	OneOf      []interface{} `yaml:"one_of"`
+	NotOneOf   []interface{} `yaml:"not_one_of"`
+	MinVersion string        `yaml:"min_version"`
+}
+
+// Rule applies a check to every resource of the listed types
+type Rule struct {
+	ID            string   `yaml:"id"`
+	Description   string   `yaml:"description"`
+	ResourceTypes []string `yaml:"resource_types"`
+	Check         `yaml:",inline"`
+	// When limits the rule to resources that pass another check
+	When *Check `yaml:"when"`
+}
+
+// Suppression accepts a rule's finding on one resource
+type Suppression struct {
+	Rule string `yaml:"rule"`
+	// Address is the resource address, with or without instance keys
+	Address       string `yaml:"address"`
+	Justification string `yaml:"justification"`
+}
+
+// Policy is the set of rules a plan must pass and the findings it accepts
+type Policy struct {
+	Rules        []Rule        `yaml:"rules"`
+	Suppressions []Suppression `yaml:"suppressions"`
+}
+
+// Violation is a planned resource that fails a rule
+type Violation struct {
+	Rule      string
+	Address   string
+	Type      string
+	Attribute string
+	Message   string
+	// File and Line locate the value in the configuration: the argument
+	// that sets it, following input variables up to the module call that
+	// passes them, or the resource block when it is not set
+	File string
+	Line int
+}
+
+func (v Violation) String() string {
+	if v.File == "" {
+		return fmt.Sprintf("%s: %s: %s", v.Address, v.Rule, v.Message)
+	}
+	return fmt.Sprintf("%s:%d: %s: %s: %s", v.File, v.Line, v.Address, v.Rule, v.Message)
+}
+
+// Suppressed is a violation a suppression accepts
+type Suppressed struct {
+	Violation
+	Justification string
+}
+
+// Result is the outcome of checking a plan
+type Result struct {
+	Violations []Violation
+	Suppressed []Suppressed
+	// UnusedSuppressions match no violation, so they are stale or mistyped
+	UnusedSuppressions []Suppression
+}
+
+// Default returns the built-in rules with no suppressions
+func Default() *Policy {
+	policy, err := parse(builtin, "builtin.yml")
+	if err == nil {
+		err = policy.validate()
+	}
+	if err != nil {
+		panic(err)
+	}
+	return policy
+}
+
+// Load reads a YAML policy file and returns the built-in rules followed by
+// the file's rules, with the file's suppressions
+func Load(path string) (*Policy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	custom, err := parse(data, path)
+	if err != nil {
+		return nil, err
+	}
+	policy := Default()
+	policy.Rules = append(policy.Rules, custom.Rules...)
+	policy.Suppressions = custom.Suppressions
+	if err := policy.validate(); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return policy, nil
+}
+
+func parse(data []byte, name string) (*Policy, error) {
+	decoder := yaml.NewDecoder(strings.NewReader(string(data)))
+	decoder.KnownFields(true)
+	policy := &Policy{}
+	if err := decoder.Decode(policy); err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return policy, nil
+}
+
+// validate reports every malformed rule and suppression
+func (p *Policy) validate() error {
+	var problems []string
+	ids := map[string]bool{}
+	for i, rule := range p.Rules {
+		name := fmt.Sprintf("rules[%d]", i)
+		switch {
+		case rule.ID == "":
+			problems = append(problems, name+": id is required")
+		case ids[rule.ID]:
+			problems = append(problems, fmt.Sprintf("%s: id %q is already used", name, rule.ID))
+		default:
+			name = fmt.Sprintf("rule %q", rule.ID)
+		}
+		ids[rule.ID] = true
+		if len(rule.ResourceTypes) == 0 {
+			problems = append(problems, name+": resource_types is empty")
+		}
+		if err := rule.Check.validate(); err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v", name, err))
+		}
+		if rule.When != nil {
+			if err := rule.When.validate(); err != nil {
+				problems = append(problems, fmt.Sprintf("%s: when: %v", name, err))
+			}
+		}
+	}
+	for i, s := range p.Suppressions {
+		name := fmt.Sprintf("suppressions[%d]", i)
+		if !ids[s.Rule] {
+			problems = append(problems, fmt.Sprintf("%s: unknown rule %q", name, s.Rule))
+		}
+		if s.Address == "" {
+			problems = append(problems, name+": address is required")
+		}
+		if strings.TrimSpace(s.Justification) == "" {
+			problems = append(problems, name+": justification is required")
+		}
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("%s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+func (c *Check) validate() error {
+	if c.Attribute == "" {
+		return fmt.Errorf("attribute is required")
+	}
+	operators := 0
+	for _, set := range []bool{c.Equals != nil, c.OneOf != nil, c.NotOneOf != nil, c.MinVersion != ""} {
+		if set {
+			operators++
+		}
+	}
+	if operators != 1 {
+		return fmt.Errorf("%s needs exactly one of equals, one_of, not_one_of and min_version", c.Attribute)
+	}
+	if c.MinVersion != "" {
+		if _, ok := parseVersion(c.MinVersion); !ok {
+			return fmt.Errorf("min_version %q is not a version", c.MinVersion)
+		}
+	}
+	return nil
+}
+
+// CheckPlan evaluates every rule against the resources plan creates or
+// updates. Values not known until apply are skipped. When dir is not empty,
+// violations are located in the configuration it holds.
+func (p *Policy) CheckPlan(plan *tfjson.Plan, dir string) (*Result, error) {
+	var locate locator
+	if dir != "" {
+		var err error
+		if locate, err = newLocator(dir); err != nil {
+			return nil, err
+		}
+	}
+
+	changes := append([]*tfjson.ResourceChange{}, plan.ResourceChanges...)
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Address < changes[j].Address })
+
+	result := &Result{}
+	used := make([]bool, len(p.Suppressions))
+	for _, rc := range changes {
+		if rc.Mode != tfjson.ManagedResourceMode || rc.Change == nil || rc.Change.Actions.Delete() {
+			continue
+		}
+		after, ok := rc.Change.After.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		for _, rule := range p.Rules {
+			if !contains(rule.ResourceTypes, rc.Type) {
+				continue
+			}
+			if rule.When != nil {
+				if message, known := rule.When.evaluate(after, rc.Change.AfterUnknown); !known || message != "" {
+					continue
+				}
+			}
+			message, known := rule.Check.evaluate(after, rc.Change.AfterUnknown)
+			if !known || message == "" {
+				continue
+			}
+
+			v := Violation{Rule: rule.ID, Address: rc.Address, Type: rc.Type, Attribute: rule.Attribute, Message: message}
+			if locate != nil {
+				v.File, v.Line = locate(planassert.StripIndexes(rc.Address), rule.Attribute)
+			}
+			if i, ok := p.suppression(v); ok {
+				used[i] = true
+				result.Suppressed = append(result.Suppressed, Suppressed{Violation: v, Justification: p.Suppressions[i].Justification})
+				continue
+			}
+			result.Violations = append(result.Violations, v)
+		}
+	}
+	for i, s := range p.Suppressions {
+		if !used[i] {
+			result.UnusedSuppressions = append(result.UnusedSuppressions, s)
+		}
+	}
+	return result, nil
+}
+
+// suppression returns the index of the suppression that accepts v
+func (p *Policy) suppression(v Violation) (int, bool) {
+	for i, s := range p.Suppressions {
+		if s.Rule == v.Rule && (s.Address == v.Address || s.Address == planassert.StripIndexes(v.Address)) {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// evaluate returns why values fail the check, or "" when they pass. It
+// reports false when the attribute is not known until apply.
+func (c *Check) evaluate(values, unknown interface{}) (string, bool) {
+	path := strings.Split(c.Attribute, ".")
+	if isUnknown(unknown, path) {
+		return "", false
+	}
+	value, ok := lookup(values, path)
+	got := "not set"
+	if ok {
+		got = fmt.Sprintf("%s = %s", c.Attribute, format(value))
+	}
+
+	switch {
+	case c.Equals != nil:
+		if ok && equal(value, c.Equals) {
+			return "", true
+		}
+		return fmt.Sprintf("%s, want %s", got, format(c.Equals)), true
+	case c.OneOf != nil:
+		for _, want := range c.OneOf {
+			if ok && equal(value, want) {
+				return "", true
+			}
+		}
+		return fmt.Sprintf("%s, want one of %s", got, formatList(c.OneOf)), true
+	case c.NotOneOf != nil:
+		for _, unwanted := range c.NotOneOf {
+			if ok && equal(value, unwanted) {
+				return fmt.Sprintf("%s, want none of %s", got, formatList(c.NotOneOf)), true
+			}
+		}
+		return "", true
+	default:
+		minimum, _ := parseVersion(c.MinVersion)
+		if s, isString := value.(string); ok && isString {
+			if version, valid := parseVersion(s); valid && compareVersions(version, minimum) >= 0 {
+				return "", true
+			}
+		}
+		return fmt.Sprintf("%s, want at least %s", got, c.MinVersion), true
+	}
+}
+
+// lookup walks path through objects and lists. A null value counts as not set.
+func lookup(value interface{}, path []string) (interface{}, bool) {
+	for _, segment := range path {
+		switch v := value.(type) {
+		case map[string]interface{}:
+			value = v[segment]
+		case []interface{}:
+			index, err := strconv.Atoi(segment)
+			if err != nil || index < 0 || index >= len(v) {
+				return nil, false
+			}
+			value = v[index]
+		default:
+			return nil, false
+		}
+	}
+	return value, value != nil
+}
+
+// isUnknown reports whether after_unknown marks path, or any object or list
+// on the way to it, as known only after apply
+func isUnknown(unknown interface{}, path []string) bool {
+	for _, segment := range path {
+		if b, ok := unknown.(bool); ok {
+			return b
+		}
+		var ok bool
+		if unknown, ok = lookup(unknown, []string{segment}); !ok {
+			return false
+		}
+	}
+	b, ok := unknown.(bool)
+	return ok && b
+}
+
+// equal compares a planned value with one from YAML, where numbers may be
+// ints and the plan's are float64
+func equal(got, want interface{}) bool {
+	switch w := want.(type) {
+	case int:
+		want = float64(w)
+	case int64:
+		want = float64(w)
+	}
+	return reflect.DeepEqual(got, want)
+}
+
+func parseVersion(s string) ([2]int, bool) {
+	m := versionPattern.FindStringSubmatch(s)
+	if m == nil {
+		return [2]int{}, false
+	}
+	major, _ := strconv.Atoi(m[1])
+	minor, _ := strconv.Atoi(m[2])
+	return [2]int{major, minor}, true
+}
+
+func compareVersions(a, b [2]int) int {
+	for i := range a {
+		if a[i] != b[i] {
+			return a[i] - b[i]
+		}
+	}
+	return 0
+}
+
+func format(value interface{}) string {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return string(data)
+}
+
+func formatList(values []interface{}) string {
+	formatted := make([]string, len(values))
+	for i, value := range values {
+		formatted[i] = format(value)
+	}
+	return strings.Join(formatted, ", ")
+}
+
+// locator returns the file and line that set attribute on the resource at
+// address, or 0 when the resource is not in the configuration
+type locator func(address, attribute string) (string, int)
+
+func newLocator(dir string) (locator, error) {
+	instances, err := tfconfig.LoadTree(dir)
+	if err != nil {
+		return nil, err
+	}
+	byPath := map[string]*tfconfig.Instance{}
+	resources := map[string]*tfconfig.Resource{}
+	owners := map[string]*tfconfig.Instance{}
+	for _, inst := range instances {
+		byPath[inst.Path] = inst
+		for _, r := range inst.Module.Resources {
+			resources[inst.Address(r)] = r
+			owners[inst.Address(r)] = inst
+		}
+	}
+
+	return func(address, attribute string) (string, int) {
+		r, ok := resources[address]
+		if !ok {
+			return "", 0
+		}
+		rng, expr := find(r, strings.Split(attribute, "."))
+		for inst := owners[address]; expr != nil; {
+			name, ok := variableName(expr)
+			if !ok || inst.Path == "" {
+				break
+			}
+			// The module block that passes the variable is in the parent
+			cut := strings.LastIndex(inst.Path, "module.")
+			parent := byPath[strings.TrimSuffix(inst.Path[:cut], ".")]
+			call := moduleCall(parent, inst.Path[cut+len("module."):])
+			if call == nil {
+				break
+			}
+			attr, ok := call.Body.Attributes[name]
+			if !ok {
+				break
+			}
+			rng, expr, inst = attr.SrcRange, attr.Expr, parent
+		}
+		return rng.Filename, rng.Start.Line
+	}, nil
+}
+
+// find returns the range of the argument or nested block that sets path in
+// r, and the argument's expression. It falls back to the closest enclosing
+// block when path is not set in the configuration.
+func find(r *tfconfig.Resource, path []string) (hcl.Range, hclsyntax.Expression) {
+	body, rng := r.Body, r.Range
+	for i := 0; i < len(path); i++ {
+		if attr, ok := body.Attributes[path[i]]; ok {
+			return attr.SrcRange, attr.Expr
+		}
+		blocks := tfconfig.Blocks(body, path[i])
+		index := 0
+		if i+1 < len(path) {
+			if n, err := strconv.Atoi(path[i+1]); err == nil {
+				index = n
+				i++
+			}
+		}
+		if index >= len(blocks) {
+			break
+		}
+		body, rng = blocks[index].Body, blocks[index].Range()
+	}
+	return rng, nil
+}
+
+// variableName returns the variable expr is, when it is nothing but var.name
+func variableName(expr hclsyntax.Expression) (string, bool) {
+	traversal, ok := expr.(*hclsyntax.ScopeTraversalExpr)
+	if !ok || len(traversal.Traversal) != 2 || traversal.Traversal.RootName() != "var" {
+		return "", false
+	}
+	attr, ok := traversal.Traversal[1].(hcl.TraverseAttr)
+	if !ok {
+		return "", false
+	}
+	return attr.Name, true
+}
+
+func moduleCall(inst *tfconfig.Instance, name string) *tfconfig.ModuleCall {
+	if inst == nil {
+		return nil
+	}
+	for _, call := range inst.Module.ModuleCalls {
+		if call.Name == name {
+			return call
+		}
+	}
+	return nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
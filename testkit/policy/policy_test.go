@@ -0,0 +1,148 @@
+package policy
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	tfjson "github.com/hashicorp/terraform-json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func loadTestPlan(t *testing.T) *tfjson.Plan {
+	data, err := os.ReadFile("testdata/plan.json")
+	require.NoError(t, err)
+	plan := &tfjson.Plan{}
+	require.NoError(t, json.Unmarshal(data, plan))
+	return plan
+}
+
+func TestDefault(t *testing.T) {
+	t.Parallel()
+
+	var ids []string
+	for _, rule := range Default().Rules {
+		ids = append(ids, rule.ID)
+	}
+	assert.Equal(t, []string{
+		"public-network-access",
+		"sql-minimum-tls-version",
+		"storage-minimum-tls-version",
+		"function-app-minimum-tls-version",
+		"key-vault-default-deny",
+		"key-vault-purge-protection",
+	}, ids)
+}
+
+func TestLoad(t *testing.T) {
+	t.Parallel()
+
+	policy, err := Load("testdata/policy.yml")
+	require.NoError(t, err)
+	assert.Len(t, policy.Rules, len(Default().Rules)+1)
+	assert.Equal(t, "storage-https-only", policy.Rules[len(policy.Rules)-1].ID)
+	assert.Len(t, policy.Suppressions, 2)
+
+	_, err = Load("testdata/missing.yml")
+	assert.Error(t, err)
+
+	tests := []struct {
+		name    string
+		yaml    string
+		wantErr string
+	}{
+		{"UnknownField", "rules:\n  - id: x\n    resource_types: [a]\n    attribute: b\n    equal: true\n", "field equal not found"},
+		{"NoOperator", "rules:\n  - id: x\n    resource_types: [a]\n    attribute: b\n", `rule "x": b needs exactly one of equals, one_of, not_one_of and min_version`},
+		{"TwoOperators", "rules:\n  - id: x\n    resource_types: [a]\n    attribute: b\n    equals: 1\n    one_of: [1]\n", "needs exactly one of"},
+		{"BadVersion", "rules:\n  - id: x\n    resource_types: [a]\n    attribute: b\n    min_version: latest\n", `min_version "latest" is not a version`},
+		{"NoTypes", "rules:\n  - id: x\n    attribute: b\n    equals: true\n", `rule "x": resource_types is empty`},
+		{"BuiltinID", "rules:\n  - id: public-network-access\n    resource_types: [a]\n    attribute: b\n    equals: true\n", `rules[6]: id "public-network-access" is already used`},
+		{"UnknownRule", "suppressions:\n  - rule: typo\n    address: a.b\n    justification: because\n", `suppressions[0]: unknown rule "typo"`},
+		{"NoJustification", "suppressions:\n  - rule: public-network-access\n    address: a.b\n", "suppressions[0]: justification is required"},
+	}
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			path := filepath.Join(t.TempDir(), "policy.yml")
+			require.NoError(t, os.WriteFile(path, []byte(tc.yaml), 0o644))
+			_, err := Load(path)
+			assert.ErrorContains(t, err, tc.wantErr)
+		})
+	}
+}
+
+func TestCheckPlan(t *testing.T) {
+	t.Parallel()
+
+	policy, err := Load("testdata/policy.yml")
+	require.NoError(t, err)
+	result, err := policy.CheckPlan(loadTestPlan(t), "testdata/stack")
+	require.NoError(t, err)
+
+	var got []string
+	for _, v := range result.Violations {
+		got = append(got, v.String())
+	}
+	assert.Equal(t, []string{
+		`testdata/stack/main.tf:13: azurerm_key_vault.kv: key-vault-default-deny: network_acls.0.default_action = "Allow", want "Deny"`,
+		`testdata/stack/main.tf:7: azurerm_key_vault.kv: key-vault-purge-protection: purge_protection_enabled = false, want true`,
+		`testdata/stack/main.tf:3: azurerm_storage_account.public: storage-minimum-tls-version: min_tls_version = "TLS1_0", want at least 1.2`,
+		`testdata/stack/main.tf:1: azurerm_storage_account.public: storage-https-only: enable_https_traffic_only = false, want true`,
+		`testdata/stack/main.tf:43: module.ai.azurerm_cognitive_account.ai: public-network-access: public_network_access_enabled = true, want false`,
+	}, got, "the unknown SQL TLS version, the deleted server and the development vault should pass")
+
+	require.Len(t, result.Suppressed, 1)
+	assert.Equal(t, "azurerm_storage_account.public", result.Suppressed[0].Address)
+	assert.Equal(t, "Serves public static content", result.Suppressed[0].Justification)
+	assert.Equal(t, []Suppression{{
+		Rule: "public-network-access", Address: "azurerm_key_vault.dev", Justification: "Stale, the vault is private now",
+	}}, result.UnusedSuppressions)
+
+	result, err = Default().CheckPlan(loadTestPlan(t), "")
+	require.NoError(t, err)
+	require.Len(t, result.Violations, 5)
+	assert.Equal(t, "azurerm_storage_account.public: public-network-access: public_network_access_enabled = true, want false", result.Violations[2].String())
+}
+
+func TestCheck(t *testing.T) {
+	t.Parallel()
+
+	values := map[string]interface{}{
+		"min_tls_version": "TLS1_3",
+		"tls":             "1.1",
+		"count":           float64(2),
+		"tags":            map[string]interface{}{"environment": "dev"},
+		"acls":            []interface{}{map[string]interface{}{"action": nil}},
+	}
+	unknown := map[string]interface{}{"pending": true, "acls": []interface{}{true}}
+	tests := []struct {
+		name    string
+		check   Check
+		want    string
+		unknown bool
+	}{
+		{"TLS13", Check{Attribute: "min_tls_version", MinVersion: "1.2"}, "", false},
+		{"TLS11", Check{Attribute: "tls", MinVersion: "1.2"}, `tls = "1.1", want at least 1.2`, false},
+		{"Integer", Check{Attribute: "count", Equals: 2}, "", false},
+		{"OneOf", Check{Attribute: "tags.environment", OneOf: []interface{}{"development", "production"}}, `tags.environment = "dev", want one of "development", "production"`, false},
+		{"NotOneOf", Check{Attribute: "tags.environment", NotOneOf: []interface{}{"dev"}}, `tags.environment = "dev", want none of "dev"`, false},
+		{"NotOneOfMissing", Check{Attribute: "tags.owner", NotOneOf: []interface{}{"dev"}}, "", false},
+		{"Missing", Check{Attribute: "tags.owner", Equals: "platform"}, `not set, want "platform"`, false},
+		{"Unknown", Check{Attribute: "pending", Equals: true}, "", true},
+		{"UnknownParent", Check{Attribute: "acls.0.action", Equals: "Deny"}, "", true},
+	}
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			message, known := tc.check.evaluate(values, unknown)
+			assert.Equal(t, tc.want, message)
+			assert.Equal(t, !tc.unknown, known)
+		})
+	}
+}
@@ -0,0 +1,44 @@
+resource "azurerm_storage_account" "public" {
+  name                          = "stpublic"
+  min_tls_version               = "TLS1_0"
+  public_network_access_enabled = true
+}
+
+resource "azurerm_key_vault" "kv" {
+  name                          = "kv-prod"
+  public_network_access_enabled = false
+
+  network_acls {
+    bypass         = "AzureServices"
+    default_action = "Allow"
+  }
+
+  tags = {
+    environment = "production"
+  }
+}
+
+resource "azurerm_key_vault" "dev" {
+  name                          = "kv-dev"
+  public_network_access_enabled = false
+
+  network_acls {
+    bypass         = "AzureServices"
+    default_action = "Deny"
+  }
+
+  tags = {
+    environment = "development"
+  }
+}
+
+resource "azurerm_mssql_server" "sql" {
+  name                          = "sql"
+  public_network_access_enabled = false
+}
+
+module "ai" {
+  source = "./modules/ai"
+
+  public_network_access_enabled = true
+}
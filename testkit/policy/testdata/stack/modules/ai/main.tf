@@ -0,0 +1,10 @@
+variable "public_network_access_enabled" {
+  type    = bool
+  default = false
+}
+
+resource "azurerm_cognitive_account" "ai" {
+  name                          = "ai"
+  kind                          = "OpenAI"
+  public_network_access_enabled = var.public_network_access_enabled
+}
@@ -0,0 +1,541 @@
+// Package privatedns checks the private DNS the modules create for their
+// private endpoints: that each zone is the privatelink zone Azure expects for
+// the endpoint's subresource, that each A record holds the address of the
+// endpoint's network interface and that each zone is linked to the stack's
+// virtual network. The checks read a `terraform show -json` plan, where they
+// follow the configuration's references because the addresses are not known
+// until apply, or a state, and can resolve the records through a Resolver.
+package privatedns
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	tfjson "github.com/hashicorp/terraform-json"
+	"github.com/stretchr/testify/require"
+
+	"github.com/vanehru/terraform-modules/testkit/arm"
+	"github.com/vanehru/terraform-modules/testkit/planassert"
+)
+
+// Zones maps the private endpoint subresources the modules connect to the
+// private DNS zone Azure resolves them through. account is an Azure OpenAI
+// account; other Cognitive Services kinds use
+// privatelink.cognitiveservices.azure.com.
+var Zones = map[string]string{
+	"account":   "privatelink.openai.azure.com",
+	"blob":      "privatelink.blob.core.windows.net",
+	"file":      "privatelink.file.core.windows.net",
+	"queue":     "privatelink.queue.core.windows.net",
+	"sites":     "privatelink.azurewebsites.net",
+	"sqlServer": "privatelink.database.windows.net",
+	"table":     "privatelink.table.core.windows.net",
+	"vault":     "privatelink.vaultcore.azure.net",
+}
+
+// endpointAddress matches a reference to the address of a private
+// endpoint's network interface, capturing the endpoint
+var endpointAddress = regexp.MustCompile(`^(azurerm_private_endpoint\.[\w-]+(?:\[[^\]]+\])?)\.private_service_connection\[0\]\.private_ip_address$`)
+
+// networkID matches a reference to the ID of a virtual network, capturing
+// the network
+var networkID = regexp.MustCompile(`^((?:data\.)?azurerm_virtual_network\.[\w-]+(?:\[[^\]]+\])?)\.id$`)
+
+// DNS is the private endpoints and private DNS zones of a plan or state
+type DNS struct {
+	Endpoints []Endpoint
+	Zones     []Zone
+	// VirtualNetworks maps the address of each virtual network to its ID,
+	// which is empty until it is applied
+	VirtualNetworks map[string]string
+
+	// configured is set when the references in the configuration are known
+	configured bool
+}
+
+// Endpoint is a private endpoint
+type Endpoint struct {
+	Address string
+	// Module is the address of the module the endpoint is in, empty for the
+	// root module
+	Module      string
+	Subresource string
+	// IP is the private address of the endpoint's network interface, empty
+	// until apply
+	IP string
+}
+
+// Zone is a private DNS zone with its A records and virtual network links
+type Zone struct {
+	Address       string
+	Module        string
+	Name          string
+	ResourceGroup string
+	Records       []Record
+	Links         []Link
+}
+
+// Record is an A record in a private DNS zone
+type Record struct {
+	Address string
+	Name    string
+	// IPs are empty until apply
+	IPs []string
+	// Endpoints are the private endpoints the configuration takes the
+	// record's addresses from, when read from a plan
+	Endpoints []string
+}
+
+// Link links a private DNS zone to a virtual network
+type Link struct {
+	Address string
+	// VirtualNetworkID is empty until apply
+	VirtualNetworkID string
+	// VirtualNetworks are the virtual networks the configuration links,
+	// followed through module variables, when read from a plan
+	VirtualNetworks []string
+}
+
+// Violation is a private DNS zone or record that would not resolve its
+// endpoint's name to the endpoint's address
+type Violation struct {
+	Address string
+	Message string
+}
+
+func (v Violation) String() string {
+	return fmt.Sprintf("%s: %s", v.Address, v.Message)
+}
+
+// FromPlan reads the planned private endpoints and private DNS, and the
+// references between them in the plan's configuration
+func FromPlan(plan *tfjson.Plan) (*DNS, error) {
+	if plan.PlannedValues == nil || plan.PlannedValues.RootModule == nil {
+		return nil, errors.New("privatedns: the plan has no planned values")
+	}
+	var config *configuration
+	if plan.Config != nil && plan.Config.RootModule != nil {
+		config = &configuration{resources: map[string]map[string]*tfjson.Expression{}, variables: map[string]*tfjson.Expression{}}
+		config.index(plan.Config.RootModule, "")
+	}
+	return build(plan.PlannedValues.RootModule, config), nil
+}
+
+// FromState reads the private endpoints and private DNS of an applied
+// configuration, whose addresses are all known
+func FromState(state *tfjson.State) (*DNS, error) {
+	if state.Values == nil || state.Values.RootModule == nil {
+		return nil, errors.New("privatedns: the state is empty")
+	}
+	return build(state.Values.RootModule, nil), nil
+}
+
+// Load reads the state of the configuration terraformOptions applied
+func Load(t *testing.T, terraformOptions *terraform.Options) *DNS {
+	var state tfjson.State
+	require.NoError(t, json.Unmarshal([]byte(terraform.Show(t, terraformOptions)), &state))
+	dns, err := FromState(&state)
+	require.NoError(t, err)
+	return dns
+}
+
+// pending is an A record or link waiting for its zone
+type pending struct {
+	module, zone, resourceGroup string
+	record                      *Record
+	link                        *Link
+}
+
+// build collects the resources of module and its children
+func build(root *tfjson.StateModule, config *configuration) *DNS {
+	dns := &DNS{VirtualNetworks: map[string]string{}, configured: config != nil}
+	var waiting []pending
+	var walk func(module *tfjson.StateModule)
+	walk = func(module *tfjson.StateModule) {
+		for _, r := range module.Resources {
+			values := r.AttributeValues
+			switch r.Type {
+			case "azurerm_virtual_network":
+				dns.VirtualNetworks[r.Address] = str(values, "id")
+			case "azurerm_private_endpoint":
+				dns.Endpoints = append(dns.Endpoints, Endpoint{
+					Address:     r.Address,
+					Module:      module.Address,
+					Subresource: str(values, "private_service_connection.0.subresource_names.0"),
+					IP:          str(values, "private_service_connection.0.private_ip_address"),
+				})
+			case "azurerm_private_dns_zone":
+				dns.Zones = append(dns.Zones, Zone{
+					Address: r.Address, Module: module.Address,
+					Name: str(values, "name"), ResourceGroup: str(values, "resource_group_name"),
+				})
+			case "azurerm_private_dns_a_record":
+				record := &Record{Address: r.Address, Name: str(values, "name"), IPs: strs(values, "records")}
+				if config != nil {
+					record.Endpoints = config.follow(module.Address, config.expression(module.Address, r, "records"), endpointAddress)
+				}
+				waiting = append(waiting, pending{module.Address, str(values, "zone_name"), str(values, "resource_group_name"), record, nil})
+			case "azurerm_private_dns_zone_virtual_network_link":
+				link := &Link{Address: r.Address, VirtualNetworkID: str(values, "virtual_network_id")}
+				if config != nil {
+					link.VirtualNetworks = config.follow(module.Address, config.expression(module.Address, r, "virtual_network_id"), networkID)
+				}
+				waiting = append(waiting, pending{module.Address, str(values, "private_dns_zone_name"), str(values, "resource_group_name"), nil, link})
+			}
+		}
+		for _, child := range module.ChildModules {
+			walk(child)
+		}
+	}
+	walk(root)
+
+	sort.Slice(dns.Endpoints, func(i, j int) bool { return dns.Endpoints[i].Address < dns.Endpoints[j].Address })
+	sort.Slice(dns.Zones, func(i, j int) bool { return dns.Zones[i].Address < dns.Zones[j].Address })
+	for _, p := range waiting {
+		zone := dns.zone(p.module, p.zone, p.resourceGroup)
+		switch {
+		case zone == nil:
+			// A zone outside the configuration is not checked
+		case p.record != nil:
+			zone.Records = append(zone.Records, *p.record)
+		default:
+			zone.Links = append(zone.Links, *p.link)
+		}
+	}
+	return dns
+}
+
+// zone returns the zone a record or link in module names, preferring one in
+// the same module since the resource group may not be known yet
+func (d *DNS) zone(module, name, resourceGroup string) *Zone {
+	var found *Zone
+	for i := range d.Zones {
+		zone := &d.Zones[i]
+		if zone.Name != name || zone.ResourceGroup != resourceGroup {
+			continue
+		}
+		if zone.Module == module {
+			return zone
+		}
+		if found == nil {
+			found = zone
+		}
+	}
+	return found
+}
+
+// endpoint returns the private endpoint at address
+func (d *DNS) endpoint(address string) (Endpoint, bool) {
+	for _, endpoint := range d.Endpoints {
+		if endpoint.Address == address {
+			return endpoint, true
+		}
+	}
+	return Endpoint{}, false
+}
+
+// served returns the private endpoints in the zone's module that resolve
+// through it
+func (d *DNS) served(zone Zone) []Endpoint {
+	var endpoints []Endpoint
+	for _, endpoint := range d.Endpoints {
+		if endpoint.Module == zone.Module && Zones[endpoint.Subresource] == zone.Name {
+			endpoints = append(endpoints, endpoint)
+		}
+	}
+	return endpoints
+}
+
+// recordEndpoints returns the private endpoints a record should hold the
+// address of: those the configuration takes its addresses from, or else those
+// its zone serves
+func (d *DNS) recordEndpoints(zone Zone, record Record) []Endpoint {
+	if len(record.Endpoints) == 0 {
+		return d.served(zone)
+	}
+	var endpoints []Endpoint
+	for _, address := range record.Endpoints {
+		if endpoint, ok := d.endpoint(address); ok && Zones[endpoint.Subresource] == zone.Name {
+			endpoints = append(endpoints, endpoint)
+		}
+	}
+	return endpoints
+}
+
+// Check reports private DNS zones that are not the zone Azure expects for a
+// private endpoint in their module, A records that do not hold the address of
+// the endpoint's network interface, and zones not linked to vnet. vnet is the
+// address of a virtual network in the configuration, such as
+// azurerm_virtual_network.vnet, or the resource ID of one deployed separately,
+// as a fixture.Network is.
+func (d *DNS) Check(vnet string) []Violation {
+	var violations []Violation
+	add := func(address, format string, args ...interface{}) {
+		violations = append(violations, Violation{Address: address, Message: fmt.Sprintf(format, args...)})
+	}
+
+	vnetID := vnet
+	if !strings.HasPrefix(vnet, "/") {
+		id, ok := d.VirtualNetworks[vnet]
+		if !ok {
+			add(vnet, "virtual network not found")
+		}
+		vnetID = id
+	}
+
+	for _, zone := range d.Zones {
+		served := d.served(zone)
+		switch {
+		case !isPrivateLinkZone(zone.Name):
+			add(zone.Address, "%s is not a private link zone", zone.Name)
+		case len(served) == 0:
+			add(zone.Address, "%s serves no private endpoint in %s%s", zone.Name, moduleName(zone.Module), d.needed(zone.Module))
+		}
+
+		if len(zone.Records) == 0 {
+			add(zone.Address, "%s has no A record", zone.Name)
+		}
+		for _, record := range zone.Records {
+			for _, address := range record.Endpoints {
+				endpoint, ok := d.endpoint(address)
+				if !ok {
+					add(record.Address, "takes its address from %s, which is not in the plan", address)
+				} else if Zones[endpoint.Subresource] != zone.Name {
+					add(record.Address, "takes its address from %s, whose %s subresource resolves through %s, not %s",
+						address, endpoint.Subresource, Zones[endpoint.Subresource], zone.Name)
+				}
+			}
+			if d.configured && len(record.Endpoints) == 0 {
+				add(record.Address, "records does not reference a private endpoint's private_service_connection[0].private_ip_address")
+			}
+			if want := addresses(d.recordEndpoints(zone, record)); len(record.IPs) > 0 && len(want) > 0 && !sameSet(record.IPs, want) {
+				add(record.Address, "holds %s, not %s, the address of the private endpoint's network interface",
+					strings.Join(record.IPs, ", "), strings.Join(want, ", "))
+			}
+		}
+
+		linked := false
+		for _, link := range zone.Links {
+			if vnetID != "" && strings.EqualFold(link.VirtualNetworkID, vnetID) || contains(link.VirtualNetworks, vnet) {
+				linked = true
+			}
+		}
+		if !linked {
+			add(zone.Address, "%s is not linked to %s", zone.Name, vnet)
+		}
+	}
+	return violations
+}
+
+// needed names the zones the private endpoints in module need
+func (d *DNS) needed(module string) string {
+	var zones []string
+	for _, endpoint := range d.Endpoints {
+		if endpoint.Module == module && Zones[endpoint.Subresource] != "" && !contains(zones, Zones[endpoint.Subresource]) {
+			zones = append(zones, Zones[endpoint.Subresource])
+		}
+	}
+	if len(zones) == 0 {
+		return ""
+	}
+	return ", which needs " + strings.Join(zones, " and ")
+}
+
+// Lookup is the name of an A record and the address of the private endpoint
+// it should resolve to inside a linked virtual network
+type Lookup struct {
+	Endpoint string
+	Host     string
+	IP       string
+}
+
+// Lookups returns the name of every A record, in its zone, with the address
+// of each private endpoint it should resolve to, for the endpoints whose
+// addresses are known
+func (d *DNS) Lookups() []Lookup {
+	var lookups []Lookup
+	for _, zone := range d.Zones {
+		for _, record := range zone.Records {
+			for _, endpoint := range d.recordEndpoints(zone, record) {
+				if endpoint.IP != "" {
+					lookups = append(lookups, Lookup{Endpoint: endpoint.Address, Host: record.Name + "." + zone.Name, IP: endpoint.IP})
+				}
+			}
+		}
+	}
+	return lookups
+}
+
+// Validate fails t for each violation Check finds in dns, then, if resolver
+// is not nil, for each A record that does not resolve to its private
+// endpoint's address. dns must have at least one private DNS zone.
+func Validate(t *testing.T, dns *DNS, vnet string, resolver Resolver) {
+	require.NotEmpty(t, dns.Zones, "There should be a private DNS zone")
+	for _, v := range dns.Check(vnet) {
+		t.Error(v)
+	}
+	if resolver == nil {
+		return
+	}
+	lookups := dns.Lookups()
+	require.NotEmpty(t, lookups, "A private endpoint address should be known")
+	for _, v := range Resolve(context.Background(), resolver, lookups) {
+		t.Error(v)
+	}
+}
+
+// ValidateApplied checks the private DNS zones in the state of the
+// configuration terraformOptions applied against the virtual network
+// virtualNetworkID, and resolves their records as Azure DNS would in that
+// network, from the zones in resourceGroupName that client reads
+func ValidateApplied(t *testing.T, terraformOptions *terraform.Options, client *arm.Client, resourceGroupName, virtualNetworkID string) {
+	Validate(t, Load(t, terraformOptions), virtualNetworkID,
+		&ARMResolver{Client: client, ResourceGroup: resourceGroupName, VirtualNetworkID: virtualNetworkID})
+}
+
+// configuration indexes the expressions in a plan's configuration by module
+// path, the module address without instance keys
+type configuration struct {
+	// resources maps a resource address in a module path, such as
+	// module.key_vault.azurerm_private_dns_a_record.kv_dns_a_record, to its
+	// expressions
+	resources map[string]map[string]*tfjson.Expression
+	// variables maps a variable in a module path, such as
+	// module.key_vault.var.virtual_network_id, to what its module call passes
+	variables map[string]*tfjson.Expression
+}
+
+func (c *configuration) index(module *tfjson.ConfigModule, path string) {
+	for _, r := range module.Resources {
+		c.resources[join(path, r.Address)] = r.Expressions
+	}
+	for name, call := range module.ModuleCalls {
+		child := join(path, "module."+name)
+		for variable, expression := range call.Expressions {
+			c.variables[join(child, "var."+variable)] = expression
+		}
+		if call.Module != nil {
+			c.index(call.Module, child)
+		}
+	}
+}
+
+// expression returns the configuration of a managed resource's attribute
+func (c *configuration) expression(module string, r *tfjson.StateResource, attribute string) *tfjson.Expression {
+	return c.resources[join(planassert.StripIndexes(module), r.Type+"."+r.Name)][attribute]
+}
+
+// follow returns the resources an expression in module refers to through
+// pattern, following module variables up to where they are set
+func (c *configuration) follow(module string, expression *tfjson.Expression, pattern *regexp.Regexp) []string {
+	if expression == nil || expression.ExpressionData == nil {
+		return nil
+	}
+	var found []string
+	for _, reference := range expression.References {
+		if strings.HasPrefix(reference, "var.") && !strings.Contains(reference[len("var."):], ".") {
+			if module != "" {
+				passed := c.variables[join(planassert.StripIndexes(module), reference)]
+				for _, address := range c.follow(parent(module), passed, pattern) {
+					if !contains(found, address) {
+						found = append(found, address)
+					}
+				}
+			}
+			continue
+		}
+		if m := pattern.FindStringSubmatch(reference); m != nil && !contains(found, join(module, m[1])) {
+			found = append(found, join(module, m[1]))
+		}
+	}
+	return found
+}
+
+// parent returns the address of the module that calls module
+func parent(module string) string {
+	if i := strings.LastIndex(module, ".module."); i >= 0 {
+		return module[:i]
+	}
+	return ""
+}
+
+func join(module, address string) string {
+	if module == "" {
+		return address
+	}
+	if address == "" {
+		return module
+	}
+	return module + "." + address
+}
+
+func moduleName(module string) string {
+	if module == "" {
+		return "the root module"
+	}
+	return module
+}
+
+func isPrivateLinkZone(name string) bool {
+	return strings.HasPrefix(name, "privatelink.")
+}
+
+// str returns the string at path in values, or "" if it is unknown
+func str(values map[string]interface{}, path string) string {
+	value, _ := planassert.Lookup(values, path)
+	s, _ := value.(string)
+	return s
+}
+
+// strs returns the strings in the list at path in values
+func strs(values map[string]interface{}, path string) []string {
+	value, _ := planassert.Lookup(values, path)
+	list, _ := value.([]interface{})
+	var out []string
+	for _, item := range list {
+		if s, ok := item.(string); ok {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+func addresses(endpoints []Endpoint) []string {
+	var ips []string
+	for _, endpoint := range endpoints {
+		if endpoint.IP != "" && !contains(ips, endpoint.IP) {
+			ips = append(ips, endpoint.IP)
+		}
+	}
+	return ips
+}
+
+func sameSet(a, b []string) bool {
+	for _, s := range a {
+		if !contains(b, s) {
+			return false
+		}
+	}
+	for _, s := range b {
+		if !contains(a, s) {
+			return false
+		}
+	}
+	return true
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,144 @@
+package privatedns
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"os"
+	"testing"
+
+	tfjson "github.com/hashicorp/terraform-json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/vanehru/terraform-modules/testkit/arm"
+	"github.com/vanehru/terraform-modules/testkit/armtest"
+)
+
+const vnetID = "/subscriptions/sub/resourceGroups/test-rg/providers/Microsoft.Network/virtualNetworks/vnet"
+
+func load(t *testing.T, path string, v interface{}) {
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(data, v))
+}
+
+func messages(violations []Violation) []string {
+	var out []string
+	for _, v := range violations {
+		out = append(out, v.String())
+	}
+	return out
+}
+
+func TestFromPlan(t *testing.T) {
+	t.Parallel()
+
+	plan := &tfjson.Plan{}
+	load(t, "testdata/plan.json", plan)
+	dns, err := FromPlan(plan)
+	require.NoError(t, err)
+
+	require.Len(t, dns.Zones, 3)
+	kv := dns.Zones[0]
+	assert.Equal(t, "module.key_vault.azurerm_private_dns_zone.dns[0]", kv.Address)
+	require.Len(t, kv.Records, 1)
+	assert.Equal(t, []string{"module.key_vault.azurerm_private_endpoint.endpoint[0]"}, kv.Records[0].Endpoints)
+	assert.Empty(t, kv.Records[0].IPs, "the address is not known until apply")
+	require.Len(t, kv.Links, 1)
+	assert.Equal(t, []string{"azurerm_virtual_network.vnet"}, kv.Links[0].VirtualNetworks,
+		"the link should be followed through the module's variable to main.tf")
+	assert.Empty(t, dns.Lookups())
+
+	assert.Equal(t, []string{
+		"module.openai.azurerm_private_dns_zone.dns[0]: privatelink.openai.azure.com has no A record",
+		"module.sql_database.azurerm_private_dns_zone.dns[0]: privatelink.database.azure.net serves no private endpoint in module.sql_database, which needs privatelink.database.windows.net",
+		"module.sql_database.azurerm_private_dns_a_record.dns_a_record[0]: records does not reference a private endpoint's private_service_connection[0].private_ip_address",
+		"module.sql_database.azurerm_private_dns_zone.dns[0]: privatelink.database.azure.net is not linked to azurerm_virtual_network.vnet",
+	}, messages(dns.Check("azurerm_virtual_network.vnet")))
+
+	assert.Equal(t, []string{"azurerm_virtual_network.missing: virtual network not found"},
+		messages(dns.Check("azurerm_virtual_network.missing"))[:1])
+}
+
+func TestFromState(t *testing.T) {
+	t.Parallel()
+
+	state := &tfjson.State{}
+	load(t, "testdata/state.json", state)
+	dns, err := FromState(state)
+	require.NoError(t, err)
+
+	assert.Equal(t, vnetID, dns.VirtualNetworks["azurerm_virtual_network.vnet"])
+	assert.Equal(t, []string{
+		"module.sql_database.azurerm_private_dns_a_record.dns_a_record[0]: holds 10.0.3.5, not 10.0.3.4, the address of the private endpoint's network interface",
+	}, messages(dns.Check("azurerm_virtual_network.vnet")))
+	assert.Equal(t, dns.Check("azurerm_virtual_network.vnet"), dns.Check(vnetID), "a network deployed separately is named by its ID")
+	assert.Len(t, dns.Check("azurerm_virtual_network.other"), 3, "neither zone is linked to the other network")
+
+	assert.Equal(t, []Lookup{
+		{Endpoint: "module.key_vault.azurerm_private_endpoint.endpoint[0]", Host: "testkv.privatelink.vaultcore.azure.net", IP: "10.0.2.4"},
+		{Endpoint: "module.sql_database.azurerm_private_endpoint.endpoint[0]", Host: "testsql.privatelink.database.windows.net", IP: "10.0.3.4"},
+	}, dns.Lookups())
+}
+
+func TestResolve(t *testing.T) {
+	t.Parallel()
+
+	state := &tfjson.State{}
+	load(t, "testdata/state.json", state)
+	dns, err := FromState(state)
+	require.NoError(t, err)
+
+	resolver := MapResolver{
+		"TestKV.privatelink.vaultcore.azure.net.":  {"10.0.2.4"},
+		"testsql.privatelink.database.windows.net": {"10.0.3.5"},
+	}
+	assert.Equal(t, []string{
+		"module.sql_database.azurerm_private_endpoint.endpoint[0]: testsql.privatelink.database.windows.net resolves to 10.0.3.5, not 10.0.3.4, the address of its network interface",
+	}, messages(Resolve(context.Background(), resolver, dns.Lookups())))
+
+	delete(resolver, "testsql.privatelink.database.windows.net")
+	violations := Resolve(context.Background(), resolver, dns.Lookups())
+	require.Len(t, violations, 1)
+	assert.Contains(t, violations[0].Message, "testsql.privatelink.database.windows.net does not resolve")
+}
+
+func TestARMResolver(t *testing.T) {
+	t.Parallel()
+
+	server := armtest.NewServer(t)
+	group := "/subscriptions/" + armtest.SubscriptionID + "/resourceGroups/test-rg"
+	network := group + "/providers/Microsoft.Network/virtualNetworks/vnet"
+	put := func(id string, properties map[string]interface{}) {
+		require.NoError(t, server.Put(id, map[string]interface{}{"location": "global", "properties": properties}))
+	}
+	put(group, nil)
+	zone := group + "/providers/Microsoft.Network/privateDnsZones/privatelink.vaultcore.azure.net"
+	put(zone, nil)
+	put(zone+"/virtualNetworkLinks/link", map[string]interface{}{"virtualNetwork": map[string]interface{}{"id": network}})
+	put(zone+"/A/testkv", map[string]interface{}{"ttl": 300, "aRecords": []interface{}{map[string]interface{}{"ipv4Address": "10.0.2.4"}}})
+	unlinked := group + "/providers/Microsoft.Network/privateDnsZones/privatelink.database.windows.net"
+	put(unlinked, nil)
+	put(unlinked+"/A/testsql", map[string]interface{}{"ttl": 300, "aRecords": []interface{}{map[string]interface{}{"ipv4Address": "10.0.3.4"}}})
+
+	client := arm.NewClient(server.URL, armtest.SubscriptionID, func(ctx context.Context) (string, error) {
+		return server.Token(), nil
+	})
+	client.HTTPClient = server.Client()
+	resolver := &ARMResolver{Client: client, ResourceGroup: "test-rg", VirtualNetworkID: network}
+	ctx := context.Background()
+
+	addrs, err := resolver.LookupHost(ctx, "TestKV.privatelink.vaultcore.azure.net.")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"10.0.2.4"}, addrs)
+
+	var dnsErr *net.DNSError
+	_, err = resolver.LookupHost(ctx, "missing.privatelink.vaultcore.azure.net")
+	require.ErrorAs(t, err, &dnsErr)
+	assert.True(t, dnsErr.IsNotFound)
+
+	_, err = resolver.LookupHost(ctx, "testsql.privatelink.database.windows.net")
+	require.ErrorAs(t, err, &dnsErr)
+	assert.Contains(t, dnsErr.Err, "linked to "+network, "a zone the network is not linked to should not answer")
+}
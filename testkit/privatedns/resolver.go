@@ -0,0 +1,149 @@
+package privatedns
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+
+	"github.com/vanehru/terraform-modules/testkit/arm"
+)
+
+// APIVersion is the Microsoft.Network/privateDnsZones API version ARMResolver
+// reads with
+const APIVersion = "2020-06-01"
+
+// Resolver looks up a host name as a client in the virtual network would. A
+// *net.Resolver on a machine in the network, such as the deployment VM, is
+// one; MapResolver and ARMResolver answer without being in it.
+type Resolver interface {
+	LookupHost(ctx context.Context, host string) ([]string, error)
+}
+
+// MapResolver is an in-memory Resolver for offline tests, mapping host names
+// to their addresses
+type MapResolver map[string][]string
+
+// LookupHost returns the addresses of host, ignoring case and a trailing dot
+func (m MapResolver) LookupHost(ctx context.Context, host string) ([]string, error) {
+	for name, addrs := range m {
+		if canonical(name) == canonical(host) {
+			return addrs, nil
+		}
+	}
+	return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+}
+
+// ARMResolver answers as Azure DNS does inside a virtual network, from the A
+// records of the private DNS zones in a resource group that are linked to
+// the network. It reads them through Resource Manager, so it works from a
+// runner outside the network, and against armtest.
+type ARMResolver struct {
+	Client           *arm.Client
+	ResourceGroup    string
+	VirtualNetworkID string
+}
+
+// errNoZone is a zone that does not exist or is not linked to the network
+var errNoZone = errors.New("no linked zone")
+
+// LookupHost returns the addresses of host from the longest zone that holds
+// it and is linked to the network
+func (r *ARMResolver) LookupHost(ctx context.Context, host string) ([]string, error) {
+	name := canonical(host)
+	for i := strings.Index(name, "."); i >= 0; {
+		label, zone := name[:i], name[i+1:]
+		if !strings.Contains(zone, ".") {
+			break
+		}
+		addrs, err := r.lookup(ctx, label, zone)
+		if !errors.Is(err, errNoZone) {
+			return addrs, err
+		}
+		next := strings.Index(zone, ".")
+		i += next + 1
+	}
+	return nil, &net.DNSError{
+		Err:        fmt.Sprintf("no private DNS zone in %s linked to %s holds it", r.ResourceGroup, r.VirtualNetworkID),
+		Name:       host,
+		IsNotFound: true,
+	}
+}
+
+// lookup returns the addresses of the A record label in zone
+func (r *ARMResolver) lookup(ctx context.Context, label, zone string) ([]string, error) {
+	zoneID := fmt.Sprintf("/subscriptions/%s/resourceGroups/%s/providers/Microsoft.Network/privateDnsZones/%s",
+		url.PathEscape(r.Client.SubscriptionID), url.PathEscape(r.ResourceGroup), url.PathEscape(zone))
+	links, err := r.Client.ListResources(ctx, zoneID+"/virtualNetworkLinks", APIVersion)
+	if arm.IsNotFound(err) {
+		return nil, errNoZone
+	}
+	if err != nil {
+		return nil, err
+	}
+	linked := false
+	for _, data := range links {
+		var link struct {
+			Properties struct {
+				VirtualNetwork struct {
+					ID string `json:"id"`
+				} `json:"virtualNetwork"`
+			} `json:"properties"`
+		}
+		if err := json.Unmarshal(data, &link); err != nil {
+			return nil, err
+		}
+		if strings.EqualFold(link.Properties.VirtualNetwork.ID, r.VirtualNetworkID) {
+			linked = true
+		}
+	}
+	if !linked {
+		return nil, errNoZone
+	}
+
+	var recordSet struct {
+		Properties struct {
+			ARecords []struct {
+				IPv4Address string `json:"ipv4Address"`
+			} `json:"aRecords"`
+		} `json:"properties"`
+	}
+	err = r.Client.GetResource(ctx, zoneID+"/A/"+url.PathEscape(label), APIVersion, &recordSet)
+	if arm.IsNotFound(err) {
+		return nil, &net.DNSError{Err: "no such host", Name: label + "." + zone, IsNotFound: true}
+	}
+	if err != nil {
+		return nil, err
+	}
+	var addrs []string
+	for _, record := range recordSet.Properties.ARecords {
+		addrs = append(addrs, record.IPv4Address)
+	}
+	return addrs, nil
+}
+
+// Resolve looks up the host of every lookup with resolver and reports those
+// that do not resolve to their private endpoint's address
+func Resolve(ctx context.Context, resolver Resolver, lookups []Lookup) []Violation {
+	var violations []Violation
+	for _, lookup := range lookups {
+		addrs, err := resolver.LookupHost(ctx, lookup.Host)
+		switch {
+		case err != nil:
+			violations = append(violations, Violation{Address: lookup.Endpoint, Message: fmt.Sprintf("%s does not resolve: %v", lookup.Host, err)})
+		case !contains(addrs, lookup.IP):
+			violations = append(violations, Violation{
+				Address: lookup.Endpoint,
+				Message: fmt.Sprintf("%s resolves to %s, not %s, the address of its network interface", lookup.Host, strings.Join(addrs, ", "), lookup.IP),
+			})
+		}
+	}
+	return violations
+}
+
+func canonical(host string) string {
+	return strings.ToLower(strings.TrimSuffix(host, "."))
+}
@@ -0,0 +1,114 @@
+package report
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"time"
+)
+
+// htmlTemplate is a standalone page: the styles are inline and it loads
+// nothing, so it can be attached to a build as a single file
+var htmlTemplate = template.Must(template.New("report").Funcs(template.FuncMap{
+	"duration": formatDuration,
+	"bar":      bar,
+	"failed":   failed,
+}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Terratest report</title>
+<style>
+body { font-family: -apple-system, "Segoe UI", Helvetica, Arial, sans-serif; margin: 2em; color: #1f2328; }
+h1 { margin-bottom: 0.2em; }
+h2 { border-bottom: 1px solid #d0d7de; padding-bottom: 0.3em; margin-top: 2em; }
+h3 { margin-bottom: 0.4em; }
+.summary { color: #59636e; }
+.result { display: inline-block; min-width: 6em; padding: 0.1em 0.5em; border-radius: 1em; font-size: 0.8em; text-align: center; color: #fff; background: #59636e; }
+.result.pass { background: #1a7f37; }
+.result.fail, .result.incomplete { background: #cf222e; }
+.result.skip { background: #9a6700; }
+.elapsed { color: #59636e; font-weight: normal; font-size: 0.9em; }
+table { border-collapse: collapse; width: 100%; max-width: 60em; }
+th, td { text-align: left; padding: 0.25em 0.6em; border-bottom: 1px solid #eaeef2; }
+td.duration { text-align: right; white-space: nowrap; }
+td.chart { width: 40%; }
+.bar { height: 0.8em; background: #0969da; border-radius: 0.2em; }
+tr.fail .bar, tr.incomplete .bar { background: #cf222e; }
+tr.terraform td:first-child { font-family: ui-monospace, monospace; }
+.failure { border-left: 4px solid #cf222e; padding: 0.2em 1em; margin: 1em 0; }
+.failure p { margin: 0.3em 0; }
+code { font-family: ui-monospace, monospace; }
+pre { background: #f6f8fa; padding: 1em; overflow-x: auto; font-size: 0.85em; }
+</style>
+</head>
+<body>
+<h1>Terratest report</h1>
+{{with .Counts}}<p class="summary">{{.Tests}} tests and subtests: {{.Passed}} passed, {{.Failed}} failed, {{.Skipped}} skipped in {{duration .Elapsed}}</p>{{end}}
+{{if .Output}}<details open><summary>Output outside go test</summary><pre>{{range .Output}}{{.}}
+{{end}}</pre></details>{{end}}
+{{range .Packages}}
+<h2><span class="result {{.Result}}">{{.Result}}</span> {{.Name}} <span class="elapsed">{{duration .Elapsed}}</span></h2>
+{{if and (ne .Result "pass") .Output}}<details><summary>Package output</summary><pre>{{range .Output}}{{.}}
+{{end}}</pre></details>{{end}}
+{{range .Tests}}{{$test := .}}
+<section>
+<h3><span class="result {{.Result}}">{{.Result}}</span> {{.Name}} <span class="elapsed">{{duration .Elapsed}}</span></h3>
+{{if .Stages}}<table>
+<tr><th>Stage</th><th>Kind</th><th>Result</th><th>Duration</th><th></th></tr>
+{{range .Stages}}<tr class="{{.Kind}} {{.Result}}"><td>{{.Name}}</td><td>{{.Kind}}</td><td>{{.Result}}</td><td class="duration">{{duration .Duration}}</td><td class="chart"><div class="bar" style="{{bar .Duration $test.Elapsed}}"></div></td></tr>
+{{end}}</table>{{end}}
+{{range failed .}}
+<div class="failure">
+<p><strong>{{.Name}}</strong> {{.Result}}{{with .Message}}: {{.}}{{end}}</p>
+{{if .OutputsRead}}<p>Terraform outputs read: {{range $i, $name := .OutputsRead}}{{if $i}}, {{end}}<code>{{$name}}</code>{{end}}</p>{{end}}
+{{if .Output}}<details><summary>Output</summary><pre>{{range .Output}}{{.}}
+{{end}}</pre></details>{{end}}
+</div>
+{{end}}
+</section>
+{{end}}
+{{end}}
+</body>
+</html>
+`))
+
+// WriteHTML writes the report as a standalone HTML page. It has a section per
+// top-level test with a table of its stages and their durations, and the
+// failures in it with the Terraform outputs each was reading.
+func (r *Report) WriteHTML(w io.Writer) error {
+	return htmlTemplate.Execute(w, r)
+}
+
+// failed returns test and its subtests that failed, depth first
+func failed(test *Test) []*Test {
+	var tests []*Test
+	if test.Failed() {
+		tests = append(tests, test)
+	}
+	for _, sub := range test.Subtests {
+		tests = append(tests, failed(sub)...)
+	}
+	return tests
+}
+
+// formatDuration rounds to a tenth of a second under a minute and to the
+// second above it
+func formatDuration(d time.Duration) string {
+	if d < time.Minute {
+		return d.Round(100 * time.Millisecond).String()
+	}
+	return d.Round(time.Second).String()
+}
+
+// bar sizes a stage's bar as its share of the test's duration
+func bar(d, total time.Duration) template.CSS {
+	percent := 0.0
+	if total > 0 {
+		percent = 100 * float64(d) / float64(total)
+	}
+	if percent > 100 {
+		percent = 100
+	}
+	return template.CSS(fmt.Sprintf("width: %.1f%%", percent))
+}
@@ -0,0 +1,123 @@
+package report
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Skipped  int              `xml:"skipped,attr"`
+	Time     string           `xml:"time,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	Skipped   int             `xml:"skipped,attr"`
+	Time      string          `xml:"time,attr"`
+	Timestamp string          `xml:"timestamp,attr,omitempty"`
+	Cases     []junitTestCase `xml:"testcase"`
+	SystemOut string          `xml:"system-out,omitempty"`
+}
+
+type junitTestCase struct {
+	Classname string        `xml:"classname,attr"`
+	Name      string        `xml:"name,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitMessage `xml:"failure"`
+	Skipped   *junitMessage `xml:"skipped"`
+}
+
+type junitMessage struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr,omitempty"`
+	Text    string `xml:",cdata"`
+}
+
+// newJUnitMessage drops the control characters XML 1.0 forbids, such as the
+// escape that starts an ANSI colour, which the encoder would reject
+func newJUnitMessage(message, typ, text string) *junitMessage {
+	strip := func(r rune) rune {
+		if r < 0x20 && r != '\t' && r != '\n' && r != '\r' || r == 0xFFFE || r == 0xFFFF {
+			return -1
+		}
+		return r
+	}
+	return &junitMessage{Message: strings.Map(strip, message), Type: typ, Text: strings.Map(strip, text)}
+}
+
+// WriteJUnit writes the report as JUnit XML, with a testsuite per package and
+// a testcase per test and subtest. A failure holds the test's output and the
+// Terraform outputs it read. A package that failed outside any test, as on a
+// build error, is one failed testcase holding the package output.
+func (r *Report) WriteJUnit(w io.Writer) error {
+	suites := junitTestSuites{}
+	var total time.Duration
+	for _, pkg := range r.Packages {
+		suite := junitTestSuite{Name: pkg.Name, Time: junitTime(pkg.Elapsed)}
+		if !pkg.Started.IsZero() {
+			suite.Timestamp = pkg.Started.UTC().Format("2006-01-02T15:04:05")
+		}
+		for _, test := range pkg.All() {
+			testCase := junitTestCase{Classname: pkg.Name, Name: test.Name, Time: junitTime(test.Elapsed)}
+			switch {
+			case test.Failed():
+				testCase.Failure = newJUnitMessage(test.Message(), test.Result, failureText(test))
+				suite.Failures++
+			case test.Result == Skip:
+				testCase.Skipped = newJUnitMessage(strings.TrimSpace(strings.Join(test.Output, "\n")), "", "")
+				suite.Skipped++
+			}
+			suite.Cases = append(suite.Cases, testCase)
+		}
+		if pkg.Result != Pass && pkg.Result != Skip && suite.Failures == 0 {
+			suite.Cases = append(suite.Cases, junitTestCase{
+				Classname: pkg.Name, Name: "(package)", Time: junitTime(pkg.Elapsed),
+				Failure: newJUnitMessage("package "+pkg.Result, pkg.Result, strings.Join(append(r.Output, pkg.Output...), "\n")),
+			})
+			suite.Failures++
+		} else if len(pkg.Output) > 0 {
+			suite.SystemOut = newJUnitMessage("", "", strings.Join(pkg.Output, "\n")).Text
+		}
+		suite.Tests = len(suite.Cases)
+
+		suites.Tests += suite.Tests
+		suites.Failures += suite.Failures
+		suites.Skipped += suite.Skipped
+		total += pkg.Elapsed
+		suites.Suites = append(suites.Suites, suite)
+	}
+	suites.Time = junitTime(total)
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(suites); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// failureText is the test's output followed by the outputs it read
+func failureText(test *Test) string {
+	text := strings.Join(test.Output, "\n")
+	if len(test.OutputsRead) > 0 {
+		text += "\n\nTerraform outputs read: " + strings.Join(test.OutputsRead, ", ")
+	}
+	return text
+}
+
+func junitTime(d time.Duration) string {
+	return fmt.Sprintf("%.3f", d.Seconds())
+}
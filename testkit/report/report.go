@@ -0,0 +1,402 @@
+// Package report turns the go test -json output of a suite into JUnit XML and
+// a standalone HTML summary. For each top-level test it times the Terraform
+// commands Terratest logged, such as init, apply and destroy, and the
+// validation subtests between them. For each failure it lists the Terraform
+// outputs the test was reading.
+package report
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Results of a test or package
+const (
+	Pass = "pass"
+	Fail = "fail"
+	Skip = "skip"
+	// Incomplete is a test that never finished, as when go test timed out
+	Incomplete = "incomplete"
+)
+
+// Stage kinds
+const (
+	TerraformStage = "terraform"
+	SubtestStage   = "subtest"
+)
+
+// Event is one line of go test -json output
+type Event struct {
+	Time    time.Time
+	Action  string
+	Package string
+	Test    string
+	Output  string
+	Elapsed float64
+}
+
+// Report is a parsed go test -json run
+type Report struct {
+	Packages []*Package
+	// Output holds the lines that were not JSON, such as build errors go
+	// test printed to a merged stderr
+	Output []string
+}
+
+// Package is the tests one package ran
+type Package struct {
+	Name    string
+	Result  string
+	Started time.Time
+	Elapsed time.Duration
+	// Tests are the top-level tests, in the order they started
+	Tests []*Test
+	// Output is what the package printed outside any test
+	Output []string
+
+	tests map[string]*Test
+}
+
+// Test is a test or subtest and what it logged
+type Test struct {
+	Package string
+	// Name is the full name, such as
+	// TestRPGAIAppInfrastructure/PrivateEndpoints/StoragePrivateEndpoint
+	Name    string
+	Result  string
+	Started time.Time
+	Elapsed time.Duration
+	// Output is what the test printed, without go test's framing lines
+	Output []string
+	// OutputsRead are the Terraform outputs the test itself read, in the
+	// order it first read them
+	OutputsRead []string
+	// Subtests are the direct subtests, in the order they started
+	Subtests []*Test
+	// Stages times the Terraform commands a top-level test ran itself and
+	// its direct subtests, in the order they started
+	Stages []Stage
+
+	parent   *Test
+	timeline []mark
+	// last is when the test last printed, for the elapsed time of one that
+	// never finished
+	last time.Time
+}
+
+// Stage is a Terraform command or a validation subtest of a top-level test
+type Stage struct {
+	// Name is the Terraform subcommand, such as apply, or the subtest's
+	// short name
+	Name     string
+	Kind     string
+	Started  time.Time
+	Duration time.Duration
+	// Result is set for subtests
+	Result string
+}
+
+// mark is a Terraform command or subtest starting in a top-level test
+type mark struct {
+	time    time.Time
+	command string
+	subtest *Test
+}
+
+// ShortName returns the last element of the test's name
+func (t *Test) ShortName() string {
+	return t.Name[strings.LastIndex(t.Name, "/")+1:]
+}
+
+// Failed reports whether the test failed or never finished
+func (t *Test) Failed() bool {
+	return t.Result == Fail || t.Result == Incomplete
+}
+
+// testifyError matches the line testify starts a failed assertion with
+var testifyError = regexp.MustCompile(`^\s*Error:\s*(.*)$`)
+
+// logLocation matches the file:line prefix of t.Error output
+var logLocation = regexp.MustCompile(`^\s+\S+\.go:\d+:\s*(.*)$`)
+
+// Message returns the first error the test logged, for a failure summary.
+// A test that failed only through its subtests names the first of them.
+func (t *Test) Message() string {
+	for _, line := range t.Output {
+		if m := testifyError.FindStringSubmatch(line); m != nil && m[1] != "" {
+			return strings.TrimSpace(m[1])
+		}
+	}
+	for _, line := range t.Output {
+		if m := logLocation.FindStringSubmatch(line); m != nil && m[1] != "" {
+			return strings.TrimSpace(m[1])
+		}
+	}
+	for _, sub := range t.Subtests {
+		if sub.Failed() {
+			return "subtest " + sub.ShortName() + " " + sub.Result
+		}
+	}
+	if t.Result == Incomplete {
+		for _, line := range t.Output {
+			if strings.HasPrefix(line, "panic: ") {
+				return line
+			}
+		}
+		return "test did not complete"
+	}
+	return ""
+}
+
+// terratestLine matches the prefix Terratest's logger puts on every line:
+// the test name, an RFC 3339 time and the caller
+var terratestLine = regexp.MustCompile(`^(\S+) (\d{4}-\d{2}-\d{2}T\S+) \S+:\d+: (.*)$`)
+
+// terraformCommand matches the line Terratest logs before running Terraform
+var terraformCommand = regexp.MustCompile(`^Running command (?:\S*/)?(?:terraform|tofu)(?:\.exe)? with args \[(.*)\]$`)
+
+// framing matches the lines go test prints around each test
+var framing = regexp.MustCompile(`^\s*(=== (RUN|PAUSE|CONT|NAME)|--- (PASS|FAIL|SKIP))`)
+
+// Parse reads go test -json output. Lines that are not JSON are kept in
+// Report.Output.
+func Parse(r io.Reader) (*Report, error) {
+	report := &Report{}
+	packages := map[string]*Package{}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		var event Event
+		if !strings.HasPrefix(line, "{") || json.Unmarshal([]byte(line), &event) != nil {
+			if strings.TrimSpace(line) != "" {
+				report.Output = append(report.Output, line)
+			}
+			continue
+		}
+
+		pkg, ok := packages[event.Package]
+		if !ok {
+			pkg = &Package{Name: event.Package, Started: event.Time, tests: map[string]*Test{}}
+			packages[event.Package] = pkg
+			report.Packages = append(report.Packages, pkg)
+		}
+		if event.Test == "" {
+			pkg.record(event)
+			continue
+		}
+		pkg.test(event.Test).record(pkg, event)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, pkg := range report.Packages {
+		if pkg.Result == "" {
+			pkg.Result = Incomplete
+		}
+		for _, test := range pkg.Tests {
+			test.finish()
+		}
+	}
+	return report, nil
+}
+
+// record applies an event about the package itself
+func (p *Package) record(event Event) {
+	switch event.Action {
+	case Pass, Fail, Skip:
+		p.Result = event.Action
+		p.Elapsed = seconds(event.Elapsed)
+	case "output":
+		p.Output = append(p.Output, strings.TrimRight(event.Output, "\n"))
+	}
+}
+
+// test returns the named test, creating it and its parents as needed
+func (p *Package) test(name string) *Test {
+	if test, ok := p.tests[name]; ok {
+		return test
+	}
+	test := &Test{Package: p.Name, Name: name}
+	p.tests[name] = test
+	if i := strings.LastIndex(name, "/"); i >= 0 {
+		test.parent = p.test(name[:i])
+		test.parent.Subtests = append(test.parent.Subtests, test)
+	} else {
+		p.Tests = append(p.Tests, test)
+	}
+	return test
+}
+
+// record applies an event about the test. Terratest lines are credited to
+// the test they name, which go test gets wrong for parallel tests.
+func (t *Test) record(pkg *Package, event Event) {
+	switch event.Action {
+	case "run":
+		t.Started = event.Time
+		if t.parent != nil && t.parent.parent == nil {
+			t.parent.timeline = append(t.parent.timeline, mark{time: event.Time, subtest: t})
+		}
+	case Pass, Fail, Skip:
+		t.Result = event.Action
+		t.Elapsed = seconds(event.Elapsed)
+	case "output":
+		line := strings.TrimRight(event.Output, "\n")
+		if framing.MatchString(line) {
+			return
+		}
+		owner := t
+		var command []string
+		if m := terratestLine.FindStringSubmatch(line); m != nil {
+			if named, ok := pkg.tests[m[1]]; ok {
+				owner = named
+			}
+			if c := terraformCommand.FindStringSubmatch(m[3]); c != nil {
+				command = strings.Fields(c[1])
+			}
+		}
+		owner.Output = append(owner.Output, line)
+		owner.last = event.Time
+		owner.logged(event.Time, command)
+	}
+}
+
+// logged notes a line the test logged, and the Terraform command it started
+func (t *Test) logged(at time.Time, command []string) {
+	var subcommand string
+	for i, arg := range command {
+		if strings.HasPrefix(arg, "-") {
+			continue
+		}
+		subcommand = arg
+		if arg == "output" {
+			t.readOutput(command[i+1:])
+		}
+		break
+	}
+	if t.parent == nil && subcommand != "" {
+		t.timeline = append(t.timeline, mark{time: at, command: subcommand})
+	}
+}
+
+// readOutput records the output a terraform output command names, if any
+func (t *Test) readOutput(args []string) {
+	for _, arg := range args {
+		if strings.HasPrefix(arg, "-") {
+			continue
+		}
+		for _, read := range t.OutputsRead {
+			if read == arg {
+				return
+			}
+		}
+		t.OutputsRead = append(t.OutputsRead, arg)
+		return
+	}
+}
+
+// finish marks unfinished tests and builds the stages of a top-level test.
+// A Terraform command runs until the test's next command or subtest starts,
+// or the test ends.
+func (t *Test) finish() {
+	if t.Result == "" {
+		t.Result = Incomplete
+		if !t.last.IsZero() {
+			t.Elapsed = t.last.Sub(t.Started)
+		}
+	}
+	for _, sub := range t.Subtests {
+		sub.finish()
+	}
+	if t.parent != nil {
+		return
+	}
+
+	var open *Stage
+	closeStage := func(end time.Time) {
+		if open != nil {
+			open.Duration = end.Sub(open.Started)
+			t.Stages = append(t.Stages, *open)
+			open = nil
+		}
+	}
+	for _, m := range t.timeline {
+		closeStage(m.time)
+		switch {
+		case m.subtest != nil:
+			t.Stages = append(t.Stages, Stage{
+				Name: m.subtest.ShortName(), Kind: SubtestStage,
+				Started: m.subtest.Started, Duration: m.subtest.Elapsed, Result: m.subtest.Result,
+			})
+		// Reading outputs is part of the validation that follows
+		case m.command != "output":
+			open = &Stage{Name: m.command, Kind: TerraformStage, Started: m.time}
+		}
+	}
+	closeStage(t.Started.Add(t.Elapsed))
+	t.timeline = nil
+}
+
+// Counts summarises a report
+type Counts struct {
+	// Tests counts tests and subtests
+	Tests, Passed, Failed, Skipped int
+	Elapsed                        time.Duration
+}
+
+// Counts returns the totals over every test and subtest
+func (r *Report) Counts() Counts {
+	var counts Counts
+	for _, pkg := range r.Packages {
+		counts.Elapsed += pkg.Elapsed
+		for _, test := range pkg.All() {
+			counts.Tests++
+			switch {
+			case test.Failed():
+				counts.Failed++
+			case test.Result == Skip:
+				counts.Skipped++
+			default:
+				counts.Passed++
+			}
+		}
+	}
+	return counts
+}
+
+// Failures returns every test and subtest that failed or never finished
+func (r *Report) Failures() []*Test {
+	var failed []*Test
+	for _, pkg := range r.Packages {
+		for _, test := range pkg.All() {
+			if test.Failed() {
+				failed = append(failed, test)
+			}
+		}
+	}
+	return failed
+}
+
+// All returns the package's tests and their subtests, depth first
+func (p *Package) All() []*Test {
+	var all []*Test
+	var walk func(tests []*Test)
+	walk = func(tests []*Test) {
+		for _, test := range tests {
+			all = append(all, test)
+			walk(test.Subtests)
+		}
+	}
+	walk(p.Tests)
+	return all
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
@@ -0,0 +1,158 @@
+package report
+
+import (
+	"bytes"
+	"encoding/xml"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func parseRun(t *testing.T) *Report {
+	f, err := os.Open("testdata/run.json")
+	require.NoError(t, err)
+	defer f.Close()
+	report, err := Parse(f)
+	require.NoError(t, err)
+	return report
+}
+
+func TestParse(t *testing.T) {
+	t.Parallel()
+
+	report := parseRun(t)
+	require.Len(t, report.Packages, 2)
+	pkg := report.Packages[0]
+	assert.Equal(t, Fail, pkg.Result)
+	assert.Equal(t, 2141123*time.Millisecond, pkg.Elapsed)
+
+	require.Len(t, pkg.Tests, 2)
+	stack := pkg.Tests[0]
+	assert.Equal(t, "TestRPGAIAppInfrastructure", stack.Name)
+	assert.Equal(t, Fail, stack.Result)
+	assert.Equal(t, Skip, pkg.Tests[1].Result)
+
+	require.Len(t, stack.Subtests, 2)
+	endpoints := stack.Subtests[1]
+	require.Len(t, endpoints.Subtests, 1)
+	storage := endpoints.Subtests[0]
+	assert.Equal(t, "StoragePrivateEndpoint", storage.ShortName())
+	assert.Equal(t, Fail, storage.Result)
+	assert.Equal(t, "Should NOT be empty, but was", storage.Message())
+	assert.Equal(t, []string{"storage_private_endpoint_id", "storage_public_network_access_enabled"}, storage.OutputsRead,
+		"Terratest lines should be credited to the test they name, once per output")
+	assert.Empty(t, endpoints.OutputsRead)
+	assert.NotContains(t, strings.Join(storage.Output, "\n"), "=== RUN")
+
+	var stages []string
+	for _, stage := range stack.Stages {
+		stages = append(stages, stage.Kind+":"+stage.Name+":"+stage.Duration.String())
+	}
+	assert.Equal(t, []string{
+		"terraform:init:29s",
+		"terraform:apply:20m1s",
+		"subtest:ResourceGroupExists:1.5s",
+		"subtest:PrivateEndpoints:1s",
+		"terraform:destroy:15m0s",
+	}, stages)
+	assert.Equal(t, Fail, stack.Stages[3].Result)
+
+	timedOut := report.Packages[1].Tests[0]
+	assert.Equal(t, Incomplete, timedOut.Result)
+	assert.True(t, timedOut.Failed())
+	assert.Equal(t, "panic: test timed out after 30m0s", timedOut.Message())
+	assert.Equal(t, "subtest PrivateEndpoints fail", stack.Message())
+
+	assert.Equal(t, Counts{Tests: 6, Passed: 1, Failed: 4, Skipped: 1, Elapsed: 3941133 * time.Millisecond}, report.Counts())
+	var failures []string
+	for _, test := range report.Failures() {
+		failures = append(failures, test.Name)
+	}
+	assert.Equal(t, []string{
+		"TestRPGAIAppInfrastructure",
+		"TestRPGAIAppInfrastructure/PrivateEndpoints",
+		"TestRPGAIAppInfrastructure/PrivateEndpoints/StoragePrivateEndpoint",
+		"TestSQLDatabaseModule",
+	}, failures)
+}
+
+func TestParseKeepsOtherLines(t *testing.T) {
+	t.Parallel()
+
+	report, err := Parse(strings.NewReader("# example.com/broken\n./main_test.go:3:2: \x1b[31mundefined: x\x1b[0m\n" +
+		`{"Action":"output","Package":"example.com/broken","Output":"FAIL\texample.com/broken [build failed]\n"}` + "\n" +
+		`{"Action":"fail","Package":"example.com/broken","Elapsed":0}` + "\n"))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"# example.com/broken", "./main_test.go:3:2: \x1b[31mundefined: x\x1b[0m"}, report.Output)
+	require.Len(t, report.Packages, 1)
+	assert.Equal(t, Fail, report.Packages[0].Result)
+
+	var junit bytes.Buffer
+	require.NoError(t, report.WriteJUnit(&junit))
+	require.NoError(t, xml.Unmarshal(junit.Bytes(), new(interface{})), "the report should be well-formed")
+	assert.Contains(t, junit.String(), `<testcase classname="example.com/broken" name="(package)" time="0.000">`)
+	assert.Contains(t, junit.String(), "undefined: x")
+}
+
+func TestWriteJUnit(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+	require.NoError(t, parseRun(t).WriteJUnit(&buf))
+
+	var suites struct {
+		Tests    int `xml:"tests,attr"`
+		Failures int `xml:"failures,attr"`
+		Suites   []struct {
+			Name     string `xml:"name,attr"`
+			Failures int    `xml:"failures,attr"`
+			Skipped  int    `xml:"skipped,attr"`
+			Cases    []struct {
+				Name    string `xml:"name,attr"`
+				Time    string `xml:"time,attr"`
+				Failure *struct {
+					Message string `xml:"message,attr"`
+					Type    string `xml:"type,attr"`
+					Text    string `xml:",chardata"`
+				} `xml:"failure"`
+			} `xml:"testcase"`
+		} `xml:"testsuite"`
+	}
+	require.NoError(t, xml.Unmarshal(buf.Bytes(), &suites), buf.String())
+	assert.Equal(t, 6, suites.Tests)
+	assert.Equal(t, 4, suites.Failures)
+	require.Len(t, suites.Suites, 2)
+	assert.Equal(t, 1, suites.Suites[0].Skipped)
+
+	storage := suites.Suites[0].Cases[3]
+	assert.Equal(t, "TestRPGAIAppInfrastructure/PrivateEndpoints/StoragePrivateEndpoint", storage.Name)
+	assert.Equal(t, "0.800", storage.Time)
+	require.NotNil(t, storage.Failure)
+	assert.Equal(t, "Should NOT be empty, but was", storage.Failure.Message)
+	assert.Contains(t, storage.Failure.Text, "Terraform outputs read: storage_private_endpoint_id, storage_public_network_access_enabled")
+
+	timedOut := suites.Suites[1].Cases[0]
+	require.NotNil(t, timedOut.Failure)
+	assert.Equal(t, Incomplete, timedOut.Failure.Type)
+}
+
+func TestWriteHTML(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+	require.NoError(t, parseRun(t).WriteHTML(&buf))
+	page := buf.String()
+
+	assert.Contains(t, page, "6 tests and subtests: 1 passed, 4 failed, 1 skipped")
+	assert.Contains(t, page, `<td>apply</td><td>terraform</td><td></td><td class="duration">20m1s</td>`)
+	assert.Contains(t, page, `<div class="bar" style="width: 56.1%">`, "apply took 1201s of 2140s")
+	assert.Contains(t, page, "<td>ResourceGroupExists</td>")
+	assert.Contains(t, page, "<strong>TestRPGAIAppInfrastructure/PrivateEndpoints/StoragePrivateEndpoint</strong> fail: Should NOT be empty, but was")
+	assert.Contains(t, page, "Terraform outputs read: <code>storage_private_endpoint_id</code>, <code>storage_public_network_access_enabled</code>")
+	assert.NotContains(t, page, "<script", "the page should be standalone")
+	assert.NotContains(t, page, "ZgotmplZ")
+}
@@ -0,0 +1,331 @@
+// Package secretcontract cross-checks the Key Vault secret names a Terraform
+// configuration writes with the names the application reads, from its app
+// settings and its source code, so a renamed secret fails without a deploy.
+package secretcontract
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/agext/levenshtein"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/zclconf/go-cty/cty"
+
+	"github.com/vanehru/terraform-modules/testkit/tfconfig"
+)
+
+// DefaultSettingSuffix marks the app settings whose value is a secret name
+// the application looks up, such as SQL_CONNECTION_SECRET
+const DefaultSettingSuffix = "_SECRET"
+
+// readPatterns match a Key Vault SDK call and the literal secret name passed
+// to it, by source file extension
+var readPatterns = map[string]*regexp.Regexp{
+	// Python: client.get_secret("name")
+	".py": regexp.MustCompile(`\b(get_secret)\(\s*["']([^"']+)["']`),
+	// C#: client.GetSecret("name") or await client.GetSecretAsync("name")
+	".cs": regexp.MustCompile(`\b(GetSecret(?:Async)?)\(\s*"([^"]+)"`),
+	// JavaScript and TypeScript: client.getSecret("name")
+	".js": regexp.MustCompile("\\b(getSecret)\\(\\s*[\"'`]([^\"'`]+)[\"'`]"),
+	".ts": regexp.MustCompile("\\b(getSecret)\\(\\s*[\"'`]([^\"'`]+)[\"'`]"),
+}
+
+// skipDirs are never scanned for source files
+var skipDirs = map[string]bool{
+	".git":         true,
+	".venv":        true,
+	"__pycache__":  true,
+	"bin":          true,
+	"node_modules": true,
+	"obj":          true,
+	"venv":         true,
+}
+
+// Use is a place a secret name is written or read
+type Use struct {
+	Name string
+	// Via describes how, such as the module argument or SDK call
+	Via  string
+	File string
+	Line int
+}
+
+func (u Use) location() string {
+	return fmt.Sprintf("%s:%d", u.File, u.Line)
+}
+
+// before orders uses by file, then line, then name
+func (u Use) before(other Use) bool {
+	if u.File != other.File {
+		return u.File < other.File
+	}
+	if u.Line != other.Line {
+		return u.Line < other.Line
+	}
+	return u.Name < other.Name
+}
+
+// Issue is a secret only one side of the contract knows
+type Issue struct {
+	Use
+	// Read is true for a secret the application reads but nothing writes,
+	// false for a secret written but never read
+	Read       bool
+	Suggestion string
+}
+
+func (i Issue) String() string {
+	var msg string
+	if i.Read {
+		msg = fmt.Sprintf("%s: %s reads secret %q but the configuration never writes it", i.location(), i.Via, i.Name)
+	} else {
+		msg = fmt.Sprintf("%s: %s writes secret %q but the application never reads it", i.location(), i.Via, i.Name)
+	}
+	if i.Suggestion != "" {
+		msg += fmt.Sprintf(" (did you mean %q?)", i.Suggestion)
+	}
+	return msg
+}
+
+// Options says where to find each side of the contract
+type Options struct {
+	// TerraformDir is the root configuration that writes and configures the secrets
+	TerraformDir string
+	VarFiles     []string
+	// SourceDirs are scanned recursively for Key Vault SDK calls
+	SourceDirs []string
+	// SettingSuffix defaults to DefaultSettingSuffix
+	SettingSuffix string
+}
+
+// Check returns an issue for every secret the application reads that the
+// configuration does not write, and every secret written that nothing reads,
+// sorted by location. Names computed at runtime are not seen on either side.
+func Check(opts Options) ([]Issue, error) {
+	suffix := opts.SettingSuffix
+	if suffix == "" {
+		suffix = DefaultSettingSuffix
+	}
+
+	instances, err := tfconfig.LoadTree(opts.TerraformDir, opts.VarFiles...)
+	if err != nil {
+		return nil, err
+	}
+	writes := Written(instances)
+	reads := SettingReads(instances, suffix)
+	for _, dir := range opts.SourceDirs {
+		sourceReads, err := SourceReads(dir)
+		if err != nil {
+			return nil, err
+		}
+		reads = append(reads, sourceReads...)
+	}
+
+	written, read := names(writes), names(reads)
+	var issues []Issue
+	for _, use := range reads {
+		if !written[use.Name] {
+			issues = append(issues, Issue{Use: use, Read: true, Suggestion: suggest(use.Name, written)})
+		}
+	}
+	for _, use := range writes {
+		if !read[use.Name] {
+			issues = append(issues, Issue{Use: use, Suggestion: suggest(use.Name, read)})
+		}
+	}
+	sort.SliceStable(issues, func(i, j int) bool {
+		return issues[i].before(issues[j].Use)
+	})
+	return issues, nil
+}
+
+// Written returns the secret names the configuration writes: the keys of any
+// literal secrets argument passed to a module, and the static names of
+// azurerm_key_vault_secret resources
+func Written(instances []*tfconfig.Instance) []Use {
+	var uses []Use
+	for _, inst := range instances {
+		for _, call := range inst.Module.ModuleCalls {
+			attr, ok := call.Body.Attributes["secrets"]
+			if !ok {
+				continue
+			}
+			via := fmt.Sprintf("%s.secrets", moduleAddress(inst, call))
+			for _, entry := range mapEntries(inst, attr.Expr) {
+				uses = append(uses, Use{Name: entry.key, Via: via, File: entry.rng.Filename, Line: entry.rng.Start.Line})
+			}
+		}
+
+		for _, r := range inst.Module.ResourcesOfType("azurerm_key_vault_secret") {
+			attr, ok := r.Body.Attributes["name"]
+			if !ok {
+				continue
+			}
+			value, ok := inst.Eval(attr.Expr)
+			if !ok || value.IsNull() || value.Type() != cty.String {
+				continue
+			}
+			uses = append(uses, Use{Name: value.AsString(), Via: inst.Address(r), File: r.Range.Filename, Line: r.Range.Start.Line})
+		}
+	}
+	return uses
+}
+
+// SettingReads returns the secret names the application is told to read:
+// the static values of app_settings entries whose key ends with suffix, in
+// module arguments and resources alike
+func SettingReads(instances []*tfconfig.Instance, suffix string) []Use {
+	var uses []Use
+	for _, inst := range instances {
+		bodies := map[string]*hclsyntax.Body{}
+		for _, call := range inst.Module.ModuleCalls {
+			bodies[moduleAddress(inst, call)] = call.Body
+		}
+		for _, r := range inst.Module.Resources {
+			bodies[inst.Address(r)] = r.Body
+		}
+
+		for address, body := range bodies {
+			attr, ok := body.Attributes["app_settings"]
+			if !ok {
+				continue
+			}
+			for _, entry := range mapEntries(inst, attr.Expr) {
+				if !strings.HasSuffix(entry.key, suffix) || entry.value == "" {
+					continue
+				}
+				uses = append(uses, Use{
+					Name: entry.value,
+					Via:  fmt.Sprintf("%s.app_settings[%q]", address, entry.key),
+					File: entry.rng.Filename,
+					Line: entry.rng.Start.Line,
+				})
+			}
+		}
+	}
+	sort.Slice(uses, func(i, j int) bool {
+		return uses[i].before(uses[j])
+	})
+	return uses
+}
+
+// SourceReads returns the literal secret names passed to Key Vault SDK calls
+// in the source files under dir
+func SourceReads(dir string) ([]Use, error) {
+	var uses []Use
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if skipDirs[d.Name()] {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		pattern, ok := readPatterns[filepath.Ext(path)]
+		if !ok {
+			return nil
+		}
+
+		// Read whole files: bundled JavaScript lines outgrow a bufio.Scanner
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		for i, line := range strings.Split(string(data), "\n") {
+			for _, match := range pattern.FindAllStringSubmatch(line, -1) {
+				uses = append(uses, Use{Name: match[2], Via: match[1] + "()", File: path, Line: i + 1})
+			}
+		}
+		return nil
+	})
+	return uses, err
+}
+
+// entry is a key of a map expression with its static string value, if any
+type entry struct {
+	key, value string
+	rng        hcl.Range
+}
+
+// mapEntries returns the static keys of an object constructor, located at
+// each item, or of any other expression that evaluates to a map
+func mapEntries(inst *tfconfig.Instance, expr hcl.Expression) []entry {
+	var entries []entry
+	if cons, ok := expr.(*hclsyntax.ObjectConsExpr); ok {
+		for _, item := range cons.Items {
+			key := hcl.ExprAsKeyword(item.KeyExpr)
+			if key == "" {
+				value, ok := inst.Eval(item.KeyExpr)
+				if !ok || value.IsNull() || value.Type() != cty.String {
+					continue
+				}
+				key = value.AsString()
+			}
+			e := entry{key: key, rng: item.KeyExpr.Range()}
+			if value, ok := inst.Eval(item.ValueExpr); ok && !value.IsNull() && value.Type() == cty.String {
+				e.value = value.AsString()
+			}
+			entries = append(entries, e)
+		}
+		return entries
+	}
+
+	value, ok := inst.Eval(expr)
+	if !ok || value.IsNull() || !value.CanIterateElements() || value.Type().IsListType() || value.Type().IsTupleType() || value.Type().IsSetType() {
+		return nil
+	}
+	for key, element := range value.AsValueMap() {
+		e := entry{key: key, rng: expr.Range()}
+		if !element.IsNull() && element.Type() == cty.String {
+			e.value = element.AsString()
+		}
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].key < entries[j].key })
+	return entries
+}
+
+func moduleAddress(inst *tfconfig.Instance, call *tfconfig.ModuleCall) string {
+	if inst.Path == "" {
+		return "module." + call.Name
+	}
+	return inst.Path + ".module." + call.Name
+}
+
+func names(uses []Use) map[string]bool {
+	set := map[string]bool{}
+	for _, use := range uses {
+		set[use.Name] = true
+	}
+	return set
+}
+
+// suggest returns the closest of candidates to name, comparing them without
+// case or separators so sqlconnectionString finds sql-connection-string
+func suggest(name string, candidates map[string]bool) string {
+	sorted := make([]string, 0, len(candidates))
+	for candidate := range candidates {
+		sorted = append(sorted, candidate)
+	}
+	sort.Strings(sorted)
+
+	best, bestDist := "", 3
+	for _, candidate := range sorted {
+		if dist := levenshtein.Distance(normalize(name), normalize(candidate), nil); dist < bestDist {
+			best, bestDist = candidate, dist
+		}
+	}
+	return best
+}
+
+func normalize(name string) string {
+	return strings.ToLower(strings.NewReplacer("-", "", "_", "", ".", "").Replace(name))
+}
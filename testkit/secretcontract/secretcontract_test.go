@@ -0,0 +1,68 @@
+package secretcontract
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheck(t *testing.T) {
+	t.Parallel()
+
+	issues, err := Check(Options{TerraformDir: "testdata/stack", SourceDirs: []string{"testdata/src"}})
+	require.NoError(t, err)
+
+	var got []string
+	for _, issue := range issues {
+		got = append(got, issue.String())
+	}
+	assert.Equal(t, []string{
+		`testdata/src/python/keyvault_helper.py:2: get_secret() reads secret "sqlconnectionString" but the configuration never writes it (did you mean "sql-connection-string"?)`,
+		`testdata/stack/main.tf:11: module.vault.secrets writes secret "unused-secret" but the application never reads it`,
+		`testdata/stack/main.tf:27: azurerm_linux_function_app.api.app_settings["OPENAI_ENDPOINT_SECRET"] reads secret "openai-endpoint" but the configuration never writes it`,
+	}, got)
+}
+
+func TestWritten(t *testing.T) {
+	t.Parallel()
+
+	issues, err := Check(Options{TerraformDir: "testdata/stack"})
+	require.NoError(t, err)
+
+	written := map[string]bool{}
+	for _, issue := range issues {
+		if !issue.Read {
+			written[issue.Name] = true
+		}
+	}
+	// Without source dirs only the app settings read anything
+	assert.Equal(t, map[string]bool{"api-token": true, "unused-secret": true}, written)
+}
+
+func TestSourceReads(t *testing.T) {
+	t.Parallel()
+
+	uses, err := SourceReads("testdata/src")
+	require.NoError(t, err)
+
+	var got []string
+	for _, use := range uses {
+		got = append(got, use.Via+" "+use.Name)
+	}
+	assert.Equal(t, []string{
+		"GetSecretAsync() api-token",
+		"get_secret() sqlconnectionString",
+		"get_secret() openai-key",
+		"getSecret() sql-connection-string",
+	}, got)
+}
+
+func TestSuggest(t *testing.T) {
+	t.Parallel()
+
+	candidates := map[string]bool{"sql-connection-string": true, "openai-key": true}
+	assert.Equal(t, "sql-connection-string", suggest("SQL_CONNECTION_STRING", candidates))
+	assert.Equal(t, "openai-key", suggest("openaikeys", candidates))
+	assert.Equal(t, "", suggest("storage-account-key", candidates))
+}
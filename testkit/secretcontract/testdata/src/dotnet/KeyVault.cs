@@ -0,0 +1,8 @@
+public static class KeyVault
+{
+    public static async Task<string> ApiToken(SecretClient client)
+    {
+        KeyVaultSecret secret = await client.GetSecretAsync("api-token");
+        return secret.Value;
+    }
+}
@@ -0,0 +1,6 @@
+def get_connection_string(client):
+    return client.get_secret("sqlconnectionString").value
+
+
+def get_openai_key(client):
+    return client.get_secret('openai-key').value
@@ -0,0 +1,3 @@
+export async function connectionString(client) {
+  return (await client.getSecret(`sql-connection-string`)).value;
+}
@@ -0,0 +1,30 @@
+locals {
+  setting_name = "OPENAI_KEY_SECRET"
+}
+
+module "vault" {
+  source = "./modules/vault"
+
+  secrets = {
+    sql-connection-string = "Server=tcp:sql;Database=rpg"
+    "openai-key"          = "key"
+    "unused-secret"       = "value"
+  }
+}
+
+resource "azurerm_key_vault_secret" "api" {
+  name         = "api-token"
+  value        = "token"
+  key_vault_id = module.vault.id
+}
+
+resource "azurerm_linux_function_app" "api" {
+  name = "rpg-func"
+
+  app_settings = {
+    SQL_CONNECTION_SECRET    = "sql-connection-string"
+    (local.setting_name)     = "openai-key"
+    OPENAI_ENDPOINT_SECRET   = "openai-endpoint"
+    FUNCTIONS_WORKER_RUNTIME = "python"
+  }
+}
@@ -0,0 +1,15 @@
+variable "secrets" {
+  type    = map(string)
+  default = {}
+}
+
+resource "azurerm_key_vault_secret" "secret" {
+  for_each = var.secrets
+
+  name  = each.key
+  value = each.value
+}
+
+output "id" {
+  value = "vault-id"
+}
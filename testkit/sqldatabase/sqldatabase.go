@@ -0,0 +1,98 @@
+// Package sqldatabase deploys and validates the sql-database module
+package sqldatabase
+
+import (
+	"testing"
+
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/vanehru/terraform-modules/testkit/deploy"
+	"github.com/vanehru/terraform-modules/testkit/naming"
+	"github.com/vanehru/terraform-modules/testkit/privatedns"
+)
+
+// Outputs are the module outputs Validate reads
+var Outputs = []string{"sql_server_name", "sql_database_name", "sql_server_fqdn", "connection_string"}
+
+// Expected describes the SQL Server and database a test deploys and expects back
+type Expected struct {
+	ServerName        string
+	DatabaseName      string
+	ResourceGroupName string
+	Location          string
+	AdminUsername     string
+	AdminPassword     string
+	// PrivateEndpointSubnetID and VirtualNetworkID, such as a fixture.Network
+	// provides, put the server behind a private endpoint when set
+	PrivateEndpointSubnetID string
+	VirtualNetworkID        string
+}
+
+// Vars returns the module inputs that deploy expected on the smallest SKU,
+// with public network access so the test runner can connect
+func Vars(expected Expected) map[string]interface{} {
+	vars := map[string]interface{}{
+		"sql_server_name":               expected.ServerName,
+		"database_name":                 expected.DatabaseName,
+		"location":                      expected.Location,
+		"resource_group_name":           expected.ResourceGroupName,
+		"admin_username":                expected.AdminUsername,
+		"admin_password":                expected.AdminPassword,
+		"sql_server_version":            "12.0",
+		"max_size_gb":                   2,
+		"sku_name":                      "Basic",
+		"public_network_access_enabled": true, // For testing
+		"minimum_tls_version":           "1.2",
+		"enable_private_endpoint":       expected.PrivateEndpointSubnetID != "",
+	}
+	if expected.PrivateEndpointSubnetID != "" {
+		vars["private_endpoint_subnet_id"] = expected.PrivateEndpointSubnetID
+		vars["virtual_network_id"] = expected.VirtualNetworkID
+	}
+	return vars
+}
+
+// Test deploys the sql-database module in terraformDir, validates it against
+// expected and destroys it. Names Azure would reject fail the test before
+// anything is deployed.
+func Test(t *testing.T, terraformDir string, expected Expected) {
+	naming.Require(t, "azurerm_mssql_server", expected.ServerName)
+	naming.Require(t, "azurerm_mssql_database", expected.DatabaseName)
+	terraformOptions := deploy.Options(t, terraformDir, Vars(expected))
+	deploy.Run(t, terraformOptions, nil, func(t *testing.T, terraformOptions *terraform.Options) {
+		Validate(t, terraformOptions, expected)
+	})
+}
+
+// Validate runs the standard checks against an applied sql-database module
+func Validate(t *testing.T, terraformOptions *terraform.Options, expected Expected) {
+	t.Run("SQLServerExists", func(t *testing.T) {
+		actualServerName := terraform.Output(t, terraformOptions, "sql_server_name")
+		assert.Equal(t, expected.ServerName, actualServerName)
+	})
+
+	t.Run("SQLDatabaseExists", func(t *testing.T) {
+		actualDBName := terraform.Output(t, terraformOptions, "sql_database_name")
+		assert.Equal(t, expected.DatabaseName, actualDBName)
+	})
+
+	t.Run("SQLServerFQDN", func(t *testing.T) {
+		fqdn := terraform.Output(t, terraformOptions, "sql_server_fqdn")
+		assert.Contains(t, fqdn, expected.ServerName)
+		assert.Contains(t, fqdn, "database.windows.net")
+	})
+
+	t.Run("ConnectionString", func(t *testing.T) {
+		connString := terraform.Output(t, terraformOptions, "connection_string")
+		assert.Contains(t, connString, "Server=tcp:")
+		assert.Contains(t, connString, expected.ServerName)
+		assert.Contains(t, connString, expected.DatabaseName)
+	})
+
+	if expected.PrivateEndpointSubnetID != "" {
+		t.Run("PrivateDNS", func(t *testing.T) {
+			privatedns.ValidateApplied(t, terraformOptions, deploy.ARMClient(t), expected.ResourceGroupName, expected.VirtualNetworkID)
+		})
+	}
+}
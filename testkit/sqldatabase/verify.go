@@ -0,0 +1,222 @@
+package sqldatabase
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	osexec "os/exec"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	// Registers the sqlserver driver
+	_ "github.com/denisenkom/go-mssqldb"
+	"github.com/gruntwork-io/terratest/modules/docker"
+	"github.com/gruntwork-io/terratest/modules/logger"
+	"github.com/gruntwork-io/terratest/modules/random"
+	"github.com/gruntwork-io/terratest/modules/retry"
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// ConnectionSource supplies the ADO-style connection string Verify connects
+// with, such as the sql-database module's connection_string output
+type ConnectionSource interface {
+	// ConnectionString returns the connection string, failing t if there is
+	// none. Anything it starts is stopped when t completes.
+	ConnectionString(t *testing.T) string
+}
+
+// TerraformOutput is a ConnectionSource that reads an output of an applied
+// configuration
+type TerraformOutput struct {
+	Options *terraform.Options
+	// Name defaults to connection_string
+	Name string
+}
+
+// ConnectionString returns the output
+func (o TerraformOutput) ConnectionString(t *testing.T) string {
+	name := o.Name
+	if name == "" {
+		name = "connection_string"
+	}
+	return terraform.Output(t, o.Options, name)
+}
+
+// DefaultImage is the SQL Server image Container starts unless it names another
+const DefaultImage = "mcr.microsoft.com/mssql/server:2022-latest"
+
+// Container is a ConnectionSource that starts SQL Server in Docker, so Verify
+// runs without Azure. The server encrypts with a self-signed certificate,
+// which the connection string trusts.
+type Container struct {
+	// Image defaults to DefaultImage
+	Image string
+}
+
+// ConnectionString starts a new container, published on a free port on
+// 127.0.0.1 and stopped when t completes, and returns a connection string for
+// its sa login. It skips t when there is no Docker daemon to start it on.
+func (c Container) ConnectionString(t *testing.T) string {
+	if err := dockerReachable(); err != nil {
+		t.Skipf("SQL Server container needs Docker: %v", err)
+	}
+	image := c.Image
+	if image == "" {
+		image = DefaultImage
+	}
+	// Upper and lower case, digits and symbols, as the sa password policy wants
+	password := fmt.Sprintf("Tk-%s-a1", random.UniqueId())
+	id := docker.RunAndGetID(t, image, &docker.RunOptions{
+		Detach:               true,
+		Remove:               true,
+		EnvironmentVariables: []string{"ACCEPT_EULA=Y", "MSSQL_SA_PASSWORD=" + password},
+		OtherOptions:         []string{"--publish", "127.0.0.1::1433"},
+		// The command line holds the password
+		Logger: logger.Discard,
+	})
+	t.Cleanup(func() {
+		docker.Stop(t, []string{id}, &docker.StopOptions{})
+	})
+	port := docker.Inspect(t, id).GetExposedHostPort(1433)
+	require.NotZero(t, port, "container %s does not publish port 1433", id)
+	return fmt.Sprintf("Server=tcp:127.0.0.1,%d;Initial Catalog=master;User ID=sa;Password=%s;Encrypt=True;TrustServerCertificate=True;Connection Timeout=30;", port, password)
+}
+
+// dockerReachable returns an error unless the docker CLI is installed and its
+// daemon answers
+func dockerReachable() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	out, err := osexec.CommandContext(ctx, "docker", "info").CombinedOutput()
+	if err != nil && len(out) > 0 {
+		return fmt.Errorf("docker info: %v: %s", err, strings.TrimSpace(string(out)))
+	}
+	if err != nil {
+		return fmt.Errorf("docker info: %v", err)
+	}
+	return nil
+}
+
+// Connection retries cover firewall rules that take a while to apply and a
+// container that is still starting. Each ping gets pingTimeout, so Open gives
+// up on a server it cannot reach after about two minutes.
+const (
+	connectRetries  = 8
+	connectInterval = 5 * time.Second
+	pingTimeout     = 10 * time.Second
+	queryTimeout    = 30 * time.Second
+)
+
+// Verify connects with the connection string from source and checks that
+// the connection is encrypted, that it is logged in as the User ID the
+// connection string names and that it can create, write, read and drop a
+// table. The table has a unique name and is dropped when the check ends,
+// whether it passed or not.
+func Verify(t *testing.T, source ConnectionSource) {
+	connectionString := source.ConnectionString(t)
+	settings := ParseConnectionString(connectionString)
+	db := Open(t, connectionString)
+
+	t.Run("TLS", func(t *testing.T) {
+		encrypt, err := strconv.ParseBool(settings["encrypt"])
+		assert.True(t, err == nil && encrypt, "the connection string should set Encrypt=True")
+
+		var encryptOption string
+		queryRow(t, db, "SELECT encrypt_option FROM sys.dm_exec_connections WHERE session_id = @@SPID", &encryptOption)
+		assert.Equal(t, "TRUE", encryptOption, "the server should report the connection as encrypted")
+	})
+
+	t.Run("LoginUser", func(t *testing.T) {
+		// Azure SQL accepts user@server, and logs the user in
+		user, _, _ := strings.Cut(settings["user id"], "@")
+		require.NotEmpty(t, user, "the connection string should name a User ID")
+
+		var login string
+		queryRow(t, db, "SELECT SUSER_SNAME()", &login)
+		assert.Equal(t, user, login)
+	})
+
+	t.Run("ReadWrite", func(t *testing.T) {
+		table := TableName()
+		quoted := QuoteName(table)
+		t.Cleanup(func() {
+			ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+			defer cancel()
+			if _, err := db.ExecContext(ctx, "DROP TABLE IF EXISTS "+quoted); err != nil {
+				t.Errorf("dropping %s: %v", table, err)
+			}
+		})
+
+		exec(t, db, "CREATE TABLE "+quoted+" (id INT PRIMARY KEY, name NVARCHAR(50))")
+		exec(t, db, "INSERT INTO "+quoted+" (id, name) VALUES (@p1, @p2)", 1, table)
+		var name string
+		queryRow(t, db, "SELECT name FROM "+quoted+" WHERE id = @p1", &name, 1)
+		assert.Equal(t, table, name)
+	})
+}
+
+// Open connects to connectionString, retrying until the server answers, and
+// closes the connection when t completes
+func Open(t *testing.T, connectionString string) *sql.DB {
+	t.Helper()
+	db, err := sql.Open("sqlserver", connectionString)
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	retry.DoWithRetry(t, "Connect to SQL Server", connectRetries, connectInterval, func() (string, error) {
+		ctx, cancel := context.WithTimeout(context.Background(), pingTimeout)
+		defer cancel()
+		return "", db.PingContext(ctx)
+	})
+	return db
+}
+
+// TableName returns a table name no other run uses, such as testkit_a1b2c3
+func TableName() string {
+	return "testkit_" + strings.ToLower(random.UniqueId())
+}
+
+// QuoteName delimits name as an identifier, as T-SQL's QUOTENAME does, for
+// statements that cannot take it as a parameter
+func QuoteName(name string) string {
+	return "[" + strings.ReplaceAll(name, "]", "]]") + "]"
+}
+
+// ParseConnectionString splits an ADO-style connection string into its
+// settings, keyed in lower case, with the driver's synonyms for the User ID
+// resolved
+func ParseConnectionString(connectionString string) map[string]string {
+	settings := map[string]string{}
+	for _, part := range strings.Split(connectionString, ";") {
+		key, value, _ := strings.Cut(part, "=")
+		key = strings.ToLower(strings.TrimSpace(key))
+		if key == "" {
+			continue
+		}
+		switch key {
+		case "user", "uid":
+			key = "user id"
+		}
+		settings[key] = strings.TrimSpace(value)
+	}
+	return settings
+}
+
+func exec(t *testing.T, db *sql.DB, query string, args ...interface{}) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+	_, err := db.ExecContext(ctx, query, args...)
+	require.NoError(t, err, query)
+}
+
+func queryRow(t *testing.T, db *sql.DB, query string, dest interface{}, args ...interface{}) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+	require.NoError(t, db.QueryRowContext(ctx, query, args...).Scan(dest), query)
+}
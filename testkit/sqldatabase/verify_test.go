@@ -0,0 +1,54 @@
+package sqldatabase
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseConnectionString(t *testing.T) {
+	t.Parallel()
+
+	settings := ParseConnectionString("Server=tcp:sql.database.windows.net,1433;Initial Catalog=rpg-gaming-db;Persist Security Info=False;User ID=sqladmin;Password=p=w;Encrypt=True;TrustServerCertificate=False;Connection Timeout=30;")
+	assert.Equal(t, "tcp:sql.database.windows.net,1433", settings["server"])
+	assert.Equal(t, "sqladmin", settings["user id"])
+	assert.Equal(t, "p=w", settings["password"], "only the first = separates the key")
+	assert.Equal(t, "True", settings["encrypt"])
+	assert.Equal(t, "False", settings["trustservercertificate"])
+
+	assert.Equal(t, "sa", ParseConnectionString("server=localhost; UID = sa")["user id"])
+}
+
+func TestTableName(t *testing.T) {
+	t.Parallel()
+
+	name := TableName()
+	assert.Regexp(t, `^testkit_[a-z0-9]{6}$`, name)
+	assert.NotEqual(t, name, TableName())
+}
+
+func TestQuoteName(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, "[testkit_a1b2c3]", QuoteName("testkit_a1b2c3"))
+	assert.Equal(t, "[a]]; DROP TABLE x; --]", QuoteName("a]; DROP TABLE x; --"))
+}
+
+func TestConnectBudget(t *testing.T) {
+	t.Parallel()
+
+	budget := connectRetries * (pingTimeout + connectInterval)
+	assert.LessOrEqual(t, budget, 2*time.Minute, "Open should give up on an unreachable server within two minutes")
+}
+
+func TestContainerWithoutDocker(t *testing.T) {
+	t.Setenv("PATH", t.TempDir())
+
+	var skipped bool
+	t.Run("ConnectionString", func(t *testing.T) {
+		defer func() { skipped = t.Skipped() }()
+		Container{}.ConnectionString(t)
+	})
+	assert.True(t, skipped, "a Container test should skip without Docker")
+}
@@ -0,0 +1,611 @@
+// Package stack deploys and validates a complete RPG AI App stack: a root
+// configuration that wires the shared modules into one VNet
+package stack
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/netip"
+	"os"
+	"testing"
+
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	test_structure "github.com/gruntwork-io/terratest/modules/test-structure"
+	tfjson "github.com/hashicorp/terraform-json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/vanehru/terraform-modules/testkit/arm"
+	"github.com/vanehru/terraform-modules/testkit/backendapi"
+	"github.com/vanehru/terraform-modules/testkit/backendapi/apitest"
+	"github.com/vanehru/terraform-modules/testkit/config"
+	"github.com/vanehru/terraform-modules/testkit/deploy"
+	"github.com/vanehru/terraform-modules/testkit/idempotency"
+	"github.com/vanehru/terraform-modules/testkit/keyvault"
+	"github.com/vanehru/terraform-modules/testkit/migrate"
+	"github.com/vanehru/terraform-modules/testkit/privatedns"
+	"github.com/vanehru/terraform-modules/testkit/sqldatabase"
+	"github.com/vanehru/terraform-modules/testkit/subnetplan"
+	"github.com/vanehru/terraform-modules/testkit/tfconfig"
+)
+
+// Outputs are the root outputs Validate and ValidateIntegration read
+var Outputs = []string{
+	"resource_group_name",
+	"resource_group_location",
+	"vnet_name",
+	"vnet_address_space",
+	"subnet_configuration",
+	"function_app_name",
+	"function_app_identity_principal_id",
+	"function_app_vnet_integration_enabled",
+	"function_app_default_hostname",
+	"key_vault_name",
+	"key_vault_uri",
+	"key_vault_private_endpoint_enabled",
+	"key_vault_network_default_action",
+	"key_vault_private_endpoint_id",
+	"sql_server_name",
+	"sql_database_name",
+	"sql_connection_string",
+	"sql_admin_username",
+	"sql_server_fqdn",
+	"sql_private_endpoint_enabled",
+	"sql_public_network_access_enabled",
+	"sql_private_endpoint_id",
+	"openai_account_name",
+	"openai_endpoint",
+	"openai_primary_key",
+	"openai_private_endpoint_enabled",
+	"openai_public_network_access_enabled",
+	"openai_private_endpoint_id",
+	"static_web_app_name",
+	"static_web_app_default_hostname",
+	"static_web_app_api_key",
+	"storage_public_network_access_enabled",
+	"storage_private_endpoint_id",
+}
+
+// VirtualNetwork is the address of the VNet every RPG AI App stack deploys
+const VirtualNetwork = "azurerm_virtual_network.vnet"
+
+// DefaultSubnets are the subnets every RPG AI App stack deploys
+var DefaultSubnets = []string{
+	"app-subnet",
+	"storage-subnet",
+	"keyvault-subnet",
+	"database-subnet",
+	"openai-subnet",
+	"deployment-subnet",
+}
+
+// DefaultSecrets are the Key Vault secrets the backend reads
+var DefaultSecrets = []string{
+	"sql-connection-string",
+	"sql-username",
+	"sql-server-fqdn",
+	"sql-database-name",
+	"openai-endpoint",
+	"openai-key",
+}
+
+// Unstable are the attributes a second plan of an RPG AI App stack is known
+// to change. Test passes caller_ip to every root that declares it, so the
+// address in the Key Vault firewall is the same on every plan, and only its
+// form can differ. Nothing else is listed: random_password and random_string
+// have no keepers, the secrets are keyed by name through
+// nonsensitive(var.secrets) so their instances do not change, and
+// idempotency.TestNoImpureCalls keeps timestamp() and the like out of both
+// roots and their modules.
+var Unstable = []idempotency.Unstable{
+	{
+		Address:   "module.key_vault.azurerm_key_vault.kv",
+		Attribute: "network_acls.0.ip_rules",
+		Reason:    "Key Vault stores the bare caller_ip as a /32 CIDR, which a plan can report as a change back",
+	},
+}
+
+// Expected describes the stack a test deploys and expects back
+type Expected struct {
+	ResourceGroupName string
+	Location          string
+	VNetAddressSpace  string
+	Subnets           []string
+	Secrets           []string
+	// CallerIP is the address the Key Vault firewall allows, for roots with
+	// a caller_ip variable. Test sets it from deploy.CallerIP when it is the
+	// zero Addr and the root declares caller_ip; Vars leaves the zero Addr
+	// out.
+	CallerIP netip.Addr
+	// ResourceGroupTags are passed as resource_group_tags, which the roots
+	// merge into their own resource group tags. Test adds
+	// janitor.CreatedTag to them.
+	ResourceGroupTags map[string]string
+}
+
+// Vars returns the root inputs that deploy expected
+func Vars(expected Expected) map[string]interface{} {
+	vars := map[string]interface{}{
+		"azurerm_resource_group_name":     expected.ResourceGroupName,
+		"azurerm_resource_group_location": expected.Location,
+	}
+	if expected.CallerIP.IsValid() {
+		vars["caller_ip"] = expected.CallerIP.String()
+	}
+	if len(expected.ResourceGroupTags) > 0 {
+		vars["resource_group_tags"] = expected.ResourceGroupTags
+	}
+	return vars
+}
+
+// Stage names. Set SKIP_<stage>, such as SKIP_teardown=true, to skip one.
+const (
+	StageDeploy      = "deploy"
+	StageValidate    = "validate"
+	StageIntegration = "integration"
+	StageTeardown    = "teardown"
+)
+
+// expectedFile is where Test keeps the generated Expected in workingDir
+const expectedFile = "Expected.json"
+
+// Test runs the stack suite in stages: deploy, validate, integration and
+// teardown. The deploy stage saves the terraform.Options and the Expected from
+// newExpected to workingDir, and later stages, in this run or the next, load
+// them from there. To iterate on validations against a deployed stack, run
+// once with SKIP_teardown=true, then with SKIP_deploy=true and
+// SKIP_teardown=true until they pass, and finally with SKIP_deploy=true.
+//
+// A deploy stage that finds saved data reapplies the same stack rather than
+// generating new names. Each apply is followed by an Idempotent subtest that
+// fails if a second plan would change anything Unstable does not cover. The
+// resource group is stamped for the janitor through the root's
+// resource_group_tags when the Expected is generated, so every reapply keeps
+// the first stamp and a plan sees no tag drift. Teardown is registered with
+// t.Cleanup, so it runs even if an earlier stage fails or panics. It follows the cleanup policy in
+// test-config.yml and clears workingDir once the stack is destroyed. Test
+// fails up front if the go test deadline is shorter than the full_test
+// timeout, or the integration_test timeout when the deploy is skipped.
+func Test(t *testing.T, terraformDir, workingDir string, newExpected func() Expected) {
+	// Without a deploy only the checks have to fit in the go test deadline
+	tier := config.FullTest
+	if os.Getenv(test_structure.SKIP_STAGE_ENV_VAR_PREFIX+StageDeploy) != "" {
+		tier = config.IntegrationTest
+	}
+	config.ForTest(t).RequireTimeout(t, tier)
+
+	t.Cleanup(func() {
+		test_structure.RunTestStage(t, StageTeardown, func() {
+			if !saved(t, workingDir) {
+				t.Logf("Nothing saved in %s to tear down", workingDir)
+				return
+			}
+			_, expected := load(t, workingDir)
+			if deploy.Destroy(t, test_structure.LoadTerraformOptions(t, workingDir), expected.ResourceGroupName) {
+				test_structure.CleanupTestDataFolder(t, workingDir)
+			}
+		})
+	})
+
+	test_structure.RunTestStage(t, StageDeploy, func() {
+		if !saved(t, workingDir) {
+			expected := prepare(t, terraformDir, newExpected(), func() netip.Addr { return deploy.CallerIP(t) })
+			// Options may skip t, which must leave nothing for teardown
+			terraformOptions := deploy.Options(t, terraformDir, Vars(expected))
+			test_structure.SaveTestData(t, test_structure.FormatTestDataPath(workingDir, expectedFile), true, expected)
+			test_structure.SaveTerraformOptions(t, workingDir, terraformOptions)
+		}
+		terraformOptions, _ := load(t, workingDir)
+		terraform.InitAndApply(t, terraformOptions)
+		t.Run("Idempotent", func(t *testing.T) {
+			idempotency.Check(t, terraformOptions, Unstable)
+		})
+	})
+
+	test_structure.RunTestStage(t, StageValidate, func() {
+		terraformOptions, expected := load(t, workingDir)
+		Validate(t, terraformOptions, expected)
+	})
+
+	test_structure.RunTestStage(t, StageIntegration, func() {
+		terraformOptions, expected := load(t, workingDir)
+		ValidateIntegration(t, terraformOptions, expected)
+	})
+}
+
+// prepare fills in what Test adds to a generated Expected: the janitor's
+// creation stamp, and callerIP when the root in terraformDir declares caller_ip
+// and the Expected has none, so no plan falls back to looking the address up
+func prepare(t *testing.T, terraformDir string, expected Expected, callerIP func() netip.Addr) Expected {
+	t.Helper()
+	root, err := tfconfig.Load(terraformDir)
+	require.NoError(t, err)
+	if _, ok := root.Variables["caller_ip"]; ok && !expected.CallerIP.IsValid() {
+		expected.CallerIP = callerIP()
+	}
+	expected.ResourceGroupTags = deploy.CreatedTags(expected.ResourceGroupTags)
+	return expected
+}
+
+// saved reports whether a deploy stage has saved a stack to workingDir
+func saved(t *testing.T, workingDir string) bool {
+	return test_structure.IsTestDataPresent(t, test_structure.FormatTestDataPath(workingDir, expectedFile))
+}
+
+// load returns what the deploy stage saved to workingDir
+func load(t *testing.T, workingDir string) (*terraform.Options, Expected) {
+	var expected Expected
+	test_structure.LoadTestData(t, test_structure.FormatTestDataPath(workingDir, expectedFile), &expected)
+	return test_structure.LoadTerraformOptions(t, workingDir), expected
+}
+
+// BackendAPI returns a client for the backend API that test.backend_api_url
+// names: an apitest stub when it is empty, the Function App of the stack the
+// deploy stage saved to workingDir when it is config.BackendAPIStack, or else
+// the URL itself, such as a func start on http://localhost:7071/api
+func BackendAPI(t *testing.T, workingDir string) *backendapi.Client {
+	t.Helper()
+	switch baseURL := config.ForTest(t).BackendAPIURL(); baseURL {
+	case "":
+		return backendapi.NewClient(apitest.NewServer(t).BaseURL())
+	case config.BackendAPIStack:
+		if !saved(t, workingDir) {
+			t.Fatalf("test.backend_api_url is %q but no stack is saved in %s; deploy one with SKIP_teardown=true first", baseURL, workingDir)
+		}
+		terraformOptions, _ := load(t, workingDir)
+		hostname := terraform.Output(t, terraformOptions, "function_app_default_hostname")
+		return backendapi.NewClient("https://" + hostname + "/api")
+	default:
+		return backendapi.NewClient(baseURL)
+	}
+}
+
+// SQLDatabase returns the database test.sql_database names: a SQL Server
+// container when it is empty, or the sql_connection_string output of the
+// stack the deploy stage saved to workingDir when it is
+// config.SQLDatabaseStack
+func SQLDatabase(t *testing.T, workingDir string) sqldatabase.ConnectionSource {
+	t.Helper()
+	if config.ForTest(t).SQLDatabase() == "" {
+		return sqldatabase.Container{}
+	}
+	if !saved(t, workingDir) {
+		t.Fatalf("test.sql_database is %q but no stack is saved in %s; deploy one with SKIP_teardown=true first", config.SQLDatabaseStack, workingDir)
+	}
+	terraformOptions, _ := load(t, workingDir)
+	return stackDatabase(terraformOptions)
+}
+
+// stackDatabase is the database of an applied stack
+func stackDatabase(terraformOptions *terraform.Options) sqldatabase.ConnectionSource {
+	return sqldatabase.TerraformOutput{Options: terraformOptions, Name: "sql_connection_string"}
+}
+
+// Validate runs the standard checks against an applied stack
+func Validate(t *testing.T, terraformOptions *terraform.Options, expected Expected) {
+	t.Run("ResourceGroupExists", func(t *testing.T) {
+		validateResourceGroup(t, terraformOptions, expected)
+	})
+
+	t.Run("VNetConfiguration", func(t *testing.T) {
+		validateVNet(t, terraformOptions, expected)
+	})
+
+	t.Run("SubnetConfiguration", func(t *testing.T) {
+		validateSubnets(t, terraformOptions, expected)
+	})
+
+	t.Run("FunctionAppDeployment", func(t *testing.T) {
+		validateFunctionApp(t, terraformOptions)
+	})
+
+	t.Run("KeyVaultDeployment", func(t *testing.T) {
+		validateKeyVault(t, terraformOptions)
+	})
+
+	t.Run("SQLDatabaseDeployment", func(t *testing.T) {
+		validateSQLDatabase(t, terraformOptions)
+	})
+
+	t.Run("OpenAIDeployment", func(t *testing.T) {
+		validateOpenAI(t, terraformOptions)
+	})
+
+	t.Run("StaticWebAppDeployment", func(t *testing.T) {
+		validateStaticWebApp(t, terraformOptions)
+	})
+
+	t.Run("NetworkSecurity", func(t *testing.T) {
+		validateNetworkIsolation(t, terraformOptions)
+	})
+
+	t.Run("PrivateEndpoints", func(t *testing.T) {
+		validatePrivateEndpoints(t, terraformOptions)
+	})
+}
+
+// ValidateIntegration checks that the components of an applied stack are
+// wired together
+func ValidateIntegration(t *testing.T, terraformOptions *terraform.Options, expected Expected) {
+	t.Run("FunctionAppToKeyVaultIntegration", func(t *testing.T) {
+		validateFunctionAppKeyVaultIntegration(t, terraformOptions)
+	})
+
+	t.Run("KeyVaultSecretsIntegration", func(t *testing.T) {
+		validateKeyVaultSecretsIntegration(t, terraformOptions, expected)
+	})
+
+	t.Run("PrivateEndpointsConnectivity", func(t *testing.T) {
+		validatePrivateEndpoints(t, terraformOptions)
+	})
+
+	t.Run("StaticWebAppAccessibility", func(t *testing.T) {
+		validateStaticWebAppAccessibility(t, terraformOptions)
+	})
+
+	t.Run("DatabaseSchema", func(t *testing.T) {
+		validateDatabaseSchema(t, terraformOptions)
+	})
+
+	t.Run("NetworkIsolation", func(t *testing.T) {
+		validateNetworkIsolation(t, terraformOptions)
+
+		openAIPublicAccess := terraform.Output(t, terraformOptions, "openai_public_network_access_enabled")
+		assert.Equal(t, "false", openAIPublicAccess, "OpenAI should not allow public access")
+	})
+}
+
+// validateResourceGroup validates that the resource group was created
+func validateResourceGroup(t *testing.T, terraformOptions *terraform.Options, expected Expected) {
+	rgName := terraform.Output(t, terraformOptions, "resource_group_name")
+	assert.Equal(t, expected.ResourceGroupName, rgName, "Resource group name should match expected value")
+
+	rgLocation := terraform.Output(t, terraformOptions, "resource_group_location")
+	assert.Equal(t, arm.NormalizeLocation(expected.Location), arm.NormalizeLocation(rgLocation),
+		"Resource group location should match expected location")
+}
+
+// validateVNet validates the Virtual Network configuration
+func validateVNet(t *testing.T, terraformOptions *terraform.Options, expected Expected) {
+	vnetName := terraform.Output(t, terraformOptions, "vnet_name")
+	assert.NotEmpty(t, vnetName, "VNet name should not be empty")
+
+	addressSpace := terraform.OutputList(t, terraformOptions, "vnet_address_space")
+	assert.Contains(t, addressSpace, expected.VNetAddressSpace, "VNet should have expected address space")
+}
+
+// validateSubnets compares the deployed subnet ranges with the layout the
+// configuration declares
+func validateSubnets(t *testing.T, terraformOptions *terraform.Options, expected Expected) {
+	vnetName := terraform.Output(t, terraformOptions, "vnet_name")
+	assert.NotEmpty(t, vnetName, "VNet name should not be empty")
+
+	layout, err := subnetplan.Load(terraformOptions.TerraformDir)
+	require.NoError(t, err)
+	expectedRanges := map[string]string{}
+	for _, subnet := range layout.Subnets {
+		expectedRanges[subnet.Name] = subnet.Prefix.String()
+	}
+
+	subnetConfiguration := terraform.OutputMapOfObjects(t, terraformOptions, "subnet_configuration")
+	deployedRanges := map[string]string{}
+	for _, value := range subnetConfiguration {
+		subnet, ok := value.(map[string]interface{})
+		require.True(t, ok, "subnet_configuration entries should be objects")
+		deployedRanges[fmt.Sprint(subnet["name"])] = fmt.Sprint(subnet["address_range"])
+	}
+
+	for _, subnetName := range expected.Subnets {
+		subnetName := subnetName
+		t.Run(subnetName, func(t *testing.T) {
+			require.Contains(t, deployedRanges, subnetName, "Subnet %s should be deployed in VNet %s", subnetName, vnetName)
+			assert.Equal(t, expectedRanges[subnetName], deployedRanges[subnetName], "Subnet %s address range", subnetName)
+		})
+	}
+}
+
+// validateFunctionApp validates the Function App deployment
+func validateFunctionApp(t *testing.T, terraformOptions *terraform.Options) {
+	functionAppName := terraform.Output(t, terraformOptions, "function_app_name")
+	assert.NotEmpty(t, functionAppName, "Function App name should not be empty")
+
+	identityPrincipalID := terraform.Output(t, terraformOptions, "function_app_identity_principal_id")
+	assert.NotEmpty(t, identityPrincipalID, "Function App should have managed identity enabled")
+
+	vnetIntegrationEnabled := terraform.Output(t, terraformOptions, "function_app_vnet_integration_enabled")
+	assert.Equal(t, "true", vnetIntegrationEnabled, "Function App should have VNet integration enabled")
+}
+
+// validateKeyVault validates the Key Vault deployment
+func validateKeyVault(t *testing.T, terraformOptions *terraform.Options) {
+	keyVaultName := terraform.Output(t, terraformOptions, "key_vault_name")
+	assert.NotEmpty(t, keyVaultName, "Key Vault name should not be empty")
+
+	keyVaultURI := terraform.Output(t, terraformOptions, "key_vault_uri")
+	assert.Contains(t, keyVaultURI, "vault.azure.net", "Key Vault URI should be valid")
+
+	privateEndpointEnabled := terraform.Output(t, terraformOptions, "key_vault_private_endpoint_enabled")
+	assert.Equal(t, "true", privateEndpointEnabled, "Key Vault should have private endpoint enabled")
+}
+
+// validateSQLDatabase validates the SQL Database deployment
+func validateSQLDatabase(t *testing.T, terraformOptions *terraform.Options) {
+	sqlServerName := terraform.Output(t, terraformOptions, "sql_server_name")
+	assert.NotEmpty(t, sqlServerName, "SQL Server name should not be empty")
+
+	sqlDatabaseName := terraform.Output(t, terraformOptions, "sql_database_name")
+	assert.NotEmpty(t, sqlDatabaseName, "SQL Database name should not be empty")
+
+	privateEndpointEnabled := terraform.Output(t, terraformOptions, "sql_private_endpoint_enabled")
+	assert.Equal(t, "true", privateEndpointEnabled, "SQL Server should have private endpoint enabled")
+}
+
+// validateOpenAI validates the Azure OpenAI deployment
+func validateOpenAI(t *testing.T, terraformOptions *terraform.Options) {
+	openAIName := terraform.Output(t, terraformOptions, "openai_account_name")
+	assert.NotEmpty(t, openAIName, "OpenAI account name should not be empty")
+
+	openAIEndpoint := terraform.Output(t, terraformOptions, "openai_endpoint")
+	assert.Contains(t, openAIEndpoint, "openai.azure.com", "OpenAI endpoint should be valid")
+
+	privateEndpointEnabled := terraform.Output(t, terraformOptions, "openai_private_endpoint_enabled")
+	assert.Equal(t, "true", privateEndpointEnabled, "OpenAI should have private endpoint enabled")
+}
+
+// validateStaticWebApp validates the Static Web App deployment
+func validateStaticWebApp(t *testing.T, terraformOptions *terraform.Options) {
+	swaName := terraform.Output(t, terraformOptions, "static_web_app_name")
+	assert.NotEmpty(t, swaName, "Static Web App name should not be empty")
+
+	defaultHostname := terraform.Output(t, terraformOptions, "static_web_app_default_hostname")
+	assert.Contains(t, defaultHostname, ".azurestaticapps.net", "Static Web App hostname should be valid")
+
+	apiKey := terraform.Output(t, terraformOptions, "static_web_app_api_key")
+	assert.NotEmpty(t, apiKey, "Static Web App API key should not be empty")
+}
+
+// validateNetworkIsolation validates that the data services deny public access
+func validateNetworkIsolation(t *testing.T, terraformOptions *terraform.Options) {
+	storagePublicAccess := terraform.Output(t, terraformOptions, "storage_public_network_access_enabled")
+	assert.Equal(t, "false", storagePublicAccess, "Storage account should have public network access disabled")
+
+	keyVaultNetworkAction := terraform.Output(t, terraformOptions, "key_vault_network_default_action")
+	assert.Equal(t, "Deny", keyVaultNetworkAction, "Key Vault should deny access by default")
+
+	sqlPublicAccess := terraform.Output(t, terraformOptions, "sql_public_network_access_enabled")
+	assert.Equal(t, "false", sqlPublicAccess, "SQL Server should have public network access disabled")
+}
+
+// validatePrivateEndpoints validates that all private endpoints are properly configured
+func validatePrivateEndpoints(t *testing.T, terraformOptions *terraform.Options) {
+	vnetName := terraform.Output(t, terraformOptions, "vnet_name")
+	assert.NotEmpty(t, vnetName, "VNet should exist for private endpoints")
+
+	t.Run("StoragePrivateEndpoint", func(t *testing.T) {
+		storagePrivateEndpointID := terraform.Output(t, terraformOptions, "storage_private_endpoint_id")
+		assert.NotEmpty(t, storagePrivateEndpointID, "Storage private endpoint should exist")
+	})
+
+	t.Run("KeyVaultPrivateEndpoint", func(t *testing.T) {
+		kvPrivateEndpointID := terraform.Output(t, terraformOptions, "key_vault_private_endpoint_id")
+		assert.NotEmpty(t, kvPrivateEndpointID, "Key Vault private endpoint should exist")
+	})
+
+	t.Run("SQLPrivateEndpoint", func(t *testing.T) {
+		sqlPrivateEndpointID := terraform.Output(t, terraformOptions, "sql_private_endpoint_id")
+		assert.NotEmpty(t, sqlPrivateEndpointID, "SQL private endpoint should exist")
+	})
+
+	t.Run("OpenAIPrivateEndpoint", func(t *testing.T) {
+		openAIPrivateEndpointID := terraform.Output(t, terraformOptions, "openai_private_endpoint_id")
+		assert.NotEmpty(t, openAIPrivateEndpointID, "OpenAI private endpoint should exist")
+	})
+
+	t.Run("PrivateDNS", func(t *testing.T) {
+		validatePrivateDNS(t, terraformOptions)
+	})
+}
+
+// validatePrivateDNS checks that each private DNS zone is the one its private
+// endpoint needs, holds the endpoint's address and is linked to the VNet, and
+// resolves each record as Azure DNS would in the VNet
+func validatePrivateDNS(t *testing.T, terraformOptions *terraform.Options) {
+	dns := privatedns.Load(t, terraformOptions)
+	resourceGroupName := terraform.Output(t, terraformOptions, "resource_group_name")
+	vnetID := dns.VirtualNetworks[VirtualNetwork]
+	require.NotEmpty(t, vnetID, "%s should be in the state", VirtualNetwork)
+
+	privatedns.Validate(t, dns, VirtualNetwork,
+		&privatedns.ARMResolver{Client: deploy.ARMClient(t), ResourceGroup: resourceGroupName, VirtualNetworkID: vnetID})
+}
+
+// validateFunctionAppKeyVaultIntegration reads the vault's access policies, or
+// with RBAC authorization the role assignments on it, through Resource
+// Manager. It checks that the Function App's identity can only get and list
+// secrets, and that the deploying principal can manage secrets and delete and
+// purge exactly what main.tf declares for it, in the key_vault module block's
+// access_policies or in role assignments scoped to that vault.
+func validateFunctionAppKeyVaultIntegration(t *testing.T, terraformOptions *terraform.Options) {
+	declared, err := keyvault.DeclaredPolicies(terraformOptions.TerraformDir, "key_vault")
+	require.NoError(t, err)
+	deployer, err := keyvault.DeclaredDeployer(declared)
+	require.NoError(t, err)
+	assignments, err := keyvault.DeclaredRoleAssignments(terraformOptions.TerraformDir, "key_vault")
+	require.NoError(t, err)
+
+	keyvault.ValidateAccess(t, &keyvault.ARMVaults{Client: deploy.ARMClient(t)},
+		terraform.Output(t, terraformOptions, "resource_group_name"),
+		terraform.Output(t, terraformOptions, "key_vault_name"),
+		keyvault.ExpectedAccess{
+			FunctionAppPrincipalID: terraform.Output(t, terraformOptions, "function_app_identity_principal_id"),
+			DeployerObjectID:       deployerObjectID(t, terraformOptions),
+			Deployer:               deployer,
+			DeployerRoles:          keyvault.DeclaredDeployerRoles(assignments),
+		})
+}
+
+// deployerObjectID returns the object ID of the principal that applied the
+// stack, as data.azurerm_client_config.current read it
+func deployerObjectID(t *testing.T, terraformOptions *terraform.Options) string {
+	var state tfjson.State
+	require.NoError(t, json.Unmarshal([]byte(terraform.Show(t, terraformOptions)), &state))
+	require.NotNil(t, state.Values, "the state should not be empty")
+	for _, r := range state.Values.RootModule.Resources {
+		if r.Address == "data.azurerm_client_config.current" {
+			objectID, _ := r.AttributeValues["object_id"].(string)
+			return objectID
+		}
+	}
+	t.Fatal("data.azurerm_client_config.current should be in the state")
+	return ""
+}
+
+// validateKeyVaultSecretsIntegration reads every expected secret back from the
+// vault and compares it with the Terraform output it was stored from. The
+// runner needs a network path to the vault, whose default action is Deny.
+func validateKeyVaultSecretsIntegration(t *testing.T, terraformOptions *terraform.Options, expected Expected) {
+	outputs := secretOutputs(t, terraformOptions)
+	want := map[string]string{}
+	for _, name := range expected.Secrets {
+		// Secrets without a matching output only have to be non-empty
+		want[name] = outputs[name]
+	}
+
+	keyVaultURI := terraform.Output(t, terraformOptions, "key_vault_uri")
+	keyvault.ValidateSecrets(t, keyvault.ClientFor(t, keyVaultURI), want)
+}
+
+// validateDatabaseSchema applies the backend's migrations to the stack's
+// database, as a deployment would, and checks its tables against
+// backendapi.Schema. The runner needs a network path to the server, whose
+// public network access is disabled. The fake Resource Manager has no
+// server behind its database to connect to.
+func validateDatabaseSchema(t *testing.T, terraformOptions *terraform.Options) {
+	if config.ForTest(t).FakeARM() {
+		t.Skip("test.fake_arm: the fake Resource Manager serves no SQL Server to migrate")
+	}
+	dir, err := backendapi.FindMigrations(".")
+	require.NoError(t, err)
+	db := sqldatabase.Open(t, stackDatabase(terraformOptions).ConnectionString(t))
+	migrate.Validate(t, db, dir, backendapi.Schema)
+}
+
+// secretOutputs returns the value each of DefaultSecrets is stored from
+func secretOutputs(t *testing.T, terraformOptions *terraform.Options) map[string]string {
+	return map[string]string{
+		"sql-connection-string": terraform.Output(t, terraformOptions, "sql_connection_string"),
+		"sql-username":          terraform.Output(t, terraformOptions, "sql_admin_username"),
+		"sql-server-fqdn":       terraform.Output(t, terraformOptions, "sql_server_fqdn"),
+		"sql-database-name":     terraform.Output(t, terraformOptions, "sql_database_name"),
+		"openai-endpoint":       terraform.Output(t, terraformOptions, "openai_endpoint"),
+		"openai-key":            terraform.Output(t, terraformOptions, "openai_primary_key"),
+	}
+}
+
+// validateStaticWebAppAccessibility verifies Static Web App is accessible
+func validateStaticWebAppAccessibility(t *testing.T, terraformOptions *terraform.Options) {
+	swaHostname := terraform.Output(t, terraformOptions, "static_web_app_default_hostname")
+	assert.Contains(t, swaHostname, ".azurestaticapps.net", "Static Web App hostname should be valid")
+
+	t.Logf("Static Web App URL: https://%s", swaHostname)
+}
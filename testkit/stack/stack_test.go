@@ -0,0 +1,91 @@
+package stack
+
+import (
+	"net/netip"
+	"os"
+	"path/filepath"
+	"testing"
+
+	test_structure "github.com/gruntwork-io/terratest/modules/test-structure"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/vanehru/terraform-modules/testkit/callerip"
+	"github.com/vanehru/terraform-modules/testkit/config"
+	"github.com/vanehru/terraform-modules/testkit/deploy"
+	"github.com/vanehru/terraform-modules/testkit/janitor"
+)
+
+// TestSavedStack verifies that a later stage loads the Expected and options
+// the deploy stage saved
+func TestSavedStack(t *testing.T) {
+	t.Parallel()
+
+	workingDir := t.TempDir()
+	require.False(t, saved(t, workingDir))
+
+	expected := Expected{
+		ResourceGroupName: "rpg-aiapp-rg-test-abc123",
+		Location:          config.Default().Region(),
+		VNetAddressSpace:  "172.16.0.0/16",
+		Subnets:           DefaultSubnets,
+		Secrets:           DefaultSecrets,
+		CallerIP:          callerip.Placeholder,
+		ResourceGroupTags: deploy.CreatedTags(nil),
+	}
+	test_structure.SaveTestData(t, test_structure.FormatTestDataPath(workingDir, expectedFile), true, expected)
+	test_structure.SaveTerraformOptions(t, workingDir, deploy.Options(t, "../", Vars(expected)))
+	require.True(t, saved(t, workingDir))
+
+	terraformOptions, loaded := load(t, workingDir)
+	assert.Equal(t, expected, loaded)
+	assert.Equal(t, "../", terraformOptions.TerraformDir)
+	assert.Equal(t, expected.ResourceGroupName, terraformOptions.Vars["azurerm_resource_group_name"])
+	assert.Equal(t, "203.0.113.10", terraformOptions.Vars["caller_ip"])
+	tags, _ := terraformOptions.Vars["resource_group_tags"].(map[string]interface{})
+	assert.Equal(t, expected.ResourceGroupTags[janitor.CreatedTag], tags[janitor.CreatedTag],
+		"a later apply should pass the stamp the deploy stage saved")
+}
+
+// TestVarsWithoutCallerIP verifies that a root without caller_ip gets none, and
+// that no resource_group_tags are passed unless there are some
+func TestVarsWithoutCallerIP(t *testing.T) {
+	t.Parallel()
+
+	vars := Vars(Expected{ResourceGroupName: "rg", Location: "Japan East"})
+	assert.NotContains(t, vars, "caller_ip")
+	assert.NotContains(t, vars, "resource_group_tags")
+}
+
+// TestPrepareCallerIP verifies that Test passes the caller IP to a root that
+// declares caller_ip, keeps one the Expected already has, and leaves it out
+// for a root without the variable
+func TestPrepareCallerIP(t *testing.T) {
+	t.Parallel()
+
+	withCallerIP := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(withCallerIP, "variables.tf"), []byte(`variable "caller_ip" {
+  type    = string
+  default = ""
+}
+`), 0o644))
+	withoutCallerIP := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(withoutCallerIP, "variables.tf"), []byte(`variable "azurerm_resource_group_name" {
+  type = string
+}
+`), 0o644))
+	detected := netip.MustParseAddr("198.51.100.7")
+	callerIP := func() netip.Addr { return detected }
+
+	expected := prepare(t, withCallerIP, Expected{ResourceGroupName: "rg"}, callerIP)
+	assert.Equal(t, detected, expected.CallerIP)
+	assert.Equal(t, "198.51.100.7", Vars(expected)["caller_ip"])
+	assert.Contains(t, expected.ResourceGroupTags, janitor.CreatedTag)
+
+	expected = prepare(t, withCallerIP, Expected{ResourceGroupName: "rg", CallerIP: callerip.Placeholder}, callerIP)
+	assert.Equal(t, callerip.Placeholder, expected.CallerIP)
+
+	expected = prepare(t, withoutCallerIP, Expected{ResourceGroupName: "rg"}, callerIP)
+	assert.False(t, expected.CallerIP.IsValid())
+	assert.NotContains(t, Vars(expected), "caller_ip")
+}
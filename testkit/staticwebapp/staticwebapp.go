@@ -0,0 +1,63 @@
+// Package staticwebapp deploys and validates the static-web-app module
+package staticwebapp
+
+import (
+	"testing"
+
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/vanehru/terraform-modules/testkit/deploy"
+	"github.com/vanehru/terraform-modules/testkit/naming"
+)
+
+// Outputs are the module outputs Validate reads
+var Outputs = []string{"static_web_app_name", "default_host_name", "api_key"}
+
+// Expected describes the Static Web App a test deploys and expects back
+type Expected struct {
+	Name              string
+	ResourceGroupName string
+	// Location must be a region Static Web Apps are offered in, such as East Asia
+	Location string
+}
+
+// Vars returns the module inputs that deploy expected on the Free tier
+func Vars(expected Expected) map[string]interface{} {
+	return map[string]interface{}{
+		"static_web_app_name": expected.Name,
+		"location":            expected.Location,
+		"resource_group_name": expected.ResourceGroupName,
+		"sku_tier":            "Free",
+		"sku_size":            "Free",
+	}
+}
+
+// Test deploys the static-web-app module in terraformDir, validates it
+// against expected and destroys it. Names Azure would reject fail the test
+// before anything is deployed.
+func Test(t *testing.T, terraformDir string, expected Expected) {
+	naming.Require(t, "azurerm_static_web_app", expected.Name)
+	terraformOptions := deploy.Options(t, terraformDir, Vars(expected))
+	deploy.Run(t, terraformOptions, nil, func(t *testing.T, terraformOptions *terraform.Options) {
+		Validate(t, terraformOptions, expected)
+	})
+}
+
+// Validate runs the standard checks against an applied static-web-app module
+func Validate(t *testing.T, terraformOptions *terraform.Options, expected Expected) {
+	t.Run("StaticWebAppExists", func(t *testing.T) {
+		actualName := terraform.Output(t, terraformOptions, "static_web_app_name")
+		assert.Equal(t, expected.Name, actualName)
+	})
+
+	t.Run("DefaultHostname", func(t *testing.T) {
+		hostname := terraform.Output(t, terraformOptions, "default_host_name")
+		assert.Contains(t, hostname, ".azurestaticapps.net", "Static Web App hostname should be valid")
+	})
+
+	t.Run("APIKeyExists", func(t *testing.T) {
+		apiKey := terraform.Output(t, terraformOptions, "api_key")
+		assert.NotEmpty(t, apiKey, "Static Web App API key should not be empty")
+	})
+}
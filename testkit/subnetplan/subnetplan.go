@@ -0,0 +1,317 @@
+// Package subnetplan reads the VNet and subnet CIDRs of a Terraform
+// configuration, validates the layout and proposes non-overlapping layouts
+// for a different VNet prefix.
+package subnetplan
+
+import (
+	"fmt"
+	"net/netip"
+	"sort"
+
+	"github.com/zclconf/go-cty/cty"
+
+	"github.com/vanehru/terraform-modules/testkit/tfconfig"
+)
+
+// Azure reserves five addresses per subnet and does not allow subnets smaller than /29
+const (
+	azureReservedAddresses = 5
+	defaultMinPrefixBits   = 29
+	bastionSubnetName      = "AzureBastionSubnet"
+)
+
+// minPrefixBits is the largest prefix length Azure accepts per subnet delegation
+var minPrefixBits = map[string]int{
+	"Microsoft.Web/serverFarms":                   28,
+	"Microsoft.ContainerInstance/containerGroups": 29,
+}
+
+// Subnet is an azurerm_subnet and the CIDR it resolves to
+type Subnet struct {
+	// Address is the resource address, prefixed with the module call for module subnets
+	Address    string
+	Name       string
+	Variable   string
+	Prefix     netip.Prefix
+	Delegation string
+	File       string
+	Line       int
+}
+
+// Layout is the VNet address space and the subnets carved out of it
+type Layout struct {
+	VNet    []netip.Prefix
+	Subnets []Subnet
+}
+
+// Problem is a layout rule violation
+type Problem struct {
+	Subnet  string
+	Message string
+}
+
+func (p Problem) String() string {
+	return fmt.Sprintf("%s: %s", p.Subnet, p.Message)
+}
+
+// Load resolves the layout of the configuration in dir, using variable
+// defaults overridden by varFiles. Subnets declared by local modules that dir
+// calls are included.
+func Load(dir string, varFiles ...string) (*Layout, error) {
+	mod, err := tfconfig.Load(dir)
+	if err != nil {
+		return nil, err
+	}
+	vars, err := mod.VariableValues(varFiles...)
+	if err != nil {
+		return nil, err
+	}
+
+	layout := &Layout{}
+	if space, ok := vars["vnet_address_space"]; ok {
+		cidrs, ok := tfconfig.Strings(space)
+		if !ok {
+			return nil, fmt.Errorf("vnet_address_space is not a list of strings")
+		}
+		for _, cidr := range cidrs {
+			prefix, err := netip.ParsePrefix(cidr)
+			if err != nil {
+				return nil, fmt.Errorf("vnet_address_space: %w", err)
+			}
+			layout.VNet = append(layout.VNet, prefix)
+		}
+	}
+
+	subnets, err := moduleSubnets(mod, "", vars)
+	if err != nil {
+		return nil, err
+	}
+	layout.Subnets = subnets
+
+	for _, call := range mod.ModuleCalls {
+		childDir, ok := call.LocalDir(dir)
+		if !ok {
+			continue
+		}
+		child, err := tfconfig.Load(childDir)
+		if err != nil {
+			return nil, err
+		}
+		childVars, err := child.VariableValues()
+		if err != nil {
+			return nil, err
+		}
+		subnets, err := moduleSubnets(child, "module."+call.Name+".", childVars)
+		if err != nil {
+			return nil, err
+		}
+		layout.Subnets = append(layout.Subnets, subnets...)
+	}
+	return layout, nil
+}
+
+// moduleSubnets resolves the azurerm_subnet resources of mod. Subnets whose
+// prefixes are computed from other resources are skipped.
+func moduleSubnets(mod *tfconfig.Module, addressPrefix string, vars map[string]cty.Value) ([]Subnet, error) {
+	var subnets []Subnet
+	for _, r := range mod.ResourcesOfType("azurerm_subnet") {
+		subnet := Subnet{
+			Address: addressPrefix + r.Address(),
+			File:    r.Range.Filename,
+			Line:    r.Range.Start.Line,
+		}
+		if attr, ok := r.Body.Attributes["name"]; ok {
+			subnet.Name, _ = tfconfig.StaticString(attr.Expr)
+		}
+		for _, delegation := range tfconfig.Blocks(r.Body, "delegation") {
+			for _, service := range tfconfig.Blocks(delegation.Body, "service_delegation") {
+				if attr, ok := service.Body.Attributes["name"]; ok {
+					subnet.Delegation, _ = tfconfig.StaticString(attr.Expr)
+				}
+			}
+		}
+
+		attr, ok := r.Body.Attributes["address_prefixes"]
+		if !ok {
+			continue
+		}
+		cidrs, ok := tfconfig.StaticStrings(attr.Expr)
+		if !ok {
+			refs := tfconfig.VariableRefs(attr.Expr)
+			if len(refs) != 1 {
+				continue
+			}
+			subnet.Variable = refs[0]
+			value, ok := vars[refs[0]]
+			if !ok {
+				return nil, fmt.Errorf("%s: variable %s has no value", subnet.Address, refs[0])
+			}
+			if value.Type() == cty.String {
+				cidrs = []string{value.AsString()}
+			} else if cidrs, ok = tfconfig.Strings(value); !ok {
+				return nil, fmt.Errorf("%s: variable %s is not a CIDR", subnet.Address, refs[0])
+			}
+		}
+
+		for _, cidr := range cidrs {
+			prefix, err := netip.ParsePrefix(cidr)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", subnet.Address, err)
+			}
+			subnet.Prefix = prefix
+			subnets = append(subnets, subnet)
+		}
+	}
+	return subnets, nil
+}
+
+// MinPrefixBits returns the longest prefix a subnet may have given its name and delegation
+func MinPrefixBits(name, delegation string) int {
+	if name == bastionSubnetName {
+		return 26
+	}
+	if bits, ok := minPrefixBits[delegation]; ok {
+		return bits
+	}
+	return defaultMinPrefixBits
+}
+
+// UsableAddresses returns the number of addresses Azure leaves for workloads in prefix
+func UsableAddresses(prefix netip.Prefix) int {
+	return 1<<(prefix.Addr().BitLen()-prefix.Bits()) - azureReservedAddresses
+}
+
+// Validate checks that every subnet is a network address inside the VNet,
+// that no two subnets overlap and that each is large enough for its
+// delegation. When the layout has no VNet address space, only the per-subnet
+// checks run.
+func (l *Layout) Validate() []Problem {
+	var problems []Problem
+	for i, subnet := range l.Subnets {
+		if subnet.Prefix.Masked() != subnet.Prefix {
+			problems = append(problems, Problem{subnet.Address, fmt.Sprintf(
+				"%s is not a network address, did you mean %s?", subnet.Prefix, subnet.Prefix.Masked())})
+		}
+
+		if len(l.VNet) > 0 && !l.contains(subnet.Prefix) {
+			problems = append(problems, Problem{subnet.Address, fmt.Sprintf(
+				"%s is outside the VNet address space %v", subnet.Prefix, l.VNet)})
+		}
+
+		if bits := MinPrefixBits(subnet.Name, subnet.Delegation); subnet.Prefix.Bits() > bits {
+			requirement := subnet.Delegation
+			if subnet.Name == bastionSubnetName {
+				requirement = "Azure Bastion"
+			}
+			if requirement == "" {
+				requirement = "an Azure subnet"
+			}
+			problems = append(problems, Problem{subnet.Address, fmt.Sprintf(
+				"%s is too small, %s needs /%d or larger", subnet.Prefix, requirement, bits)})
+		}
+
+		for _, other := range l.Subnets[i+1:] {
+			if subnet.Prefix.Overlaps(other.Prefix) {
+				problems = append(problems, Problem{subnet.Address, fmt.Sprintf(
+					"%s overlaps %s (%s)", subnet.Prefix, other.Address, other.Prefix)})
+			}
+		}
+	}
+	return problems
+}
+
+func (l *Layout) contains(prefix netip.Prefix) bool {
+	for _, vnet := range l.VNet {
+		if vnet.Bits() <= prefix.Bits() && vnet.Contains(prefix.Addr()) {
+			return true
+		}
+	}
+	return false
+}
+
+// Request asks for a subnet of the given prefix length
+type Request struct {
+	Name string
+	Bits int
+}
+
+// Requests returns a request per subnet in the layout that keeps its current size
+func (l *Layout) Requests() []Request {
+	requests := make([]Request, len(l.Subnets))
+	for i, subnet := range l.Subnets {
+		requests[i] = Request{Name: subnet.Address, Bits: subnet.Prefix.Bits()}
+	}
+	return requests
+}
+
+// Propose allocates a non-overlapping, aligned prefix inside vnet for every
+// request. Larger subnets are placed first to limit fragmentation; the result
+// is in request order.
+func Propose(vnet netip.Prefix, requests []Request) ([]netip.Prefix, error) {
+	vnet = vnet.Masked()
+
+	order := make([]int, len(requests))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return requests[order[a]].Bits < requests[order[b]].Bits
+	})
+
+	allocated := make([]netip.Prefix, len(requests))
+	var taken []netip.Prefix
+	for _, i := range order {
+		req := requests[i]
+		if req.Bits < vnet.Bits() || req.Bits > vnet.Addr().BitLen() {
+			return nil, fmt.Errorf("%s: /%d does not fit in %s", req.Name, req.Bits, vnet)
+		}
+		prefix, ok := firstFree(vnet, req.Bits, taken)
+		if !ok {
+			return nil, fmt.Errorf("%s: no free /%d left in %s", req.Name, req.Bits, vnet)
+		}
+		allocated[i] = prefix
+		taken = append(taken, prefix)
+	}
+	return allocated, nil
+}
+
+// firstFree returns the lowest prefix of the given length in vnet that overlaps nothing taken
+func firstFree(vnet netip.Prefix, bits int, taken []netip.Prefix) (netip.Prefix, bool) {
+	candidate := netip.PrefixFrom(vnet.Addr(), bits)
+	for vnet.Contains(candidate.Addr()) {
+		free := true
+		for _, t := range taken {
+			if candidate.Overlaps(t) {
+				free = false
+				break
+			}
+		}
+		if free {
+			return candidate, true
+		}
+		next, ok := nextPrefix(candidate)
+		if !ok {
+			break
+		}
+		candidate = next
+	}
+	return netip.Prefix{}, false
+}
+
+// nextPrefix returns the prefix of the same length immediately after p
+func nextPrefix(p netip.Prefix) (netip.Prefix, bool) {
+	addr := p.Addr().AsSlice()
+	hostBits := len(addr)*8 - p.Bits()
+	// Add 1 << hostBits to the address, carrying across bytes
+	carry := 1 << (hostBits % 8)
+	for i := len(addr) - 1 - hostBits/8; i >= 0 && carry > 0; i-- {
+		sum := int(addr[i]) + carry
+		addr[i] = byte(sum)
+		carry = sum >> 8
+	}
+	if carry > 0 {
+		return netip.Prefix{}, false
+	}
+	next, _ := netip.AddrFromSlice(addr)
+	return netip.PrefixFrom(next, p.Bits()), true
+}
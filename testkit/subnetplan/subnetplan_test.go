@@ -0,0 +1,124 @@
+package subnetplan
+
+import (
+	"net/netip"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func problemsFor(problems []Problem, address string) []string {
+	var messages []string
+	for _, p := range problems {
+		if p.Subnet == address {
+			messages = append(messages, p.Message)
+		}
+	}
+	return messages
+}
+
+func TestLoad(t *testing.T) {
+	t.Parallel()
+
+	layout, err := Load("testdata/stack")
+	require.NoError(t, err)
+
+	assert.Equal(t, []netip.Prefix{netip.MustParsePrefix("172.16.0.0/16")}, layout.VNet)
+	require.Len(t, layout.Subnets, 4)
+
+	app := layout.Subnets[0]
+	assert.Equal(t, "azurerm_subnet.app_subnet", app.Address)
+	assert.Equal(t, "app-subnet", app.Name)
+	assert.Equal(t, "app_subnet_cidr", app.Variable)
+	assert.Equal(t, "Microsoft.Web/serverFarms", app.Delegation)
+	assert.Equal(t, netip.MustParsePrefix("172.16.1.0/29"), app.Prefix)
+	assert.Equal(t, 6, app.Line)
+
+	bastion := layout.Subnets[3]
+	assert.Equal(t, "module.bastion.azurerm_subnet.bastion_subnet", bastion.Address)
+	assert.Equal(t, "AzureBastionSubnet", bastion.Name)
+	assert.Empty(t, bastion.Variable)
+
+	layout, err = Load("testdata/stack", "testdata/fixed.tfvars")
+	require.NoError(t, err)
+	assert.Equal(t, netip.MustParsePrefix("172.16.2.0/24"), layout.Subnets[1].Prefix)
+}
+
+func TestValidate(t *testing.T) {
+	t.Parallel()
+
+	layout, err := Load("testdata/stack")
+	require.NoError(t, err)
+	problems := layout.Validate()
+
+	app := problemsFor(problems, "azurerm_subnet.app_subnet")
+	require.Len(t, app, 2)
+	assert.Contains(t, app[0], "Microsoft.Web/serverFarms needs /28 or larger")
+	assert.Contains(t, app[1], "overlaps azurerm_subnet.database_subnet")
+
+	deployment := problemsFor(problems, "azurerm_subnet.deployment_subnet")
+	require.Len(t, deployment, 1)
+	assert.Contains(t, deployment[0], "outside the VNet address space")
+
+	bastion := problemsFor(problems, "module.bastion.azurerm_subnet.bastion_subnet")
+	require.Len(t, bastion, 1)
+	assert.Contains(t, bastion[0], "Azure Bastion needs /26 or larger")
+
+	layout, err = Load("testdata/stack", "testdata/fixed.tfvars")
+	require.NoError(t, err)
+	assert.Len(t, layout.Validate(), 1, "Only the bastion subnet should remain invalid")
+}
+
+func TestValidateNetworkAddress(t *testing.T) {
+	t.Parallel()
+
+	layout := &Layout{Subnets: []Subnet{
+		{Address: "azurerm_subnet.app_subnet", Prefix: netip.MustParsePrefix("172.16.1.10/24")},
+	}}
+	problems := layout.Validate()
+	require.Len(t, problems, 1)
+	assert.True(t, strings.HasSuffix(problems[0].String(), "did you mean 172.16.1.0/24?"))
+}
+
+func TestMinPrefixBits(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, 26, MinPrefixBits("AzureBastionSubnet", ""))
+	assert.Equal(t, 28, MinPrefixBits("app-subnet", "Microsoft.Web/serverFarms"))
+	assert.Equal(t, 29, MinPrefixBits("deployment-subnet", "Microsoft.ContainerInstance/containerGroups"))
+	assert.Equal(t, 29, MinPrefixBits("storage-subnet", ""))
+	assert.Equal(t, 251, UsableAddresses(netip.MustParsePrefix("172.16.1.0/24")))
+}
+
+func TestPropose(t *testing.T) {
+	t.Parallel()
+
+	requests := []Request{
+		{Name: "app", Bits: 28},
+		{Name: "database", Bits: 24},
+		{Name: "bastion", Bits: 26},
+		{Name: "deployment", Bits: 29},
+	}
+	proposal, err := Propose(netip.MustParsePrefix("10.10.0.0/23"), requests)
+	require.NoError(t, err)
+	assert.Equal(t, []netip.Prefix{
+		netip.MustParsePrefix("10.10.1.64/28"),
+		netip.MustParsePrefix("10.10.0.0/24"),
+		netip.MustParsePrefix("10.10.1.0/26"),
+		netip.MustParsePrefix("10.10.1.80/29"),
+	}, proposal)
+
+	layout := &Layout{VNet: []netip.Prefix{netip.MustParsePrefix("10.10.0.0/23")}}
+	for i, prefix := range proposal {
+		layout.Subnets = append(layout.Subnets, Subnet{Address: requests[i].Name, Prefix: prefix})
+	}
+	assert.Empty(t, layout.Validate())
+
+	_, err = Propose(netip.MustParsePrefix("10.10.0.0/24"), requests)
+	assert.ErrorContains(t, err, "bastion: no free /26")
+
+	_, err = Propose(netip.MustParsePrefix("10.10.0.0/24"), []Request{{Name: "vnet", Bits: 16}})
+	assert.ErrorContains(t, err, "does not fit")
+}
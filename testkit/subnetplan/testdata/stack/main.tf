@@ -0,0 +1,30 @@
+resource "azurerm_virtual_network" "vnet" {
+  name          = "demo-vnet"
+  address_space = var.vnet_address_space
+}
+
+resource "azurerm_subnet" "app_subnet" {
+  name             = "app-subnet"
+  address_prefixes = [var.app_subnet_cidr]
+
+  delegation {
+    name = "delegation"
+    service_delegation {
+      name = "Microsoft.Web/serverFarms"
+    }
+  }
+}
+
+resource "azurerm_subnet" "database_subnet" {
+  name             = "database-subnet"
+  address_prefixes = [var.database_subnet_cidr]
+}
+
+resource "azurerm_subnet" "deployment_subnet" {
+  name             = "deployment-subnet"
+  address_prefixes = [var.deployment_subnet_cidr]
+}
+
+module "bastion" {
+  source = "./modules/bastion"
+}
@@ -0,0 +1,4 @@
+resource "azurerm_subnet" "bastion_subnet" {
+  name             = "AzureBastionSubnet"
+  address_prefixes = ["172.16.200.0/27"]
+}
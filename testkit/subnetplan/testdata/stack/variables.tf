@@ -0,0 +1,19 @@
+variable "vnet_address_space" {
+  type    = list(string)
+  default = ["172.16.0.0/16"]
+}
+
+variable "app_subnet_cidr" {
+  type    = string
+  default = "172.16.1.0/29"
+}
+
+variable "database_subnet_cidr" {
+  type    = string
+  default = "172.16.1.0/24"
+}
+
+variable "deployment_subnet_cidr" {
+  type    = string
+  default = "10.0.6.0/24"
+}
@@ -0,0 +1,290 @@
+// Package tagpolicy checks resource tags against a declarative policy, both in
+// the HCL configuration and in `terraform show -json` plans.
+package tagpolicy
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	tfjson "github.com/hashicorp/terraform-json"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/convert"
+	"gopkg.in/yaml.v3"
+
+	"github.com/vanehru/terraform-modules/testkit/planassert"
+	"github.com/vanehru/terraform-modules/testkit/tfconfig"
+)
+
+// exemptAll in an exemption list excuses a resource type from every required tag
+const exemptAll = "*"
+
+// untaggable lists azurerm resource types whose schema has no tags argument
+var untaggable = map[string]bool{
+	"azurerm_app_service_virtual_network_swift_connection": true,
+	"azurerm_cognitive_deployment":                         true,
+	"azurerm_key_vault_access_policy":                      true,
+	"azurerm_management_lock":                              true,
+	"azurerm_monitor_diagnostic_setting":                   true,
+	"azurerm_mssql_firewall_rule":                          true,
+	"azurerm_mssql_virtual_network_rule":                   true,
+	"azurerm_network_interface_security_group_association": true,
+	"azurerm_network_security_rule":                        true,
+	"azurerm_role_assignment":                              true,
+	"azurerm_role_definition":                              true,
+	"azurerm_static_web_app_custom_domain":                 true,
+	"azurerm_static_web_app_function_app_registration":     true,
+	"azurerm_storage_blob":                                 true,
+	"azurerm_storage_container":                            true,
+	"azurerm_storage_queue":                                true,
+	"azurerm_storage_share":                                true,
+	"azurerm_storage_table":                                true,
+	"azurerm_subnet":                                       true,
+	"azurerm_subnet_nat_gateway_association":               true,
+	"azurerm_subnet_network_security_group_association":    true,
+	"azurerm_subnet_route_table_association":               true,
+	"azurerm_virtual_network_peering":                      true,
+}
+
+// Policy lists the tags every taggable resource must carry
+type Policy struct {
+	RequiredTags map[string]TagRule `yaml:"required_tags"`
+	// Exemptions maps a resource type to the required tags it need not carry
+	Exemptions map[string][]string `yaml:"exemptions"`
+}
+
+// TagRule restricts the values of a required tag. Any non-empty value is
+// accepted when AllowedValues is empty.
+type TagRule struct {
+	AllowedValues []string `yaml:"allowed_values"`
+}
+
+// Violation is a resource that does not satisfy the policy
+type Violation struct {
+	Address string
+	Type    string
+	// Tag is the offending tag, empty when the resource has no tags at all
+	Tag     string
+	Message string
+	File    string
+	Line    int
+}
+
+func (v Violation) String() string {
+	if v.File == "" {
+		return fmt.Sprintf("%s: %s", v.Address, v.Message)
+	}
+	return fmt.Sprintf("%s:%d: %s: %s", v.File, v.Line, v.Address, v.Message)
+}
+
+// LoadPolicy reads a YAML policy file
+func LoadPolicy(path string) (*Policy, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	decoder := yaml.NewDecoder(f)
+	decoder.KnownFields(true)
+	policy := &Policy{}
+	if err := decoder.Decode(policy); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if len(policy.RequiredTags) == 0 {
+		return nil, fmt.Errorf("%s: required_tags is empty", path)
+	}
+	return policy, nil
+}
+
+// Taggable reports whether resourceType is an azurerm resource with a tags argument
+func Taggable(resourceType string) bool {
+	return strings.HasPrefix(resourceType, "azurerm_") && !untaggable[resourceType]
+}
+
+// RequiredKeys returns the sorted tag keys resourceType must carry
+func (p *Policy) RequiredKeys(resourceType string) []string {
+	exempt := map[string]bool{}
+	for _, key := range p.Exemptions[resourceType] {
+		if key == exemptAll {
+			return nil
+		}
+		exempt[key] = true
+	}
+
+	var keys []string
+	for key := range p.RequiredTags {
+		if !exempt[key] {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// check returns a violation per required tag that is missing or has a
+// disallowed value. A nil tags map means the resource sets no tags at all.
+func (p *Policy) check(address, resourceType string, tags map[string]string) []Violation {
+	keys := p.RequiredKeys(resourceType)
+	if len(keys) == 0 {
+		return nil
+	}
+	if len(tags) == 0 {
+		return []Violation{{
+			Address: address,
+			Type:    resourceType,
+			Message: fmt.Sprintf("has no tags, requires %s", strings.Join(keys, ", ")),
+		}}
+	}
+
+	var violations []Violation
+	for _, key := range keys {
+		value, ok := tags[key]
+		var message string
+		switch allowed := p.RequiredTags[key].AllowedValues; {
+		case !ok:
+			message = fmt.Sprintf("missing required tag %q", key)
+		case value == "":
+			message = fmt.Sprintf("tag %q is empty", key)
+		case len(allowed) > 0 && !contains(allowed, value):
+			message = fmt.Sprintf("tag %q = %q is not one of %s", key, value, strings.Join(allowed, ", "))
+		default:
+			continue
+		}
+		violations = append(violations, Violation{Address: address, Type: resourceType, Tag: key, Message: message})
+	}
+	return violations
+}
+
+// CheckConfig checks every taggable resource in the configuration in dir and
+// the local modules it calls. Tags computed from resources or other values
+// that are not known before apply are skipped.
+func CheckConfig(dir string, policy *Policy, varFiles ...string) ([]Violation, error) {
+	instances, err := tfconfig.LoadTree(dir, varFiles...)
+	if err != nil {
+		return nil, err
+	}
+
+	var violations []Violation
+	for _, inst := range instances {
+		for _, r := range inst.Module.Resources {
+			if r.Mode != "managed" || !Taggable(r.Type) {
+				continue
+			}
+
+			var tags map[string]string
+			if attr, ok := r.Body.Attributes["tags"]; ok {
+				value, ok := inst.Eval(attr.Expr)
+				if !ok {
+					continue
+				}
+				if tags, ok = toStringMap(value); !ok {
+					continue
+				}
+			}
+
+			for _, v := range policy.check(inst.Address(r), r.Type, tags) {
+				v.File, v.Line = r.Range.Filename, r.Range.Start.Line
+				violations = append(violations, v)
+			}
+		}
+	}
+	return violations, nil
+}
+
+// CheckPlan checks the planned values of every taggable resource in plan.
+// When dir is not empty, violations are located in the configuration it holds.
+func CheckPlan(plan *tfjson.Plan, policy *Policy, dir string) ([]Violation, error) {
+	locations := map[string]*tfconfig.Resource{}
+	if dir != "" {
+		instances, err := tfconfig.LoadTree(dir)
+		if err != nil {
+			return nil, err
+		}
+		for _, inst := range instances {
+			for _, r := range inst.Module.Resources {
+				locations[inst.Address(r)] = r
+			}
+		}
+	}
+
+	var violations []Violation
+	if plan.PlannedValues == nil {
+		return nil, fmt.Errorf("plan has no planned values")
+	}
+	for _, r := range plannedResources(plan.PlannedValues.RootModule) {
+		if r.Mode != tfjson.ManagedResourceMode || !Taggable(r.Type) {
+			continue
+		}
+		// Unknown values are left out of planned values, as are arguments
+		// the provider schema does not have
+		raw, ok := r.AttributeValues["tags"]
+		if !ok {
+			continue
+		}
+		var tags map[string]string
+		if raw != nil {
+			object, ok := raw.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("%s: tags is %T, not a map", r.Address, raw)
+			}
+			tags = map[string]string{}
+			for key, value := range object {
+				tags[key] = fmt.Sprint(value)
+			}
+		}
+
+		for _, v := range policy.check(r.Address, r.Type, tags) {
+			if config, ok := locations[planassert.StripIndexes(r.Address)]; ok {
+				v.File, v.Line = config.Range.Filename, config.Range.Start.Line
+			}
+			violations = append(violations, v)
+		}
+	}
+	return violations, nil
+}
+
+// plannedResources flattens a module and its children, sorted by address
+func plannedResources(module *tfjson.StateModule) []*tfjson.StateResource {
+	if module == nil {
+		return nil
+	}
+	resources := append([]*tfjson.StateResource{}, module.Resources...)
+	for _, child := range module.ChildModules {
+		resources = append(resources, plannedResources(child)...)
+	}
+	sort.Slice(resources, func(i, j int) bool {
+		return resources[i].Address < resources[j].Address
+	})
+	return resources
+}
+
+// toStringMap converts an object or map value to Go strings
+func toStringMap(value cty.Value) (map[string]string, bool) {
+	if value.IsNull() {
+		return nil, true
+	}
+	converted, err := convert.Convert(value, cty.Map(cty.String))
+	if err != nil {
+		return nil, false
+	}
+	tags := map[string]string{}
+	for key, element := range converted.AsValueMap() {
+		if element.IsNull() {
+			tags[key] = ""
+		} else {
+			tags[key] = element.AsString()
+		}
+	}
+	return tags, true
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
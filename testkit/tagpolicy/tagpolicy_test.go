@@ -0,0 +1,87 @@
+package tagpolicy
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+
+	tfjson "github.com/hashicorp/terraform-json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func loadTestPolicy(t *testing.T) *Policy {
+	policy, err := LoadPolicy("testdata/policy.yml")
+	require.NoError(t, err)
+	return policy
+}
+
+func TestLoadPolicy(t *testing.T) {
+	t.Parallel()
+
+	policy := loadTestPolicy(t)
+	assert.Equal(t, []string{"environment", "project_owner"}, policy.RequiredKeys("azurerm_resource_group"))
+	assert.Equal(t, []string{"project_owner"}, policy.RequiredKeys("azurerm_private_dns_a_record"))
+	assert.Empty(t, policy.RequiredKeys("azurerm_user_assigned_identity"))
+
+	_, err := LoadPolicy("testdata/missing.yml")
+	assert.Error(t, err)
+}
+
+func TestTaggable(t *testing.T) {
+	t.Parallel()
+
+	assert.True(t, Taggable("azurerm_key_vault_secret"))
+	assert.False(t, Taggable("azurerm_subnet"))
+	assert.False(t, Taggable("random_string"))
+}
+
+func TestCheckConfig(t *testing.T) {
+	t.Parallel()
+
+	violations, err := CheckConfig("testdata/stack", loadTestPolicy(t))
+	require.NoError(t, err)
+
+	var got []string
+	for _, v := range violations {
+		got = append(got, v.String())
+	}
+	assert.Equal(t, []string{
+		`testdata/stack/main.tf:14: azurerm_virtual_network.vnet: has no tags, requires environment, project_owner`,
+		`testdata/stack/main.tf:19: azurerm_public_ip.pip: tag "environment" = "dev" is not one of development, production`,
+		`testdata/stack/main.tf:19: azurerm_public_ip.pip: tag "project_owner" is empty`,
+		`testdata/stack/modules/vault/main.tf:6: module.vault.azurerm_key_vault_secret.secret: tag "environment" = "staging" is not one of development, production`,
+		`testdata/stack/modules/vault/main.tf:6: module.bare_vault.azurerm_key_vault_secret.secret: has no tags, requires environment, project_owner`,
+	}, got)
+
+	assert.Equal(t, "environment", violations[1].Tag)
+	assert.Empty(t, violations[0].Tag)
+}
+
+func TestCheckPlan(t *testing.T) {
+	t.Parallel()
+
+	data, err := os.ReadFile("testdata/plan.json")
+	require.NoError(t, err)
+	plan := &tfjson.Plan{}
+	require.NoError(t, json.Unmarshal(data, plan))
+
+	violations, err := CheckPlan(plan, loadTestPolicy(t), "testdata/stack")
+	require.NoError(t, err)
+
+	var got []string
+	for _, v := range violations {
+		got = append(got, v.String())
+	}
+	assert.Equal(t, []string{
+		`testdata/stack/main.tf:19: azurerm_public_ip.pip: tag "environment" = "dev" is not one of development, production`,
+		`testdata/stack/main.tf:19: azurerm_public_ip.pip: missing required tag "project_owner"`,
+		`testdata/stack/main.tf:14: azurerm_virtual_network.vnet: has no tags, requires environment, project_owner`,
+		`testdata/stack/modules/vault/main.tf:6: module.vault.azurerm_key_vault_secret.secret: tag "environment" = "staging" is not one of development, production`,
+	}, got)
+
+	violations, err = CheckPlan(plan, loadTestPolicy(t), "")
+	require.NoError(t, err)
+	require.Len(t, violations, 4)
+	assert.Equal(t, "azurerm_virtual_network.vnet: has no tags, requires environment, project_owner", violations[2].String())
+}
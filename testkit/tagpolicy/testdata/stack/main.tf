@@ -0,0 +1,64 @@
+locals {
+  common_tags = {
+    project_owner = "ootsuka"
+    environment   = "development"
+  }
+}
+
+resource "azurerm_resource_group" "rg" {
+  name     = "rg"
+  location = "Japan East"
+  tags     = local.common_tags
+}
+
+resource "azurerm_virtual_network" "vnet" {
+  name          = "vnet"
+  address_space = ["172.16.0.0/16"]
+}
+
+resource "azurerm_public_ip" "pip" {
+  name = "pip"
+
+  tags = {
+    project_owner = ""
+    environment   = "dev"
+  }
+}
+
+resource "azurerm_subnet" "subnet" {
+  name             = "subnet"
+  address_prefixes = ["172.16.1.0/24"]
+}
+
+resource "azurerm_private_dns_a_record" "record" {
+  name = "record"
+
+  tags = {
+    project_owner = "ootsuka"
+  }
+}
+
+resource "azurerm_user_assigned_identity" "identity" {
+  name = "identity"
+}
+
+resource "azurerm_key_vault" "kv" {
+  name = "kv"
+  tags = azurerm_resource_group.rg.tags
+}
+
+resource "random_string" "suffix" {
+  length = 6
+}
+
+module "vault" {
+  source = "./modules/vault"
+
+  tags = merge(local.common_tags, {
+    environment = "staging"
+  })
+}
+
+module "bare_vault" {
+  source = "./modules/vault"
+}
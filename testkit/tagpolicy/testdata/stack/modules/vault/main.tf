@@ -0,0 +1,9 @@
+variable "tags" {
+  type    = map(string)
+  default = {}
+}
+
+resource "azurerm_key_vault_secret" "secret" {
+  name = "secret"
+  tags = var.tags
+}
@@ -0,0 +1,17 @@
+// Package testkit holds the Terratest helpers shared by the stacks in this
+// repository. Each subpackage named after a Terraform module deploys and
+// validates that module through package deploy; package stack validates a
+// complete RPG AI App deployment. The remaining subpackages are offline
+// checks that read HCL or plan JSON and need no Azure credentials.
+package testkit
+
+import (
+	"strings"
+
+	"github.com/gruntwork-io/terratest/modules/random"
+)
+
+// UniqueID returns a lower-case random suffix for resource names
+func UniqueID() string {
+	return strings.ToLower(random.UniqueId())
+}
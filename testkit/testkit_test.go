@@ -0,0 +1,52 @@
+package testkit_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/vanehru/terraform-modules/testkit/fixture"
+	"github.com/vanehru/terraform-modules/testkit/functionapp"
+	"github.com/vanehru/terraform-modules/testkit/keyvault"
+	"github.com/vanehru/terraform-modules/testkit/openai"
+	"github.com/vanehru/terraform-modules/testkit/outputcontract"
+	"github.com/vanehru/terraform-modules/testkit/sqldatabase"
+	"github.com/vanehru/terraform-modules/testkit/stack"
+	"github.com/vanehru/terraform-modules/testkit/staticwebapp"
+)
+
+// TestHelperOutputs verifies that each helper lists every output it reads, so
+// the suites' output contract checks cover the helpers too
+func TestHelperOutputs(t *testing.T) {
+	t.Parallel()
+
+	helpers := map[string][]string{
+		"fixture":      fixture.Outputs,
+		"functionapp":  functionapp.Outputs,
+		"keyvault":     keyvault.Outputs,
+		"openai":       openai.Outputs,
+		"sqldatabase":  sqldatabase.Outputs,
+		"stack":        stack.Outputs,
+		"staticwebapp": staticwebapp.Outputs,
+	}
+	for dir, outputs := range helpers {
+		dir, outputs := dir, outputs
+		t.Run(dir, func(t *testing.T) {
+			t.Parallel()
+
+			refs, err := outputcontract.ReferencedOutputs(dir, outputcontract.Options{Pattern: "*.go"})
+			require.NoError(t, err)
+			require.NotEmpty(t, refs)
+
+			read := map[string]bool{}
+			for _, ref := range refs {
+				read[ref.Name] = true
+				assert.Contains(t, outputs, ref.Name, "%s:%d reads an output missing from Outputs", ref.File, ref.Line)
+			}
+			for _, name := range outputs {
+				assert.True(t, read[name], "%s is listed in Outputs but never read", name)
+			}
+		})
+	}
+}
@@ -0,0 +1,44 @@
+data "azurerm_client_config" "current" {}
+
+resource "azurerm_resource_group" "rg" {
+  name     = var.resource_group_name
+  location = "Japan East"
+
+  tags = {
+    environment = "development"
+  }
+}
+
+resource "azurerm_subnet" "app_subnet" {
+  name             = "app-subnet"
+  address_prefixes = [var.app_subnet_cidr]
+
+  delegation {
+    name = "delegation"
+    service_delegation {
+      name = "Microsoft.Web/serverFarms"
+    }
+  }
+}
+
+locals {
+  common_tags = merge(local.owner_tags, {
+    environment = "development"
+  })
+  owner_tags = {
+    project_owner = upper(var.resource_group_name)
+  }
+}
+
+module "network" {
+  source = "./modules/network"
+
+  vnet_name           = "demo-vnet"
+  resource_group_name = azurerm_resource_group.rg.name
+  tags                = local.common_tags
+}
+
+module "registry" {
+  source  = "Azure/naming/azurerm"
+  version = "0.4.0"
+}
@@ -0,0 +1,18 @@
+variable "vnet_name" {
+  type = string
+}
+
+variable "resource_group_name" {
+  type    = string
+  default = "network-rg"
+}
+
+variable "tags" {
+  type    = map(string)
+  default = {}
+}
+
+resource "azurerm_virtual_network" "vnet" {
+  name          = var.vnet_name
+  address_space = ["10.0.0.0/16"]
+}
@@ -0,0 +1,18 @@
+variable "resource_group_name" {
+  type    = string
+  default = "rpg-aiapp-rg"
+}
+
+variable "app_subnet_cidr" {
+  type    = string
+  default = "172.16.1.0/24"
+}
+
+variable "vnet_address_space" {
+  type    = list(string)
+  default = ["172.16.0.0/16"]
+}
+
+variable "tenant_id" {
+  type = string
+}
@@ -0,0 +1,284 @@
+// Package tfconfig loads the parts of a Terraform configuration directory that
+// the static checks need. Bodies are kept as hclsyntax trees so callers can
+// walk nested blocks and inspect expressions without a terraform binary.
+package tfconfig
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclparse"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// Module is a Terraform configuration directory
+type Module struct {
+	Dir         string
+	Variables   map[string]*Variable
+	Outputs     map[string]*Output
+	Locals      map[string]*hclsyntax.Attribute
+	Resources   []*Resource
+	ModuleCalls []*ModuleCall
+}
+
+// Variable is a variable block and its static default, if any
+type Variable struct {
+	Name    string
+	Default cty.Value
+	Range   hcl.Range
+}
+
+// Output is an output block
+type Output struct {
+	Name  string
+	Range hcl.Range
+}
+
+// Resource is a resource or data block
+type Resource struct {
+	Mode  string
+	Type  string
+	Name  string
+	Body  *hclsyntax.Body
+	Range hcl.Range
+}
+
+// Address returns the resource address relative to its module
+func (r *Resource) Address() string {
+	if r.Mode == "data" {
+		return fmt.Sprintf("data.%s.%s", r.Type, r.Name)
+	}
+	return fmt.Sprintf("%s.%s", r.Type, r.Name)
+}
+
+// ModuleCall is a module block
+type ModuleCall struct {
+	Name   string
+	Source string
+	Body   *hclsyntax.Body
+	Range  hcl.Range
+}
+
+// LocalDir returns the directory of a module called with a relative source
+func (c *ModuleCall) LocalDir(parent string) (string, bool) {
+	if !strings.HasPrefix(c.Source, "./") && !strings.HasPrefix(c.Source, "../") {
+		return "", false
+	}
+	return filepath.Join(parent, c.Source), true
+}
+
+// Load parses every .tf file in dir
+func Load(dir string) (*Module, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.tf"))
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no Terraform files found in %s", dir)
+	}
+	sort.Strings(files)
+
+	mod := &Module{
+		Dir:       dir,
+		Variables: map[string]*Variable{},
+		Outputs:   map[string]*Output{},
+		Locals:    map[string]*hclsyntax.Attribute{},
+	}
+
+	parser := hclparse.NewParser()
+	for _, file := range files {
+		f, diags := parser.ParseHCLFile(file)
+		if diags.HasErrors() {
+			return nil, diags
+		}
+		body, ok := f.Body.(*hclsyntax.Body)
+		if !ok {
+			return nil, fmt.Errorf("%s: unexpected body type %T", file, f.Body)
+		}
+		if err := mod.addBlocks(body.Blocks); err != nil {
+			return nil, err
+		}
+	}
+	return mod, nil
+}
+
+func (m *Module) addBlocks(blocks hclsyntax.Blocks) error {
+	for _, block := range blocks {
+		switch block.Type {
+		case "variable":
+			v := &Variable{Name: block.Labels[0], Default: cty.NilVal, Range: block.DefRange()}
+			if attr, ok := block.Body.Attributes["default"]; ok {
+				value, diags := attr.Expr.Value(nil)
+				if diags.HasErrors() {
+					return diags
+				}
+				v.Default = value
+			}
+			m.Variables[v.Name] = v
+		case "locals":
+			for name, attr := range block.Body.Attributes {
+				m.Locals[name] = attr
+			}
+		case "output":
+			m.Outputs[block.Labels[0]] = &Output{Name: block.Labels[0], Range: block.DefRange()}
+		case "resource", "data":
+			mode := "managed"
+			if block.Type == "data" {
+				mode = "data"
+			}
+			m.Resources = append(m.Resources, &Resource{
+				Mode:  mode,
+				Type:  block.Labels[0],
+				Name:  block.Labels[1],
+				Body:  block.Body,
+				Range: block.DefRange(),
+			})
+		case "module":
+			call := &ModuleCall{Name: block.Labels[0], Body: block.Body, Range: block.DefRange()}
+			if attr, ok := block.Body.Attributes["source"]; ok {
+				if value, ok := StaticString(attr.Expr); ok {
+					call.Source = value
+				}
+			}
+			m.ModuleCalls = append(m.ModuleCalls, call)
+		}
+	}
+	return nil
+}
+
+// ResourcesOfType returns the managed resources of the given type
+func (m *Module) ResourcesOfType(resourceType string) []*Resource {
+	var resources []*Resource
+	for _, r := range m.Resources {
+		if r.Mode == "managed" && r.Type == resourceType {
+			resources = append(resources, r)
+		}
+	}
+	return resources
+}
+
+// VariableValues returns the variable defaults overridden by each var file in order
+func (m *Module) VariableValues(varFiles ...string) (map[string]cty.Value, error) {
+	values := map[string]cty.Value{}
+	for name, v := range m.Variables {
+		if v.Default != cty.NilVal {
+			values[name] = v.Default
+		}
+	}
+	for _, file := range varFiles {
+		fileValues, err := LoadVarFile(file)
+		if err != nil {
+			return nil, err
+		}
+		for name, value := range fileValues {
+			values[name] = value
+		}
+	}
+	return values, nil
+}
+
+// LoadVarFile parses a .tfvars or .tfvars.json file
+func LoadVarFile(path string) (map[string]cty.Value, error) {
+	parser := hclparse.NewParser()
+	var (
+		f     *hcl.File
+		diags hcl.Diagnostics
+	)
+	if strings.HasSuffix(path, ".json") {
+		f, diags = parser.ParseJSONFile(path)
+	} else {
+		f, diags = parser.ParseHCLFile(path)
+	}
+	if diags.HasErrors() {
+		return nil, diags
+	}
+
+	attrs, diags := f.Body.JustAttributes()
+	if diags.HasErrors() {
+		return nil, diags
+	}
+	values := map[string]cty.Value{}
+	for name, attr := range attrs {
+		value, diags := attr.Expr.Value(nil)
+		if diags.HasErrors() {
+			return nil, diags
+		}
+		values[name] = value
+	}
+	return values, nil
+}
+
+// Blocks returns the nested blocks of body with the given type
+func Blocks(body *hclsyntax.Body, blockType string) []*hclsyntax.Block {
+	var blocks []*hclsyntax.Block
+	for _, block := range body.Blocks {
+		if block.Type == blockType {
+			blocks = append(blocks, block)
+		}
+	}
+	return blocks
+}
+
+// StaticValue evaluates expr without any variables or functions in scope
+func StaticValue(expr hcl.Expression) (cty.Value, bool) {
+	if len(expr.Variables()) > 0 {
+		return cty.NilVal, false
+	}
+	value, diags := expr.Value(nil)
+	if diags.HasErrors() || !value.IsWhollyKnown() {
+		return cty.NilVal, false
+	}
+	return value, true
+}
+
+// StaticString returns expr as a string when it is a literal
+func StaticString(expr hcl.Expression) (string, bool) {
+	value, ok := StaticValue(expr)
+	if !ok || value.IsNull() || value.Type() != cty.String {
+		return "", false
+	}
+	return value.AsString(), true
+}
+
+// StaticStrings returns expr as a list of strings when it is a literal list or tuple
+func StaticStrings(expr hcl.Expression) ([]string, bool) {
+	value, ok := StaticValue(expr)
+	if !ok {
+		return nil, false
+	}
+	return Strings(value)
+}
+
+// Strings converts a list, set or tuple of strings to a Go slice
+func Strings(value cty.Value) ([]string, bool) {
+	if value.IsNull() || !value.CanIterateElements() {
+		return nil, false
+	}
+	var out []string
+	for it := value.ElementIterator(); it.Next(); {
+		_, element := it.Element()
+		if element.IsNull() || element.Type() != cty.String {
+			return nil, false
+		}
+		out = append(out, element.AsString())
+	}
+	return out, true
+}
+
+// VariableRefs returns the names of the input variables expr references
+func VariableRefs(expr hcl.Expression) []string {
+	var names []string
+	for _, traversal := range expr.Variables() {
+		if traversal.RootName() != "var" || len(traversal) < 2 {
+			continue
+		}
+		if attr, ok := traversal[1].(hcl.TraverseAttr); ok {
+			names = append(names, attr.Name)
+		}
+	}
+	return names
+}
@@ -0,0 +1,147 @@
+package tfconfig
+
+import (
+	"testing"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zclconf/go-cty/cty"
+)
+
+func TestLoad(t *testing.T) {
+	t.Parallel()
+
+	mod, err := Load("testdata/stack")
+	require.NoError(t, err)
+
+	assert.Contains(t, mod.Outputs, "resource_group_name")
+	assert.Equal(t, cty.NilVal, mod.Variables["tenant_id"].Default, "Variables without a default should have no value")
+	assert.Equal(t, cty.StringVal("rpg-aiapp-rg"), mod.Variables["resource_group_name"].Default)
+
+	require.Len(t, mod.Resources, 3)
+	assert.Equal(t, "data.azurerm_client_config.current", mod.Resources[0].Address())
+	assert.Equal(t, "azurerm_resource_group.rg", mod.Resources[1].Address())
+	assert.Equal(t, 3, mod.Resources[1].Range.Start.Line)
+	assert.Len(t, mod.ResourcesOfType("azurerm_subnet"), 1)
+
+	require.Len(t, mod.ModuleCalls, 2)
+	dir, ok := mod.ModuleCalls[0].LocalDir(mod.Dir)
+	assert.True(t, ok)
+	assert.Equal(t, "testdata/stack/modules/network", dir)
+	_, ok = mod.ModuleCalls[1].LocalDir(mod.Dir)
+	assert.False(t, ok, "Registry modules have no local directory")
+
+	_, err = Load("testdata/missing")
+	assert.Error(t, err)
+}
+
+func TestVariableValues(t *testing.T) {
+	t.Parallel()
+
+	mod, err := Load("testdata/stack")
+	require.NoError(t, err)
+
+	defaults, err := mod.VariableValues()
+	require.NoError(t, err)
+	assert.Equal(t, "172.16.1.0/24", defaults["app_subnet_cidr"].AsString())
+	assert.NotContains(t, defaults, "tenant_id")
+
+	values, err := mod.VariableValues("testdata/override.tfvars", "testdata/override.tfvars.json")
+	require.NoError(t, err)
+	assert.Equal(t, "10.10.1.0/24", values["app_subnet_cidr"].AsString())
+	assert.Equal(t, "rpg-aiapp-rg-json", values["resource_group_name"].AsString())
+
+	space, ok := Strings(values["vnet_address_space"])
+	assert.True(t, ok)
+	assert.Equal(t, []string{"10.10.0.0/16"}, space)
+}
+
+func TestExpressionHelpers(t *testing.T) {
+	t.Parallel()
+
+	mod, err := Load("testdata/stack")
+	require.NoError(t, err)
+
+	rg := mod.ResourcesOfType("azurerm_resource_group")[0]
+	location, ok := StaticString(rg.Body.Attributes["location"].Expr)
+	assert.True(t, ok)
+	assert.Equal(t, "Japan East", location)
+
+	_, ok = StaticString(rg.Body.Attributes["name"].Expr)
+	assert.False(t, ok, "References are not static")
+	assert.Equal(t, []string{"resource_group_name"}, VariableRefs(rg.Body.Attributes["name"].Expr))
+
+	subnet := mod.ResourcesOfType("azurerm_subnet")[0]
+	delegations := Blocks(subnet.Body, "delegation")
+	require.Len(t, delegations, 1)
+	services := Blocks(delegations[0].Body, "service_delegation")
+	require.Len(t, services, 1)
+	name, ok := StaticString(services[0].Body.Attributes["name"].Expr)
+	assert.True(t, ok)
+	assert.Equal(t, "Microsoft.Web/serverFarms", name)
+
+	network, err := Load("testdata/stack/modules/network")
+	require.NoError(t, err)
+	prefixes, ok := StaticStrings(network.Resources[0].Body.Attributes["address_space"].Expr)
+	assert.True(t, ok)
+	assert.Equal(t, []string{"10.0.0.0/16"}, prefixes)
+}
+
+func TestLoadTree(t *testing.T) {
+	t.Parallel()
+
+	instances, err := LoadTree("testdata/stack", "testdata/override.tfvars.json")
+	require.NoError(t, err)
+	require.Len(t, instances, 2)
+
+	root, network := instances[0], instances[1]
+	assert.Equal(t, "", root.Path)
+	assert.Equal(t, "module.network", network.Path)
+	assert.Equal(t, "module.network.azurerm_virtual_network.vnet", network.Address(network.Module.Resources[0]))
+
+	name, ok := network.Eval(network.Module.Resources[0].Body.Attributes["name"].Expr)
+	assert.True(t, ok)
+	assert.Equal(t, cty.StringVal("demo-vnet"), name)
+
+	tags, ok := network.Eval(&hclsyntax.ScopeTraversalExpr{Traversal: hcl.Traversal{
+		hcl.TraverseRoot{Name: "var"}, hcl.TraverseAttr{Name: "tags"},
+	}})
+	assert.True(t, ok, "Locals built with merge() should be passed to the module")
+	assert.Equal(t, "RPG-AIAPP-RG-JSON", tags.GetAttr("project_owner").AsString())
+	assert.Equal(t, "development", tags.GetAttr("environment").AsString())
+
+	_, ok = network.Eval(&hclsyntax.ScopeTraversalExpr{Traversal: hcl.Traversal{
+		hcl.TraverseRoot{Name: "var"}, hcl.TraverseAttr{Name: "resource_group_name"},
+	}})
+	assert.False(t, ok, "Arguments computed from resources should not fall back to the default")
+
+	_, ok = root.Eval(root.Module.ResourcesOfType("azurerm_subnet")[0].Body.Attributes["address_prefixes"].Expr)
+	assert.True(t, ok)
+}
+
+func TestLoadTreeResolving(t *testing.T) {
+	t.Parallel()
+
+	resolve := func(mod *Module, ctx *hcl.EvalContext) map[string]cty.Value {
+		resources := map[string]cty.Value{}
+		for _, r := range mod.ResourcesOfType("azurerm_resource_group") {
+			name, ok := eval(ctx, r.Body.Attributes["name"].Expr)
+			require.True(t, ok)
+			resources[r.Type] = cty.ObjectVal(map[string]cty.Value{
+				r.Name: cty.ObjectVal(map[string]cty.Value{"name": name}),
+			})
+		}
+		return resources
+	}
+	instances, err := LoadTreeResolving("testdata/stack", resolve)
+	require.NoError(t, err)
+	require.Len(t, instances, 2)
+
+	group, ok := instances[1].Eval(&hclsyntax.ScopeTraversalExpr{Traversal: hcl.Traversal{
+		hcl.TraverseRoot{Name: "var"}, hcl.TraverseAttr{Name: "resource_group_name"},
+	}})
+	assert.True(t, ok, "Resolved resource references should be passed to the module")
+	assert.Equal(t, cty.StringVal("rpg-aiapp-rg"), group)
+}
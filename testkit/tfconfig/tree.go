@@ -0,0 +1,171 @@
+package tfconfig
+
+import (
+	"github.com/hashicorp/hcl/v2"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/function"
+	"github.com/zclconf/go-cty/cty/function/stdlib"
+)
+
+// functions are the pure Terraform functions available to Eval. Anything
+// that reads files or the environment is deliberately left out.
+var functions = map[string]function.Function{
+	"coalesce":  stdlib.CoalesceFunc,
+	"concat":    stdlib.ConcatFunc,
+	"format":    stdlib.FormatFunc,
+	"join":      stdlib.JoinFunc,
+	"lookup":    stdlib.LookupFunc,
+	"lower":     stdlib.LowerFunc,
+	"merge":     stdlib.MergeFunc,
+	"replace":   stdlib.ReplaceFunc,
+	"substr":    stdlib.SubstrFunc,
+	"trimspace": stdlib.TrimSpaceFunc,
+	"upper":     stdlib.UpperFunc,
+}
+
+// moduleMetaArguments are module block attributes that are not input variables
+var moduleMetaArguments = map[string]bool{
+	"source":     true,
+	"version":    true,
+	"count":      true,
+	"for_each":   true,
+	"depends_on": true,
+	"providers":  true,
+}
+
+// Instance is a module at a position in the module tree, evaluated with the
+// input values its caller passes in
+type Instance struct {
+	// Path is the module address, empty for the root module
+	Path    string
+	Module  *Module
+	Context *hcl.EvalContext
+}
+
+// Resolver returns stand-in values for references a module makes to its own
+// resources, keyed by resource type, for checks that only need the shape of a
+// value that is not known before apply. ctx resolves the module's variables.
+type Resolver func(mod *Module, ctx *hcl.EvalContext) map[string]cty.Value
+
+// LoadTree loads the root module in dir and every local module it calls,
+// recursively. Root variables take their defaults overridden by varFiles;
+// child variables take the values their module block passes when those are
+// statically known.
+func LoadTree(dir string, varFiles ...string) ([]*Instance, error) {
+	return LoadTreeResolving(dir, nil, varFiles...)
+}
+
+// LoadTreeResolving is LoadTree with resource references resolved by resolve
+// wherever they appear, including in the arguments of module blocks
+func LoadTreeResolving(dir string, resolve Resolver, varFiles ...string) ([]*Instance, error) {
+	root, err := Load(dir)
+	if err != nil {
+		return nil, err
+	}
+	vars, err := root.VariableValues(varFiles...)
+	if err != nil {
+		return nil, err
+	}
+	return loadInstances("", root, vars, resolve)
+}
+
+func loadInstances(path string, mod *Module, vars map[string]cty.Value, resolve Resolver) ([]*Instance, error) {
+	inst := &Instance{Path: path, Module: mod, Context: evalContext(mod, vars, resolve)}
+	instances := []*Instance{inst}
+
+	for _, call := range mod.ModuleCalls {
+		childDir, ok := call.LocalDir(mod.Dir)
+		if !ok {
+			continue
+		}
+		child, err := Load(childDir)
+		if err != nil {
+			return nil, err
+		}
+		childVars, err := child.VariableValues()
+		if err != nil {
+			return nil, err
+		}
+		for name, attr := range call.Body.Attributes {
+			if moduleMetaArguments[name] {
+				continue
+			}
+			if value, ok := inst.Eval(attr.Expr); ok {
+				childVars[name] = value
+			} else {
+				// An unknown argument must not fall back to the default
+				delete(childVars, name)
+			}
+		}
+
+		childPath := "module." + call.Name
+		if path != "" {
+			childPath = path + "." + childPath
+		}
+		children, err := loadInstances(childPath, child, childVars, resolve)
+		if err != nil {
+			return nil, err
+		}
+		instances = append(instances, children...)
+	}
+	return instances, nil
+}
+
+// evalContext resolves var.* from vars, the resources resolve stands in for
+// and every local that only depends on those, functions and other resolvable
+// locals
+func evalContext(mod *Module, vars map[string]cty.Value, resolve Resolver) *hcl.EvalContext {
+	ctx := &hcl.EvalContext{
+		Variables: map[string]cty.Value{"var": cty.ObjectVal(vars)},
+		Functions: functions,
+	}
+	if resolve != nil {
+		for resourceType, value := range resolve(mod, ctx) {
+			ctx.Variables[resourceType] = value
+		}
+	}
+
+	locals := map[string]cty.Value{}
+	for progress := true; progress; {
+		progress = false
+		ctx.Variables["local"] = cty.ObjectVal(locals)
+		for name, attr := range mod.Locals {
+			if _, done := locals[name]; done {
+				continue
+			}
+			if value, ok := eval(ctx, attr.Expr); ok {
+				locals[name] = value
+				progress = true
+			}
+		}
+	}
+	ctx.Variables["local"] = cty.ObjectVal(locals)
+	return ctx
+}
+
+// Address returns the absolute address of r within the instance
+func (i *Instance) Address(r *Resource) string {
+	if i.Path == "" {
+		return r.Address()
+	}
+	return i.Path + "." + r.Address()
+}
+
+// Eval evaluates expr in the instance's context. It reports false when the
+// value depends on resources, unknown variables or unsupported functions.
+func (i *Instance) Eval(expr hcl.Expression) (cty.Value, bool) {
+	return eval(i.Context, expr)
+}
+
+func eval(ctx *hcl.EvalContext, expr hcl.Expression) (cty.Value, bool) {
+	for _, traversal := range expr.Variables() {
+		if _, ok := ctx.Variables[traversal.RootName()]; !ok {
+			return cty.NilVal, false
+		}
+	}
+	value, diags := expr.Value(ctx)
+	if diags.HasErrors() || !value.IsWhollyKnown() {
+		return cty.NilVal, false
+	}
+	return value, true
+}